@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/crane/util"
+	"gopkg.in/yaml.v2"
+)
+
+// partialBackupNote heads the backups without the full definition of the service
+const partialBackupNote = "# Partial backup: the framework does not return the definition of the service, only the\n" +
+	"# image, the instances and the ports are saved. The envs, resources, constraints, labels and\n" +
+	"# health check are missing, deploying this file does not bring the same service back.\n"
+
+// manifestFromSnapshot builds a manifest with the service saved in the snapshot. The envs,
+// constraints and resources are only known when the framework implements ServiceInspector,
+// otherwise the manifest is partial
+func manifestFromSnapshot(snapshot *cluster.ServiceSnapshot) (manifest *configuration.ServiceManifest, partial bool) {
+	manifest = newServiceManifest()
+	manifest.ServiceID = strings.TrimPrefix(snapshot.ServiceID, "/")
+	manifest.Image = snapshot.Service.ImageName
+	manifest.Tag = snapshot.Service.ImageTag
+	manifest.Instances = snapshot.Instances
+
+	if config := snapshot.Config; config != nil {
+		manifest.Image = config.ImageName
+		manifest.Tag = config.Tag
+		manifest.CPU = snapshot.CPU()
+		manifest.Memory = config.Memory
+		manifest.Ports = config.Publish
+		manifest.Envs = config.Envs
+		manifest.Constraints = config.Constraints
+		manifest.Labels = config.Labels
+		manifest.MinimumHealthCapacity = config.MinimumHealthCapacity
+		manifest.MaximumOverCapacity = config.MaximumOverCapacity
+		if config.HealthCheckConfig != nil {
+			manifest.HealthCheck.Path = config.HealthCheckConfig.Path
+		}
+		return manifest, false
+	}
+
+	// The public ports of the instances are the ports of the container, the internal ones are
+	// the ports of the hosts given by the framework
+	seen := make(map[string]bool)
+	for _, instance := range snapshot.Service.Instances {
+		for _, port := range instance.Ports {
+			for _, public := range port.Publics {
+				publish := fmt.Sprintf("%d/%s", public, strings.ToLower(string(port.Type)))
+				if !seen[publish] {
+					seen[publish] = true
+					manifest.Ports = append(manifest.Ports, publish)
+				}
+			}
+		}
+	}
+	sort.Strings(manifest.Ports)
+	return manifest, true
+}
+
+// newBackupWriter returns a backup that saves the service of every stack as a manifest in the
+// directory. The manifests can hold secrets, so only the owner can read them
+func newBackupWriter(dir string, now time.Time) cluster.BackupFunc {
+	return func(stackKey string, snapshot *cluster.ServiceSnapshot) error {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		manifest, partial := manifestFromSnapshot(snapshot)
+		out, err := yaml.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		if partial {
+			out = append([]byte(partialBackupNote), out...)
+		}
+		name := fmt.Sprintf("%s-%s-%s.yml", strings.Replace(strings.TrimPrefix(snapshot.ServiceID, "/"), "/", "_", -1), stackKey, now.Format("20060102T150405"))
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, out, 0600); err != nil {
+			return err
+		}
+		if partial {
+			util.Log.Warnf("Partial backup of %s on stack %s saved in %s, the framework does not return the envs, resources, constraints, labels or health check of the service", snapshot.ServiceID, stackKey, path)
+			return nil
+		}
+		util.Log.Infof("Backup of %s on stack %s saved in %s, it is deployed again with: --cluster %s deploy --file %s", snapshot.ServiceID, stackKey, path, stackKey, path)
+		return nil
+	}
+}
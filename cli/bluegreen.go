@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+var blueGreenCommand = cli.Command{
+	Name:  "bluegreen",
+	Usage: "finish a deploy with the blue-green strategy",
+	Subcommands: []cli.Command{
+		{
+			Name:   "promote",
+			Usage:  "delete the previous version, the active version is kept",
+			Flags:  blueGreenFlags(),
+			Before: blueGreenBefore,
+			Action: blueGreenPromoteCmd,
+		},
+		{
+			Name:   "abort",
+			Usage:  "activate the previous version again and delete the new one",
+			Flags:  blueGreenFlags(),
+			Before: blueGreenBefore,
+			Action: blueGreenAbortCmd,
+		},
+	},
+}
+
+func blueGreenFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "service-id",
+			Usage: "Id of the service deployed with the blue-green strategy, without the color",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: outputJSON,
+			Usage: "Format of the report: json, yaml or table",
+		},
+	}
+}
+
+func blueGreenBefore(c *cli.Context) error {
+	if c.String("service-id") == "" {
+		return errors.New("Service-id is empty")
+	}
+	return validateOutput(c.String("output"))
+}
+
+func blueGreenPromoteCmd(c *cli.Context) {
+	runBlueGreen(c, "bluegreen-promote", "Promote-Process", stackManager.PromoteBlueGreen)
+}
+
+func blueGreenAbortCmd(c *cli.Context) {
+	runBlueGreen(c, "bluegreen-abort", "Abort-Process", stackManager.AbortBlueGreen)
+}
+
+func runBlueGreen(c *cli.Context, command, operation string, run func(ctx context.Context, serviceId string) *cluster.DeployResult) {
+	serviceID := c.String("service-id")
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	result := run(ctx, serviceID)
+	recordHistory(command, serviceID, nil, result)
+	recordRollback(serviceID, result, command == "bluegreen-abort")
+	if err := printReport(os.Stdout, c.String("output"), newDeployReport(framework.ServiceConfig{ServiceID: serviceID}, result)); err != nil {
+		util.Log.Errorln("Error printing the report", err)
+	}
+	exitOnResult(result, operation)
+}
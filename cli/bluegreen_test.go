@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlueGreenBefore(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.String("service-id", "", "")
+	set.String("output", outputJSON, "")
+	ctx := cli.NewContext(nil, set, nil)
+	assert.NotNil(t, blueGreenBefore(ctx), "Should throw error service-id empty")
+
+	set.Set("service-id", "nginx")
+	assert.Nil(t, blueGreenBefore(ctx))
+
+	set.Set("output", "xml")
+	assert.NotNil(t, blueGreenBefore(ctx), "Should throw error invalid output")
+}
+
+func TestBlueGreenCmd(t *testing.T) {
+	stackManager = createStackManagerMock()
+	status := 0
+	exit = func(code int) { status = code }
+	defer func() { exit = os.Exit }()
+
+	set := flag.NewFlagSet("test", 0)
+	set.String("service-id", "nginx", "")
+	ctx := cli.NewContext(nil, set, nil)
+	blueGreenPromoteCmd(ctx)
+	assert.Equal(t, 0, status)
+
+	blueGreenAbortCmd(ctx)
+	assert.Equal(t, 1, status, "Should exit with an error when the abort fails")
+}
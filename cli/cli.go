@@ -1,10 +1,14 @@
 package cli
 
 import (
+	"context"
 	"errors"
-	"io/ioutil"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	valid "github.com/asaskevich/govalidator"
@@ -13,12 +17,14 @@ import (
 	"github.com/latam-airlines/crane/configuration"
 	"github.com/latam-airlines/crane/util"
 	"github.com/latam-airlines/crane/version"
-	"gopkg.in/yaml.v2"
 )
 
 var stackManager cluster.CraneManager
 var logFile *os.File
 
+// timeout limits the duration of the command, there is no limit when it is zero
+var timeout time.Duration
+
 func setupLogger(config configuration.Loggging, debug bool) error {
 	var err error
 
@@ -59,34 +65,28 @@ func setupLogger(config configuration.Loggging, debug bool) error {
 	return nil
 }
 
-type parseConfig func(configFile string) (*configuration.Configuration, error)
+// parseConfig reads the configuration, the project file is optional when it is not required
+type parseConfig func(configFile string, required bool) (*configuration.Configuration, error)
 
-func readConfiguration(configFile string) (*configuration.Configuration, error) {
-	_, err := os.Stat(configFile)
-	if os.IsNotExist(err) {
-		return nil, err
-	}
+// defaultConfigFile is the project file read when --config is not given, it is optional when
+// the system or user files exist
+const defaultConfigFile = "crane.yml"
 
-	configFile, err = filepath.Abs(configFile)
+func readConfiguration(configFile string, required bool) (*configuration.Configuration, error) {
+	layered, err := configuration.LoadLayered(configFile, required, os.Environ())
 	if err != nil {
 		return nil, err
 	}
 
-	var yamlFile []byte
-	if yamlFile, err = ioutil.ReadFile(configFile); err != nil {
+	if _, err := valid.ValidateStruct(layered.Config); err != nil {
 		return nil, err
 	}
 
-	var config configuration.Configuration
-	if err = yaml.Unmarshal(yamlFile, &config); err != nil {
+	if err := layered.Config.Hooks.Validate(); err != nil {
 		return nil, err
 	}
 
-	if _, err := valid.ValidateStruct(config); err != nil {
-		return nil, err
-	}
-
-	return &config, nil
+	return layered.Config, nil
 }
 
 func globalFlags() []cli.Flag {
@@ -97,8 +97,24 @@ func globalFlags() []cli.Flag {
 		},
 		cli.StringFlag{
 			Name:  "config",
-			Value: "crane.yml",
-			Usage: "Path to config-file",
+			Value: defaultConfigFile,
+			Usage: "Path to config-file, it overrides /etc/crane/crane.yml, ~/.crane/crane.yml and is overridden by the CRANE_* envs",
+		},
+		cli.StringSliceFlag{
+			Name:  "cluster",
+			Usage: "Run only on the clusters, ie --cluster=sjc,scl",
+		},
+		cli.StringSliceFlag{
+			Name:  "exclude-cluster",
+			Usage: "Do not run on the clusters, ie --exclude-cluster=dal",
+		},
+		cli.StringSliceFlag{
+			Name:  "cluster-group",
+			Usage: "Run only on the clusters of the groups configured in config-file, ie --cluster-group=prod",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "Maximum duration of the command, ie --timeout=10m. A deploy that times out is rolled back",
 		},
 	}
 
@@ -108,7 +124,7 @@ func globalFlags() []cli.Flag {
 func setupApplication(c *cli.Context, parser parseConfig) error {
 	var appConfig *configuration.Configuration
 	var err error
-	if appConfig, err = parser(c.String("config")); err != nil {
+	if appConfig, err = parser(c.String("config"), c.IsSet("config")); err != nil {
 		return err
 	}
 
@@ -116,13 +132,79 @@ func setupApplication(c *cli.Context, parser parseConfig) error {
 		return err
 	}
 
-	stackManager, err = cluster.NewStackManager(appConfig)
+	if timeout = c.Duration("timeout"); timeout < 0 {
+		return errors.New("Timeout should not be negative")
+	}
+
+	selector := cluster.ClusterSelector{
+		Clusters: splitListFlag(c.StringSlice("cluster")),
+		Exclude:  splitListFlag(c.StringSlice("exclude-cluster")),
+		Groups:   splitListFlag(c.StringSlice("cluster-group")),
+	}
+	historyStore = newHistoryStore(appConfig.History)
+
+	stackManager, err = cluster.NewStackManager(appConfig, selector)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// commandContext returns the context of the operations of a command. It is cancelled when the
+// timeout of the command expires or on the first SIGINT or SIGTERM, so the running operations
+// stop and a deploy is rolled back. A second signal exits immediately, until the command calls
+// the returned cancel function, which stops listening to the signals
+func commandContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	finished := make(chan struct{})
+	var once sync.Once
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case <-signals:
+			util.Log.Warnln("Cancelling the operations, send the signal again to exit immediately")
+			cancel()
+		case <-ctx.Done():
+			return
+		case <-finished:
+			return
+		}
+		select {
+		case <-signals:
+			util.Log.Errorln("Exiting without waiting for the operations")
+			os.Exit(1)
+		case <-finished:
+		}
+	}()
+	return ctx, func() {
+		once.Do(func() { close(finished) })
+		cancel()
+	}
+}
+
+// splitListFlag splits the values of a slice flag separated by commas, so the flag can be
+// repeated or take a list
+func splitListFlag(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
 func RunApp() {
 
 	app := cli.NewApp()
@@ -133,6 +215,10 @@ func RunApp() {
 	app.Flags = globalFlags()
 
 	app.Before = func(c *cli.Context) error {
+		if command := c.Args().First(); command == "config" || command == "history" {
+			// These commands read the configuration and the history without connecting to the clusters
+			return nil
+		}
 		err := setupApplication(c, readConfiguration)
 		if err != nil {
 			util.Log.Fatalln(err)
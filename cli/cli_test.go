@@ -1,16 +1,36 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"github.com/codegangsta/cli"
 	"github.com/latam-airlines/crane/configuration"
 	_ "github.com/latam-airlines/mesos-framework-factory/marathon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
 	"reflect"
+	"syscall"
 	"testing"
+	"time"
 )
 
+// TestMain moves HOME to a temp dir, so the commands run by the tests record their history there
+// and do not read the configuration of the user or the system
+func TestMain(m *testing.M) {
+	home, err := ioutil.TempDir("", "crane-home")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	configuration.SystemConfigFile = ""
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
 func TestCli(t *testing.T) {
 	suite.Run(t, new(CliSuite))
 }
@@ -49,7 +69,7 @@ func (suite *CliSuite) SetupTest() {
 
 func (suite *CliSuite) TestSetupApp() {
 	globatCtx := cli.NewContext(nil, suite.globalSet, nil)
-	err := setupApplication(globatCtx, func(configFile string) (*configuration.Configuration, error) {
+	err := setupApplication(globatCtx, func(configFile string, required bool) (*configuration.Configuration, error) {
 		config := &configuration.Configuration{
 			Logging: configuration.Loggging{
 				Level:     "debug",
@@ -85,7 +105,7 @@ func (suite *CliSuite) TestInvalidLoglevel() {
 	set := suite.globalSet
 	set.Parse([]string{"--log-level=OtherLevel"})
 	ctx := cli.NewContext(nil, set, nil)
-	err := setupApplication(ctx, func(configFile string) (*configuration.Configuration, error) {
+	err := setupApplication(ctx, func(configFile string, required bool) (*configuration.Configuration, error) {
 		return suite.config, nil
 	})
 	assert.NotNil(suite.T(), err, "Should return error")
@@ -93,7 +113,7 @@ func (suite *CliSuite) TestInvalidLoglevel() {
 
 func (suite *CliSuite) TestDisabledFramework() {
 	ctx := cli.NewContext(nil, suite.globalSet, nil)
-	err := setupApplication(ctx, func(configFile string) (*configuration.Configuration, error) {
+	err := setupApplication(ctx, func(configFile string, required bool) (*configuration.Configuration, error) {
 		config := &configuration.Configuration{
 			Logging: configuration.Loggging{
 				Level:     "debug",
@@ -129,11 +149,127 @@ func (suite *CliSuite) TestDisabledFramework() {
 	assert.Equal(suite.T(), 1, stacks.Len(), "Cli should instantiate one stack")
 }
 
+func (suite *CliSuite) TestClusterSelection() {
+	remote := configuration.Framework{
+		"marathon": configuration.Parameters{
+			"address":        "http://remote:8011",
+			"deploy-timeout": 30,
+		},
+	}
+	parser := func(configFile string, required bool) (*configuration.Configuration, error) {
+		config := &configuration.Configuration{
+			Logging: configuration.Loggging{
+				Level:     "debug",
+				Output:    "console",
+				Formatter: "text",
+			},
+			Clusters: map[string]configuration.Cluster{
+				"sjc": {Framework: remote, Groups: []string{"prod"}},
+				"scl": {Framework: remote, Groups: []string{"prod"}},
+				"dal": {Framework: remote},
+			},
+		}
+		return config, nil
+	}
+
+	set := suite.globalSet
+	set.Var(&cli.StringSlice{"prod"}, "cluster-group", "")
+	set.Var(&cli.StringSlice{"scl"}, "exclude-cluster", "")
+	ctx := cli.NewContext(nil, set, nil)
+	assert.Nil(suite.T(), setupApplication(ctx, parser), "Should return nil")
+
+	stacks := reflect.ValueOf(stackManager).Elem().FieldByName("stacks")
+	assert.Equal(suite.T(), 1, stacks.Len(), "Cli should instantiate only sjc")
+
+	set.Var(&cli.StringSlice{"wdc"}, "cluster", "")
+	ctx = cli.NewContext(nil, set, nil)
+	assert.NotNil(suite.T(), setupApplication(ctx, parser), "Should return error with a cluster not configured")
+}
+
+func (suite *CliSuite) TestTimeout() {
+	parser := func(configFile string, required bool) (*configuration.Configuration, error) {
+		return &configuration.Configuration{
+			Logging: configuration.Loggging{Level: "debug", Output: "console", Formatter: "text"},
+			Clusters: map[string]configuration.Cluster{
+				"remote": {Framework: configuration.Framework{
+					"marathon": configuration.Parameters{"address": "http://remote:8011", "deploy-timeout": 30},
+				}},
+			},
+		}, nil
+	}
+	defer func() { timeout = 0 }()
+
+	set := suite.globalSet
+	set.Duration("timeout", 0, "")
+	set.Parse([]string{"--timeout=50ms"})
+	assert.Nil(suite.T(), setupApplication(cli.NewContext(nil, set, nil), parser), "Should return nil")
+	assert.Equal(suite.T(), 50*time.Millisecond, timeout)
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		assert.Equal(suite.T(), context.DeadlineExceeded, ctx.Err())
+	case <-time.After(time.Second):
+		suite.T().Error("The context of the command should time out")
+	}
+}
+
+func TestCommandContextSignal(t *testing.T) {
+	ctx, cancel := commandContext()
+	defer cancel()
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+	select {
+	case <-ctx.Done():
+		assert.Equal(t, context.Canceled, ctx.Err(), "The first signal should cancel the operations")
+	case <-time.After(time.Second):
+		t.Error("The context of the command should be cancelled by the signal")
+	}
+}
+
+func TestConfigFileRequired(t *testing.T) {
+	var required []bool
+	parser := func(configFile string, isRequired bool) (*configuration.Configuration, error) {
+		required = append(required, isRequired)
+		return nil, errors.New("stop")
+	}
+	for _, args := range [][]string{{}, {"--config=crane.yml"}} {
+		set := flag.NewFlagSet("test", 0)
+		set.String("config", defaultConfigFile, "")
+		set.Parse(args)
+		setupApplication(cli.NewContext(nil, set, nil), parser)
+	}
+	assert.Equal(t, []bool{false, true}, required, "The project file is required when --config is given, even with the default name")
+}
+
+func TestSplitListFlag(t *testing.T) {
+	assert.Equal(t, []string{"sjc", "scl", "dal"}, splitListFlag([]string{"sjc, scl", "dal", ""}))
+	assert.Nil(t, splitListFlag(nil))
+}
+
 func TestReadConfiguration(t *testing.T) {
-	res, _ := readConfiguration("../test/resources/crane.yml")
+	res, _ := readConfiguration("../test/resources/crane.yml", true)
 	assert.NotNil(t, res.Clusters["sjc"], "Cluster sjc should be set")
-	_, err := readConfiguration("../test/resources/crane-not-there.yml")
+	_, err := readConfiguration("../test/resources/crane-not-there.yml", true)
 	assert.NotNil(t, err, "Should throw error")
-	_, err = readConfiguration("../test/resources/broken.yml")
+	_, err = readConfiguration("../test/resources/broken.yml", true)
 	assert.NotNil(t, err, "Should throw error")
+	_, err = readConfiguration("../test/resources/crane-invalid-strategy.yml", true)
+	assert.NotNil(t, err, "Should throw error with an unknown strategy")
+}
+
+func TestReadConfigurationReferences(t *testing.T) {
+	_, err := readConfiguration("../test/resources/crane-references.yml", true)
+	assert.NotNil(t, err, "Should throw error with an undefined variable")
+
+	os.Setenv("CRANE_TEST_MARATHON_HOST", "3.3.3.3")
+	os.Setenv("CRANE_TEST_MARATHON_USER", "chuck")
+	defer os.Unsetenv("CRANE_TEST_MARATHON_HOST")
+	defer os.Unsetenv("CRANE_TEST_MARATHON_USER")
+	config, err := readConfiguration("../test/resources/crane-references.yml", true)
+	assert.Nil(t, err)
+	params := config.Clusters["sjc"].Framework.Parameters()
+	assert.Equal(t, "3.3.3.3:8081", params["address"])
+	assert.Equal(t, "chuck", params["basic-auth-user"])
+	assert.Equal(t, "norris", params["basic-auth-pwd"], "The secret file is relative to the config")
 }
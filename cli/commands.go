@@ -6,11 +6,18 @@ var commands = []cli.Command{
 	{
 		Name:    "deploy",
 		Aliases: []string{"d"},
-		Usage:   "deploy or scale a service",
+		Usage:   "deploy a service",
 		Flags:   deployFlags(),
 		Before:  deployBefore,
 		Action:  deployCmd,
 	},
+	{
+		Name:   "scale",
+		Usage:  "change the instances of an existing service without deploying it",
+		Flags:  scaleFlags(),
+		Before: scaleBefore,
+		Action: scaleCmd,
+	},
 	{
 		Name:    "find",
 		Aliases: []string{"f"},
@@ -19,6 +26,21 @@ var commands = []cli.Command{
 		Before:  findBefore,
 		Action:  findCmd,
 	},
+	{
+		Name:    "status",
+		Aliases: []string{"s"},
+		Usage:   "show the status of a service on every cluster",
+		Flags:   statusFlags(),
+		Before:  statusBefore,
+		Action:  statusCmd,
+	},
+	{
+		Name:   "diff",
+		Usage:  "compare a service between the clusters, exits with status 1 when they drift",
+		Flags:  diffFlags(),
+		Before: diffBefore,
+		Action: diffCmd,
+	},
 	{
 		Name:    "delete",
 		Aliases: []string{"x"},
@@ -27,4 +49,19 @@ var commands = []cli.Command{
 		Before:  deleteBefore,
 		Action:  deleteCmd,
 	},
+	{
+		Name:   "history",
+		Usage:  "show the deploys, scales and deletes recorded on this machine",
+		Flags:  historyFlags(),
+		Before: historyBefore,
+		Action: historyCmd,
+	},
+	{
+		Name:   "serve",
+		Usage:  "serve a REST API with the deploy, find, status, delete, rollback and cancel operations, the timeout limits every operation",
+		Flags:  serveFlags(),
+		Action: serveCmd,
+	},
+	blueGreenCommand,
+	configCommand,
 }
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/crane/util"
+	"gopkg.in/yaml.v2"
+)
+
+const maskedValue = "*****"
+
+var configCommand = cli.Command{
+	Name:  "config",
+	Usage: "inspect the configuration merged from the config files and the CRANE_* envs",
+	Subcommands: []cli.Command{
+		{
+			Name:   "show",
+			Usage:  "print the merged configuration with the secrets masked and the origin of every value",
+			Action: configShowCmd,
+		},
+	},
+}
+
+// formatValue writes a value of the configuration in one line of yaml, masking the secrets
+func formatValue(key string, value interface{}) string {
+	if util.IsSecretKey(key) && value != nil {
+		return maskedValue
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return "{}"
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, formatValue(key, item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeLayeredConfig writes the merged configuration as yaml, with the origin of every value in a
+// comment. The references are shown as they are written, they are not resolved
+func writeLayeredConfig(w io.Writer, layered *configuration.Layered) {
+	fmt.Fprintf(w, "# Files, each one overrides the previous: %s\n", strings.Join(layered.Files, ", "))
+
+	var previous []string
+	for _, entry := range layered.Entries() {
+		sections := entry.Path[:len(entry.Path)-1]
+		common := 0
+		for common < len(sections) && common < len(previous) && sections[common] == previous[common] {
+			common++
+		}
+		for i := common; i < len(sections); i++ {
+			fmt.Fprintf(w, "%s%s:\n", strings.Repeat("  ", i), sections[i])
+		}
+		key := entry.Path[len(entry.Path)-1]
+		fmt.Fprintf(w, "%s%s: %s  # %s\n", strings.Repeat("  ", len(sections)), key, formatValue(key, entry.Value), entry.Origin)
+		previous = sections
+	}
+}
+
+func configShowCmd(c *cli.Context) {
+	layered, err := configuration.MergeLayers(c.GlobalString("config"), c.GlobalIsSet("config"), os.Environ())
+	if err != nil {
+		util.Log.Fatalln("Error reading the configuration", err)
+	}
+	writeLayeredConfig(os.Stdout, layered)
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteLayeredConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "crane.yml")
+	content := `
+logging:
+  level: info
+cluster:
+  sjc:
+    groups: [prod, us]
+    framework:
+      marathon:
+        address: http://sjc:8081
+        basic-auth-pwd: norris
+  scl:
+    framework: fake
+`
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	system, user := configuration.SystemConfigFile, configuration.UserConfigFile
+	configuration.SystemConfigFile, configuration.UserConfigFile = "", ""
+	defer func() { configuration.SystemConfigFile, configuration.UserConfigFile = system, user }()
+
+	layered, err := configuration.LoadLayered(path, true, []string{"CRANE_LOGGING__LEVEL=debug"})
+	assert.Nil(t, err)
+	var out bytes.Buffer
+	writeLayeredConfig(&out, layered)
+	expected := "# Files, each one overrides the previous: " + path + `
+cluster:
+  scl:
+    framework: fake  # ` + path + `
+  sjc:
+    framework:
+      marathon:
+        address: http://sjc:8081  # ` + path + `
+        basic-auth-pwd: *****  # ` + path + `
+    groups: [prod, us]  # ` + path + `
+logging:
+  level: debug  # env CRANE_LOGGING__LEVEL
+`
+	assert.Equal(t, expected, out.String())
+}
@@ -1,17 +1,48 @@
 package cli
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
 	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
 )
 
+// confirmInput is where the confirmation of the delete is read
+var confirmInput io.Reader = os.Stdin
+
 func deleteFlags() []cli.Flag {
 	return []cli.Flag{
 		cli.StringFlag{
 			Name:  "service-id",
 			Usage: "service id of the service",
 		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Show the clusters where the service would be deleted without deleting it",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: outputTable,
+			Usage: "Format of the plan and the summary: json, yaml or table",
+		},
+		cli.BoolFlag{
+			Name:  "yes, y",
+			Usage: "Delete without asking for confirmation",
+		},
+		cli.StringFlag{
+			Name:  "backup-dir",
+			Value: "crane-backups",
+			Usage: "Directory where the definition of the service on each cluster is saved before deleting it",
+		},
 	}
 }
 
@@ -19,14 +50,75 @@ func deleteBefore(c *cli.Context) error {
 	if c.String("service-id") == "" {
 		return errors.New("Flag \"service-id\" is empty")
 	}
-	return nil
+	return validateOutput(c.String("output"))
+}
+
+// confirmDelete lists the clusters where the service is deleted and asks for confirmation
+func confirmDelete(serviceID string, plan *cluster.DeployPlan, in io.Reader, out io.Writer) bool {
+	stackKeys := make([]string, 0, len(plan.Stacks))
+	for stackKey := range plan.Stacks {
+		stackKeys = append(stackKeys, stackKey)
+	}
+	sort.Strings(stackKeys)
+
+	fmt.Fprintf(out, "The service %s will be deleted on:\n", serviceID)
+	for _, stackKey := range stackKeys {
+		stackPlan := plan.Stacks[stackKey]
+		if stackPlan.Action != cluster.PlanDelete {
+			continue
+		}
+		var hosts []string
+		for _, instance := range stackPlan.Current.Instances {
+			hosts = append(hosts, instance.ID+"@"+instance.Host)
+		}
+		fmt.Fprintf(out, "  %s: %s, %d instances %s\n", stackKey, stackPlan.Current.FullImageName(), len(hosts), strings.Join(hosts, ", "))
+	}
+	fmt.Fprint(out, "Continue? [y/N]: ")
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
 func deleteCmd(c *cli.Context) {
-	err := stackManager.DeleteService(c.String("service-id"))
-	if err != nil {
-		util.Log.Fatalln("Error deleting service", err)
-	} else {
-		util.Log.Infoln("Service deleted: ", c.String("service-id"))
+	serviceID := c.String("service-id")
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	plan := stackManager.PlanDelete(ctx, serviceID)
+	if c.Bool("dry-run") {
+		if err := printReport(os.Stdout, c.String("output"), newPlanReport("delete", serviceID, plan)); err != nil {
+			util.Log.Fatalln("Error printing the plan", err)
+		}
+		return
+	}
+
+	found := false
+	for stackKey, stackPlan := range plan.Stacks {
+		if stackPlan.Error != nil {
+			util.Log.Warnf("The service could not be looked up on stack %s: %s", stackKey, stackPlan.Error)
+		}
+		found = found || stackPlan.Action == cluster.PlanDelete
+	}
+	if !found {
+		util.Log.Warnf("The service %s does not exist on the clusters", serviceID)
+		return
+	}
+
+	if !c.Bool("yes") && !confirmDelete(serviceID, plan, confirmInput, os.Stderr) {
+		util.Log.Infoln("Delete cancelled")
+		return
+	}
+
+	result := stackManager.DeleteService(ctx, serviceID, newBackupWriter(c.String("backup-dir"), time.Now()))
+	recordHistory("delete", serviceID, nil, result)
+	if err := printReport(os.Stdout, c.String("output"), newDeployReport(framework.ServiceConfig{ServiceID: serviceID}, result)); err != nil {
+		util.Log.Errorln("Error printing the delete summary", err)
+	}
+	if !result.Succeeded() {
+		util.Log.Errorln("Error deleting service", serviceID)
+		exit(1)
+		return
 	}
+	util.Log.Infoln("Service deleted: ", serviceID)
 }
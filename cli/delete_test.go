@@ -1,10 +1,19 @@
 package cli
 
 import (
+	"bytes"
+	"context"
 	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
 	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/mesos-framework-factory"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestDeleteFlags(t *testing.T) {
@@ -31,8 +40,71 @@ func TestDeleteBeforeError(t *testing.T) {
 
 func TestDeleteCmd(t *testing.T) {
 	stackManager = createStackManagerMock()
+	confirmInput = strings.NewReader("")
+	defer func() { confirmInput = os.Stdin }()
 	set := flag.NewFlagSet("test", 0)
 	set.String("deleteX", "SABRE-SESSION-POOL-v1", "some hint")
 	ctx := cli.NewContext(nil, set, nil)
 	deleteCmd(ctx)
 }
+
+func TestConfirmDelete(t *testing.T) {
+	plan := createStackManagerMock().PlanDelete(context.Background(), "nginx")
+	var out bytes.Buffer
+	assert.True(t, confirmDelete("nginx", plan, strings.NewReader("yes\n"), &out), "Should confirm")
+	assert.Contains(t, out.String(), "local", "Should list the clusters")
+	assert.Contains(t, out.String(), "instance id", "Should list the instances")
+	assert.False(t, confirmDelete("nginx", plan, strings.NewReader("\n"), &out), "Should cancel by default")
+	assert.False(t, confirmDelete("nginx", plan, strings.NewReader(""), &out), "Should cancel without input")
+}
+
+func TestDeleteCmdWithBackup(t *testing.T) {
+	stackManager = createStackManagerMock()
+	dir, err := ioutil.TempDir("", "crane-backups")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	confirmInput = strings.NewReader("y\n")
+	defer func() { confirmInput = os.Stdin }()
+
+	set := flag.NewFlagSet("test", 0)
+	set.String("service-id", "nginx", "")
+	set.String("backup-dir", dir, "")
+	ctx := cli.NewContext(nil, set, nil)
+	deleteCmd(ctx)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "nginx-local-*.yml"))
+	assert.Len(t, files, 1, "Should save the backup of the stack")
+	manifest, err := readManifest(files[0])
+	assert.Nil(t, err, "The backup should be a manifest")
+	assert.Equal(t, "nginx", manifest.ServiceID)
+}
+
+func TestManifestFromSnapshot(t *testing.T) {
+	snapshot := &cluster.ServiceSnapshot{
+		ServiceID: "/nginx",
+		Service: &framework.ServiceInformation{ImageName: "nginx", ImageTag: "1.9", Instances: []*framework.Instance{
+			{Ports: map[string]framework.InstancePort{"80": {Internal: 31234, Publics: []int64{80}, Type: framework.TCP}}},
+			{Ports: map[string]framework.InstancePort{"80": {Internal: 31877, Publics: []int64{80}, Type: framework.TCP}}},
+		}},
+		Instances: 2,
+	}
+	manifest, partial := manifestFromSnapshot(snapshot)
+	assert.True(t, partial, "Without the definition the backup is partial")
+	assert.Equal(t, "nginx", manifest.ServiceID)
+	assert.Equal(t, "1.9", manifest.Tag)
+	assert.Equal(t, 2, manifest.Instances)
+	assert.Equal(t, []string{"80/tcp"}, manifest.Ports, "Should publish the container port, not the port of the host")
+
+	snapshot.Config = &framework.ServiceConfig{ImageName: "nginx", Tag: "1.8", Envs: []string{"A=1"}, Publish: []string{"8080/tcp"}}
+	manifest, partial = manifestFromSnapshot(snapshot)
+	assert.False(t, partial)
+	assert.Equal(t, "1.8", manifest.Tag, "Should use the inspected definition")
+	assert.Equal(t, []string{"A=1"}, manifest.Envs)
+
+	// Nomad reserves the cpu in MHz, the manifest gives it in cores
+	snapshot.Config.CPUShares = 500
+	snapshot.Framework = "nomad"
+	manifest, _ = manifestFromSnapshot(snapshot)
+	assert.Equal(t, 0.5, manifest.CPU, "The cpu should be converted back to cores")
+}
@@ -1,35 +1,33 @@
 package cli
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
-	"syscall"
 
+	valid "github.com/asaskevich/govalidator"
 	"github.com/codegangsta/cli"
 	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/configuration"
 	"github.com/latam-airlines/crane/util"
 	"github.com/latam-airlines/mesos-framework-factory"
 )
 
-func handleDeploySigTerm(sm cluster.CraneManager) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	signal.Notify(c, syscall.SIGTERM)
-	go func() {
-		<-c
-		//sm.Rollback() XXX: To Fix This Rollback needs the current version of every Service
-		os.Exit(1)
-	}()
-}
+// exitDegraded is the exit status of a deploy with degraded stacks
+const exitDegraded = 2
+
+var exit = os.Exit
 
 func deployFlags() []cli.Flag {
 	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "file, f",
+			Usage: "Service manifest in YAML or JSON format. The flags override the values of the manifest",
+		},
 		cli.StringFlag{
 			Name:  "service-id",
 			Usage: "Id of the service",
@@ -49,7 +47,7 @@ func deployFlags() []cli.Flag {
 		cli.Float64Flag{
 			Name:  "cpu",
 			Value: 0,
-			Usage: "Cantidad de CPU reservadas para el servicio.",
+			Usage: "Cores reserved for the service, ie 0.5. They are translated to the units of the framework of each cluster",
 		},
 		cli.StringFlag{
 			Name:  "memory",
@@ -65,15 +63,15 @@ func deployFlags() []cli.Flag {
 		},
 		cli.IntFlag{
 			Name:  "instances",
-			Value: 1,
+			Value: defaultInstances,
 			Usage: "Total de servicios que se quieren obtener en cada uno de los stack.",
 		},
 		cli.Float64Flag{
 			Name:  "tolerance",
-			Value: 0.5,
+			Value: defaultTolerance,
 			Usage: "Porcentaje de servicios que pueden fallar en el proceso de deploy por cada enpoint entregado." +
 				"Este valor es respecto al total de instancias." +
-				"Por ejemplo, si se despliegan 5 servicios y fallan ",
+				"Por ejemplo, si se despliegan 5 servicios y fallan 2 con tolerancia 0.5 el stack queda degradado y el deploy termina con estado 2",
 		},
 		cli.StringSliceFlag{
 			Name:  "constraint",
@@ -85,74 +83,189 @@ func deployFlags() []cli.Flag {
 		},
 		cli.Float64Flag{
 			Name:  "minimumHealthCapacity",
-			Value: 1.0,
+			Value: defaultMinimumHealthCapacity,
 			Usage: "Number between 0 and 1 that is multiplied with the instance count. This is the minimum number of healthy nodes that do not sacrifice overall application purpose, ie --minimumHealthCapacity=0.8",
 		},
 		cli.Float64Flag{
 			Name:  "maximumOverCapacity",
-			Value: 0.2,
+			Value: defaultMaximumOverCapacity,
 			Usage: "Number between 0 and 1 which is multiplied with the instance count. This is the maximum number of additional instances launched at any point of time during the upgrade process, i.e. maximumOverCapacity=0.2",
 		},
 		cli.StringFlag{
 			Name:  "health-check-path",
 			Usage: "path to the health check file. ex: --health-check-path=/v0/healthy",
 		},
+		cli.StringFlag{
+			Name:  "verify",
+			Usage: "Verify every deployed instance from crane with an http or tcp check. The instances that fail count against the tolerance, ie --verify=http",
+		},
+		cli.StringFlag{
+			Name:  "verify-path",
+			Usage: "Path of the http verification, the health-check-path by default",
+		},
+		cli.IntFlag{
+			Name:  "verify-port",
+			Usage: "Port of the instances to verify, the lowest port by default, ie --verify-port=8080",
+		},
+		cli.IntSliceFlag{
+			Name:  "verify-status",
+			Value: &cli.IntSlice{},
+			Usage: "Status expected by the http verification, any 2xx by default, ie --verify-status=200 --verify-status=204",
+		},
+		cli.IntFlag{
+			Name:  "verify-attempts",
+			Usage: "Attempts to verify each instance before it fails, 3 by default",
+		},
+		cli.IntFlag{
+			Name:  "verify-interval",
+			Usage: "Seconds between the attempts of the verification, 5 by default",
+		},
+		cli.IntFlag{
+			Name:  "verify-timeout",
+			Usage: "Seconds to wait for each attempt of the verification, 5 by default",
+		},
 		cli.StringSliceFlag{
 			Name:  "label",
 			Usage: "Add the label to the deployment, ie --label=environment=beta, --label=test=beta",
 		},
+		cli.StringFlag{
+			Name:  "strategy",
+			Usage: "Strategy to deploy on the clusters: parallel, sequential, canary or blue-green. Overrides the strategy of the config-file. Blue-green does not run on swarm clusters, swarm can not change the labels of a service.",
+		},
+		cli.StringFlag{
+			Name:  "canary",
+			Usage: "Cluster where the canary is deployed with the canary strategy, ie --canary=sjc",
+		},
+		cli.IntFlag{
+			Name:  "soak-time",
+			Usage: "Seconds to check the health of the canary before deploying on the rest of the clusters",
+		},
+		cli.IntFlag{
+			Name:  "keep-old",
+			Usage: "Seconds to keep the previous version with the blue-green strategy, until then it is only removed by bluegreen promote and the next deploy fails. Once expired the next deploy deletes it, with 0 it is deleted right after the switch",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: outputJSON,
+			Usage: "Format of the deploy report: json, yaml or table",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Show what the deploy would do on every cluster without deploying",
+		},
 	}
 }
 
 func deployBefore(c *cli.Context) error {
-	if c.String("service-id") == "" {
+	if c.String("memory") != "" {
+		if _, err := strconv.ParseInt(c.String("memory"), 10, 64); err != nil {
+			return errors.New("Invalid value of paramter memory")
+		}
+	}
+
+	switch c.String("strategy") {
+	case "", cluster.StrategyParallel, cluster.StrategySequential, cluster.StrategyCanary, cluster.StrategyBlueGreen:
+	default:
+		return fmt.Errorf("Unknown strategy %s", c.String("strategy"))
+	}
+
+	if c.Int("soak-time") < 0 {
+		return errors.New("Soak-time flag value should not be negative")
+	}
+
+	if c.Int("keep-old") < 0 {
+		return errors.New("Keep-old flag value should not be negative")
+	}
+
+	if err := validateOutput(c.String("output")); err != nil {
+		return err
+	}
+
+	manifest, err := buildServiceManifest(c, readManifest)
+	if err != nil {
+		return err
+	}
+
+	return validateServiceManifest(manifest)
+}
+
+func validateServiceManifest(manifest *configuration.ServiceManifest) error {
+	if manifest.ServiceID == "" {
 		return errors.New("Service-id is empty")
 	}
 
-	if c.String("image") == "" {
+	if manifest.Image == "" {
 		return errors.New("The name of the image is empty")
 	}
 
-	if c.String("tag") == "" {
+	if manifest.Tag == "" {
 		return errors.New("The Tag of the image is empty")
 	}
 
-	if c.String("memory") != "" {
-		if _, err := strconv.ParseInt(c.String("memory"), 10, 64); err != nil {
-			return errors.New("Invalid value of paramter memory")
-		}
+	if manifest.Memory < 0 {
+		return errors.New("Memory value should not be negative")
 	}
 
-	if c.Float64("cpu") < 0 {
+	if manifest.CPU < 0 {
 		return errors.New("Cpu flag value should not be negative")
 	}
 
-	if c.String("framework") == "marathon" && c.Float64("cpu") > 1.0 { // Fix this: framework flag does not exist anymore
-		return errors.New("Cpu flag value should not be > 1.0 for marathon")
-	} else if c.String("framework") == "swarm" && c.Float64("cpu") > 1024 { // Fix this: framework flag does not exist anymore
-		return errors.New("Cpu flag value should not be > 1024.0 for swarm")
+	if err := applyPorts(manifest.Ports, new(framework.ServiceConfig)); err != nil {
+		return err
 	}
 
-	for _, file := range c.StringSlice("env-file") {
+	for _, file := range manifest.EnvFiles {
 		if err := util.FileExists(file); err != nil {
 			return errors.New(fmt.Sprintf("El archivo %s con variables de entorno no existe", file))
 		}
 	}
 
-	if c.Float64("minimumHealthCapacity") < 0.0 || c.Float64("minimumHealthCapacity") > 1.0 {
+	if manifest.MinimumHealthCapacity < 0.0 || manifest.MinimumHealthCapacity > 1.0 {
 		return errors.New("MinimumHealthCapacity flag value should be between 0.0 and 1.0")
 	}
 
-	if c.Float64("maximumOverCapacity") < 0.0 || c.Float64("maximumOverCapacity") > 1.0 {
+	if manifest.MaximumOverCapacity < 0.0 || manifest.MaximumOverCapacity > 1.0 {
 		return errors.New("MaximumOverCapacity flag value should be between 0.0 and 1.0")
 	}
 
-	return nil
-}
+	if manifest.Tolerance < 0.0 || manifest.Tolerance > 1.0 {
+		return errors.New("Tolerance value should be between 0.0 and 1.0")
+	}
+
+	if manifest.Instances < 0 {
+		return errors.New("Instances value should not be negative")
+	}
+
+	for stackKey, override := range manifest.Clusters {
+		if override.Instances < 0 {
+			return fmt.Errorf("Instances value of cluster %s should not be negative", stackKey)
+		}
+		if override.CPU < 0 || override.Memory < 0 {
+			return fmt.Errorf("Cpu and memory values of cluster %s should not be negative", stackKey)
+		}
+		for _, env := range override.Envs {
+			if !strings.Contains(env, "=") {
+				return fmt.Errorf("The env %s of cluster %s does not comply format KEY=VALUE", env, stackKey)
+			}
+		}
+	}
+
+	if err := manifest.Hooks.Validate(); err != nil {
+		return err
+	}
+	if len(manifest.Hooks.PreDelete) != 0 || len(manifest.Hooks.PostDelete) != 0 {
+		return errors.New("The pre-delete and post-delete hooks do not run from the manifest, configure them in crane.yml")
+	}
+
+	if err := manifest.Verify.Validate(); err != nil {
+		return err
+	}
 
-type callbackResume struct {
-	Id      string `json:Id"`
-	Address string `json:"Address"`
+	if _, err := valid.ValidateStruct(manifest); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 func applyPorts(ports []string, cfg *framework.ServiceConfig) error {
@@ -189,84 +302,105 @@ func applyKeyValSliceFlag(sliceFlag []string, setAction func(newMap map[string]s
 	return nil
 }
 
-func deployCmd(c *cli.Context) {
-
-	envs, err := util.ParseMultiFileLinesToArray(c.StringSlice("env-file"))
+// serviceConfigFromManifest builds the framework.ServiceConfig described by the manifest
+func serviceConfigFromManifest(manifest *configuration.ServiceManifest) (framework.ServiceConfig, error) {
+	envs, err := util.ParseMultiFileLinesToArray(manifest.EnvFiles)
 	if err != nil {
-		util.Log.Fatalln("No se pudo procesar el archivo con variables de entorno", err)
-	}
-
-	for _, v := range c.StringSlice("env") {
-		envs = append(envs, v)
+		return framework.ServiceConfig{}, err
 	}
+	envs = append(envs, manifest.Envs...)
 
 	serviceConfig := framework.ServiceConfig{
-		ServiceID: c.String("service-id"),
-		CPUShares: c.Float64("cpu"),
-		Envs:      envs,
-		ImageName: c.String("image"),
-		Tag:       c.String("tag"),
-		MinimumHealthCapacity: c.Float64("minimumHealthCapacity"),
-		MaximumOverCapacity:   c.Float64("maximumOverCapacity"),
-		HealthCheckConfig:     &framework.HealthCheck{Path: c.String("health-check-path")},
-	}
-	applyPorts(c.StringSlice("port"), &serviceConfig)
-	if c.String("memory") != "" {
-		n, _ := strconv.ParseInt(c.String("memory"), 10, 64)
-		serviceConfig.Memory = int64(n)
+		ServiceID:             manifest.ServiceID,
+		CPUShares:             manifest.CPU,
+		Memory:                manifest.Memory,
+		Envs:                  envs,
+		ImageName:             manifest.Image,
+		Tag:                   manifest.Tag,
+		MinimumHealthCapacity: manifest.MinimumHealthCapacity,
+		MaximumOverCapacity:   manifest.MaximumOverCapacity,
+		HealthCheckConfig:     &framework.HealthCheck{Path: manifest.HealthCheck.Path},
+		Constraints:           mergeStringMaps(nil, manifest.Constraints),
+		Labels:                mergeStringMaps(nil, manifest.Labels),
+	}
+	if err := applyPorts(manifest.Ports, &serviceConfig); err != nil {
+		return framework.ServiceConfig{}, err
 	}
 
-	err = applyKeyValSliceFlag(c.StringSlice("constraint"), func(configMap map[string]string) {
-		if configMap != nil && len(configMap) != 0 {
-			serviceConfig.Constraints = configMap
+	if manifest.Beta != "" {
+		if serviceConfig.Labels == nil {
+			serviceConfig.Labels = make(map[string]string)
+		}
+		if serviceConfig.Constraints == nil {
+			serviceConfig.Constraints = make(map[string]string)
 		}
-	})
 
-	if err != nil {
-		util.Log.Fatalln("Error reading constraints", err)
+		serviceConfig.Labels["slave_name"] = manifest.Beta
+		serviceConfig.Constraints["slave_name"] = manifest.Beta
 	}
 
-	err = applyKeyValSliceFlag(c.StringSlice("label"), func(configMap map[string]string) {
-		if configMap != nil && len(configMap) != 0 {
-			serviceConfig.Labels = configMap
-		}
-	})
+	return serviceConfig, nil
+}
 
+func deployCmd(c *cli.Context) {
+	manifest, err := buildServiceManifest(c, readManifest)
 	if err != nil {
-		util.Log.Fatalln("Error reading labels", err)
+		util.Log.Fatalln("Error reading the service definition", err)
 	}
 
-	if c.String("beta") != "" {
-		if serviceConfig.Labels == nil {
-			serviceConfig.Labels = make(map[string]string)
-		}
-		if serviceConfig.Constraints == nil {
-			serviceConfig.Constraints = make(map[string]string)
-		}
+	serviceConfig, err := serviceConfigFromManifest(manifest)
+	if err != nil {
+		util.Log.Fatalln("Error building the service configuration", err)
+	}
 
-		serviceConfig.Labels["slave_name"] = c.String("beta")
-		serviceConfig.Constraints["slave_name"] = c.String("beta")
-	}
-
-	handleDeploySigTerm(stackManager)
-	if stackManager.Deploy(serviceConfig, c.Int("instances"), c.Float64("tolerance")) {
-		services := stackManager.DeployedContainers()
-		var resume []callbackResume
-		for _, service := range services {
-			for _, instance := range service.Instances {
-				for _, val := range instance.Ports {
-					util.Log.Infof("Se desplegó %s en host %s y dirección %+v", instance.ID, instance.Host, val)
-					instanceInfo := callbackResume{
-						Id:      instance.ID,
-						Address: instance.Host + ":" + strconv.FormatInt(val.Internal, 10),
-					}
-					resume = append(resume, instanceInfo)
-				}
-			}
+	options := cluster.DeployOptions{
+		Instances: manifest.Instances,
+		Tolerance: manifest.Tolerance,
+		Overrides: manifest.Clusters,
+		Hooks:     manifest.Hooks,
+		Verify:    manifest.Verify,
+		Policy: configuration.DeployPolicy{
+			Strategy: c.String("strategy"),
+			Canary:   c.String("canary"),
+			SoakTime: c.Int("soak-time"),
+			KeepOld:  c.Int("keep-old"),
+		},
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	if c.Bool("dry-run") {
+		plan := stackManager.PlanDeploy(ctx, serviceConfig, options)
+		if err := printReport(os.Stdout, c.String("output"), newPlanReport("deploy", serviceConfig.ServiceID, plan)); err != nil {
+			util.Log.Fatalln("Error printing the plan", err)
 		}
-		jsonResume, _ := json.Marshal(resume)
-		fmt.Println(string(jsonResume))
-	} else {
-		util.Log.Fatalln("Deployment-Process terminated with errors")
+		return
+	}
+
+	result := stackManager.Deploy(ctx, serviceConfig, options)
+	recordHistory("deploy", serviceConfig.ServiceID, &serviceConfig, result)
+	recordRollback(serviceConfig.ServiceID, result, ctx.Err() == context.Canceled)
+	for stackKey, stackResult := range result.Stacks {
+		util.Log.Infof("Stack %s: %s", stackKey, stackResult.Status)
+	}
+
+	if err := printReport(os.Stdout, c.String("output"), newDeployReport(serviceConfig, result)); err != nil {
+		util.Log.Errorln("Error printing the deploy report", err)
+	}
+
+	exitOnResult(result, "Deployment-Process")
+}
+
+// exitOnResult exits with status 1 when the operation failed and exitDegraded when it has
+// unhealthy instances within the tolerance
+func exitOnResult(result *cluster.DeployResult, operation string) {
+	switch {
+	case !result.Succeeded():
+		util.Log.Errorf("%s terminated with errors", operation)
+		exit(1)
+	case result.Status == cluster.STACK_DEGRADED:
+		util.Log.Warnf("%s terminated with unhealthy instances within the tolerance", operation)
+		exit(exitDegraded)
 	}
 }
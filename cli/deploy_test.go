@@ -146,22 +146,12 @@ func TestCpuFlagNegative(t *testing.T) {
 	assert.NotNil(t, err, "Should fail")
 }
 
-func TestCpuFlagMarathonWrongRange(t *testing.T) {
+func TestCpuFlagOverOneCore(t *testing.T) {
 	set := createFlagSetWithMandatoryFlags()
-	set.String("framework", "marathon", "usage") // Fix this: framework flag does not exist anymore
-	set.Float64("cpu", 1.1, "usage")
+	set.Float64("cpu", 2, "usage")
 	ctx := cli.NewContext(nil, set, nil)
 	err := deployBefore(ctx)
-	assert.NotNil(t, err, "Should fail")
-}
-
-func TestCpuFlagSwarmWrongRange(t *testing.T) {
-	set := createFlagSetWithMandatoryFlags()
-	set.String("framework", "swarm", "usage") // Fix this: framework flag does not exist anymore
-	set.Float64("cpu", 1025, "usage")
-	ctx := cli.NewContext(nil, set, nil)
-	err := deployBefore(ctx)
-	assert.NotNil(t, err, "Should fail")
+	assert.Nil(t, err, "The max cpu depends on the framework of each cluster, it is checked on deploy")
 }
 
 func createEndpointSliceFlag() cli.StringSliceFlag {
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/util"
+)
+
+func diffFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "service-id",
+			Usage: "Id of the service",
+		},
+		cli.StringFlag{
+			Name:  "search",
+			Usage: "text which contains the services to compare",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: outputTable,
+			Usage: "Format of the differences: json, yaml or table",
+		},
+	}
+}
+
+func diffBefore(c *cli.Context) error {
+	if c.String("service-id") == "" && c.String("search") == "" {
+		return errors.New("Service-id or search is required")
+	}
+	if c.String("service-id") != "" && c.String("search") != "" {
+		return errors.New("Service-id and search can not be used together")
+	}
+	return validateOutput(c.String("output"))
+}
+
+type differenceReport struct {
+	Field  string            `json:"field" yaml:"field"`
+	Values map[string]string `json:"values" yaml:"values"`
+}
+
+type serviceDiffReport struct {
+	ServiceID   string             `json:"service-id" yaml:"service-id"`
+	Differences []differenceReport `json:"differences" yaml:"differences"`
+	// Errors keeps the stacks that could not be compared
+	Errors map[string]string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// diffReport lists the differences of the services between the clusters
+type diffReport struct {
+	Drift    bool                 `json:"drift" yaml:"drift"`
+	Services []*serviceDiffReport `json:"services" yaml:"services"`
+}
+
+func newServiceDiffReport(serviceID string, statuses map[string]*cluster.StackServiceStatus) *serviceDiffReport {
+	report := &serviceDiffReport{ServiceID: serviceID, Differences: make([]differenceReport, 0)}
+	for _, difference := range cluster.DiffService(statuses) {
+		report.Differences = append(report.Differences, differenceReport{difference.Field, difference.Values})
+	}
+	for stackKey, status := range statuses {
+		if status.Error != nil {
+			if report.Errors == nil {
+				report.Errors = make(map[string]string)
+			}
+			report.Errors[stackKey] = status.Error.Error()
+		}
+	}
+	return report
+}
+
+func (r *diffReport) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "SERVICE\tFIELD\tVALUES")
+	for _, service := range r.Services {
+		for _, difference := range service.Differences {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", service.ServiceID, difference.Field, joinStackValues(difference.Values))
+		}
+		for _, stackKey := range sortedKeys(service.Errors) {
+			fmt.Fprintf(w, "%s\tERROR\t%s=%s\n", service.ServiceID, stackKey, service.Errors[stackKey])
+		}
+	}
+	if !r.Drift {
+		fmt.Fprintln(w, "\nNo drift between the clusters")
+	}
+}
+
+func joinStackValues(values map[string]string) string {
+	pairs := make([]string, 0, len(values))
+	for _, stackKey := range sortedKeys(values) {
+		pairs = append(pairs, stackKey+"="+values[stackKey])
+	}
+	return strings.Join(pairs, " ")
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffServiceIDs returns the services to compare, searching them on every stack when needed
+func diffServiceIDs(ctx context.Context, c *cli.Context) []string {
+	if c.String("service-id") != "" {
+		return []string{c.String("service-id")}
+	}
+	seen := make(map[string]bool)
+	var serviceIDs []string
+	for _, service := range stackManager.FindServiceInformation(ctx, c.String("search")) {
+		serviceID := strings.TrimPrefix(service.ID, "/")
+		if !seen[serviceID] {
+			seen[serviceID] = true
+			serviceIDs = append(serviceIDs, serviceID)
+		}
+	}
+	sort.Strings(serviceIDs)
+	return serviceIDs
+}
+
+func diffCmd(c *cli.Context) {
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	serviceIDs := diffServiceIDs(ctx, c)
+	if len(serviceIDs) == 0 {
+		util.Log.Errorln("No services found")
+		exit(1)
+		return
+	}
+
+	report := &diffReport{}
+	for _, serviceID := range serviceIDs {
+		serviceReport := newServiceDiffReport(serviceID, stackManager.ServiceStatus(ctx, serviceID))
+		if len(serviceReport.Differences) != 0 || len(serviceReport.Errors) != 0 {
+			report.Drift = true
+		}
+		report.Services = append(report.Services, serviceReport)
+	}
+
+	if err := printReport(os.Stdout, c.String("output"), report); err != nil {
+		util.Log.Errorln("Error printing the differences", err)
+	}
+
+	if report.Drift {
+		util.Log.Warnln("The services drift between the clusters or some clusters could not be compared")
+		exit(1)
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffBefore(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.String("service-id", "", "")
+	set.String("search", "", "")
+	ctx := cli.NewContext(nil, set, nil)
+	assert.NotNil(t, diffBefore(ctx), "Should require service-id or search")
+
+	set.Set("service-id", "nginx")
+	assert.Nil(t, diffBefore(ctx))
+
+	set.Set("search", "nginx")
+	assert.NotNil(t, diffBefore(ctx), "Should not accept service-id and search")
+}
+
+func TestDiffCmdExitsOnDrift(t *testing.T) {
+	stackManager = createStackManagerMock()
+	status := 0
+	exit = func(code int) { status = code }
+	defer func() { exit = os.Exit }()
+
+	set := flag.NewFlagSet("test", 0)
+	set.String("search", "SABRE", "")
+	set.String("output", "json", "")
+	ctx := cli.NewContext(nil, set, nil)
+	diffCmd(ctx)
+	assert.Equal(t, 1, status, "The mock service does not exist in every stack")
+}
+
+func TestDiffReportTable(t *testing.T) {
+	report := &diffReport{Services: []*serviceDiffReport{{
+		ServiceID:   "nginx",
+		Differences: []differenceReport{{Field: "tag", Values: map[string]string{"sjc": "1.0", "scl": "1.1"}}},
+	}}, Drift: true}
+	var out bytes.Buffer
+	assert.Nil(t, printReport(&out, outputTable, report))
+	assert.Contains(t, out.String(), "scl=1.1 sjc=1.0")
+}
@@ -23,7 +23,10 @@ func findBefore(c *cli.Context) error {
 }
 
 func findCmd(c *cli.Context) {
-	services := stackManager.FindServiceInformation(c.String("search"))
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	services := stackManager.FindServiceInformation(ctx, c.String("search"))
 	for _, service := range services {
 		fmt.Printf("Service %s running with %d instances\n", service.ID, len(service.Instances))
 	}
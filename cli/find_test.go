@@ -1,7 +1,9 @@
 package cli
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"github.com/codegangsta/cli"
 	"github.com/latam-airlines/crane/cluster"
 	"github.com/latam-airlines/mesos-framework-factory"
@@ -21,18 +23,90 @@ func (sm *StackManagerMock) buildServiceDummyList() []*framework.ServiceInformat
 	services[0] = service
 	return services
 }
-func (sm *StackManagerMock) FindServiceInformation(search string) []*framework.ServiceInformation {
+func (sm *StackManagerMock) FindServiceInformation(ctx context.Context, search string) []*framework.ServiceInformation {
 	return sm.buildServiceDummyList()
 }
 func (sm *StackManagerMock) AppendStack(fh framework.Framework) {}
-func (sm *StackManagerMock) Deploy(serviceConfig framework.ServiceConfig, instances int, tolerance float64) bool {
-	return true
+func (sm *StackManagerMock) Deploy(ctx context.Context, serviceConfig framework.ServiceConfig, options cluster.DeployOptions) *cluster.DeployResult {
+	return &cluster.DeployResult{
+		Status: cluster.STACK_READY,
+		Stacks: map[string]*cluster.StackResult{
+			"local": {Status: cluster.STACK_READY, Service: sm.buildServiceDummyList()[0]},
+		},
+	}
 }
 func (sm *StackManagerMock) DeployedContainers() []*framework.ServiceInformation {
 	return sm.buildServiceDummyList()
 }
-func (sm *StackManagerMock) Rollback(appId, previousVersion string) {}
-func (sm *StackManagerMock) DeleteService(string) error             { return nil }
+func (sm *StackManagerMock) DeleteService(ctx context.Context, serviceId string, backup cluster.BackupFunc) *cluster.DeployResult {
+	service := sm.buildServiceDummyList()[0]
+	if backup != nil {
+		backup("local", &cluster.ServiceSnapshot{ServiceID: serviceId, Service: service, Instances: 1})
+	}
+	return &cluster.DeployResult{
+		Status: cluster.STACK_READY,
+		Stacks: map[string]*cluster.StackResult{"local": {Status: cluster.STACK_READY, Service: service}},
+	}
+}
+func (sm *StackManagerMock) Rollback(ctx context.Context, serviceId string, snapshots map[string]*cluster.ServiceSnapshot) *cluster.DeployResult {
+	result := &cluster.DeployResult{Status: cluster.STACK_READY, Stacks: make(map[string]*cluster.StackResult)}
+	for stackKey, snapshot := range snapshots {
+		result.Stacks[stackKey] = &cluster.StackResult{Status: cluster.STACK_READY, Service: snapshot.Service, RolledBack: true}
+	}
+	return result
+}
+func (sm *StackManagerMock) ServiceStatus(ctx context.Context, serviceId string) map[string]*cluster.StackServiceStatus {
+	service := sm.buildServiceDummyList()[0]
+	service.ImageTag = "1.0"
+	return map[string]*cluster.StackServiceStatus{
+		"local": {Service: service, Desired: 1},
+		"sjc":   {Desired: cluster.UnknownInstances},
+	}
+}
+
+func (sm *StackManagerMock) Scale(ctx context.Context, serviceId string, options cluster.ScaleOptions) *cluster.DeployResult {
+	return &cluster.DeployResult{
+		Status: cluster.STACK_READY,
+		Stacks: map[string]*cluster.StackResult{
+			"local": {Status: cluster.STACK_READY, Service: sm.buildServiceDummyList()[0]},
+		},
+	}
+}
+
+func (sm *StackManagerMock) PlanDeploy(ctx context.Context, serviceConfig framework.ServiceConfig, options cluster.DeployOptions) *cluster.DeployPlan {
+	return &cluster.DeployPlan{
+		Strategy: cluster.StrategyParallel,
+		Waves:    [][]string{{"local"}},
+		Stacks: map[string]*cluster.StackPlan{
+			"local": {Action: cluster.PlanCreate, Config: &serviceConfig, Instances: options.Instances},
+		},
+	}
+}
+func (sm *StackManagerMock) PlanDelete(ctx context.Context, serviceId string) *cluster.DeployPlan {
+	return &cluster.DeployPlan{
+		Stacks: map[string]*cluster.StackPlan{
+			"local": {Action: cluster.PlanDelete, Current: sm.buildServiceDummyList()[0]},
+		},
+	}
+}
+
+func (sm *StackManagerMock) PromoteBlueGreen(ctx context.Context, serviceId string) *cluster.DeployResult {
+	return &cluster.DeployResult{
+		Status: cluster.STACK_READY,
+		Stacks: map[string]*cluster.StackResult{
+			"local": {Status: cluster.STACK_READY, Service: sm.buildServiceDummyList()[0]},
+		},
+	}
+}
+
+func (sm *StackManagerMock) AbortBlueGreen(ctx context.Context, serviceId string) *cluster.DeployResult {
+	return &cluster.DeployResult{
+		Status: cluster.STACK_FAILED,
+		Stacks: map[string]*cluster.StackResult{
+			"local": {Status: cluster.STACK_FAILED, Error: fmt.Errorf("There is no previous version of %s to switch back to", serviceId)},
+		},
+	}
+}
 
 func createStackManagerMock() cluster.CraneManager {
 	return new(StackManagerMock)
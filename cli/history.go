@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/crane/history"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// historyStore records the operations on the clusters, it is nil when the history is disabled
+var historyStore *history.Store
+
+// newHistoryStore returns the store configured in crane.yml, ~/.crane/history.jsonl by default
+func newHistoryStore(config configuration.History) *history.Store {
+	if config.Disabled {
+		return nil
+	}
+	path := config.Path
+	if path == "" {
+		path = "crane-history.jsonl"
+		if home := os.Getenv("HOME"); home != "" {
+			path = filepath.Join(home, ".crane", "history.jsonl")
+		}
+	}
+	return &history.Store{Path: path}
+}
+
+// recordHistory appends the operation to the history. A failure is logged, the operation on the
+// clusters already happened
+func recordHistory(command, serviceID string, config *framework.ServiceConfig, result *cluster.DeployResult) {
+	if historyStore == nil {
+		return
+	}
+	appendHistory(history.NewEntry(command, serviceID, config, result))
+}
+
+// recordRollback appends the rollback of the stacks restored by the operation to the history,
+// after the operation. A requested rollback is recorded even when no stack was restored
+func recordRollback(serviceID string, result *cluster.DeployResult, requested bool) {
+	if historyStore == nil {
+		return
+	}
+	if entry := history.NewRollbackEntry(serviceID, result, requested); entry != nil {
+		appendHistory(entry)
+	}
+}
+
+// previousSnapshots returns the snapshots of the versions the service ran on every stack before
+// its last deploy, read from the history. The frameworks roll the stacks back to those versions
+func previousSnapshots(serviceID string) (map[string]*cluster.ServiceSnapshot, error) {
+	if historyStore == nil {
+		return nil, fmt.Errorf("The history is disabled, the previous version of %s is unknown", serviceID)
+	}
+	entries, err := historyStore.Query(history.Filter{ServiceID: serviceID})
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make(map[string]*cluster.ServiceSnapshot)
+	for stackKey, stack := range history.PreviousVersions(entries) {
+		service := &framework.ServiceInformation{ID: serviceID, Version: stack.Version}
+		service.ImageName, service.ImageTag = splitImage(stack.Image)
+		snapshots[stackKey] = &cluster.ServiceSnapshot{ServiceID: serviceID, Service: service, Instances: stack.Instances}
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("The history has no deploy of %s before the last one", serviceID)
+	}
+	return snapshots, nil
+}
+
+// splitImage splits the name:tag of an image, the registry of the name can have a port
+func splitImage(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || i < strings.LastIndex(image, "/") {
+		return image, ""
+	}
+	return image[:i], image[i+1:]
+}
+
+func appendHistory(entry *history.Entry) {
+	if err := historyStore.Append(entry); err != nil {
+		util.Log.Errorf("Error recording the %s of %s in the history %s: %s", entry.Command, entry.ServiceID, historyStore.Path, err)
+	}
+}
+
+func historyFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "service-id",
+			Usage: "Show only the operations on the service",
+		},
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "Show only the operations since a duration ago or a date, ie --since=72h or --since=2016-03-01",
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Value: outputTable,
+			Usage: "Format of the history: json, yaml or table",
+		},
+	}
+}
+
+// parseSince reads the since flag, a duration before now or a date
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, since, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid since %s, it should be a duration as 72h or a date as 2016-03-01", since)
+}
+
+func historyBefore(c *cli.Context) error {
+	if _, err := parseSince(c.String("since"), time.Now()); err != nil {
+		return err
+	}
+	return validateOutput(c.String("output"))
+}
+
+// historyReport lists the operations of the history
+type historyReport struct {
+	Entries []*history.Entry `json:"entries" yaml:"entries"`
+}
+
+func (r *historyReport) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "TIME\tUSER\tHOST\tCOMMAND\tSERVICE\tIMAGE\tRESULT\tDURATION\tCLUSTERS")
+	for _, entry := range r.Entries {
+		image := ""
+		if entry.Config != nil {
+			image = entry.Config.ImageName + ":" + entry.Config.Tag
+		}
+		result := entry.Result
+		if entry.RolledBack() {
+			result += " (rolled back)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%.1fs\t%s\n", entry.Time.Local().Format("2006-01-02 15:04:05"),
+			entry.User, entry.Host, entry.Command, entry.ServiceID, image, result, entry.Duration, strings.Join(stackStatuses(entry), ","))
+	}
+}
+
+// stackStatuses describes the outcome on every stack of the entry, ie sjc:STACK_READY
+func stackStatuses(entry *history.Entry) []string {
+	statuses := make([]string, 0, len(entry.Stacks))
+	for stackKey, stack := range entry.Stacks {
+		statuses = append(statuses, stackKey+":"+stack.Status)
+	}
+	sort.Strings(statuses)
+	return statuses
+}
+
+func historyCmd(c *cli.Context) {
+	config, err := readConfiguration(c.GlobalString("config"), c.GlobalIsSet("config"))
+	if err != nil {
+		util.Log.Fatalln("Error reading the configuration", err)
+	}
+	store := newHistoryStore(config.History)
+	if store == nil {
+		util.Log.Fatalln("The history is disabled in the configuration")
+	}
+
+	since, _ := parseSince(c.String("since"), time.Now())
+	entries, err := store.Query(history.Filter{ServiceID: c.String("service-id"), Since: since})
+	if err != nil {
+		util.Log.Fatalln("Error reading the history", err)
+	}
+	if entries == nil {
+		entries = make([]*history.Entry, 0)
+	}
+	if err := printReport(os.Stdout, c.String("output"), &historyReport{Entries: entries}); err != nil {
+		util.Log.Fatalln("Error printing the history", err)
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/crane/history"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHistoryStore(t *testing.T) {
+	home := os.Getenv("HOME")
+	defer os.Setenv("HOME", home)
+	os.Setenv("HOME", "/home/chuck")
+
+	assert.Equal(t, "/home/chuck/.crane/history.jsonl", newHistoryStore(configuration.History{}).Path)
+	assert.Equal(t, "/var/log/crane.jsonl", newHistoryStore(configuration.History{Path: "/var/log/crane.jsonl"}).Path)
+	assert.Nil(t, newHistoryStore(configuration.History{Disabled: true}))
+
+	os.Setenv("HOME", "")
+	assert.Equal(t, "crane-history.jsonl", newHistoryStore(configuration.History{}).Path)
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2016, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	since, err := parseSince("", now)
+	assert.Nil(t, err)
+	assert.True(t, since.IsZero())
+
+	since, err = parseSince("72h", now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2016, 3, 7, 12, 0, 0, 0, time.UTC), since)
+
+	since, err = parseSince("2016-03-01T10:00:00Z", now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC), since.UTC())
+
+	since, err = parseSince("2016-03-01", now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2016, 3, 1, 0, 0, 0, 0, time.Local), since)
+
+	_, err = parseSince("yesterday", now)
+	assert.NotNil(t, err)
+}
+
+func TestHistoryReportTable(t *testing.T) {
+	report := &historyReport{Entries: []*history.Entry{
+		{
+			Time:      time.Date(2016, 3, 1, 10, 0, 0, 0, time.Local),
+			User:      "chuck",
+			Host:      "ci",
+			Command:   "deploy",
+			ServiceID: "app",
+			Config:    &framework.ServiceConfig{ImageName: "latam/app", Tag: "1.0"},
+			Result:    "STACK_FAILED",
+			Duration:  12.34,
+			Stacks: map[string]*history.StackEntry{
+				"sjc": {Status: "STACK_READY"},
+				"scl": {Status: "STACK_FAILED", RolledBack: true},
+			},
+		},
+		{
+			Time:      time.Date(2016, 3, 2, 10, 0, 0, 0, time.Local),
+			User:      "chuck",
+			Host:      "ci",
+			Command:   "delete",
+			ServiceID: "app",
+			Result:    "STACK_READY",
+			Duration:  1,
+		},
+	}}
+
+	var out bytes.Buffer
+	assert.Nil(t, printReport(&out, outputTable, report))
+	assert.Equal(t, `TIME                 USER   HOST  COMMAND  SERVICE  IMAGE          RESULT                      DURATION  CLUSTERS
+2016-03-01 10:00:00  chuck  ci    deploy   app      latam/app:1.0  STACK_FAILED (rolled back)  12.3s     scl:STACK_FAILED,sjc:STACK_READY
+2016-03-02 10:00:00  chuck  ci    delete   app                     STACK_READY                 1.0s      
+`, out.String())
+}
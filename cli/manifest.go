@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/configuration"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultInstances             = 1
+	defaultTolerance             = 0.5
+	defaultMinimumHealthCapacity = 1.0
+	defaultMaximumOverCapacity   = 0.2
+)
+
+type parseManifest func(manifestFile string) (*configuration.ServiceManifest, error)
+
+// newServiceManifest returns a manifest holding the same defaults as the deploy flags
+func newServiceManifest() *configuration.ServiceManifest {
+	return &configuration.ServiceManifest{
+		Instances:             defaultInstances,
+		Tolerance:             defaultTolerance,
+		MinimumHealthCapacity: defaultMinimumHealthCapacity,
+		MaximumOverCapacity:   defaultMaximumOverCapacity,
+	}
+}
+
+// readManifest reads a service manifest in YAML or JSON format. Values not present
+// in the file keep the defaults of the deploy flags
+func readManifest(manifestFile string) (*configuration.ServiceManifest, error) {
+	_, err := os.Stat(manifestFile)
+	if os.IsNotExist(err) {
+		return nil, err
+	}
+
+	manifestFile, err = filepath.Abs(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	if content, err = ioutil.ReadFile(manifestFile); err != nil {
+		return nil, err
+	}
+
+	manifest := newServiceManifest()
+	if strings.ToLower(filepath.Ext(manifestFile)) == ".json" {
+		err = json.Unmarshal(content, manifest)
+	} else {
+		err = yaml.Unmarshal(content, manifest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// env files are relative to the manifest, not to the working directory
+	for i, envFile := range manifest.EnvFiles {
+		if !filepath.IsAbs(envFile) {
+			manifest.EnvFiles[i] = filepath.Join(filepath.Dir(manifestFile), envFile)
+		}
+	}
+
+	return manifest, nil
+}
+
+// buildServiceManifest resolves the service to deploy. When the flag "file" is present the
+// manifest is read with the parser and every flag given in the command line overrides it
+func buildServiceManifest(c *cli.Context, parser parseManifest) (*configuration.ServiceManifest, error) {
+	var manifest *configuration.ServiceManifest
+	if c.String("file") == "" {
+		manifest = manifestFromFlags(c)
+	} else {
+		var err error
+		if manifest, err = parser(c.String("file")); err != nil {
+			return nil, err
+		}
+		applyFlagsToManifest(c, manifest)
+	}
+
+	err := applyKeyValSliceFlag(c.StringSlice("constraint"), func(configMap map[string]string) {
+		manifest.Constraints = mergeStringMaps(manifest.Constraints, configMap)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyKeyValSliceFlag(c.StringSlice("label"), func(configMap map[string]string) {
+		manifest.Labels = mergeStringMaps(manifest.Labels, configMap)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// mergeStringMaps adds the values of override to base, override wins on duplicated keys
+func mergeStringMaps(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	if base == nil {
+		base = make(map[string]string)
+	}
+	for k, v := range override {
+		base[k] = v
+	}
+	return base
+}
+
+func manifestFromFlags(c *cli.Context) *configuration.ServiceManifest {
+	manifest := &configuration.ServiceManifest{
+		ServiceID:             c.String("service-id"),
+		Image:                 c.String("image"),
+		Tag:                   c.String("tag"),
+		Ports:                 c.StringSlice("port"),
+		CPU:                   c.Float64("cpu"),
+		EnvFiles:              c.StringSlice("env-file"),
+		Envs:                  c.StringSlice("env"),
+		Beta:                  c.String("beta"),
+		HealthCheck:           configuration.HealthCheck{Path: c.String("health-check-path")},
+		MinimumHealthCapacity: c.Float64("minimumHealthCapacity"),
+		MaximumOverCapacity:   c.Float64("maximumOverCapacity"),
+		Instances:             c.Int("instances"),
+		Tolerance:             c.Float64("tolerance"),
+	}
+	manifest.Memory, _ = strconv.ParseInt(c.String("memory"), 10, 64)
+	applyVerifyFlags(c, &manifest.Verify)
+	return manifest
+}
+
+// applyVerifyFlags overrides the verification of the instances with the flags that have a value
+func applyVerifyFlags(c *cli.Context, verify *configuration.Verification) {
+	if c.String("verify") != "" {
+		verify.Type = c.String("verify")
+	}
+	if c.String("verify-path") != "" {
+		verify.Path = c.String("verify-path")
+	}
+	if len(c.IntSlice("verify-status")) != 0 {
+		verify.ExpectedStatus = c.IntSlice("verify-status")
+	}
+	overrideInt := func(name string, value *int) {
+		if c.IsSet(name) {
+			*value = c.Int(name)
+		}
+	}
+	if c.IsSet("verify-port") {
+		verify.Port = int64(c.Int("verify-port"))
+	}
+	overrideInt("verify-attempts", &verify.Attempts)
+	overrideInt("verify-interval", &verify.Interval)
+	overrideInt("verify-timeout", &verify.Timeout)
+}
+
+// applyFlagsToManifest overrides the manifest with the flags. Text and list flags override it
+// when they have a value, numeric flags only when they were set explicitly
+func applyFlagsToManifest(c *cli.Context, manifest *configuration.ServiceManifest) {
+	overrideString := func(name string, value *string) {
+		if c.String(name) != "" {
+			*value = c.String(name)
+		}
+	}
+	overrideFloat := func(name string, value *float64) {
+		if c.IsSet(name) {
+			*value = c.Float64(name)
+		}
+	}
+
+	overrideString("service-id", &manifest.ServiceID)
+	overrideString("image", &manifest.Image)
+	overrideString("tag", &manifest.Tag)
+	overrideString("beta", &manifest.Beta)
+	overrideString("health-check-path", &manifest.HealthCheck.Path)
+
+	if c.String("memory") != "" {
+		manifest.Memory, _ = strconv.ParseInt(c.String("memory"), 10, 64)
+	}
+	if len(c.StringSlice("port")) != 0 {
+		manifest.Ports = c.StringSlice("port")
+	}
+	if len(c.StringSlice("env-file")) != 0 {
+		manifest.EnvFiles = c.StringSlice("env-file")
+	}
+	manifest.Envs = append(manifest.Envs, c.StringSlice("env")...)
+
+	overrideFloat("cpu", &manifest.CPU)
+	overrideFloat("minimumHealthCapacity", &manifest.MinimumHealthCapacity)
+	overrideFloat("maximumOverCapacity", &manifest.MaximumOverCapacity)
+	overrideFloat("tolerance", &manifest.Tolerance)
+	if c.IsSet("instances") {
+		manifest.Instances = c.Int("instances")
+	}
+	applyVerifyFlags(c, &manifest.Verify)
+}
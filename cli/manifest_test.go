@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadManifest(t *testing.T) {
+	manifest, err := readManifest("../test/resources/service.yml")
+	assert.Nil(t, err, "Should read the manifest")
+	assert.Equal(t, "nginx-v1", manifest.ServiceID)
+	assert.Equal(t, "nginx", manifest.Image)
+	assert.Equal(t, "1.9.12", manifest.Tag)
+	assert.Equal(t, int64(256), manifest.Memory)
+	assert.Equal(t, "/health", manifest.HealthCheck.Path)
+	assert.Equal(t, "UNIQUE", manifest.Constraints["hostname"])
+	assert.Equal(t, 0.5, manifest.MinimumHealthCapacity)
+	assert.Equal(t, defaultMaximumOverCapacity, manifest.MaximumOverCapacity, "Should keep the default value")
+	assert.Equal(t, defaultTolerance, manifest.Tolerance, "Should keep the default value")
+	assert.Equal(t, 3, manifest.Clusters["sjc"].Instances)
+	assert.Equal(t, int64(512), manifest.Clusters["scl"].Memory)
+	assert.Equal(t, []string{"NGINX_PORT=8080"}, manifest.Clusters["scl"].Envs)
+	assert.Equal(t, "scl-r1", manifest.Clusters["scl"].Constraints["rack"])
+}
+
+func TestReadManifestJSON(t *testing.T) {
+	manifest, err := readManifest("../test/resources/service.json")
+	assert.Nil(t, err, "Should read the manifest")
+	assert.Equal(t, "nginx-v1", manifest.ServiceID)
+	assert.Equal(t, 2, manifest.Instances)
+	assert.Equal(t, 3, manifest.Clusters["sjc"].Instances)
+}
+
+func TestReadManifestError(t *testing.T) {
+	_, err := readManifest("../test/resources/service-not-there.yml")
+	assert.NotNil(t, err, "Should throw error")
+	_, err = readManifest("../test/resources/broken.yml")
+	assert.NotNil(t, err, "Should throw error")
+}
+
+func TestBuildServiceManifestFlagsOverride(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.String("file", "service.yml", "")
+	set.String("tag", "1.9.13", "")
+	set.Int("instances", defaultInstances, "")
+	set.Parse([]string{"--instances=4"})
+	labelSlice := new(cli.StringSlice)
+	labelSlice.Set("team=platform")
+	cli.StringSliceFlag{Name: "label", Value: labelSlice}.Apply(set)
+	ctx := cli.NewContext(nil, set, nil)
+
+	manifest, err := buildServiceManifest(ctx, func(string) (*configuration.ServiceManifest, error) {
+		return readManifest("../test/resources/service.yml")
+	})
+	assert.Nil(t, err, "Should build the manifest")
+	assert.Equal(t, "nginx", manifest.Image, "Should keep the image of the manifest")
+	assert.Equal(t, "1.9.13", manifest.Tag, "Flag should override the tag")
+	assert.Equal(t, 4, manifest.Instances, "Flag should override the instances")
+	assert.Equal(t, "beta", manifest.Labels["environment"])
+	assert.Equal(t, "platform", manifest.Labels["team"])
+}
+
+func TestDeployBeforeWithManifest(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.String("file", "../test/resources/service.yml", "")
+	ctx := cli.NewContext(nil, set, nil)
+	err := deployBefore(ctx)
+	assert.Nil(t, err, "Should pass without any error")
+}
+
+func TestServiceConfigFromManifest(t *testing.T) {
+	manifest, _ := readManifest("../test/resources/service.yml")
+	manifest.Beta = "beta4002"
+	cfg, err := serviceConfigFromManifest(manifest)
+	assert.Nil(t, err, "Should build the service config")
+	assert.Equal(t, "nginx-v1", cfg.ServiceID)
+	assert.Equal(t, []string{"80/tcp"}, cfg.Publish)
+	assert.Equal(t, []string{"NGINX_PORT=80"}, cfg.Envs)
+	assert.Equal(t, "/health", cfg.HealthCheckConfig.Path)
+	assert.Equal(t, "beta4002", cfg.Constraints["slave_name"])
+	assert.Equal(t, "beta4002", cfg.Labels["slave_name"])
+	assert.Equal(t, "UNIQUE", cfg.Constraints["hostname"])
+}
+
+func TestValidateServiceManifestOverrides(t *testing.T) {
+	manifest, err := readManifest("../test/resources/service.yml")
+	assert.Nil(t, err)
+	assert.Nil(t, validateServiceManifest(manifest))
+
+	manifest.Clusters["scl"] = configuration.ServiceOverride{Envs: []string{"NGINX_PORT"}}
+	assert.NotNil(t, validateServiceManifest(manifest), "Should throw error env without value")
+
+	manifest.Clusters["scl"] = configuration.ServiceOverride{Memory: -1}
+	assert.NotNil(t, validateServiceManifest(manifest), "Should throw error negative memory")
+}
+
+func TestValidateServiceManifestDeleteHooks(t *testing.T) {
+	manifest, err := readManifest("../test/resources/service.yml")
+	assert.Nil(t, err)
+	manifest.Hooks.PostDelete = []configuration.Hook{{URL: "http://hooks/deleted"}}
+	assert.NotNil(t, validateServiceManifest(manifest), "The delete hooks of the manifest never run")
+}
+
+func TestBuildServiceManifestVerifyFlags(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.String("file", "service.yml", "")
+	set.String("verify", "", "")
+	set.Int("verify-port", 0, "")
+	set.Int("verify-attempts", 0, "")
+	set.Parse([]string{"--verify=tcp", "--verify-port=80"})
+	ctx := cli.NewContext(nil, set, nil)
+
+	manifest, err := buildServiceManifest(ctx, func(string) (*configuration.ServiceManifest, error) {
+		return readManifest("../test/resources/service.yml")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, configuration.Verification{Type: "tcp", Port: 80, ExpectedStatus: []int{200}, Attempts: 5}, manifest.Verify,
+		"The flags set override the verification of the manifest")
+
+	manifest.Verify.Type = "ping"
+	assert.NotNil(t, validateServiceManifest(manifest), "Should throw error unknown verification")
+}
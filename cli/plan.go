@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// serviceConfigReport is the resolved service of a stack, with the secrets masked
+type serviceConfigReport struct {
+	Image                 string            `json:"image" yaml:"image"`
+	CPU                   float64           `json:"cpu" yaml:"cpu"`
+	Memory                int64             `json:"memory" yaml:"memory"`
+	Ports                 []string          `json:"ports" yaml:"ports"`
+	Envs                  []string          `json:"envs" yaml:"envs"`
+	Constraints           map[string]string `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+	Labels                map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	HealthCheck           string            `json:"health-check,omitempty" yaml:"health-check,omitempty"`
+	MinimumHealthCapacity float64           `json:"minimum-health-capacity" yaml:"minimum-health-capacity"`
+	MaximumOverCapacity   float64           `json:"maximum-over-capacity" yaml:"maximum-over-capacity"`
+}
+
+type stackPlanReport struct {
+	Action  string   `json:"action" yaml:"action"`
+	Changes []string `json:"changes,omitempty" yaml:"changes,omitempty"`
+	// ServiceID is set when the stack deploys another id, as the versions of a blue-green deploy
+	ServiceID        string               `json:"service-id,omitempty" yaml:"service-id,omitempty"`
+	Error            string               `json:"error,omitempty" yaml:"error,omitempty"`
+	CurrentImage     string               `json:"current-image,omitempty" yaml:"current-image,omitempty"`
+	CurrentInstances int                  `json:"current-instances" yaml:"current-instances"`
+	Instances        int                  `json:"instances,omitempty" yaml:"instances,omitempty"`
+	Config           *serviceConfigReport `json:"config,omitempty" yaml:"config,omitempty"`
+}
+
+// planReport shows what a deploy or delete would do, nothing is sent to the clusters
+type planReport struct {
+	DryRun    bool                        `json:"dry-run" yaml:"dry-run"`
+	Operation string                      `json:"operation" yaml:"operation"`
+	ServiceID string                      `json:"service-id" yaml:"service-id"`
+	Strategy  string                      `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	Waves     [][]string                  `json:"waves,omitempty" yaml:"waves,omitempty"`
+	Error     string                      `json:"error,omitempty" yaml:"error,omitempty"`
+	Stacks    map[string]*stackPlanReport `json:"stacks" yaml:"stacks"`
+}
+
+func newServiceConfigReport(config *framework.ServiceConfig) *serviceConfigReport {
+	report := &serviceConfigReport{
+		Image:                 config.ImageName + ":" + config.Tag,
+		CPU:                   config.CPUShares,
+		Memory:                config.Memory,
+		Ports:                 config.Publish,
+		Envs:                  util.MaskEnv(config.Envs),
+		Constraints:           config.Constraints,
+		Labels:                config.Labels,
+		MinimumHealthCapacity: config.MinimumHealthCapacity,
+		MaximumOverCapacity:   config.MaximumOverCapacity,
+	}
+	if report.Envs == nil {
+		report.Envs = make([]string, 0)
+	}
+	if config.HealthCheckConfig != nil {
+		report.HealthCheck = config.HealthCheckConfig.Path
+	}
+	return report
+}
+
+func newPlanReport(operation, serviceID string, plan *cluster.DeployPlan) *planReport {
+	report := &planReport{
+		DryRun:    true,
+		Operation: operation,
+		ServiceID: serviceID,
+		Strategy:  plan.Strategy,
+		Waves:     plan.Waves,
+		Error:     errorMessage(plan.Error),
+		Stacks:    make(map[string]*stackPlanReport),
+	}
+	for stackKey, stackPlan := range plan.Stacks {
+		stack := &stackPlanReport{
+			Action:    string(stackPlan.Action),
+			Changes:   stackPlan.Changes,
+			Error:     errorMessage(stackPlan.Error),
+			Instances: stackPlan.Instances,
+		}
+		if stackPlan.Current != nil {
+			stack.CurrentImage = stackPlan.Current.FullImageName()
+			stack.CurrentInstances = len(stackPlan.Current.Instances)
+		}
+		if stackPlan.Config != nil {
+			stack.Config = newServiceConfigReport(stackPlan.Config)
+			if stackPlan.Config.ServiceID != serviceID {
+				stack.ServiceID = stackPlan.Config.ServiceID
+			}
+		}
+		report.Stacks[stackKey] = stack
+	}
+	return report
+}
+
+func (r *planReport) writeTable(w io.Writer) {
+	fmt.Fprintf(w, "DRY-RUN\t%s %s, nothing is sent to the clusters\n", r.Operation, r.ServiceID)
+	if r.Strategy != "" {
+		var waves []string
+		for _, wave := range r.Waves {
+			waves = append(waves, "["+strings.Join(wave, ",")+"]")
+		}
+		fmt.Fprintf(w, "STRATEGY\t%s %s\n", r.Strategy, strings.Join(waves, " "))
+	}
+	if r.Error != "" {
+		fmt.Fprintf(w, "ERROR\t%s\n", r.Error)
+	}
+	fmt.Fprintln(w)
+
+	stackKeys := make([]string, 0, len(r.Stacks))
+	for stackKey := range r.Stacks {
+		stackKeys = append(stackKeys, stackKey)
+	}
+	sort.Strings(stackKeys)
+
+	fmt.Fprintln(w, "STACK\tACTION\tCURRENT\tINSTANCES")
+	for _, stackKey := range stackKeys {
+		stack := r.Stacks[stackKey]
+		if stack.Error != "" {
+			fmt.Fprintf(w, "%s\tERROR: %s\t\t\n", stackKey, stack.Error)
+			continue
+		}
+		current := "-"
+		if stack.CurrentImage != "" {
+			current = fmt.Sprintf("%s (%d)", stack.CurrentImage, stack.CurrentInstances)
+		}
+		instances := "-"
+		if stack.Config != nil {
+			instances = fmt.Sprintf("%d", stack.Instances)
+		}
+		action := stack.Action
+		if stack.ServiceID != "" {
+			action += " " + stack.ServiceID
+		}
+		if len(stack.Changes) != 0 {
+			action += " (" + strings.Join(stack.Changes, ", ") + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", stackKey, action, current, instances)
+	}
+
+	for _, stackKey := range stackKeys {
+		config := r.Stacks[stackKey].Config
+		if config == nil {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s\n", stackKey)
+		fmt.Fprintf(w, "  image\t%s\n", config.Image)
+		fmt.Fprintf(w, "  cpu\t%v\n", config.CPU)
+		fmt.Fprintf(w, "  memory\t%d\n", config.Memory)
+		fmt.Fprintf(w, "  ports\t%s\n", strings.Join(config.Ports, ","))
+		fmt.Fprintf(w, "  health-check\t%s\n", config.HealthCheck)
+		fmt.Fprintf(w, "  capacity\tminimum %.2f, maximum over %.2f\n", config.MinimumHealthCapacity, config.MaximumOverCapacity)
+		for _, env := range config.Envs {
+			fmt.Fprintf(w, "  env\t%s\n", env)
+		}
+		for _, key := range sortedKeys(config.Constraints) {
+			fmt.Fprintf(w, "  constraint\t%s=%s\n", key, config.Constraints[key])
+		}
+		for _, key := range sortedKeys(config.Labels) {
+			fmt.Fprintf(w, "  label\t%s=%s\n", key, config.Labels[key])
+		}
+	}
+}
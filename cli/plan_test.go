@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanReportMasksSecrets(t *testing.T) {
+	plan := &cluster.DeployPlan{
+		Strategy: cluster.StrategyParallel,
+		Waves:    [][]string{{"sjc"}},
+		Stacks: map[string]*cluster.StackPlan{
+			"sjc": {
+				Action:    cluster.PlanUpdate,
+				Changes:   []string{"image", "envs"},
+				Instances: 2,
+				Current:   &framework.ServiceInformation{ImageName: "nginx", ImageTag: "1.8"},
+				Config: &framework.ServiceConfig{
+					ImageName:         "nginx",
+					Tag:               "1.9",
+					Envs:              []string{"DB_PASSWORD=secret", "LEVEL=info"},
+					Constraints:       map[string]string{"slave_name": "beta4002"},
+					HealthCheckConfig: &framework.HealthCheck{Path: "/health"},
+				},
+			},
+		},
+	}
+	report := newPlanReport("deploy", "nginx", plan)
+	assert.Equal(t, []string{"DB_PASSWORD=*****", "LEVEL=info"}, report.Stacks["sjc"].Config.Envs)
+	assert.Equal(t, "nginx:1.8", report.Stacks["sjc"].CurrentImage)
+
+	var out bytes.Buffer
+	assert.Nil(t, printReport(&out, outputTable, report))
+	assert.NotContains(t, out.String(), "secret")
+	assert.Contains(t, out.String(), "slave_name=beta4002")
+	assert.Contains(t, out.String(), "update (image, envs)")
+}
+
+func TestDeployDryRun(t *testing.T) {
+	stackManager = createStackManagerMock()
+	set := createFlagSetWithMandatoryFlags()
+	set.Bool("dry-run", true, "")
+	set.String("output", "yaml", "")
+	ctx := cli.NewContext(nil, set, nil)
+	deployCmd(ctx)
+}
+
+func TestDeleteDryRun(t *testing.T) {
+	stackManager = createStackManagerMock()
+	set := flag.NewFlagSet("test", 0)
+	set.String("service-id", "nginx", "")
+	set.Bool("dry-run", true, "")
+	ctx := cli.NewContext(nil, set, nil)
+	deleteCmd(ctx)
+}
@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+)
+
+// validateOutput checks the value of the output flag, json is used when it is empty
+func validateOutput(output string) error {
+	switch output {
+	case "", outputJSON, outputYAML, outputTable:
+		return nil
+	}
+	return fmt.Errorf("Unknown output %s, it should be json, yaml or table", output)
+}
+
+// tableReport is implemented by the reports that can be printed as a table
+type tableReport interface {
+	writeTable(w io.Writer)
+}
+
+// printReport writes the report in the requested output format
+func printReport(w io.Writer, output string, report tableReport) error {
+	switch output {
+	case outputYAML:
+		out, err := yaml.Marshal(report)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		report.writeTable(tw)
+		return tw.Flush()
+	default:
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+}
+
+type portReport struct {
+	Internal int64   `json:"internal" yaml:"internal"`
+	Publics  []int64 `json:"publics,omitempty" yaml:"publics,omitempty"`
+	Type     string  `json:"type" yaml:"type"`
+	Address  string  `json:"address" yaml:"address"`
+}
+
+type instanceReport struct {
+	ID      string       `json:"id" yaml:"id"`
+	Host    string       `json:"host" yaml:"host"`
+	Ports   []portReport `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Healthy bool         `json:"healthy" yaml:"healthy"`
+}
+
+type stackReport struct {
+	Status     string           `json:"status" yaml:"status"`
+	Error      string           `json:"error,omitempty" yaml:"error,omitempty"`
+	Duration   float64          `json:"duration" yaml:"duration"`
+	Attempts   int              `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	RolledBack bool             `json:"rolled-back,omitempty" yaml:"rolled-back,omitempty"`
+	Instances  []instanceReport `json:"instances" yaml:"instances"`
+}
+
+// deployReport is the outcome of a deploy, with an entry for every stack. Durations are in seconds
+type deployReport struct {
+	ServiceID string                  `json:"service-id" yaml:"service-id"`
+	Image     string                  `json:"image,omitempty" yaml:"image,omitempty"`
+	Result    string                  `json:"result" yaml:"result"`
+	Error     string                  `json:"error,omitempty" yaml:"error,omitempty"`
+	Duration  float64                 `json:"duration" yaml:"duration"`
+	Stacks    map[string]*stackReport `json:"stacks" yaml:"stacks"`
+}
+
+func newDeployReport(serviceConfig framework.ServiceConfig, result *cluster.DeployResult) *deployReport {
+	report := &deployReport{
+		ServiceID: serviceConfig.ServiceID,
+		Result:    result.Status.String(),
+		Error:     errorMessage(result.Error),
+		Duration:  result.Duration.Seconds(),
+		Stacks:    make(map[string]*stackReport),
+	}
+	if serviceConfig.ImageName != "" {
+		report.Image = serviceConfig.ImageName + ":" + serviceConfig.Tag
+	}
+	for stackKey, stackResult := range result.Stacks {
+		report.Stacks[stackKey] = &stackReport{
+			Status:     stackResult.Status.String(),
+			Error:      errorMessage(stackResult.Error),
+			Duration:   stackResult.Duration.Seconds(),
+			Attempts:   stackResult.Attempts,
+			RolledBack: stackResult.RolledBack,
+			Instances:  instanceReports(stackResult.Service),
+		}
+	}
+	return report
+}
+
+func instanceReports(service *framework.ServiceInformation) []instanceReport {
+	instances := make([]instanceReport, 0)
+	if service == nil {
+		return instances
+	}
+	for _, instance := range service.Instances {
+		ports := make([]portReport, 0, len(instance.Ports))
+		for _, port := range instance.Ports {
+			ports = append(ports, portReport{
+				Internal: port.Internal,
+				Publics:  port.Publics,
+				Type:     string(port.Type),
+				Address:  instance.Host + ":" + strconv.FormatInt(port.Internal, 10),
+			})
+		}
+		sort.Sort(byInternalPort(ports))
+		instances = append(instances, instanceReport{
+			ID:      instance.ID,
+			Host:    instance.Host,
+			Ports:   ports,
+			Healthy: instance.Healthy(),
+		})
+	}
+	return instances
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func (r *deployReport) stackKeys() []string {
+	keys := make([]string, 0, len(r.Stacks))
+	for stackKey := range r.Stacks {
+		keys = append(keys, stackKey)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *deployReport) writeTable(w io.Writer) {
+	fmt.Fprintf(w, "SERVICE\t%s\n", r.ServiceID)
+	if r.Image != "" {
+		fmt.Fprintf(w, "IMAGE\t%s\n", r.Image)
+	}
+	fmt.Fprintf(w, "RESULT\t%s\n", r.Result)
+	if r.Error != "" {
+		fmt.Fprintf(w, "ERROR\t%s\n", r.Error)
+	}
+	fmt.Fprintf(w, "DURATION\t%.1fs\n", r.Duration)
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "STACK\tSTATUS\tDURATION\tATTEMPTS\tINSTANCES\tHEALTHY\tADDRESSES\tERROR")
+	for _, stackKey := range r.stackKeys() {
+		stack := r.Stacks[stackKey]
+		healthy := 0
+		var addresses []string
+		for _, instance := range stack.Instances {
+			if instance.Healthy {
+				healthy++
+			}
+			for _, port := range instance.Ports {
+				addresses = append(addresses, port.Address)
+			}
+		}
+		message := stack.Error
+		if stack.RolledBack {
+			message = strings.TrimSpace(message + " (rolled back)")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1fs\t%d\t%d\t%d\t%s\t%s\n", stackKey, stack.Status, stack.Duration, stack.Attempts,
+			len(stack.Instances), healthy, strings.Join(addresses, ","), message)
+	}
+}
+
+type byInternalPort []portReport
+
+func (p byInternalPort) Len() int           { return len(p) }
+func (p byInternalPort) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byInternalPort) Less(i, j int) bool { return p[i].Internal < p[j].Internal }
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDeployReport() *deployReport {
+	result := &cluster.DeployResult{
+		Status:   cluster.STACK_FAILED,
+		Duration: 3 * time.Second,
+		Stacks: map[string]*cluster.StackResult{
+			"sjc": {
+				Status: cluster.STACK_READY,
+				Service: &framework.ServiceInformation{ID: "nginx", Instances: []*framework.Instance{{
+					ID:     "nginx.1",
+					Host:   "10.0.0.1",
+					Status: framework.InstanceUp,
+					Ports:  map[string]framework.InstancePort{"8080/tcp": {Internal: 8080, Publics: []int64{31000}, Type: framework.TCP}},
+				}}},
+				Duration:   2 * time.Second,
+				RolledBack: true,
+			},
+			"scl": {Status: cluster.STACK_FAILED, Error: errors.New("Connection refused")},
+		},
+	}
+	return newDeployReport(framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9"}, result)
+}
+
+func TestNewDeployReport(t *testing.T) {
+	report := newTestDeployReport()
+	assert.Equal(t, "nginx:1.9", report.Image)
+	assert.Equal(t, "STACK_FAILED", report.Result)
+	assert.Equal(t, 2.0, report.Stacks["sjc"].Duration)
+	assert.Equal(t, "10.0.0.1:8080", report.Stacks["sjc"].Instances[0].Ports[0].Address)
+	assert.True(t, report.Stacks["sjc"].Instances[0].Healthy)
+	assert.Equal(t, "Connection refused", report.Stacks["scl"].Error)
+	assert.Empty(t, report.Stacks["scl"].Instances, "A stack without service has no instances")
+}
+
+func TestPrintReportJSON(t *testing.T) {
+	var out bytes.Buffer
+	assert.Nil(t, printReport(&out, outputJSON, newTestDeployReport()))
+
+	var report map[string]interface{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &report), "Should print valid json")
+	assert.Equal(t, "nginx", report["service-id"])
+	assert.Contains(t, report["stacks"], "scl")
+}
+
+func TestPrintReportYAMLAndTable(t *testing.T) {
+	var out bytes.Buffer
+	assert.Nil(t, printReport(&out, outputYAML, newTestDeployReport()))
+	assert.Contains(t, out.String(), "service-id: nginx")
+
+	out.Reset()
+	assert.Nil(t, printReport(&out, outputTable, newTestDeployReport()))
+	assert.Contains(t, out.String(), "10.0.0.1:8080")
+	assert.Contains(t, out.String(), "(rolled back)")
+}
+
+func TestValidateOutput(t *testing.T) {
+	assert.Nil(t, validateOutput("table"))
+	assert.NotNil(t, validateOutput("xml"), "Should reject an unknown output")
+}
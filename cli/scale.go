@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+func scaleFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "service-id",
+			Usage: "Id of the service",
+		},
+		cli.StringFlag{
+			Name:  "instances",
+			Usage: "Instances of the service on every cluster, or on each cluster, ie --instances=3, --instances=sjc=3,scl=5, --instances=2,sjc=4",
+		},
+		cli.Float64Flag{
+			Name:  "tolerance",
+			Value: defaultTolerance,
+			Usage: "Fraction of the instances that can be unhealthy on each cluster after scaling",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: outputJSON,
+			Usage: "Format of the scale report: json, yaml or table",
+		},
+	}
+}
+
+// parseInstances reads the instances flag. The number without a cluster is used on the clusters
+// without their own count, it is negative when there is none so those clusters are not scaled
+func parseInstances(spec string) (cluster.ScaleOptions, error) {
+	options := cluster.ScaleOptions{Instances: -1, StackInstances: make(map[string]int)}
+	if strings.TrimSpace(spec) == "" {
+		return options, errors.New("Instances is empty")
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		stackKey, value := "", item
+		if strings.Contains(item, "=") {
+			keyVal := strings.SplitN(item, "=", 2)
+			stackKey, value = strings.TrimSpace(keyVal[0]), strings.TrimSpace(keyVal[1])
+			if stackKey == "" {
+				return options, fmt.Errorf("The cluster of %s is empty", item)
+			}
+		}
+
+		instances, err := strconv.Atoi(value)
+		if err != nil || instances < 0 {
+			return options, fmt.Errorf("Invalid instances %s, it should be a number not negative", item)
+		}
+
+		if stackKey == "" {
+			if options.Instances >= 0 {
+				return options, errors.New("Instances has more than one number without cluster")
+			}
+			options.Instances = instances
+		} else {
+			if _, ok := options.StackInstances[stackKey]; ok {
+				return options, fmt.Errorf("Instances of cluster %s are repeated", stackKey)
+			}
+			options.StackInstances[stackKey] = instances
+		}
+	}
+	return options, nil
+}
+
+func scaleBefore(c *cli.Context) error {
+	if c.String("service-id") == "" {
+		return errors.New("Service-id is empty")
+	}
+	if _, err := parseInstances(c.String("instances")); err != nil {
+		return err
+	}
+	if c.Float64("tolerance") < 0.0 || c.Float64("tolerance") > 1.0 {
+		return errors.New("Tolerance value should be between 0.0 and 1.0")
+	}
+	return validateOutput(c.String("output"))
+}
+
+func scaleCmd(c *cli.Context) {
+	options, err := parseInstances(c.String("instances"))
+	if err != nil {
+		util.Log.Fatalln("Error reading the instances", err)
+	}
+	options.Tolerance = c.Float64("tolerance")
+
+	serviceID := c.String("service-id")
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	result := stackManager.Scale(ctx, serviceID, options)
+	recordHistory("scale", serviceID, nil, result)
+	if err := printReport(os.Stdout, c.String("output"), newDeployReport(framework.ServiceConfig{ServiceID: serviceID}, result)); err != nil {
+		util.Log.Errorln("Error printing the scale report", err)
+	}
+	exitOnResult(result, "Scale-Process")
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInstances(t *testing.T) {
+	options, err := parseInstances("3")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, options.Instances)
+	assert.Empty(t, options.StackInstances)
+
+	options, err = parseInstances("sjc=3, scl=5")
+	assert.Nil(t, err)
+	assert.True(t, options.Instances < 0, "The clusters without count should not be scaled")
+	assert.Equal(t, map[string]int{"sjc": 3, "scl": 5}, options.StackInstances)
+
+	options, err = parseInstances("2,sjc=0")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, options.Instances)
+	assert.Equal(t, 0, options.StackInstances["sjc"], "Should scale a cluster to zero")
+
+	for _, spec := range []string{"", "x", "-1", "sjc=", "=3", "1,2", "sjc=1,sjc=2"} {
+		_, err = parseInstances(spec)
+		assert.NotNil(t, err, "Should reject %q", spec)
+	}
+}
+
+func TestScaleBefore(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.String("service-id", "", "")
+	set.String("instances", "3", "")
+	set.Float64("tolerance", 0.5, "")
+	ctx := cli.NewContext(nil, set, nil)
+	assert.NotNil(t, scaleBefore(ctx), "Should throw error service-id empty")
+
+	set.Set("service-id", "nginx")
+	assert.Nil(t, scaleBefore(ctx), "Should not require image and tag")
+
+	set.Set("instances", "sjc")
+	assert.NotNil(t, scaleBefore(ctx), "Should throw error invalid instances")
+}
+
+func TestScaleCmd(t *testing.T) {
+	stackManager = createStackManagerMock()
+	status := 0
+	exit = func(code int) { status = code }
+	defer func() { exit = os.Exit }()
+
+	set := flag.NewFlagSet("test", 0)
+	set.String("service-id", "nginx", "")
+	set.String("instances", "sjc=3", "")
+	ctx := cli.NewContext(nil, set, nil)
+	scaleCmd(ctx)
+	assert.Equal(t, 0, status)
+}
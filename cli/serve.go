@@ -0,0 +1,520 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/crane/history"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+const (
+	apiPrefix = "/v1"
+
+	// maxOperations is the number of finished operations kept by the server, the oldest are
+	// forgotten first
+	maxOperations = 500
+)
+
+// Status of the operations of the server
+const (
+	operationQueued    = "queued"
+	operationRunning   = "running"
+	operationSucceeded = "succeeded"
+	operationFailed    = "failed"
+)
+
+func serveFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "listen",
+			Value: "127.0.0.1:8080",
+			Usage: "Address where the API listens, the API has no authentication, ie --listen=:8080",
+		},
+		cli.StringFlag{
+			Name:  "backup-dir",
+			Value: "crane-backups",
+			Usage: "Directory where the definition of the service on each cluster is saved before deleting it",
+		},
+	}
+}
+
+// operation is a deploy or delete run by the server in the background. Result is set when it
+// finishes
+type operation struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"`
+	ServiceID string        `json:"service-id"`
+	Status    string        `json:"status"`
+	Created   time.Time     `json:"created"`
+	Started   *time.Time    `json:"started,omitempty"`
+	Finished  *time.Time    `json:"finished,omitempty"`
+	Result    *deployReport `json:"result,omitempty"`
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	// rollback is set when the operation was cancelled by a cancel request, the deployed clusters
+	// are rolled back
+	rollback bool
+}
+
+func (o *operation) finished() bool {
+	return o.Status == operationSucceeded || o.Status == operationFailed
+}
+
+// apiServer exposes the operations of the stack manager as a REST API. Deploys and deletes run in
+// the background as operations, and the operations of the same service run one after the other
+type apiServer struct {
+	manager   cluster.CraneManager
+	backupDir string
+
+	mutex      sync.Mutex
+	operations map[string]*operation
+	order      []string
+	services   map[string]*sync.Mutex
+	running    sync.WaitGroup
+}
+
+func newAPIServer(manager cluster.CraneManager, backupDir string) *apiServer {
+	return &apiServer{
+		manager:    manager,
+		backupDir:  backupDir,
+		operations: make(map[string]*operation),
+		services:   make(map[string]*sync.Mutex),
+	}
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiPrefix+"/deploy", s.deploy)
+	mux.HandleFunc(apiPrefix+"/services", s.find)
+	mux.HandleFunc(apiPrefix+"/services/", s.service)
+	mux.HandleFunc(apiPrefix+"/operations", s.listOperations)
+	mux.HandleFunc(apiPrefix+"/operations/", s.getOperation)
+	return mux
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		util.Log.Errorf("Error writing the response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+// allowMethod answers 405 when the request does not use the method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return false
+	}
+	return true
+}
+
+// serviceLock returns the lock that serializes the operations of the service
+func (s *apiServer) serviceLock(serviceID string) *sync.Mutex {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := strings.TrimPrefix(serviceID, "/")
+	if _, ok := s.services[key]; !ok {
+		s.services[key] = new(sync.Mutex)
+	}
+	return s.services[key]
+}
+
+func newOperationID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id)
+}
+
+// start queues the operation. It runs once the previous operations of the service finish, unless
+// it is cancelled before. The timeout of crane limits every operation from the moment it starts,
+// the time waiting in the queue does not count
+func (s *apiServer) start(operationType, serviceID string, run func(ctx context.Context, op *operation) *deployReport) *operation {
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &operation{
+		ID:        newOperationID(),
+		Type:      operationType,
+		ServiceID: serviceID,
+		Status:    operationQueued,
+		Created:   time.Now().UTC(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	s.mutex.Lock()
+	s.operations[op.ID] = op
+	s.order = append(s.order, op.ID)
+	s.forgetOperations()
+	s.mutex.Unlock()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		defer close(op.done)
+		defer cancel()
+
+		lock := s.serviceLock(serviceID)
+		lock.Lock()
+		defer lock.Unlock()
+
+		var report *deployReport
+		if ctx.Err() != nil {
+			report = &deployReport{
+				ServiceID: serviceID,
+				Result:    cluster.STACK_FAILED.String(),
+				Error:     fmt.Sprintf("The %s was cancelled before it started", operationType),
+				Stacks:    make(map[string]*stackReport),
+			}
+			if s.rollbackRequested(op) {
+				recordRollback(serviceID, &cluster.DeployResult{Status: cluster.STACK_FAILED, Stacks: make(map[string]*cluster.StackResult)}, true)
+			}
+		} else {
+			now := time.Now().UTC()
+			s.mutex.Lock()
+			op.Status = operationRunning
+			op.Started = &now
+			s.mutex.Unlock()
+			util.Log.Infof("Operation %s: %s of %s", op.ID, operationType, serviceID)
+			runCtx := ctx
+			if timeout > 0 {
+				var stop context.CancelFunc
+				runCtx, stop = context.WithTimeout(ctx, timeout)
+				defer stop()
+			}
+			report = run(runCtx, op)
+		}
+
+		now := time.Now().UTC()
+		s.mutex.Lock()
+		op.Result = report
+		op.Finished = &now
+		op.Status = operationFailed
+		if report.Result == cluster.STACK_READY.String() || report.Result == cluster.STACK_DEGRADED.String() {
+			op.Status = operationSucceeded
+		}
+		s.mutex.Unlock()
+		util.Log.Infof("Operation %s %s: %s", op.ID, op.Status, report.Result)
+	}()
+	return op
+}
+
+// forgetOperations drops the oldest finished operations over maxOperations
+func (s *apiServer) forgetOperations() {
+	excess := len(s.order) - maxOperations
+	kept := s.order[:0]
+	for _, id := range s.order {
+		if excess > 0 && s.operations[id].finished() {
+			delete(s.operations, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.order = kept
+}
+
+// snapshot copies the operation, so it can be encoded while it runs
+func (s *apiServer) snapshot(op *operation) operation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return *op
+}
+
+// deploy starts the deploy of the manifest of the body. The strategy, canary, soak-time and
+// keep-old query parameters replace the deploy policy as the flags of the deploy command
+func (s *apiServer) deploy(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	// The values missing in the body keep the defaults of the deploy flags
+	manifest := newServiceManifest()
+	if err := json.NewDecoder(r.Body).Decode(manifest); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid manifest: %s", err))
+		return
+	}
+	if len(manifest.EnvFiles) != 0 {
+		writeError(w, http.StatusBadRequest, errors.New("The env-files of the manifest are not supported by the API, use envs"))
+		return
+	}
+	for _, event := range []string{configuration.PreDeploy, configuration.PostStackSuccess, configuration.PostStackFailure, configuration.PostDeploy} {
+		for _, hook := range manifest.Hooks.For(event) {
+			if hook.Command != "" {
+				writeError(w, http.StatusBadRequest, errors.New("The command hooks of the manifest are not supported by the API, use webhooks or configure them in crane.yml"))
+				return
+			}
+		}
+	}
+	if err := validateServiceManifest(manifest); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	query := r.URL.Query()
+	policy := configuration.DeployPolicy{Strategy: query.Get("strategy"), Canary: query.Get("canary")}
+	switch policy.Strategy {
+	case "", cluster.StrategyParallel, cluster.StrategySequential, cluster.StrategyCanary, cluster.StrategyBlueGreen:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Unknown strategy %s", policy.Strategy))
+		return
+	}
+	if soakTime := query.Get("soak-time"); soakTime != "" {
+		var err error
+		if policy.SoakTime, err = strconv.Atoi(soakTime); err != nil || policy.SoakTime < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("Soak-time should be a positive number of seconds"))
+			return
+		}
+	}
+	if keepOld := query.Get("keep-old"); keepOld != "" {
+		var err error
+		if policy.KeepOld, err = strconv.Atoi(keepOld); err != nil || policy.KeepOld < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("Keep-old should be a positive number of seconds"))
+			return
+		}
+	}
+
+	serviceConfig, err := serviceConfigFromManifest(manifest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	options := cluster.DeployOptions{
+		Instances: manifest.Instances,
+		Tolerance: manifest.Tolerance,
+		Overrides: manifest.Clusters,
+		Policy:    policy,
+		Hooks:     manifest.Hooks,
+		Verify:    manifest.Verify,
+	}
+
+	op := s.start("deploy", serviceConfig.ServiceID, func(ctx context.Context, op *operation) *deployReport {
+		result := s.manager.Deploy(ctx, serviceConfig, options)
+		recordHistory("deploy", serviceConfig.ServiceID, &serviceConfig, result)
+		recordRollback(serviceConfig.ServiceID, result, s.rollbackRequested(op))
+		return newDeployReport(serviceConfig, result)
+	})
+	writeJSON(w, http.StatusAccepted, s.snapshot(op))
+}
+
+// serviceReport describes a service found on a cluster
+type serviceReport struct {
+	ID        string           `json:"id"`
+	Image     string           `json:"image"`
+	Version   string           `json:"version,omitempty"`
+	Instances []instanceReport `json:"instances"`
+}
+
+// find lists the services that contain the search query parameter
+func (s *apiServer) find(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	search := r.URL.Query().Get("search")
+	if search == "" {
+		writeError(w, http.StatusBadRequest, errors.New("The search query parameter is empty"))
+		return
+	}
+	services := make([]serviceReport, 0)
+	for _, service := range s.manager.FindServiceInformation(r.Context(), search) {
+		services = append(services, serviceReport{
+			ID:        service.ID,
+			Image:     service.FullImageName(),
+			Version:   service.Version,
+			Instances: instanceReports(service),
+		})
+	}
+	writeJSON(w, http.StatusOK, services)
+}
+
+// service routes the requests on a service, its id can contain slashes:
+//
+//	GET    /v1/services/{id}/status    status of the service on every cluster
+//	POST   /v1/services/{id}/rollback  rolls the service back to the version before its last deploy
+//	POST   /v1/services/{id}/cancel    stops the running deploy of the service and rolls it back
+//	DELETE /v1/services/{id}           deletes the service on every cluster
+func (s *apiServer) service(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix+"/services/"), "/")
+	switch {
+	case path == "":
+		writeError(w, http.StatusNotFound, errors.New("The service id is empty"))
+	case strings.HasSuffix(path, "/status"):
+		if allowMethod(w, r, http.MethodGet) {
+			s.status(w, r, strings.TrimSuffix(path, "/status"))
+		}
+	case strings.HasSuffix(path, "/rollback"):
+		if allowMethod(w, r, http.MethodPost) {
+			s.rollback(w, strings.TrimSuffix(path, "/rollback"))
+		}
+	case strings.HasSuffix(path, "/cancel"):
+		if allowMethod(w, r, http.MethodPost) {
+			s.cancel(w, strings.TrimSuffix(path, "/cancel"))
+		}
+	default:
+		if allowMethod(w, r, http.MethodDelete) {
+			s.delete(w, path)
+		}
+	}
+}
+
+func (s *apiServer) status(w http.ResponseWriter, r *http.Request, serviceID string) {
+	writeJSON(w, http.StatusOK, newStatusReport(serviceID, s.manager.ServiceStatus(r.Context(), serviceID)))
+}
+
+func (s *apiServer) delete(w http.ResponseWriter, serviceID string) {
+	op := s.start("delete", serviceID, func(ctx context.Context, op *operation) *deployReport {
+		result := s.manager.DeleteService(ctx, serviceID, newBackupWriter(s.backupDir, time.Now()))
+		recordHistory("delete", serviceID, nil, result)
+		return newDeployReport(framework.ServiceConfig{ServiceID: serviceID}, result)
+	})
+	writeJSON(w, http.StatusAccepted, s.snapshot(op))
+}
+
+// rollback starts the rollback of the service to the version each cluster ran before the last
+// deploy recorded in the history. It runs after the operations of the service already queued
+func (s *apiServer) rollback(w http.ResponseWriter, serviceID string) {
+	op := s.start(history.RollbackCommand, serviceID, func(ctx context.Context, op *operation) *deployReport {
+		snapshots, err := previousSnapshots(serviceID)
+		if err != nil {
+			result := &cluster.DeployResult{Status: cluster.STACK_FAILED, Stacks: make(map[string]*cluster.StackResult), Error: err}
+			recordRollback(serviceID, result, true)
+			return newDeployReport(framework.ServiceConfig{ServiceID: serviceID}, result)
+		}
+		result := s.manager.Rollback(ctx, serviceID, snapshots)
+		recordRollback(serviceID, result, true)
+		return newDeployReport(framework.ServiceConfig{ServiceID: serviceID}, result)
+	})
+	writeJSON(w, http.StatusAccepted, s.snapshot(op))
+}
+
+// cancel cancels the deploys of the service that did not finish. The running deploy restores
+// the clusters already deployed, as an interrupted deploy of the deploy command. The outcome of
+// the rollback is the result of the cancelled operations
+func (s *apiServer) cancel(w http.ResponseWriter, serviceID string) {
+	s.mutex.Lock()
+	var cancelled []*operation
+	for _, id := range s.order {
+		op := s.operations[id]
+		if op.Type == "deploy" && !op.finished() && strings.TrimPrefix(op.ServiceID, "/") == strings.TrimPrefix(serviceID, "/") {
+			op.rollback = true
+			op.cancel()
+			cancelled = append(cancelled, op)
+		}
+	}
+	s.mutex.Unlock()
+
+	if len(cancelled) == 0 {
+		writeError(w, http.StatusConflict, fmt.Errorf("There is no running deploy of %s to cancel", serviceID))
+		return
+	}
+	ops := make([]operation, 0, len(cancelled))
+	for _, op := range cancelled {
+		ops = append(ops, s.snapshot(op))
+	}
+	writeJSON(w, http.StatusAccepted, ops)
+}
+
+// rollbackRequested reports if a cancel request cancelled the operation
+func (s *apiServer) rollbackRequested(op *operation) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return op.rollback
+}
+
+// listOperations returns the operations, the newest first. The service-id query parameter
+// selects the operations of a service
+func (s *apiServer) listOperations(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	serviceID := strings.TrimPrefix(r.URL.Query().Get("service-id"), "/")
+	s.mutex.Lock()
+	ops := make([]operation, 0, len(s.order))
+	for _, id := range s.order {
+		op := s.operations[id]
+		if serviceID == "" || strings.TrimPrefix(op.ServiceID, "/") == serviceID {
+			ops = append(ops, *op)
+		}
+	}
+	s.mutex.Unlock()
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Created.After(ops[j].Created) })
+	writeJSON(w, http.StatusOK, ops)
+}
+
+func (s *apiServer) getOperation(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix+"/operations/"), "/")
+	s.mutex.Lock()
+	op, ok := s.operations[id]
+	s.mutex.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("The operation %s does not exist", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.snapshot(op))
+}
+
+// shutdown cancels the operations that did not finish, so the running deploys are rolled back,
+// and waits for them
+func (s *apiServer) shutdown() {
+	s.mutex.Lock()
+	for _, op := range s.operations {
+		if !op.finished() {
+			op.cancel()
+		}
+	}
+	s.mutex.Unlock()
+	s.running.Wait()
+}
+
+func serveCmd(c *cli.Context) {
+	api := newAPIServer(stackManager, c.String("backup-dir"))
+	server := &http.Server{Addr: c.String("listen"), Handler: api.handler()}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		<-signals
+		util.Log.Infoln("Stopping the API, the running operations are cancelled")
+		server.Shutdown(context.Background())
+		api.shutdown()
+		close(stopped)
+	}()
+
+	util.Log.Infof("Serving the API on %s%s", server.Addr, apiPrefix)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		util.Log.Fatalln("Error serving the API", err)
+	}
+	<-stopped
+}
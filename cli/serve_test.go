@@ -0,0 +1,307 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/history"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingManager deploys until the deploy is released or cancelled, a cancelled deploy is
+// rolled back. It records the most deploys running at the same time
+type blockingManager struct {
+	StackManagerMock
+	release chan struct{}
+	mutex   sync.Mutex
+	running int
+	maxRun  int
+}
+
+func (m *blockingManager) Deploy(ctx context.Context, serviceConfig framework.ServiceConfig, options cluster.DeployOptions) *cluster.DeployResult {
+	m.mutex.Lock()
+	m.running++
+	if m.running > m.maxRun {
+		m.maxRun = m.running
+	}
+	m.mutex.Unlock()
+	defer func() {
+		m.mutex.Lock()
+		m.running--
+		m.mutex.Unlock()
+	}()
+
+	select {
+	case <-m.release:
+		return m.StackManagerMock.Deploy(ctx, serviceConfig, options)
+	case <-ctx.Done():
+		return &cluster.DeployResult{
+			Status: cluster.STACK_FAILED,
+			Error:  ctx.Err(),
+			Stacks: map[string]*cluster.StackResult{"local": {Status: cluster.STACK_FAILED, RolledBack: true}},
+		}
+	}
+}
+
+const manifestBody = `{"service-id": "nginx", "image": "nginx", "tag": "1.9", "instances": 1}`
+
+func doRequest(t *testing.T, server *httptest.Server, method, path, body string, out interface{}) int {
+	req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.Nil(t, err) {
+		return 0
+	}
+	defer resp.Body.Close()
+	content, _ := ioutil.ReadAll(resp.Body)
+	if out != nil {
+		assert.Nil(t, json.Unmarshal(content, out), string(content))
+	}
+	return resp.StatusCode
+}
+
+func waitOperation(t *testing.T, server *httptest.Server, id string) *operation {
+	for i := 0; i < 100; i++ {
+		op := new(operation)
+		doRequest(t, server, http.MethodGet, "/v1/operations/"+id, "", op)
+		if op.finished() {
+			return op
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("The operation %s did not finish", id)
+	return nil
+}
+
+func newTestAPI(t *testing.T, manager cluster.CraneManager) (*httptest.Server, func()) {
+	dir, _ := ioutil.TempDir("", "serve")
+	server := httptest.NewServer(newAPIServer(manager, dir).handler())
+	return server, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestServeDeploy(t *testing.T) {
+	server, cleanup := newTestAPI(t, createStackManagerMock())
+	defer cleanup()
+
+	op := new(operation)
+	assert.Equal(t, http.StatusAccepted, doRequest(t, server, http.MethodPost, "/v1/deploy?strategy=sequential", manifestBody, op))
+	assert.NotEmpty(t, op.ID)
+	assert.Equal(t, "deploy", op.Type)
+	assert.Equal(t, "nginx", op.ServiceID)
+
+	op = waitOperation(t, server, op.ID)
+	assert.Equal(t, operationSucceeded, op.Status)
+	assert.Equal(t, "nginx:1.9", op.Result.Image)
+	assert.Equal(t, "STACK_READY", op.Result.Stacks["local"].Status)
+	assert.NotNil(t, op.Finished)
+
+	var ops []operation
+	assert.Equal(t, http.StatusOK, doRequest(t, server, http.MethodGet, "/v1/operations?service-id=/nginx", "", &ops))
+	assert.Len(t, ops, 1)
+}
+
+// recordingManager keeps the last deploy
+type recordingManager struct {
+	StackManagerMock
+	mutex   sync.Mutex
+	config  framework.ServiceConfig
+	options cluster.DeployOptions
+}
+
+func (m *recordingManager) Deploy(ctx context.Context, serviceConfig framework.ServiceConfig, options cluster.DeployOptions) *cluster.DeployResult {
+	m.mutex.Lock()
+	m.config, m.options = serviceConfig, options
+	m.mutex.Unlock()
+	return m.StackManagerMock.Deploy(ctx, serviceConfig, options)
+}
+
+func TestServeDeployDefaults(t *testing.T) {
+	manager := new(recordingManager)
+	server, cleanup := newTestAPI(t, manager)
+	defer cleanup()
+
+	op := new(operation)
+	assert.Equal(t, http.StatusAccepted, doRequest(t, server, http.MethodPost, "/v1/deploy", `{"service-id": "nginx", "image": "nginx", "tag": "1.9"}`, op))
+	assert.Equal(t, operationSucceeded, waitOperation(t, server, op.ID).Status)
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	assert.Equal(t, defaultInstances, manager.options.Instances, "The instances missing in the body keep the default of the flag")
+	assert.Equal(t, defaultTolerance, manager.options.Tolerance)
+	assert.Equal(t, defaultMinimumHealthCapacity, manager.config.MinimumHealthCapacity)
+	assert.Equal(t, defaultMaximumOverCapacity, manager.config.MaximumOverCapacity)
+}
+
+func TestServeDeployInvalid(t *testing.T) {
+	server, cleanup := newTestAPI(t, createStackManagerMock())
+	defer cleanup()
+
+	var apiErr apiError
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, server, http.MethodPost, "/v1/deploy", `{"service-id": "nginx"}`, &apiErr))
+	assert.Equal(t, "The name of the image is empty", apiErr.Error)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, server, http.MethodPost, "/v1/deploy", "{broken", nil))
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, server, http.MethodPost, "/v1/deploy?strategy=random", manifestBody, nil))
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, server, http.MethodPost, "/v1/deploy",
+		`{"service-id": "nginx", "image": "nginx", "tag": "1.9", "env-files": ["/etc/passwd"]}`, nil))
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, server, http.MethodPost, "/v1/deploy",
+		`{"service-id": "nginx", "image": "nginx", "tag": "1.9", "hooks": {"pre-deploy": [{"command": "rm -rf /"}]}}`, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, doRequest(t, server, http.MethodGet, "/v1/deploy", "", nil))
+}
+
+func TestServeDeploysOfAServiceAreSerialized(t *testing.T) {
+	manager := &blockingManager{release: make(chan struct{})}
+	server, cleanup := newTestAPI(t, manager)
+	defer cleanup()
+
+	first, second, other := new(operation), new(operation), new(operation)
+	doRequest(t, server, http.MethodPost, "/v1/deploy", manifestBody, first)
+	doRequest(t, server, http.MethodPost, "/v1/deploy", manifestBody, second)
+	doRequest(t, server, http.MethodPost, "/v1/deploy", `{"service-id": "redis", "image": "redis", "tag": "3"}`, other)
+
+	time.Sleep(100 * time.Millisecond)
+	queued := new(operation)
+	doRequest(t, server, http.MethodGet, "/v1/operations/"+second.ID, "", queued)
+	assert.Equal(t, operationQueued, queued.Status, "The second deploy of nginx waits for the first")
+
+	close(manager.release)
+	for _, op := range []*operation{first, second, other} {
+		assert.Equal(t, operationSucceeded, waitOperation(t, server, op.ID).Status)
+	}
+	assert.Equal(t, 2, manager.maxRun, "Only the deploys of different services run at the same time")
+}
+
+func TestServeTimeoutStartsWithTheOperation(t *testing.T) {
+	defer func() { timeout = 0 }()
+	timeout = 300 * time.Millisecond
+	manager := &blockingManager{release: make(chan struct{})}
+	server, cleanup := newTestAPI(t, manager)
+	defer cleanup()
+
+	first, second := new(operation), new(operation)
+	doRequest(t, server, http.MethodPost, "/v1/deploy", manifestBody, first)
+	doRequest(t, server, http.MethodPost, "/v1/deploy", manifestBody, second)
+	assert.Equal(t, operationFailed, waitOperation(t, server, first.ID).Status, "The first deploy times out")
+
+	second = waitOperation(t, server, second.ID)
+	assert.NotNil(t, second.Started, "The queued deploy should start after the first one, its timeout had not expired")
+	assert.True(t, second.Finished.Sub(*second.Started) >= timeout, "The timeout should count from the start of the deploy")
+}
+
+func TestServeCancel(t *testing.T) {
+	manager := &blockingManager{release: make(chan struct{})}
+	server, cleanup := newTestAPI(t, manager)
+	defer cleanup()
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+	defer func(store *history.Store) { historyStore = store }(historyStore)
+	historyStore = &history.Store{Path: filepath.Join(dir, "history.jsonl")}
+
+	assert.Equal(t, http.StatusConflict, doRequest(t, server, http.MethodPost, "/v1/services/nginx/cancel", "", nil))
+
+	op := new(operation)
+	doRequest(t, server, http.MethodPost, "/v1/deploy", manifestBody, op)
+	var cancelled []operation
+	assert.Equal(t, http.StatusAccepted, doRequest(t, server, http.MethodPost, "/v1/services/nginx/cancel", "", &cancelled))
+	assert.Len(t, cancelled, 1)
+	assert.Equal(t, op.ID, cancelled[0].ID)
+
+	op = waitOperation(t, server, op.ID)
+	assert.Equal(t, operationFailed, op.Status)
+	assert.True(t, op.Result.Stacks["local"].RolledBack)
+
+	entries, err := historyStore.Query(history.Filter{ServiceID: "nginx"})
+	assert.Nil(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "deploy", entries[0].Command)
+		assert.Equal(t, history.RollbackCommand, entries[1].Command, "The rollback is recorded after the deploy")
+		assert.True(t, entries[1].Stacks["local"].RolledBack)
+	}
+}
+
+// rollbackManager records the snapshots of the rollback
+type rollbackManager struct {
+	StackManagerMock
+	snapshots map[string]*cluster.ServiceSnapshot
+}
+
+func (m *rollbackManager) Rollback(ctx context.Context, serviceId string, snapshots map[string]*cluster.ServiceSnapshot) *cluster.DeployResult {
+	m.snapshots = snapshots
+	return m.StackManagerMock.Rollback(ctx, serviceId, snapshots)
+}
+
+func TestServeRollback(t *testing.T) {
+	manager := &rollbackManager{}
+	server, cleanup := newTestAPI(t, manager)
+	defer cleanup()
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+	defer func(store *history.Store) { historyStore = store }(historyStore)
+	historyStore = &history.Store{Path: filepath.Join(dir, "history.jsonl")}
+
+	op := new(operation)
+	doRequest(t, server, http.MethodPost, "/v1/services/nginx/rollback", "", op)
+	op = waitOperation(t, server, op.ID)
+	assert.Equal(t, operationFailed, op.Status, "The history has no previous deploy")
+	assert.Contains(t, op.Result.Error, "no deploy of nginx before the last one")
+
+	for _, tag := range []string{"1.8", "1.9"} {
+		historyStore.Append(&history.Entry{Command: "deploy", ServiceID: "nginx", Result: "STACK_READY", Stacks: map[string]*history.StackEntry{
+			"local": {Status: "STACK_READY", Image: "registry:5000/nginx:" + tag, Version: "v" + tag, Instances: 2},
+		}})
+	}
+	doRequest(t, server, http.MethodPost, "/v1/services/nginx/rollback", "", op)
+	assert.Equal(t, history.RollbackCommand, op.Type)
+	op = waitOperation(t, server, op.ID)
+	assert.Equal(t, operationSucceeded, op.Status)
+	assert.True(t, op.Result.Stacks["local"].RolledBack)
+	if assert.Contains(t, manager.snapshots, "local") {
+		snapshot := manager.snapshots["local"]
+		assert.Nil(t, snapshot.Config, "The framework rolls the service back to its version")
+		assert.Equal(t, "registry:5000/nginx", snapshot.Service.ImageName)
+		assert.Equal(t, "1.8", snapshot.Service.ImageTag)
+		assert.Equal(t, "v1.8", snapshot.Service.Version)
+		assert.Equal(t, 2, snapshot.Instances)
+	}
+
+	entries, _ := historyStore.Query(history.Filter{ServiceID: "nginx"})
+	assert.Equal(t, history.RollbackCommand, entries[len(entries)-1].Command)
+	assert.Equal(t, "STACK_FAILED", entries[0].Result, "The failed rollback is recorded")
+}
+
+func TestServeFindStatusAndDelete(t *testing.T) {
+	server, cleanup := newTestAPI(t, createStackManagerMock())
+	defer cleanup()
+
+	var services []serviceReport
+	assert.Equal(t, http.StatusOK, doRequest(t, server, http.MethodGet, "/v1/services?search=SABRE", "", &services))
+	assert.Equal(t, "SABRE-SESSION-POOL", services[0].ID)
+	assert.Equal(t, "instance id", services[0].Instances[0].ID)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, server, http.MethodGet, "/v1/services", "", nil))
+
+	status := new(statusReport)
+	assert.Equal(t, http.StatusOK, doRequest(t, server, http.MethodGet, "/v1/services/group/nginx/status", "", status))
+	assert.Equal(t, "group/nginx", status.ServiceID)
+	assert.Contains(t, status.Stacks, "sjc")
+
+	op := new(operation)
+	assert.Equal(t, http.StatusAccepted, doRequest(t, server, http.MethodDelete, "/v1/services/nginx", "", op))
+	op = waitOperation(t, server, op.ID)
+	assert.Equal(t, "delete", op.Type)
+	assert.Equal(t, operationSucceeded, op.Status)
+
+	assert.Equal(t, http.StatusNotFound, doRequest(t, server, http.MethodGet, "/v1/operations/missing", "", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, doRequest(t, server, http.MethodPost, "/v1/services/nginx", "", nil))
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/util"
+)
+
+func statusFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "service-id",
+			Usage: "Id of the service",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: outputTable,
+			Usage: "Format of the status: json, yaml or table",
+		},
+	}
+}
+
+func statusBefore(c *cli.Context) error {
+	if c.String("service-id") == "" {
+		return errors.New("Service-id is empty")
+	}
+	return validateOutput(c.String("output"))
+}
+
+type stackStatusReport struct {
+	Exists    bool     `json:"exists" yaml:"exists"`
+	Tag       string   `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Desired   *int     `json:"desired,omitempty" yaml:"desired,omitempty"`
+	Running   int      `json:"running" yaml:"running"`
+	Healthy   int      `json:"healthy" yaml:"healthy"`
+	Unhealthy int      `json:"unhealthy" yaml:"unhealthy"`
+	Hosts     []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	Error     string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// statusReport shows the service on every stack. It drifts when the stacks run different tags
+type statusReport struct {
+	ServiceID string                        `json:"service-id" yaml:"service-id"`
+	Drift     bool                          `json:"drift" yaml:"drift"`
+	Tags      []string                      `json:"tags" yaml:"tags"`
+	Stacks    map[string]*stackStatusReport `json:"stacks" yaml:"stacks"`
+}
+
+func newStatusReport(serviceID string, statuses map[string]*cluster.StackServiceStatus) *statusReport {
+	tags := cluster.RunningTags(statuses)
+	report := &statusReport{
+		ServiceID: serviceID,
+		Drift:     len(tags) > 1,
+		Tags:      tags,
+		Stacks:    make(map[string]*stackStatusReport),
+	}
+	for stackKey, status := range statuses {
+		stack := &stackStatusReport{Error: errorMessage(status.Error), Hosts: make([]string, 0)}
+		if status.Desired != cluster.UnknownInstances {
+			desired := status.Desired
+			stack.Desired = &desired
+		}
+		if status.Service != nil {
+			stack.Exists = true
+			stack.Tag = status.Service.ImageTag
+			stack.Running = len(status.Service.Instances)
+			stack.Healthy = status.Healthy()
+			stack.Unhealthy = stack.Running - stack.Healthy
+			for _, instance := range status.Service.Instances {
+				stack.Hosts = append(stack.Hosts, instance.Host)
+			}
+			sort.Strings(stack.Hosts)
+		}
+		report.Stacks[stackKey] = stack
+	}
+	return report
+}
+
+func (r *statusReport) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "CLUSTER\tTAG\tDESIRED\tRUNNING\tHEALTHY\tUNHEALTHY\tHOSTS")
+	stackKeys := make([]string, 0, len(r.Stacks))
+	for stackKey := range r.Stacks {
+		stackKeys = append(stackKeys, stackKey)
+	}
+	sort.Strings(stackKeys)
+
+	for _, stackKey := range stackKeys {
+		stack := r.Stacks[stackKey]
+		switch {
+		case stack.Error != "":
+			fmt.Fprintf(w, "%s\tERROR: %s\t\t\t\t\t\n", stackKey, stack.Error)
+		case !stack.Exists:
+			fmt.Fprintf(w, "%s\tNOT DEPLOYED\t\t\t\t\t\n", stackKey)
+		default:
+			desired := "?"
+			if stack.Desired != nil {
+				desired = strconv.Itoa(*stack.Desired)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", stackKey, stack.Tag, desired, stack.Running,
+				stack.Healthy, stack.Unhealthy, strings.Join(stack.Hosts, ","))
+		}
+	}
+
+	if r.Drift {
+		fmt.Fprintf(w, "\nDRIFT: the clusters run different tags of %s: %s\n", r.ServiceID, strings.Join(r.Tags, ", "))
+	}
+}
+
+func statusCmd(c *cli.Context) {
+	serviceID := c.String("service-id")
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	report := newStatusReport(serviceID, stackManager.ServiceStatus(ctx, serviceID))
+	if report.Drift {
+		util.Log.Warnf("The clusters run different tags of %s: %s", serviceID, strings.Join(report.Tags, ", "))
+	}
+	if err := printReport(os.Stdout, c.String("output"), report); err != nil {
+		util.Log.Fatalln("Error printing the status", err)
+	}
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusBefore(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	ctx := cli.NewContext(nil, set, nil)
+	assert.NotNil(t, statusBefore(ctx), "Should throw error service-id empty")
+
+	set.String("service-id", "nginx", "")
+	ctx = cli.NewContext(nil, set, nil)
+	assert.Nil(t, statusBefore(ctx))
+}
+
+func TestStatusReportDrift(t *testing.T) {
+	statuses := map[string]*cluster.StackServiceStatus{
+		"sjc": {Desired: 2, Service: &framework.ServiceInformation{ImageTag: "1.0", Instances: []*framework.Instance{
+			{Host: "10.0.0.2", Status: framework.InstanceUp},
+			{Host: "10.0.0.1", Status: framework.InstanceDown},
+		}}},
+		"scl": {Desired: cluster.UnknownInstances, Service: &framework.ServiceInformation{ImageTag: "1.1"}},
+		"dal": {Desired: cluster.UnknownInstances},
+		"wdc": {Desired: cluster.UnknownInstances, Error: errors.New("Connection refused")},
+	}
+	report := newStatusReport("nginx", statuses)
+	assert.True(t, report.Drift, "Clusters run different tags")
+	assert.Equal(t, []string{"1.0", "1.1"}, report.Tags)
+	assert.Equal(t, 2, *report.Stacks["sjc"].Desired)
+	assert.Equal(t, 1, report.Stacks["sjc"].Healthy)
+	assert.Equal(t, 1, report.Stacks["sjc"].Unhealthy)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, report.Stacks["sjc"].Hosts)
+	assert.Nil(t, report.Stacks["scl"].Desired, "Desired instances are unknown")
+	assert.False(t, report.Stacks["dal"].Exists)
+
+	var out bytes.Buffer
+	assert.Nil(t, printReport(&out, outputTable, report))
+	assert.Contains(t, out.String(), "NOT DEPLOYED")
+	assert.Contains(t, out.String(), "Connection refused")
+	assert.Contains(t, out.String(), "DRIFT")
+}
+
+func TestStatusCmd(t *testing.T) {
+	stackManager = createStackManagerMock()
+	set := flag.NewFlagSet("test", 0)
+	set.String("service-id", "SABRE-SESSION-POOL", "")
+	set.String("output", "table", "")
+	ctx := cli.NewContext(nil, set, nil)
+	statusCmd(ctx)
+}
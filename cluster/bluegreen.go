@@ -0,0 +1,454 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// Labels of the versions deployed with the blue-green strategy. The routing selects the version
+// with the active label set to true
+const (
+	defaultActiveLabel = "crane.active"
+	// blueGreenLabel keeps the id of the service of both versions
+	blueGreenLabel = "crane.blue-green"
+	// keepUntilLabel is the unix time until the previous version is kept
+	keepUntilLabel = "crane.keep-until"
+
+	colorBlue  = "blue"
+	colorGreen = "green"
+)
+
+// ServiceLabeler is implemented by the frameworks able to change the labels of a service without
+// changing the rest of its definition. A label with an empty value is removed
+type ServiceLabeler interface {
+	LabelService(serviceID string, labels map[string]string) error
+}
+
+// colorServiceID returns the id of a version of the service
+func colorServiceID(serviceID, color string) string {
+	return serviceID + "-" + color
+}
+
+// SupportsBlueGreen reports if the framework can read and change the labels of the services, the
+// blue-green strategy needs both
+func (s *Stack) SupportsBlueGreen() bool {
+	_, inspector := s.frameworkApiHelper.(ServiceInspector)
+	_, labeler := s.frameworkApiHelper.(ServiceLabeler)
+	return inspector && labeler
+}
+
+// LabelService changes the labels of the service without changing the rest of its definition
+func (s *Stack) LabelService(ctx context.Context, serviceId string, labels map[string]string) error {
+	labeler, ok := s.frameworkApiHelper.(ServiceLabeler)
+	if !ok {
+		return fmt.Errorf("The framework of stack %s can not change the labels of a service", s.id)
+	}
+	s.log.Infof("Labeling service %s with %v", serviceId, labels)
+	_, _, err := s.withRetry(ctx, "LabelService "+serviceId, func() (interface{}, error) {
+		return nil, labeler.LabelService(serviceId, labels)
+	})
+	return err
+}
+
+// blueGreenState is the versions of a service on a stack, nil when they do not exist
+type blueGreenState struct {
+	active   *ServiceSnapshot
+	inactive *ServiceSnapshot
+}
+
+// keepUntil returns the time until the inactive version is kept, zero when it is not set
+func (st blueGreenState) keepUntil() time.Time {
+	if st.inactive == nil {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(st.inactive.Config.Labels[keepUntilLabel], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+func activeLabelOf(policy configuration.DeployPolicy) string {
+	if policy.ActiveLabel != "" {
+		return policy.ActiveLabel
+	}
+	return defaultActiveLabel
+}
+
+// blueGreenState reads both versions of the service on the stack. The service deployed with its
+// own id before the first blue-green deploy is a version too, it is active until the active label
+// is moved away from it
+func (sm *StackManager) blueGreenState(ctx context.Context, stackKey, serviceID, activeLabel string) (blueGreenState, error) {
+	var state blueGreenState
+	if !sm.stacks[stackKey].SupportsBlueGreen() {
+		return state, fmt.Errorf("The framework %s of stack %s does not support the blue-green strategy", sm.frameworks[stackKey], stackKey)
+	}
+	for _, id := range []string{serviceID, colorServiceID(serviceID, colorBlue), colorServiceID(serviceID, colorGreen)} {
+		snapshot, err := sm.stacks[stackKey].Snapshot(ctx, id)
+		if err != nil {
+			return state, err
+		}
+		if !snapshot.Exists() {
+			continue
+		}
+		if snapshot.Config == nil {
+			return state, fmt.Errorf("The definition of %s on stack %s is not available", id, stackKey)
+		}
+		active := snapshot.Config.Labels[activeLabel] == "true"
+		if id == serviceID {
+			active = snapshot.Config.Labels[activeLabel] != "false"
+		}
+		if !active {
+			if state.inactive != nil {
+				return state, fmt.Errorf("Neither %s nor %s is active on stack %s", state.inactive.ServiceID, id, stackKey)
+			}
+			state.inactive = snapshot
+		} else {
+			if state.active != nil {
+				return state, fmt.Errorf("Both %s and %s are active on stack %s", state.active.ServiceID, id, stackKey)
+			}
+			state.active = snapshot
+		}
+	}
+	return state, nil
+}
+
+// blueGreenDeploy is the new version of the service deployed on a stack
+type blueGreenDeploy struct {
+	state  blueGreenState
+	target string
+	// created is set once the deploy of the target started, it is deleted if the deploy fails
+	created  bool
+	status   *ServiceInfoStatus
+	duration time.Duration
+}
+
+// deployBlueGreen deploys the new version next to the active one at the same time on every stack,
+// it is not visible to the routing until the active label is moved to it. The label is only
+// moved once every stack is healthy, otherwise the new versions are deleted and the active ones
+// are untouched. The previous version stays inactive during the keep-old seconds of the policy,
+// until then only PromoteBlueGreen or AbortBlueGreen remove it. Crane does not run in background,
+// so the expired previous version is deleted by the next deploy, and without keep-old it is
+// deleted right after the switch
+func (sm *StackManager) deployBlueGreen(ctx context.Context, serviceConfig framework.ServiceConfig, options DeployOptions, policy configuration.DeployPolicy, hooks configuration.Hooks, result *DeployResult) {
+	activeLabel := activeLabelOf(policy)
+	for stackKey, stack := range sm.stacks {
+		if !stack.SupportsBlueGreen() {
+			result.Status = STACK_FAILED
+			result.Error = fmt.Errorf("The framework %s of stack %s does not support the blue-green strategy", sm.frameworks[stackKey], stackKey)
+			util.Log.Errorf("Deploy aborted: %s", result.Error)
+			return
+		}
+	}
+
+	type stackDeploy struct {
+		stackKey string
+		deploy   *blueGreenDeploy
+	}
+	results := make(chan stackDeploy, len(sm.stacks))
+	for stackKey := range sm.stacks {
+		go func(stackKey string) {
+			start := time.Now()
+			deploy := sm.deployStackBlueGreen(ctx, stackKey, serviceConfig, options, activeLabel)
+			deploy.duration = time.Since(start)
+			results <- stackDeploy{stackKey, deploy}
+		}(stackKey)
+	}
+
+	deploys := make(map[string]*blueGreenDeploy)
+	success := true
+	for range sm.stacks {
+		deployed := <-results
+		deploy := deployed.deploy
+		deploys[deployed.stackKey] = deploy
+		stackResult := &StackResult{
+			Status:   deploy.status.status,
+			Service:  deploy.status.serviceInfo,
+			Error:    deploy.status.err,
+			Duration: deploy.duration,
+			Attempts: deploy.status.attempts,
+		}
+		result.Stacks[deployed.stackKey] = stackResult
+		event := configuration.PostStackSuccess
+		if stackResult.Status.Succeeded() {
+			util.Log.Infof("Deploy Process OK on stack %s, %s is ready to be activated", deployed.stackKey, deploy.target)
+		} else {
+			util.Log.Errorf("Deploy Process Fails on stack %s", deployed.stackKey)
+			event = configuration.PostStackFailure
+			success = false
+		}
+		payload := newHookPayload(event, serviceConfig.ServiceID, &serviceConfig)
+		fireHooks(ctx, hooks, payload.withStack(deployed.stackKey, stackResult))
+	}
+
+	if success && ctx.Err() != nil {
+		result.Error = fmt.Errorf("The deploy was interrupted: %s", ctx.Err())
+		success = false
+	}
+	if success {
+		keepUntil := time.Now().Add(time.Duration(policy.KeepOld) * time.Second)
+		if err := sm.switchBlueGreen(ctx, deploys, activeLabel, keepUntil); err != nil {
+			result.Error = err
+			success = false
+		} else if policy.KeepOld == 0 {
+			sm.deletePrevious(ctx, deploys)
+		}
+	}
+
+	result.summarize()
+	if !success {
+		sm.dropBlueGreen(deploys, activeLabel, result)
+		result.Status = STACK_FAILED
+	}
+}
+
+// deployStackBlueGreen deploys the new version as inactive on the stack. The new version takes the
+// color that is not active, the previous version left inactive is deleted first once it is not
+// kept anymore
+func (sm *StackManager) deployStackBlueGreen(ctx context.Context, stackKey string, serviceConfig framework.ServiceConfig, options DeployOptions, activeLabel string) *blueGreenDeploy {
+	deploy := new(blueGreenDeploy)
+	fail := func(err error) *blueGreenDeploy {
+		deploy.status = &ServiceInfoStatus{status: STACK_FAILED, err: err}
+		return deploy
+	}
+
+	state, err := sm.blueGreenState(ctx, stackKey, serviceConfig.ServiceID, activeLabel)
+	if err != nil {
+		return fail(err)
+	}
+	deploy.state = state
+	if deploy.target, err = blueGreenTarget(serviceConfig.ServiceID, state); err != nil {
+		return fail(err)
+	}
+
+	if previous := state.inactive; previous != nil {
+		util.Log.Infof("Deleting the previous version %s on stack %s, it is not kept anymore", previous.ServiceID, stackKey)
+		if err := <-sm.stacks[stackKey].DeleteService(ctx, previous.ServiceID); err != nil {
+			return fail(err)
+		}
+		deploy.state.inactive = nil
+	}
+
+	stackConfig, instances, err := sm.stackServiceConfig(stackKey, blueGreenConfig(serviceConfig, deploy.target, activeLabel), options)
+	if err != nil {
+		return fail(err)
+	}
+
+	deploy.created = true
+	ch := make(chan *ServiceInfoStatus, 1)
+	sm.stacks[stackKey].DeployCheckAndNotify(ctx, stackConfig, instances, options.Tolerance, ch)
+	deploy.status = <-ch
+	if deploy.status.status.Succeeded() {
+		sm.verifyStack(ctx, stackKey, stackConfig, options, deploy.status)
+	}
+	return deploy
+}
+
+// blueGreenTarget returns the id of the new version, the color that is not active. It fails when
+// the previous version left inactive is still kept
+func blueGreenTarget(serviceID string, state blueGreenState) (string, error) {
+	color := colorBlue
+	if state.active != nil && state.active.ServiceID == colorServiceID(serviceID, colorBlue) {
+		color = colorGreen
+	}
+	target := colorServiceID(serviceID, color)
+	if previous := state.inactive; previous != nil {
+		if until := state.keepUntil(); time.Now().Before(until) {
+			return target, fmt.Errorf("The previous version %s is kept until %s, promote or abort the blue-green deploy first", previous.ServiceID, until.Format(time.RFC3339))
+		}
+	}
+	return target, nil
+}
+
+// blueGreenConfig returns the definition of the new version, inactive until the switch
+func blueGreenConfig(serviceConfig framework.ServiceConfig, target, activeLabel string) framework.ServiceConfig {
+	config := serviceConfig
+	config.ServiceID = target
+	config.Labels = mergeMaps(serviceConfig.Labels, map[string]string{
+		activeLabel:    "false",
+		blueGreenLabel: strings.TrimPrefix(serviceConfig.ServiceID, "/"),
+	})
+	return config
+}
+
+// switchBlueGreen moves the active label to the new version stack by stack, the previous version
+// is marked with the time until it is kept
+func (sm *StackManager) switchBlueGreen(ctx context.Context, deploys map[string]*blueGreenDeploy, activeLabel string, keepUntil time.Time) error {
+	stackKeys := make([]string, 0, len(deploys))
+	for stackKey := range deploys {
+		stackKeys = append(stackKeys, stackKey)
+	}
+	sort.Strings(stackKeys)
+
+	for _, stackKey := range stackKeys {
+		deploy := deploys[stackKey]
+		if previous := deploy.state.active; previous != nil {
+			labels := map[string]string{activeLabel: "false", keepUntilLabel: strconv.FormatInt(keepUntil.Unix(), 10)}
+			if err := sm.stacks[stackKey].LabelService(ctx, previous.ServiceID, labels); err != nil {
+				return fmt.Errorf("The version %s could not be deactivated on stack %s: %s", previous.ServiceID, stackKey, err)
+			}
+		}
+		if err := sm.stacks[stackKey].LabelService(ctx, deploy.target, map[string]string{activeLabel: "true"}); err != nil {
+			return fmt.Errorf("The version %s could not be activated on stack %s: %s", deploy.target, stackKey, err)
+		}
+		util.Log.Infof("%s is active on stack %s", deploy.target, stackKey)
+	}
+	return nil
+}
+
+// deletePrevious deletes the previous versions once the new ones are active. A failure is only
+// logged, the new version already receives the traffic and the next deploy deletes it again
+func (sm *StackManager) deletePrevious(ctx context.Context, deploys map[string]*blueGreenDeploy) {
+	for stackKey, deploy := range deploys {
+		previous := deploy.state.active
+		if previous == nil {
+			continue
+		}
+		util.Log.Infof("Deleting the previous version %s on stack %s, it is not kept", previous.ServiceID, stackKey)
+		if err := <-sm.stacks[stackKey].DeleteService(ctx, previous.ServiceID); err != nil {
+			util.Log.Errorf("The previous version %s could not be deleted on stack %s: %s", previous.ServiceID, stackKey, err)
+		}
+	}
+}
+
+// dropBlueGreen deletes the new versions and activates again the previous ones. It does not use
+// the context of the deploy, it must run even when the deploy timed out or was cancelled
+func (sm *StackManager) dropBlueGreen(deploys map[string]*blueGreenDeploy, activeLabel string, result *DeployResult) {
+	ctx := context.Background()
+	for stackKey, deploy := range deploys {
+		if !deploy.created {
+			continue
+		}
+		stackResult := result.Stacks[stackKey]
+		if previous := deploy.state.active; previous != nil {
+			if err := sm.stacks[stackKey].LabelService(ctx, previous.ServiceID, map[string]string{activeLabel: "true", keepUntilLabel: ""}); err != nil {
+				util.Log.Errorf("Rollback fails on stack %s: %s", stackKey, err)
+				stackResult.Error = fmt.Errorf("Rollback fails: %s", err)
+				stackResult.RollbackError = err
+				continue
+			}
+		}
+		deleted := sm.deleteStackService(ctx, stackKey, deploy.target, nil)
+		if deleted.Status == STACK_FAILED {
+			util.Log.Errorf("Rollback fails on stack %s: %s", stackKey, deleted.Error)
+			stackResult.Error = fmt.Errorf("Rollback fails: %s", deleted.Error)
+			stackResult.RollbackError = deleted.Error
+			continue
+		}
+		util.Log.Infof("Rollback OK on stack %s, %s was deleted", stackKey, deploy.target)
+		stackResult.RolledBack = true
+	}
+}
+
+// PromoteBlueGreen deletes the previous version of a blue-green deploy on every stack, the active
+// version is kept. The stacks without a previous version are skipped
+func (sm *StackManager) PromoteBlueGreen(ctx context.Context, serviceId string) *DeployResult {
+	activeLabel := activeLabelOf(sm.policy)
+	return sm.eachBlueGreenStack(ctx, serviceId, activeLabel, func(stackKey string, state blueGreenState) *StackResult {
+		if state.inactive == nil {
+			return &StackResult{Status: STACK_SKIPPED}
+		}
+		if state.active == nil {
+			return &StackResult{Status: STACK_FAILED, Error: fmt.Errorf("No version of %s is active, %s is not deleted", serviceId, state.inactive.ServiceID)}
+		}
+		util.Log.Infof("Promoting %s on stack %s, deleting %s", state.active.ServiceID, stackKey, state.inactive.ServiceID)
+		result := sm.deleteStackService(ctx, stackKey, state.inactive.ServiceID, nil)
+		if result.Status == STACK_READY {
+			result.Service = state.active.Service
+		}
+		return result
+	})
+}
+
+// AbortBlueGreen activates again the previous version of a blue-green deploy on every stack and
+// deletes the new one. It fails on the stacks without a previous version. The stacks switched
+// back to the previous version are rolled back
+func (sm *StackManager) AbortBlueGreen(ctx context.Context, serviceId string) *DeployResult {
+	activeLabel := activeLabelOf(sm.policy)
+	return sm.eachBlueGreenStack(ctx, serviceId, activeLabel, func(stackKey string, state blueGreenState) *StackResult {
+		result := sm.abortBlueGreen(ctx, stackKey, serviceId, activeLabel, state)
+		switch {
+		case result.Status == STACK_READY:
+			result.RolledBack = true
+		case result.Status == STACK_FAILED && state.inactive != nil:
+			result.RollbackError = result.Error
+		}
+		return result
+	})
+}
+
+// abortBlueGreen switches the stack back to the previous version of the service
+func (sm *StackManager) abortBlueGreen(ctx context.Context, stackKey, serviceId, activeLabel string, state blueGreenState) *StackResult {
+	if state.active == nil && state.inactive == nil {
+		return &StackResult{Status: STACK_SKIPPED}
+	}
+	if state.inactive == nil {
+		return &StackResult{Status: STACK_FAILED, Error: fmt.Errorf("There is no previous version of %s to switch back to", serviceId)}
+	}
+	previous := state.inactive
+	util.Log.Infof("Aborting the blue-green deploy on stack %s, activating %s", stackKey, previous.ServiceID)
+	if state.active != nil {
+		if err := sm.stacks[stackKey].LabelService(ctx, state.active.ServiceID, map[string]string{activeLabel: "false"}); err != nil {
+			return &StackResult{Status: STACK_FAILED, Error: err}
+		}
+	}
+	if err := sm.stacks[stackKey].LabelService(ctx, previous.ServiceID, map[string]string{activeLabel: "true", keepUntilLabel: ""}); err != nil {
+		return &StackResult{Status: STACK_FAILED, Error: err}
+	}
+	if state.active == nil {
+		return &StackResult{Status: STACK_READY, Service: previous.Service}
+	}
+	result := sm.deleteStackService(ctx, stackKey, state.active.ServiceID, nil)
+	if result.Status == STACK_READY {
+		result.Service = previous.Service
+	}
+	return result
+}
+
+// eachBlueGreenStack reads the versions of the service and runs the operation on every stack
+// concurrently
+func (sm *StackManager) eachBlueGreenStack(ctx context.Context, serviceId, activeLabel string, operation func(stackKey string, state blueGreenState) *StackResult) *DeployResult {
+	start := time.Now()
+	result := newDeployResult()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	type operationResult struct {
+		stackKey string
+		result   *StackResult
+	}
+	results := make(chan operationResult, len(sm.stacks))
+	for stackKey := range sm.stacks {
+		go func(stackKey string) {
+			stackStart := time.Now()
+			state, err := sm.blueGreenState(ctx, stackKey, serviceId, activeLabel)
+			var stackResult *StackResult
+			if err != nil {
+				stackResult = &StackResult{Status: STACK_FAILED, Error: err}
+			} else {
+				stackResult = operation(stackKey, state)
+			}
+			stackResult.Duration = time.Since(stackStart)
+			results <- operationResult{stackKey, stackResult}
+		}(stackKey)
+	}
+
+	for range sm.stacks {
+		done := <-results
+		result.Stacks[done.stackKey] = done.result
+		if done.result.Status == STACK_FAILED {
+			util.Log.Errorf("The blue-green operation fails on stack %s: %s", done.stackKey, done.result.Error)
+		}
+	}
+	result.summarize()
+	return result
+}
@@ -0,0 +1,196 @@
+package cluster
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+// newBlueGreenManager creates the stacks sjc and scl on the fake framework, keeping their state in
+// the directory so the next managers see the services deployed
+func newBlueGreenManager(t *testing.T, dir string, failDeploy bool) *StackManager {
+	config := &configuration.Configuration{
+		Clusters: map[string]configuration.Cluster{
+			"sjc": {Framework: configuration.Framework{"fake": configuration.Parameters{"state-file": filepath.Join(dir, "sjc.json")}}},
+			"scl": {Framework: configuration.Framework{"fake": configuration.Parameters{"state-file": filepath.Join(dir, "scl.json"), "fail-deploy": failDeploy}}},
+		},
+	}
+	sm, err := NewStackManager(config, ClusterSelector{})
+	assert.Nil(t, err)
+	return sm.(*StackManager)
+}
+
+// colorLabels returns the labels of every version of nginx on the stack, the service deployed
+// without the blue-green strategy too. A missing version has no entry
+func colorLabels(t *testing.T, sm *StackManager, stackKey string) map[string]map[string]string {
+	labels := make(map[string]map[string]string)
+	for _, id := range []string{"nginx", "nginx-blue", "nginx-green"} {
+		snapshot, err := sm.stacks[stackKey].Snapshot(context.Background(), id)
+		assert.Nil(t, err)
+		if snapshot.Exists() {
+			labels[id] = snapshot.Config.Labels
+		}
+	}
+	return labels
+}
+
+func TestDeployBlueGreen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "crane-bluegreen")
+	defer os.RemoveAll(dir)
+	sm := newBlueGreenManager(t, dir, false)
+
+	svc := framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9", Labels: map[string]string{"environment": "beta"}}
+	options := DeployOptions{Instances: 2, Tolerance: 0.5, Policy: configuration.DeployPolicy{Strategy: StrategyBlueGreen, KeepOld: 3600}}
+	result := sm.Deploy(context.Background(), svc, options)
+	assert.True(t, result.Succeeded(), "The first deploy should succeed")
+	for _, stackKey := range []string{"sjc", "scl"} {
+		labels := colorLabels(t, sm, stackKey)
+		assert.Len(t, labels, 1)
+		assert.Equal(t, map[string]string{"environment": "beta", "crane.active": "true", "crane.blue-green": "nginx"}, labels["nginx-blue"])
+	}
+
+	svc.Tag = "1.10"
+	plan := sm.PlanDeploy(context.Background(), svc, options)
+	assert.Equal(t, PlanCreate, plan.Stacks["sjc"].Action)
+	assert.Equal(t, "nginx-green", plan.Stacks["sjc"].Config.ServiceID, "Should plan the inactive color")
+	assert.Equal(t, "1.9", plan.Stacks["sjc"].Current.ImageTag, "The active version is the current service")
+
+	result = sm.Deploy(context.Background(), svc, options)
+	assert.True(t, result.Succeeded(), "The second deploy should succeed")
+	assert.Equal(t, "1.10", result.Stacks["sjc"].Service.ImageTag)
+	labels := colorLabels(t, sm, "sjc")
+	assert.Equal(t, "true", labels["nginx-green"]["crane.active"], "The new version should be active")
+	assert.Equal(t, "false", labels["nginx-blue"]["crane.active"], "The previous version should be kept inactive")
+	assert.NotEmpty(t, labels["nginx-blue"]["crane.keep-until"])
+
+	assert.NotNil(t, sm.PlanDeploy(context.Background(), svc, options).Stacks["sjc"].Error, "The plan should show the previous version is kept")
+	result = sm.Deploy(context.Background(), svc, options)
+	assert.False(t, result.Succeeded(), "The previous version is still kept")
+	assert.Contains(t, result.Stacks["sjc"].Error.Error(), "promote or abort")
+
+	result = sm.AbortBlueGreen(context.Background(), "nginx")
+	assert.True(t, result.Succeeded(), "The abort should succeed")
+	labels = colorLabels(t, sm, "scl")
+	assert.Len(t, labels, 1, "The new version should be deleted")
+	assert.Equal(t, "true", labels["nginx-blue"]["crane.active"], "The previous version should be active again")
+	assert.Empty(t, labels["nginx-blue"]["crane.keep-until"])
+	assert.False(t, sm.AbortBlueGreen(context.Background(), "nginx").Succeeded(), "There is nothing to abort")
+
+	options.Policy.KeepOld = 1
+	assert.True(t, sm.Deploy(context.Background(), svc, options).Succeeded())
+	assert.Len(t, colorLabels(t, sm, "sjc"), 2, "The previous version is kept for a second")
+	result = sm.PromoteBlueGreen(context.Background(), "nginx")
+	assert.True(t, result.Succeeded(), "The promote should succeed")
+	labels = colorLabels(t, sm, "sjc")
+	assert.Len(t, labels, 1, "The previous version should be deleted")
+	assert.Equal(t, "true", labels["nginx-green"]["crane.active"])
+	assert.Equal(t, STACK_SKIPPED, sm.PromoteBlueGreen(context.Background(), "nginx").Stacks["sjc"].Status, "There is nothing to promote")
+
+	options.Policy.KeepOld = 0
+	assert.True(t, sm.Deploy(context.Background(), svc, options).Succeeded())
+	labels = colorLabels(t, sm, "scl")
+	assert.Len(t, labels, 1, "The previous version is not kept, it should be deleted after the switch")
+	assert.Equal(t, "true", labels["nginx-blue"]["crane.active"])
+}
+
+func TestDeployBlueGreenExpiredVersion(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "crane-bluegreen")
+	defer os.RemoveAll(dir)
+	sm := newBlueGreenManager(t, dir, false)
+
+	svc := framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9"}
+	options := DeployOptions{Instances: 1, Policy: configuration.DeployPolicy{Strategy: StrategyBlueGreen, KeepOld: 3600}}
+	assert.True(t, sm.Deploy(context.Background(), svc, options).Succeeded())
+	svc.Tag = "1.10"
+	assert.True(t, sm.Deploy(context.Background(), svc, options).Succeeded())
+	for _, stackKey := range []string{"sjc", "scl"} {
+		assert.Nil(t, sm.stacks[stackKey].LabelService(context.Background(), "nginx-blue", map[string]string{keepUntilLabel: "1"}))
+	}
+
+	svc.Tag = "1.11"
+	result := sm.Deploy(context.Background(), svc, options)
+	assert.True(t, result.Succeeded(), "The expired previous version should be deleted by the deploy")
+	assert.Equal(t, "1.11", result.Stacks["sjc"].Service.ImageTag)
+	labels := colorLabels(t, sm, "sjc")
+	assert.Equal(t, "true", labels["nginx-blue"]["crane.active"])
+	assert.Equal(t, "false", labels["nginx-green"]["crane.active"])
+}
+
+func TestDeployBlueGreenFailure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "crane-bluegreen")
+	defer os.RemoveAll(dir)
+	svc := framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9"}
+	options := DeployOptions{Instances: 2, Tolerance: 0.5, Policy: configuration.DeployPolicy{Strategy: StrategyBlueGreen}}
+	assert.True(t, newBlueGreenManager(t, dir, false).Deploy(context.Background(), svc, options).Succeeded())
+
+	sm := newBlueGreenManager(t, dir, true)
+	svc.Tag = "1.10"
+	result := sm.Deploy(context.Background(), svc, options)
+	assert.False(t, result.Succeeded(), "The deploy on scl should fail")
+	assert.Equal(t, STACK_FAILED, result.Stacks["scl"].Status)
+	assert.True(t, result.Stacks["sjc"].RolledBack, "The new version on sjc should be deleted")
+	for _, stackKey := range []string{"sjc", "scl"} {
+		labels := colorLabels(t, sm, stackKey)
+		assert.Len(t, labels, 1, "Only the previous version should remain on %s", stackKey)
+		assert.Equal(t, "true", labels["nginx-blue"]["crane.active"], "The previous version should stay active on %s", stackKey)
+	}
+}
+
+func TestDeployBlueGreenUnsupported(t *testing.T) {
+	sm := new(StackManager)
+	sm.frameworks = map[string]string{"sjc": "swarm"}
+	stackMock := &StackMock{mockId: 2}
+	stackMock.On("SupportsBlueGreen").Return()
+	sm.stacks = map[string]StackInterface{"sjc": stackMock}
+
+	result := sm.Deploy(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, DeployOptions{Instances: 1, Policy: configuration.DeployPolicy{Strategy: StrategyBlueGreen}})
+	assert.False(t, result.Succeeded())
+	assert.Contains(t, result.Error.Error(), "does not support the blue-green strategy")
+	stackMock.AssertNotCalled(t, "DeployCheckAndNotify")
+}
+
+func TestDeployBlueGreenFromPlainService(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "crane-bluegreen")
+	defer os.RemoveAll(dir)
+	sm := newBlueGreenManager(t, dir, false)
+
+	svc := framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9"}
+	assert.True(t, sm.Deploy(context.Background(), svc, DeployOptions{Instances: 1}).Succeeded())
+
+	svc.Tag = "1.10"
+	options := DeployOptions{Instances: 1, Policy: configuration.DeployPolicy{Strategy: StrategyBlueGreen, KeepOld: 3600}}
+	plan := sm.PlanDeploy(context.Background(), svc, options)
+	assert.Equal(t, "1.9", plan.Stacks["sjc"].Current.ImageTag, "The plain service is the active version")
+	assert.True(t, sm.Deploy(context.Background(), svc, options).Succeeded())
+	labels := colorLabels(t, sm, "sjc")
+	assert.Equal(t, "true", labels["nginx-blue"]["crane.active"])
+	assert.Equal(t, "false", labels["nginx"]["crane.active"], "The plain service should be deactivated")
+	assert.NotEmpty(t, labels["nginx"]["crane.keep-until"])
+
+	result := sm.AbortBlueGreen(context.Background(), "nginx")
+	assert.True(t, result.Succeeded(), "The plain service is the previous version")
+	assert.Equal(t, "1.9", result.Stacks["sjc"].Service.ImageTag)
+	labels = colorLabels(t, sm, "sjc")
+	assert.Len(t, labels, 1, "The new version should be deleted")
+	assert.Equal(t, "true", labels["nginx"]["crane.active"])
+
+	assert.True(t, sm.Deploy(context.Background(), svc, options).Succeeded())
+	result = sm.Deploy(context.Background(), svc, options)
+	assert.False(t, result.Succeeded(), "The plain service is still kept")
+	assert.Contains(t, result.Stacks["sjc"].Error.Error(), "promote or abort")
+	for _, stackKey := range []string{"sjc", "scl"} {
+		assert.Nil(t, sm.stacks[stackKey].LabelService(context.Background(), "nginx", map[string]string{keepUntilLabel: "1"}))
+	}
+	assert.True(t, sm.Deploy(context.Background(), svc, options).Succeeded(), "The expired plain service should be deleted by the deploy")
+	labels = colorLabels(t, sm, "sjc")
+	assert.Len(t, labels, 2)
+	assert.NotContains(t, labels, "nginx")
+	assert.Equal(t, "false", labels["nginx-blue"]["crane.active"])
+	assert.Equal(t, "true", labels["nginx-green"]["crane.active"])
+}
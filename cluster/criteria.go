@@ -0,0 +1,37 @@
+package cluster
+
+import (
+	"strings"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// serviceIDCriteria filters the services by its ID. The frameworks return an error instead of an
+// empty list when no service meets the criteria, so it records if it was evaluated and matched
+type serviceIDCriteria struct {
+	id        string
+	evaluated bool
+	matched   bool
+}
+
+func (c *serviceIDCriteria) MeetCriteria(elements []*framework.ServiceInformation) []*framework.ServiceInformation {
+	c.evaluated = true
+	var filtered []*framework.ServiceInformation
+	for k, v := range elements {
+		if sameServiceID(v.ID, c.id) {
+			filtered = append(filtered, elements[k])
+		}
+	}
+	c.matched = len(filtered) != 0
+	return filtered
+}
+
+// notFound reports if the error of a search was caused by the absence of the service
+func (c *serviceIDCriteria) notFound() bool {
+	return c.evaluated && !c.matched
+}
+
+// sameServiceID compares two service ids, marathon prefixes the ids with a slash
+func sameServiceID(id, otherID string) bool {
+	return strings.TrimPrefix(id, "/") == strings.TrimPrefix(otherID, "/")
+}
@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+const notSet = "<unset>"
+
+// Difference is a field of a service with different values between stacks. The values use the
+// id of the stack as key
+type Difference struct {
+	Field  string
+	Values map[string]string
+}
+
+// DiffService compares the service between the stacks. Envs and constraints are only compared
+// on the stacks whose framework implements ServiceInspector, the values of the envs are replaced
+// by a checksum so the secrets are not printed. The stacks with errors are ignored
+func DiffService(statuses map[string]*StackServiceStatus) []Difference {
+	exists := make(map[string]string)
+	running := make(map[string]*framework.ServiceInformation)
+	inspected := make(map[string]*framework.ServiceConfig)
+	for stackKey, status := range statuses {
+		if status.Error != nil {
+			continue
+		}
+		exists[stackKey] = strconv.FormatBool(status.Service != nil)
+		if status.Service != nil {
+			running[stackKey] = status.Service
+		}
+		if status.Config != nil {
+			inspected[stackKey] = status.Config
+		}
+	}
+
+	var differences []Difference
+	differences = appendDifference(differences, "exists", exists)
+	differences = appendDifference(differences, "image", serviceValues(running, func(s *framework.ServiceInformation) string {
+		return s.ImageName
+	}))
+	differences = appendDifference(differences, "tag", serviceValues(running, func(s *framework.ServiceInformation) string {
+		return s.ImageTag
+	}))
+	differences = appendDifference(differences, "instances", serviceValues(running, func(s *framework.ServiceInformation) string {
+		return strconv.Itoa(len(s.Instances))
+	}))
+	differences = appendDifference(differences, "desired", desiredValues(statuses, inspected))
+	differences = appendDifference(differences, "ports", serviceValues(running, instancePorts))
+
+	envs := make(map[string]map[string]string)
+	constraints := make(map[string]map[string]string)
+	for stackKey, config := range inspected {
+		envs[stackKey] = envChecksums(config.Envs)
+		constraints[stackKey] = config.Constraints
+	}
+	differences = append(differences, diffMaps("env", envs)...)
+	differences = append(differences, diffMaps("constraint", constraints)...)
+	return differences
+}
+
+func appendDifference(differences []Difference, field string, values map[string]string) []Difference {
+	distinct := make(map[string]bool)
+	for _, value := range values {
+		distinct[value] = true
+	}
+	if len(distinct) > 1 {
+		differences = append(differences, Difference{Field: field, Values: values})
+	}
+	return differences
+}
+
+func serviceValues(services map[string]*framework.ServiceInformation, value func(*framework.ServiceInformation) string) map[string]string {
+	values := make(map[string]string)
+	for stackKey, service := range services {
+		values[stackKey] = value(service)
+	}
+	return values
+}
+
+func desiredValues(statuses map[string]*StackServiceStatus, inspected map[string]*framework.ServiceConfig) map[string]string {
+	values := make(map[string]string)
+	for stackKey := range inspected {
+		values[stackKey] = strconv.Itoa(statuses[stackKey].Desired)
+	}
+	return values
+}
+
+// instancePorts lists the internal ports exposed by the instances of the service
+func instancePorts(service *framework.ServiceInformation) string {
+	seen := make(map[string]bool)
+	ports := make([]string, 0)
+	for _, instance := range service.Instances {
+		for _, port := range instance.Ports {
+			key := fmt.Sprintf("%d/%s", port.Internal, strings.ToLower(string(port.Type)))
+			if !seen[key] {
+				seen[key] = true
+				ports = append(ports, key)
+			}
+		}
+	}
+	sort.Strings(ports)
+	return strings.Join(ports, ",")
+}
+
+func envChecksums(envs []string) map[string]string {
+	checksums := make(map[string]string)
+	for _, env := range envs {
+		keyVal := strings.SplitN(env, "=", 2)
+		value := ""
+		if len(keyVal) == 2 {
+			value = keyVal[1]
+		}
+		checksums[keyVal[0]] = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(value)))[:15]
+	}
+	return checksums
+}
+
+// diffMaps compares every key of the maps, the stacks without the key get notSet as value
+func diffMaps(field string, maps map[string]map[string]string) []Difference {
+	keys := make(map[string]bool)
+	for _, values := range maps {
+		for key := range values {
+			keys[key] = true
+		}
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	var differences []Difference
+	for _, key := range sortedKeys {
+		values := make(map[string]string)
+		for stackKey, stackValues := range maps {
+			value, ok := stackValues[key]
+			if !ok {
+				value = notSet
+			}
+			values[stackKey] = value
+		}
+		differences = appendDifference(differences, field+"."+key, values)
+	}
+	return differences
+}
@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func findDifference(differences []Difference, field string) *Difference {
+	for i := range differences {
+		if differences[i].Field == field {
+			return &differences[i]
+		}
+	}
+	return nil
+}
+
+func TestDiffServiceWithoutDrift(t *testing.T) {
+	statuses := map[string]*StackServiceStatus{
+		"sjc": {Service: &framework.ServiceInformation{ImageName: "nginx", ImageTag: "1.0"}},
+		"scl": {Service: &framework.ServiceInformation{ImageName: "nginx", ImageTag: "1.0"}},
+		"wdc": {Error: errors.New("Connection refused")},
+	}
+	assert.Empty(t, DiffService(statuses), "The stacks with errors are ignored")
+}
+
+func TestDiffService(t *testing.T) {
+	port := map[string]framework.InstancePort{"8080/tcp": {Internal: 8080, Type: framework.TCP}}
+	statuses := map[string]*StackServiceStatus{
+		"sjc": {
+			Service: &framework.ServiceInformation{ImageName: "nginx", ImageTag: "1.0", Instances: []*framework.Instance{{Ports: port}}},
+			Config:  &framework.ServiceConfig{Envs: []string{"PASSWORD=secret", "LEVEL=info"}, Constraints: map[string]string{"hostname": "UNIQUE"}},
+			Desired: 1,
+		},
+		"scl": {
+			Service: &framework.ServiceInformation{ImageName: "nginx", ImageTag: "1.1", Instances: []*framework.Instance{{}, {}}},
+			Config:  &framework.ServiceConfig{Envs: []string{"PASSWORD=other", "LEVEL=info"}},
+			Desired: 2,
+		},
+		"dal": {Desired: UnknownInstances},
+	}
+	differences := DiffService(statuses)
+
+	assert.Equal(t, map[string]string{"sjc": "true", "scl": "true", "dal": "false"}, findDifference(differences, "exists").Values)
+	assert.Nil(t, findDifference(differences, "image"), "Every stack runs the same image")
+	assert.Equal(t, "1.1", findDifference(differences, "tag").Values["scl"])
+	assert.Equal(t, "2", findDifference(differences, "instances").Values["scl"])
+	assert.Equal(t, "1", findDifference(differences, "desired").Values["sjc"])
+	assert.Equal(t, "8080/tcp", findDifference(differences, "ports").Values["sjc"])
+	assert.Equal(t, notSet, findDifference(differences, "constraint.hostname").Values["scl"])
+	assert.Nil(t, findDifference(differences, "env.LEVEL"))
+
+	password := findDifference(differences, "env.PASSWORD")
+	assert.NotNil(t, password)
+	assert.NotContains(t, password.Values["sjc"], "secret", "Should not print the value of the envs")
+}
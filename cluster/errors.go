@@ -1,6 +1,9 @@
 package cluster
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ClusterDisabled error generated if cluster is disabled
 type ClusterDisabled struct {
@@ -10,3 +13,18 @@ type ClusterDisabled struct {
 func (err ClusterDisabled) Error() string {
 	return fmt.Sprintf("The cluster is not enabled: %s", err.Name)
 }
+
+// OperationInterrupted error generated when an operation on a framework does not finish before
+// the timeout or the cancellation of its context. The operation can still finish on the framework
+type OperationInterrupted struct {
+	Operation string
+	Stack     string
+	Err       error
+}
+
+func (err OperationInterrupted) Error() string {
+	if err.Err == context.DeadlineExceeded {
+		return fmt.Sprintf("%s on stack %s timed out", err.Operation, err.Stack)
+	}
+	return fmt.Sprintf("%s on stack %s was cancelled", err.Operation, err.Stack)
+}
@@ -0,0 +1,32 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// FrameworkExtension wraps a framework created by the factory to add the operations of crane it
+// does not implement, as ServiceScaler. It receives the parameters of the framework in crane.yml
+type FrameworkExtension func(fw framework.Framework, parameters map[string]interface{}) (framework.Framework, error)
+
+// frameworkExtensions keeps the extension of every type of framework
+var frameworkExtensions = make(map[string]FrameworkExtension)
+
+// RegisterExtension extends every framework of the type created by NewStack. A type of framework
+// has only one extension
+func RegisterExtension(frameworkType string, extension FrameworkExtension) {
+	if _, ok := frameworkExtensions[frameworkType]; ok {
+		panic(fmt.Sprintf("The framework %s already has an extension", frameworkType))
+	}
+	frameworkExtensions[frameworkType] = extension
+}
+
+// extendFramework applies the extension registered for the type of the framework, if any
+func extendFramework(frameworkType string, fw framework.Framework, parameters map[string]interface{}) (framework.Framework, error) {
+	extension, ok := frameworkExtensions[frameworkType]
+	if !ok {
+		return fw, nil
+	}
+	return extension(fw, parameters)
+}
@@ -0,0 +1,201 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// defaultHookTimeout limits the hooks without a timeout
+const defaultHookTimeout = 5 * time.Minute
+
+// hookClient sends the webhooks, the timeout of every hook is set on its request
+var hookClient = &http.Client{}
+
+// HookStackResult is the outcome of the operation on a stack given to the hooks. Durations are
+// in seconds
+type HookStackResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	Image      string  `json:"image,omitempty"`
+	Version    string  `json:"version,omitempty"`
+	Instances  int     `json:"instances"`
+	Duration   float64 `json:"duration"`
+	RolledBack bool    `json:"rolled-back,omitempty"`
+}
+
+// HookPayload is the JSON given to the hooks, on stdin to the commands and as the body of the
+// webhooks. Stack is set on the events of a single stack, and Status and Error are its outcome.
+// The pre events have no results yet. Duration is the duration of the whole operation in seconds
+type HookPayload struct {
+	Event     string                      `json:"event"`
+	ServiceID string                      `json:"service-id"`
+	Service   *framework.ServiceConfig    `json:"service,omitempty"`
+	Stack     string                      `json:"stack,omitempty"`
+	Status    string                      `json:"status,omitempty"`
+	Error     string                      `json:"error,omitempty"`
+	Duration  float64                     `json:"duration,omitempty"`
+	Stacks    map[string]*HookStackResult `json:"stacks,omitempty"`
+}
+
+func newHookPayload(event, serviceID string, serviceConfig *framework.ServiceConfig) *HookPayload {
+	payload := &HookPayload{Event: event, ServiceID: serviceID}
+	if serviceConfig != nil {
+		masked := *serviceConfig
+		masked.Envs = util.MaskEnv(serviceConfig.Envs)
+		if masked.DockerCfg != "" {
+			masked.DockerCfg = "*****"
+		}
+		payload.Service = &masked
+	}
+	return payload
+}
+
+func newHookStackResult(result *StackResult) *HookStackResult {
+	stack := &HookStackResult{
+		Status:     result.Status.String(),
+		Duration:   result.Duration.Seconds(),
+		RolledBack: result.RolledBack,
+	}
+	if result.Error != nil {
+		stack.Error = result.Error.Error()
+	}
+	if service := result.Service; service != nil {
+		stack.Image = service.FullImageName()
+		stack.Version = service.Version
+		stack.Instances = len(service.Instances)
+	}
+	return stack
+}
+
+// withStack sets the result of a stack on the payload
+func (p *HookPayload) withStack(stackKey string, result *StackResult) *HookPayload {
+	p.Stack = stackKey
+	p.Status = result.Status.String()
+	if result.Error != nil {
+		p.Error = result.Error.Error()
+	}
+	p.Stacks = map[string]*HookStackResult{stackKey: newHookStackResult(result)}
+	return p
+}
+
+// withResult sets the result of the operation on every stack on the payload
+func (p *HookPayload) withResult(result *DeployResult) *HookPayload {
+	p.Status = result.Status.String()
+	p.Duration = result.Duration.Seconds()
+	if result.Error != nil {
+		p.Error = result.Error.Error()
+	}
+	p.Stacks = make(map[string]*HookStackResult, len(result.Stacks))
+	for stackKey, stackResult := range result.Stacks {
+		p.Stacks[stackKey] = newHookStackResult(stackResult)
+	}
+	return p
+}
+
+// isPreEvent reports if the hooks of the event run before the operation, their failure aborts it
+func isPreEvent(event string) bool {
+	return event == configuration.PreDeploy || event == configuration.PreDelete
+}
+
+// fireHooks runs the hooks of the event of the payload one after the other. The first failure of
+// a pre hook is returned and the next hooks do not run, the failures of the other hooks are only
+// logged. The post hooks do not use the context of the operation, they must run even when it
+// timed out or was cancelled
+func fireHooks(ctx context.Context, hooks configuration.Hooks, payload *HookPayload) error {
+	event := payload.Event
+	if !isPreEvent(event) {
+		ctx = context.Background()
+	}
+	for _, hook := range hooks.For(event) {
+		util.Log.Infof("Running %s hook %s", event, hook.Name())
+		if err := runHook(ctx, hook, payload); err != nil {
+			if isPreEvent(event) {
+				return fmt.Errorf("The %s hook %s fails: %s", event, hook.Name(), err)
+			}
+			util.Log.Errorf("The %s hook %s fails: %s", event, hook.Name(), err)
+		}
+	}
+	return nil
+}
+
+func runHook(ctx context.Context, hook configuration.Hook, payload *HookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	timeout := defaultHookTimeout
+	if hook.Timeout > 0 {
+		timeout = time.Duration(hook.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if hook.Command != "" {
+		return runCommandHook(ctx, hook, payload, body)
+	}
+	return runWebhook(ctx, hook, payload, body)
+}
+
+// runCommandHook runs the command with sh, it gets the payload on stdin and the event, the
+// service and the stack in the CRANE_HOOK_EVENT, CRANE_HOOK_SERVICE_ID and CRANE_HOOK_STACK envs
+func runCommandHook(ctx context.Context, hook configuration.Hook, payload *HookPayload, body []byte) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"CRANE_HOOK_EVENT="+payload.Event,
+		"CRANE_HOOK_SERVICE_ID="+payload.ServiceID,
+		"CRANE_HOOK_STACK="+payload.Stack,
+	)
+	output, err := cmd.CombinedOutput()
+	if len(output) != 0 {
+		util.Log.Debugf("Output of hook %s: %s", hook.Name(), output)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out")
+	}
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%s: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+// runWebhook posts the payload to the url of the hook, any status but 2xx is a failure
+func runWebhook(ctx context.Context, hook configuration.Hook, payload *HookPayload, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Crane-Event", payload.Event)
+	for key, value := range hook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := hookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Webhook responds %s %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// hookServer records the payloads of the webhooks, it fails the events of failing
+type hookServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	payloads []*HookPayload
+	headers  []http.Header
+	failing  map[string]bool
+}
+
+func newHookServer() *hookServer {
+	s := &hookServer{failing: make(map[string]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := new(HookPayload)
+		if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mutex.Lock()
+		s.payloads = append(s.payloads, payload)
+		s.headers = append(s.headers, r.Header)
+		s.mutex.Unlock()
+		if s.failing[payload.Event] {
+			http.Error(w, "migration failed", http.StatusInternalServerError)
+		}
+	}))
+	return s
+}
+
+func (s *hookServer) events() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var events []string
+	for _, payload := range s.payloads {
+		events = append(events, payload.Event+" "+payload.Stack)
+	}
+	return events
+}
+
+func TestCommandHook(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hooks")
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "payload.json")
+	hook := configuration.Hook{Command: "cat > " + out + " && echo $CRANE_HOOK_EVENT $CRANE_HOOK_SERVICE_ID $CRANE_HOOK_STACK > " + out + ".env"}
+
+	payload := newHookPayload(configuration.PostStackSuccess, "nginx", &framework.ServiceConfig{ServiceID: "nginx", Envs: []string{"DB_PASSWORD=norris"}})
+	payload.withStack("sjc", &StackResult{Status: STACK_READY, Service: &framework.ServiceInformation{ImageName: "nginx", ImageTag: "1.9", Version: "v2"}})
+	assert.Nil(t, runHook(context.Background(), hook, payload))
+
+	content, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	received := new(HookPayload)
+	assert.Nil(t, json.Unmarshal(content, received))
+	assert.Equal(t, "sjc", received.Stack)
+	assert.Equal(t, "STACK_READY", received.Status)
+	assert.Equal(t, []string{"DB_PASSWORD=*****"}, received.Service.Envs, "The secrets should be masked")
+	assert.Equal(t, &HookStackResult{Status: "STACK_READY", Image: "nginx:1.9", Version: "v2"}, received.Stacks["sjc"])
+	env, _ := ioutil.ReadFile(out + ".env")
+	assert.Equal(t, "post-stack-success nginx sjc\n", string(env))
+}
+
+func TestCommandHookFailure(t *testing.T) {
+	err := runHook(context.Background(), configuration.Hook{Command: "echo pending migrations >&2; exit 3"}, newHookPayload(configuration.PreDeploy, "nginx", nil))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "pending migrations")
+
+	err = runHook(context.Background(), configuration.Hook{Command: "sleep 5", Timeout: 1}, newHookPayload(configuration.PreDeploy, "nginx", nil))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
+
+func TestWebhook(t *testing.T) {
+	server := newHookServer()
+	defer server.Close()
+	server.failing[configuration.PreDelete] = true
+	hook := configuration.Hook{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer norris"}}
+
+	assert.Nil(t, runHook(context.Background(), hook, newHookPayload(configuration.PostDelete, "nginx", nil)))
+	assert.Equal(t, "Bearer norris", server.headers[0].Get("Authorization"))
+	assert.Equal(t, "application/json", server.headers[0].Get("Content-Type"))
+	assert.Equal(t, "post-delete", server.headers[0].Get("X-Crane-Event"))
+	assert.Equal(t, "nginx", server.payloads[0].ServiceID)
+
+	err := runHook(context.Background(), hook, newHookPayload(configuration.PreDelete, "nginx", nil))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "500")
+	assert.Contains(t, err.Error(), "migration failed")
+}
+
+func TestFireHooks(t *testing.T) {
+	server := newHookServer()
+	defer server.Close()
+	hooks := configuration.Hooks{
+		PreDeploy:  []configuration.Hook{{Command: "exit 1"}, {URL: server.URL}},
+		PostDeploy: []configuration.Hook{{Command: "exit 1"}, {URL: server.URL}},
+	}
+
+	assert.NotNil(t, fireHooks(context.Background(), hooks, newHookPayload(configuration.PreDeploy, "nginx", nil)))
+	assert.Empty(t, server.events(), "A failing pre hook stops the next hooks")
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Nil(t, fireHooks(cancelled, hooks, newHookPayload(configuration.PostDeploy, "nginx", nil)))
+	assert.Equal(t, []string{"post-deploy "}, server.events(), "The post hooks run after a failure and a cancel")
+}
+
+func TestDeployHooks(t *testing.T) {
+	server := newHookServer()
+	defer server.Close()
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.hooks = configuration.Hooks{PostDeploy: []configuration.Hook{{URL: server.URL}}}
+
+	svc := framework.ServiceConfig{ServiceID: "nginx"}
+	stackMock := new(StackMock)
+	stackMock.mockId = 1
+	stackMock.On("Snapshot", "nginx").Return().On("DeployCheckAndNotify", svc, 2, 0.0, mock.AnythingOfType("chan *cluster.ServiceInfoStatus")).Return()
+	sm.stacks["key1"] = stackMock
+	failMock := new(StackMock)
+	failMock.mockId = 2
+	failMock.On("Snapshot", "nginx").Return().On("DeployCheckAndNotify", svc, 2, 0.0, mock.AnythingOfType("chan *cluster.ServiceInfoStatus")).Return()
+	stackMock.On("Restore", mock.AnythingOfType("*cluster.ServiceSnapshot")).Return()
+	sm.stacks["key2"] = failMock
+
+	hooks := configuration.Hooks{
+		PreDeploy:        []configuration.Hook{{URL: server.URL}},
+		PostStackSuccess: []configuration.Hook{{URL: server.URL}},
+		PostStackFailure: []configuration.Hook{{URL: server.URL}},
+	}
+	result := sm.Deploy(context.Background(), svc, DeployOptions{Instances: 2, Hooks: hooks})
+	assert.False(t, result.Succeeded())
+
+	events := server.events()
+	assert.Len(t, events, 4)
+	assert.Equal(t, "pre-deploy ", events[0])
+	assert.Contains(t, events[1:3], "post-stack-success key1")
+	assert.Contains(t, events[1:3], "post-stack-failure key2")
+	assert.Equal(t, "post-deploy ", events[3])
+	postDeploy := server.payloads[3]
+	assert.Equal(t, "STACK_FAILED", postDeploy.Status)
+	assert.True(t, postDeploy.Duration > 0, "The post-deploy hooks should receive the duration of the deploy")
+	assert.True(t, postDeploy.Stacks["key1"].RolledBack)
+	assert.Equal(t, "STACK_FAILED", postDeploy.Stacks["key2"].Status)
+}
+
+func TestDeployAbortedByPreDeployHook(t *testing.T) {
+	server := newHookServer()
+	defer server.Close()
+	server.failing[configuration.PreDeploy] = true
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.hooks = configuration.Hooks{
+		PreDeploy:  []configuration.Hook{{URL: server.URL}},
+		PostDeploy: []configuration.Hook{{URL: server.URL}},
+	}
+
+	stackMock := new(StackMock)
+	stackMock.mockId = 1
+	sm.stacks["key1"] = stackMock
+
+	result := sm.Deploy(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, DeployOptions{Instances: 2})
+	assert.False(t, result.Succeeded(), "Deploy should be aborted")
+	assert.Contains(t, result.Error.Error(), "pre-deploy hook")
+	stackMock.AssertNotCalled(t, "Snapshot", "nginx")
+	assert.Equal(t, []string{"pre-deploy "}, server.events())
+}
+
+func TestDeleteHooks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hooks")
+	defer os.RemoveAll(dir)
+	log := filepath.Join(dir, "hooks.log")
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.hooks = configuration.Hooks{
+		PreDelete:  []configuration.Hook{{Command: "echo $CRANE_HOOK_EVENT >> " + log}},
+		PostDelete: []configuration.Hook{{Command: "echo $CRANE_HOOK_EVENT >> " + log}},
+	}
+	stackMock := new(StackMock)
+	stackMock.mockId = 1
+	sm.stacks["key1"] = stackMock
+	stackMock.On("Snapshot", "nginx").Return()
+	stackMock.On("DeleteService", "nginx").Return(mock.AnythingOfType("chan error"))
+
+	assert.True(t, sm.DeleteService(context.Background(), "nginx", nil).Succeeded())
+	content, _ := ioutil.ReadFile(log)
+	assert.Equal(t, "pre-delete\npost-delete\n", string(content))
+
+	sm.hooks.PreDelete = []configuration.Hook{{Command: "exit 1"}}
+	result := sm.DeleteService(context.Background(), "nginx", nil)
+	assert.False(t, result.Succeeded(), "Delete should be aborted")
+	assert.Len(t, stackMock.Calls, 2, "The service should not be deleted again")
+}
@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// stackServiceConfig returns the service and instances to deploy on the stack, applying the
+// overrides of crane.yml and then the overrides of the deploy. The service is translated to
+// the units of the framework of the stack
+func (sm *StackManager) stackServiceConfig(stackKey string, serviceConfig framework.ServiceConfig, options DeployOptions) (framework.ServiceConfig, int, error) {
+	instances := options.Instances
+	for _, override := range []configuration.ServiceOverride{sm.overrides[stackKey], options.Overrides[stackKey]} {
+		serviceConfig = applyServiceOverride(serviceConfig, override)
+		if override.Instances > 0 {
+			instances = override.Instances
+		}
+	}
+	serviceConfig, err := translateServiceConfig(sm.frameworks[stackKey], serviceConfig)
+	if err != nil {
+		return serviceConfig, instances, fmt.Errorf("Invalid service on stack %s: %s", stackKey, err)
+	}
+	return serviceConfig, instances, nil
+}
+
+// applyServiceOverride returns a copy of the config with the values of the override. The envs,
+// constraints and labels are merged, replacing the ones with the same key
+func applyServiceOverride(config framework.ServiceConfig, override configuration.ServiceOverride) framework.ServiceConfig {
+	if override.CPU > 0 {
+		config.CPUShares = override.CPU
+	}
+	if override.Memory > 0 {
+		config.Memory = override.Memory
+	}
+	config.Envs = mergeEnvs(config.Envs, override.Envs)
+	config.Constraints = mergeMaps(config.Constraints, override.Constraints)
+	config.Labels = mergeMaps(config.Labels, override.Labels)
+	return config
+}
+
+// mergeEnvs appends the envs of the override, an env already defined keeps its position
+func mergeEnvs(envs, override []string) []string {
+	if len(override) == 0 {
+		return envs
+	}
+	merged := make([]string, len(envs))
+	copy(merged, envs)
+	positions := make(map[string]int)
+	for i, env := range merged {
+		positions[envKey(env)] = i
+	}
+	for _, env := range override {
+		if i, ok := positions[envKey(env)]; ok {
+			merged[i] = env
+		} else {
+			positions[envKey(env)] = len(merged)
+			merged = append(merged, env)
+		}
+	}
+	return merged
+}
+
+func envKey(env string) string {
+	return strings.SplitN(env, "=", 2)[0]
+}
+
+func mergeMaps(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make(map[string]string)
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
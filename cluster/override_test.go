@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyServiceOverride(t *testing.T) {
+	config := framework.ServiceConfig{
+		ServiceID:   "nginx",
+		CPUShares:   0.5,
+		Memory:      256,
+		Envs:        []string{"ENDPOINT=http://us", "LEVEL=info"},
+		Constraints: map[string]string{"rack": "r1", "hostname": "UNIQUE"},
+	}
+	override := configuration.ServiceOverride{
+		Memory:      512,
+		Envs:        []string{"ENDPOINT=http://cl", "REGION=cl"},
+		Constraints: map[string]string{"rack": "scl-r1"},
+	}
+
+	stackConfig := applyServiceOverride(config, override)
+	assert.Equal(t, 0.5, stackConfig.CPUShares, "Empty values are not overridden")
+	assert.Equal(t, int64(512), stackConfig.Memory)
+	assert.Equal(t, []string{"ENDPOINT=http://cl", "LEVEL=info", "REGION=cl"}, stackConfig.Envs)
+	assert.Equal(t, map[string]string{"rack": "scl-r1", "hostname": "UNIQUE"}, stackConfig.Constraints)
+	assert.Equal(t, "r1", config.Constraints["rack"], "The base config should not change")
+	assert.Equal(t, "ENDPOINT=http://us", config.Envs[0], "The base config should not change")
+}
+
+func TestStackServiceConfig(t *testing.T) {
+	sm := new(StackManager)
+	sm.overrides = map[string]configuration.ServiceOverride{
+		"scl": {Instances: 2, Envs: []string{"REGION=cl"}, Labels: map[string]string{"dc": "scl"}},
+	}
+	options := DeployOptions{
+		Instances: 1,
+		Overrides: map[string]configuration.ServiceOverride{"scl": {Instances: 4, Envs: []string{"REGION=cl-2"}}},
+	}
+
+	config, instances, err := sm.stackServiceConfig("scl", framework.ServiceConfig{ServiceID: "nginx"}, options)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, instances, "The deploy overrides crane.yml")
+	assert.Equal(t, []string{"REGION=cl-2"}, config.Envs)
+	assert.Equal(t, "scl", config.Labels["dc"])
+
+	config, instances, err = sm.stackServiceConfig("sjc", framework.ServiceConfig{ServiceID: "nginx"}, options)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, instances)
+	assert.Empty(t, config.Envs)
+}
@@ -0,0 +1,215 @@
+package cluster
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// PlanAction is what a deploy or delete would do with the service in a stack
+type PlanAction string
+
+const (
+	PlanCreate    PlanAction = "create"
+	PlanUpdate    PlanAction = "update"
+	PlanScale     PlanAction = "scale"
+	PlanUnchanged PlanAction = "unchanged"
+	PlanDelete    PlanAction = "delete"
+	// PlanAbsent the service to delete does not exist in the stack
+	PlanAbsent PlanAction = "absent"
+	// PlanUnknown the framework does not return the definition of the service, the deploy may
+	// update it although the image and the instances are the same
+	PlanUnknown PlanAction = "unknown"
+)
+
+// StackPlan is the plan of an operation on a stack
+type StackPlan struct {
+	Action PlanAction
+	// Changes are the fields of the definition the deploy would update
+	Changes []string
+	// Config and Instances are the resolved service for the stack, they are empty on a delete
+	Config    *framework.ServiceConfig
+	Instances int
+	// Current is the service running in the stack, nil when it does not exist
+	Current *framework.ServiceInformation
+	Error   error
+}
+
+// DeployPlan describes what an operation would do on every stack without modifying them
+type DeployPlan struct {
+	Strategy string
+	Waves    [][]string
+	Stacks   map[string]*StackPlan
+	Error    error
+}
+
+// PlanDeploy resolves the service of every stack and compares it with the running service. It
+// only reads the stacks. With the blue-green strategy the new version of every stack is planned
+func (sm *StackManager) PlanDeploy(ctx context.Context, serviceConfig framework.ServiceConfig, options DeployOptions) *DeployPlan {
+	policy := mergeDeployPolicy(sm.policy, options.Policy)
+	plan := &DeployPlan{Strategy: policy.Strategy}
+	plan.Waves, plan.Error = sm.deployWaves(policy)
+	if policy.Strategy == StrategyBlueGreen {
+		plan.Stacks = sm.planBlueGreen(ctx, serviceConfig, options, activeLabelOf(policy))
+		return plan
+	}
+
+	plan.Stacks = sm.planStacks(ctx, serviceConfig.ServiceID, func(stackKey string, current *ServiceSnapshot) *StackPlan {
+		config, instances, err := sm.stackServiceConfig(stackKey, serviceConfig, options)
+		if err != nil {
+			return &StackPlan{Error: err}
+		}
+		action, changes := deployAction(current, &config, instances)
+		return &StackPlan{Action: action, Changes: changes, Config: &config, Instances: instances}
+	})
+	return plan
+}
+
+// planBlueGreen plans the new version of the service on every stack, it is always created next
+// to the active version, which is the current service of the plan
+func (sm *StackManager) planBlueGreen(ctx context.Context, serviceConfig framework.ServiceConfig, options DeployOptions, activeLabel string) map[string]*StackPlan {
+	type stackPlan struct {
+		stackKey string
+		plan     *StackPlan
+	}
+	results := make(chan stackPlan, len(sm.stacks))
+	for stackKey := range sm.stacks {
+		go func(stackKey string) {
+			state, err := sm.blueGreenState(ctx, stackKey, serviceConfig.ServiceID, activeLabel)
+			if err != nil {
+				results <- stackPlan{stackKey, &StackPlan{Error: err}}
+				return
+			}
+			target, err := blueGreenTarget(serviceConfig.ServiceID, state)
+			if err != nil {
+				results <- stackPlan{stackKey, &StackPlan{Error: err}}
+				return
+			}
+			config, instances, err := sm.stackServiceConfig(stackKey, blueGreenConfig(serviceConfig, target, activeLabel), options)
+			if err != nil {
+				results <- stackPlan{stackKey, &StackPlan{Error: err}}
+				return
+			}
+			plan := &StackPlan{Action: PlanCreate, Config: &config, Instances: instances}
+			if state.active != nil {
+				plan.Current = state.active.Service
+			}
+			results <- stackPlan{stackKey, plan}
+		}(stackKey)
+	}
+
+	plans := make(map[string]*StackPlan)
+	for range sm.stacks {
+		result := <-results
+		plans[result.stackKey] = result.plan
+	}
+	return plans
+}
+
+// PlanDelete looks for the service on every stack. It only reads the stacks
+func (sm *StackManager) PlanDelete(ctx context.Context, serviceId string) *DeployPlan {
+	plan := new(DeployPlan)
+	plan.Stacks = sm.planStacks(ctx, serviceId, func(stackKey string, current *ServiceSnapshot) *StackPlan {
+		if !current.Exists() {
+			return &StackPlan{Action: PlanAbsent}
+		}
+		return &StackPlan{Action: PlanDelete}
+	})
+	return plan
+}
+
+// planStacks reads the service on every stack concurrently and plans the action on it
+func (sm *StackManager) planStacks(ctx context.Context, serviceId string, planStack func(stackKey string, current *ServiceSnapshot) *StackPlan) map[string]*StackPlan {
+	type stackPlan struct {
+		stackKey string
+		plan     *StackPlan
+	}
+	results := make(chan stackPlan, len(sm.stacks))
+	for stackKey := range sm.stacks {
+		go func(stackKey string) {
+			current, err := sm.stacks[stackKey].Snapshot(ctx, serviceId)
+			if err != nil {
+				results <- stackPlan{stackKey, &StackPlan{Error: err}}
+				return
+			}
+			plan := planStack(stackKey, current)
+			plan.Current = current.Service
+			results <- stackPlan{stackKey, plan}
+		}(stackKey)
+	}
+
+	plans := make(map[string]*StackPlan)
+	for range sm.stacks {
+		result := <-results
+		plans[result.stackKey] = result.plan
+	}
+	return plans
+}
+
+// deployAction compares the service to deploy with the running one. The whole definition is
+// compared when the framework returns it, otherwise only the image is known
+func deployAction(current *ServiceSnapshot, config *framework.ServiceConfig, instances int) (PlanAction, []string) {
+	switch {
+	case !current.Exists():
+		return PlanCreate, nil
+	case current.Config != nil:
+		if changes := definitionChanges(current.Config, config); len(changes) != 0 {
+			return PlanUpdate, changes
+		}
+		if current.Instances != instances {
+			return PlanScale, nil
+		}
+		return PlanUnchanged, nil
+	case current.Service.ImageName != config.ImageName || current.Service.ImageTag != config.Tag:
+		return PlanUpdate, []string{"image"}
+	default:
+		return PlanUnknown, nil
+	}
+}
+
+// definitionChanges returns the fields that differ between the running definition and the new
+// one. Envs, ports, constraints and labels are compared without their order
+func definitionChanges(current, config *framework.ServiceConfig) []string {
+	var changes []string
+	add := func(field string, changed bool) {
+		if changed {
+			changes = append(changes, field)
+		}
+	}
+	add("image", current.ImageName+":"+current.Tag != config.ImageName+":"+config.Tag)
+	add("cpu", current.CPUShares != config.CPUShares)
+	add("memory", current.Memory != config.Memory)
+	add("ports", !sameItems(current.Publish, config.Publish))
+	add("envs", !sameItems(current.Envs, config.Envs))
+	add("constraints", !sameMap(current.Constraints, config.Constraints))
+	add("labels", !sameMap(current.Labels, config.Labels))
+	add("health-check", healthCheckPath(current) != healthCheckPath(config))
+	return changes
+}
+
+func sameItems(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	return reflect.DeepEqual(sortedA, sortedB)
+}
+
+func sameMap(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func healthCheckPath(config *framework.ServiceConfig) string {
+	if config.HealthCheckConfig == nil {
+		return ""
+	}
+	return config.HealthCheckConfig.Path
+}
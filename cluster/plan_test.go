@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDeployAction(t *testing.T) {
+	config := &framework.ServiceConfig{ImageName: "nginx", Tag: "1.9", Envs: []string{"A=1", "B=2"}, Publish: []string{"80/tcp"}}
+	running := &framework.ServiceInformation{ImageName: "nginx", ImageTag: "1.9", Instances: []*framework.Instance{{}, {}}}
+
+	action, _ := deployAction(&ServiceSnapshot{ServiceID: "nginx"}, config, 2)
+	assert.Equal(t, PlanCreate, action)
+
+	inspected := &ServiceSnapshot{ServiceID: "nginx", Service: running, Config: &framework.ServiceConfig{ImageName: "nginx", Tag: "1.9", Envs: []string{"B=2", "A=1"}, Publish: []string{"80/tcp"}}, Instances: 2}
+	action, changes := deployAction(inspected, config, 2)
+	assert.Equal(t, PlanUnchanged, action, "The order of the envs does not matter")
+	assert.Empty(t, changes)
+	action, _ = deployAction(inspected, config, 3)
+	assert.Equal(t, PlanScale, action)
+
+	changed := *config
+	changed.Envs = []string{"A=1", "B=3"}
+	changed.Memory = 512
+	changed.Labels = map[string]string{"environment": "beta"}
+	action, changes = deployAction(inspected, &changed, 2)
+	assert.Equal(t, PlanUpdate, action, "Should update the service when its definition changes")
+	assert.Equal(t, []string{"memory", "envs", "labels"}, changes)
+
+	notInspected := &ServiceSnapshot{ServiceID: "nginx", Service: running, Instances: 2}
+	action, _ = deployAction(notInspected, &changed, 2)
+	assert.Equal(t, PlanUnknown, action, "Without the definition the changes are unknown")
+	action, changes = deployAction(notInspected, &framework.ServiceConfig{ImageName: "nginx", Tag: "1.10"}, 2)
+	assert.Equal(t, PlanUpdate, action)
+	assert.Equal(t, []string{"image"}, changes)
+}
+
+func TestPlanDeploy(t *testing.T) {
+	policy := configuration.DeployPolicy{Strategy: StrategySequential, Order: []string{"sjc", "scl"}}
+	sm, mocks := newStrategyStackManager(map[string]int{"sjc": 1, "scl": 1}, policy)
+	sm.overrides = map[string]configuration.ServiceOverride{"scl": {Instances: 3}}
+
+	plan := sm.PlanDeploy(context.Background(), framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9"}, DeployOptions{Instances: 1})
+	assert.Nil(t, plan.Error)
+	assert.Equal(t, [][]string{{"sjc"}, {"scl"}}, plan.Waves)
+	assert.Equal(t, PlanUpdate, plan.Stacks["sjc"].Action, "The mock runs a service without image")
+	assert.Equal(t, 3, plan.Stacks["scl"].Instances, "Should apply the overrides of the stack")
+	for _, stackMock := range mocks {
+		stackMock.AssertNotCalled(t, "DeployCheckAndNotify", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestPlanDelete(t *testing.T) {
+	fw := new(FrameworkMock)
+	fw.services = []*framework.ServiceInformation{{ID: "/nginx"}}
+	failing := new(FrameworkMock)
+	failing.findErr = errors.New("Connection refused")
+	sm := new(StackManager)
+	sm.stacks = map[string]StackInterface{
+		"sjc": newStackWithFramework(fw),
+		"scl": newStackWithFramework(new(FrameworkMock)),
+		"dal": newStackWithFramework(failing),
+	}
+
+	plan := sm.PlanDelete(context.Background(), "nginx")
+	assert.Equal(t, PlanDelete, plan.Stacks["sjc"].Action)
+	assert.Equal(t, PlanAbsent, plan.Stacks["scl"].Action)
+	assert.NotNil(t, plan.Stacks["dal"].Error)
+	fw.AssertNotCalled(t, "DeleteService", "nginx")
+}
@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"time"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// StackResult is the outcome of a deploy on a stack
+type StackResult struct {
+	Status   StackStatus
+	Service  *framework.ServiceInformation
+	Error    error
+	Duration time.Duration
+	// Attempts needed by the framework to deploy the service
+	Attempts int
+	// RolledBack is set when the stack was restored to the definition it had before the deploy
+	RolledBack bool
+	// RollbackError is the reason the stack could not be restored
+	RollbackError error
+}
+
+// DeployResult is the outcome of a deploy on every stack. Status is STACK_FAILED when the deploy
+// fails on any stack or is aborted, STACK_DEGRADED when a stack has unhealthy instances within
+// the tolerance and STACK_READY otherwise
+type DeployResult struct {
+	Status StackStatus
+	Stacks map[string]*StackResult
+	// Error is the reason of a failure that does not belong to a single stack
+	Error    error
+	Duration time.Duration
+}
+
+func newDeployResult() *DeployResult {
+	return &DeployResult{Status: STACK_READY, Stacks: make(map[string]*StackResult)}
+}
+
+// Succeeded reports if the deploy counts as successful
+func (r *DeployResult) Succeeded() bool {
+	return r.Status.Succeeded()
+}
+
+// summarize sets the status of the deploy from the status of every stack
+func (r *DeployResult) summarize() {
+	for _, stack := range r.Stacks {
+		switch stack.Status {
+		case STACK_FAILED:
+			r.Status = STACK_FAILED
+			return
+		case STACK_DEGRADED:
+			r.Status = STACK_DEGRADED
+		}
+	}
+}
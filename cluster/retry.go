@@ -0,0 +1,161 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/latam-airlines/crane/configuration"
+)
+
+// Classes of the errors returned by the frameworks, used to choose the retryable errors
+const (
+	ErrorClassConnection  = "connection"
+	ErrorClassTimeout     = "timeout"
+	ErrorClassServerError = "server-error"
+	ErrorClassAll         = "all"
+)
+
+const (
+	defaultRetryAttempts       = 1
+	defaultRetryInitialBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff     = 10 * time.Second
+)
+
+var defaultRetryOn = []string{ErrorClassConnection, ErrorClassTimeout, ErrorClassServerError}
+
+// retryPolicy decides how many times and how often an operation on a framework is tried
+type retryPolicy struct {
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	retryOn        map[string]bool
+}
+
+func newRetryPolicy(config configuration.Retry) (*retryPolicy, error) {
+	policy := &retryPolicy{
+		attempts:       defaultRetryAttempts,
+		initialBackoff: defaultRetryInitialBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+		retryOn:        make(map[string]bool),
+	}
+	if config.Attempts < 0 || config.InitialBackoff < 0 || config.MaxBackoff < 0 {
+		return nil, fmt.Errorf("The retry values should not be negative")
+	}
+	if config.Attempts > 0 {
+		policy.attempts = config.Attempts
+	}
+	if config.InitialBackoff > 0 {
+		policy.initialBackoff = time.Duration(config.InitialBackoff) * time.Millisecond
+	}
+	if config.MaxBackoff > 0 {
+		policy.maxBackoff = time.Duration(config.MaxBackoff) * time.Millisecond
+	}
+	if policy.maxBackoff < policy.initialBackoff {
+		policy.maxBackoff = policy.initialBackoff
+	}
+
+	retryOn := config.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = defaultRetryOn
+	}
+	for _, class := range retryOn {
+		switch class {
+		case ErrorClassConnection, ErrorClassTimeout, ErrorClassServerError, ErrorClassAll:
+			policy.retryOn[class] = true
+		default:
+			return nil, fmt.Errorf("Unknown retryable error class %s", class)
+		}
+	}
+	return policy, nil
+}
+
+// retryable reports if the error belongs to a class that is retried. An operation interrupted by
+// the timeout of the stack may still be running on the framework, it is never tried again
+func (p *retryPolicy) retryable(err error) bool {
+	if _, interrupted := err.(*OperationInterrupted); interrupted {
+		return false
+	}
+	return p.retryOn[ErrorClassAll] || p.retryOn[errorClass(err)]
+}
+
+// backoff is the wait before the attempt, it doubles on every attempt up to the max backoff
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.initialBackoff
+	for i := 2; i < attempt && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+	return backoff
+}
+
+// run calls the operation until it succeeds, it fails with an error that is not retryable, the
+// attempts are exhausted or the context is done. It returns the attempts used
+func (p *retryPolicy) run(ctx context.Context, logger *log.Entry, operation string, fn func() (interface{}, error)) (interface{}, int, error) {
+	var value interface{}
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		if value, err = fn(); err == nil {
+			if attempt > 1 {
+				logger.WithField("attempt", attempt).Infof("%s succeeded", operation)
+			}
+			return value, attempt, nil
+		}
+		if attempt >= p.attempts || !p.retryable(err) || ctx.Err() != nil {
+			break
+		}
+		backoff := p.backoff(attempt + 1)
+		logger.WithField("attempt", attempt).Warnf("%s fails, retrying in %s: %s", operation, backoff, err)
+		if sleepContext(ctx, backoff) != nil {
+			break
+		}
+	}
+	if p.attempts > 1 {
+		logger.WithField("attempt", attempt).Errorf("%s fails: %s", operation, err)
+	}
+	return nil, attempt, err
+}
+
+// Messages of the errors of the frameworks that are not net errors. The status codes are only
+// matched next to the words status or code, or followed by their reason
+var (
+	serverErrorMessage = regexp.MustCompile(`(status|code)\W*50[0234]\b|\b50[0234] (internal server error|bad gateway|service unavailable|gateway timeout)|internal server error|bad gateway|service unavailable`)
+	connectionMessage  = regexp.MustCompile(`connection refused|connection reset|no such host|hosts are presently down|no cluster members available|unexpected eof|(^|: )eof$`)
+	timeoutMessage     = regexp.MustCompile(`\btimeout\b|timed out`)
+)
+
+// errorClass classifies the errors of the frameworks. The frameworks do not share error types,
+// so besides the errors of the net package the message of the error is used
+func errorClass(err error) string {
+	switch err := err.(type) {
+	case *OperationInterrupted:
+		return ""
+	case net.Error:
+		if err.Timeout() {
+			return ErrorClassTimeout
+		}
+	}
+	switch err.(type) {
+	case *net.OpError, *url.Error:
+		return ErrorClassConnection
+	}
+
+	message := strings.ToLower(err.Error())
+	switch {
+	case timeoutMessage.MatchString(message):
+		return ErrorClassTimeout
+	case connectionMessage.MatchString(message):
+		return ErrorClassConnection
+	case serverErrorMessage.MatchString(message):
+		return ErrorClassServerError
+	}
+	return ""
+}
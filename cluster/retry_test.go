@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyFramework fails the deploys with the errors before succeeding
+type flakyFramework struct {
+	FrameworkMock
+	errs  []error
+	calls int
+}
+
+func (f *flakyFramework) DeployService(config framework.ServiceConfig, instances int) (*framework.ServiceInformation, error) {
+	f.calls++
+	if len(f.errs) != 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, err
+	}
+	return &framework.ServiceInformation{ID: config.ServiceID}, nil
+}
+
+func newRetryStack(t *testing.T, fw framework.Framework, config configuration.Retry) *Stack {
+	s := newStackWithFramework(fw)
+	retry, err := newRetryPolicy(config)
+	assert.Nil(t, err)
+	s.retry = retry
+	return s
+}
+
+func stubSleep() (*[]time.Duration, func()) {
+	var waits []time.Duration
+	newTimer = func(d time.Duration) *time.Timer {
+		waits = append(waits, d)
+		return time.NewTimer(0)
+	}
+	return &waits, func() { newTimer = time.NewTimer }
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	waits, restore := stubSleep()
+	defer restore()
+
+	fw := &flakyFramework{errs: []error{errors.New("Marathon API error: 503 Service Unavailable"), errors.New("dial tcp: connection refused")}}
+	s := newRetryStack(t, fw, configuration.Retry{Attempts: 3, InitialBackoff: 100, MaxBackoff: 150})
+
+	ch := make(chan *ServiceInfoStatus, 1)
+	s.DeployCheckAndNotify(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, 1, 0.0, ch)
+	status := <-ch
+	assert.Equal(t, STACK_READY, status.status)
+	assert.Equal(t, 3, status.attempts)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 150 * time.Millisecond}, *waits, "Backoff should double up to the max")
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	_, restore := stubSleep()
+	defer restore()
+
+	fw := &flakyFramework{errs: []error{errors.New("Marathon API error: invalid app definition")}}
+	s := newRetryStack(t, fw, configuration.Retry{Attempts: 3})
+
+	ch := make(chan *ServiceInfoStatus, 1)
+	s.DeployCheckAndNotify(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, 1, 0.0, ch)
+	status := <-ch
+	assert.Equal(t, STACK_FAILED, status.status)
+	assert.Equal(t, 1, fw.calls, "Should not retry an error that is not retryable")
+}
+
+func TestRetryAttemptsExhausted(t *testing.T) {
+	_, restore := stubSleep()
+	defer restore()
+
+	fw := &flakyFramework{errs: []error{errors.New("timeout"), errors.New("timeout"), errors.New("timeout")}}
+	s := newRetryStack(t, fw, configuration.Retry{Attempts: 2, RetryOn: []string{ErrorClassAll}})
+
+	_, attempts, err := s.deployService(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestRetryDoesNotRetryNotFound(t *testing.T) {
+	fw := new(FrameworkMock)
+	s := newRetryStack(t, fw, configuration.Retry{Attempts: 3, RetryOn: []string{ErrorClassAll}})
+	service, err := s.FindService(context.Background(), "nginx")
+	assert.Nil(t, err)
+	assert.Nil(t, service)
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	policy, err := newRetryPolicy(configuration.Retry{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, policy.attempts, "Should not retry by default")
+
+	_, err = newRetryPolicy(configuration.Retry{RetryOn: []string{"bad-request"}})
+	assert.NotNil(t, err, "Should reject an unknown error class")
+	_, err = newRetryPolicy(configuration.Retry{Attempts: -1})
+	assert.NotNil(t, err)
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, ErrorClassServerError, errorClass(errors.New("Marathon API error: 502 Bad Gateway")))
+	assert.Equal(t, ErrorClassConnection, errorClass(errors.New("all the Marathon hosts are presently down")))
+	assert.Equal(t, ErrorClassTimeout, errorClass(errors.New("the operation has timed out")))
+	assert.Equal(t, ErrorClassServerError, errorClass(errors.New("unexpected status code 503")))
+	assert.Equal(t, ErrorClassConnection, errorClass(errors.New("Get http://marathon/v2/apps: EOF")))
+	assert.Equal(t, "", errorClass(errors.New("No services found")))
+	assert.Equal(t, "", errorClass(errors.New("Marathon API error: cpus should be below 500")), "A number in the message is not a status code")
+	assert.Equal(t, "", errorClass(errors.New("Marathon API error: invalid geofence label")), "A word containing eof is not an EOF")
+	assert.Equal(t, "", errorClass(&OperationInterrupted{Operation: "deploy", Stack: "sjc", Err: context.DeadlineExceeded}))
+}
+
+func TestRetryDoesNotRetryInterrupted(t *testing.T) {
+	policy, err := newRetryPolicy(configuration.Retry{Attempts: 3, RetryOn: []string{ErrorClassAll}})
+	assert.Nil(t, err)
+	assert.False(t, policy.retryable(&OperationInterrupted{Operation: "deploy", Stack: "sjc", Err: context.DeadlineExceeded}), "The interrupted operation may still be running")
+}
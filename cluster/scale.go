@@ -0,0 +1,132 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// ServiceScaler is implemented by the frameworks able to change the instances of a service
+// without deploying it again
+type ServiceScaler interface {
+	ScaleService(serviceID string, instances int) (*framework.ServiceInformation, error)
+}
+
+// ScaleOptions groups the parameters of a scale on every stack
+type ScaleOptions struct {
+	// Instances is used on the stacks without their own count, the stacks are skipped when it is negative
+	Instances int
+	// StackInstances replaces the instances on a stack, using the id of the stack as key
+	StackInstances map[string]int
+	Tolerance      float64
+}
+
+// instances returns the instances of the stack, or a negative number when it is not scaled
+func (o ScaleOptions) instances(stackKey string) int {
+	if instances, ok := o.StackInstances[stackKey]; ok {
+		return instances
+	}
+	return o.Instances
+}
+
+// Scale changes the instances of an existing service. It fails when the service does not
+// exist in the stack instead of creating it, and when the framework can neither scale the
+// service nor return its definition to deploy it again
+func (s *Stack) Scale(ctx context.Context, serviceId string, instances int) (*framework.ServiceInformation, error) {
+	service, err := s.FindService(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	if service == nil {
+		return nil, fmt.Errorf("The service %s does not exist in stack %s", serviceId, s.id)
+	}
+
+	s.log.Infof("Scaling service %s from %d to %d instances", serviceId, len(service.Instances), instances)
+	if scaler, ok := s.frameworkApiHelper.(ServiceScaler); ok {
+		value, _, err := s.withRetry(ctx, "ScaleService "+serviceId, func() (interface{}, error) {
+			return scaler.ScaleService(serviceId, instances)
+		})
+		scaled, _ := value.(*framework.ServiceInformation)
+		return scaled, err
+	}
+
+	inspector, ok := s.frameworkApiHelper.(ServiceInspector)
+	if !ok {
+		return nil, fmt.Errorf("The framework of stack %s can not scale a service without its full definition", s.id)
+	}
+	config, _, err := s.inspectService(ctx, inspector, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("The service %s does not exist in stack %s", serviceId, s.id)
+	}
+	// The full definition is deployed again, only the instances change
+	service, _, err = s.deployService(ctx, *config, instances)
+	return service, err
+}
+
+// Scale changes the instances of the service on every stack concurrently
+func (sm *StackManager) Scale(ctx context.Context, serviceId string, options ScaleOptions) *DeployResult {
+	start := time.Now()
+	result := newDeployResult()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	var unknown []string
+	for stackKey := range options.StackInstances {
+		if _, ok := sm.stacks[stackKey]; !ok {
+			unknown = append(unknown, stackKey)
+		}
+	}
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		result.Status = STACK_FAILED
+		result.Error = fmt.Errorf("The stacks %s are not configured", strings.Join(unknown, ", "))
+		return result
+	}
+
+	type scaleResult struct {
+		stackKey string
+		result   *StackResult
+	}
+	results := make(chan scaleResult, len(sm.stacks))
+	for stackKey := range sm.stacks {
+		go func(stackKey string) {
+			instances := options.instances(stackKey)
+			if instances < 0 {
+				results <- scaleResult{stackKey, &StackResult{Status: STACK_SKIPPED}}
+				return
+			}
+			stackStart := time.Now()
+			stackResult := new(StackResult)
+			stackResult.Service, stackResult.Error = sm.stacks[stackKey].Scale(ctx, serviceId, instances)
+			if stackResult.Error != nil {
+				stackResult.Status = STACK_FAILED
+			} else {
+				stackResult.Status = healthStatus(stackResult.Service, options.Tolerance)
+				if stackResult.Status == STACK_FAILED {
+					stackResult.Error = fmt.Errorf("%d of %d instances are unhealthy, tolerance %.2f", unhealthyInstances(stackResult.Service), len(stackResult.Service.Instances), options.Tolerance)
+				}
+			}
+			stackResult.Duration = time.Since(stackStart)
+			results <- scaleResult{stackKey, stackResult}
+		}(stackKey)
+	}
+
+	for range sm.stacks {
+		scaled := <-results
+		result.Stacks[scaled.stackKey] = scaled.result
+		if scaled.result.Error != nil {
+			util.Log.Errorf("Scale fails on stack %s: %s", scaled.stackKey, scaled.result.Error)
+		}
+	}
+	result.summarize()
+	return result
+}
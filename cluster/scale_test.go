@@ -0,0 +1,113 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStackScaleMissingService(t *testing.T) {
+	fw := new(FrameworkMock)
+	s := newStackWithFramework(fw)
+
+	_, err := s.Scale(context.Background(), "nginx", 3)
+	assert.NotNil(t, err, "Should not create the service")
+	fw.AssertNotCalled(t, "DeployService", mock.Anything, 3)
+}
+
+// scalingFramework adds ScaleService to a framework, as the extension of marathon does
+type scalingFramework struct {
+	framework.Framework
+	scaled map[string]int
+}
+
+func (f *scalingFramework) ScaleService(serviceID string, instances int) (*framework.ServiceInformation, error) {
+	f.scaled[serviceID] = instances
+	return &framework.ServiceInformation{ID: serviceID}, nil
+}
+
+func TestStackScaleWithoutDefinition(t *testing.T) {
+	fw := new(FrameworkMock)
+	fw.services = []*framework.ServiceInformation{{ID: "/nginx", ImageName: "nginx", ImageTag: "1.9"}}
+
+	_, err := newStackWithFramework(fw).Scale(context.Background(), "nginx", 3)
+	assert.NotNil(t, err, "Should not deploy the service with only its image")
+	fw.AssertNotCalled(t, "DeployService", mock.Anything, 3)
+
+	// The extension of the framework scales the service
+	scaler := &scalingFramework{scaled: make(map[string]int)}
+	RegisterExtension("mock", func(fw framework.Framework, params map[string]interface{}) (framework.Framework, error) {
+		scaler.Framework = fw
+		return scaler, nil
+	})
+	defer delete(frameworkExtensions, "mock")
+	extended, err := extendFramework("mock", fw, nil)
+	assert.Nil(t, err)
+
+	_, err = newStackWithFramework(extended).Scale(context.Background(), "nginx", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"nginx": 3}, scaler.scaled)
+	fw.AssertNotCalled(t, "DeployService", mock.Anything, 3)
+}
+
+// inspectorFrameworkMock returns the full definition of the service
+type inspectorFrameworkMock struct {
+	FrameworkMock
+	config *framework.ServiceConfig
+}
+
+func (f *inspectorFrameworkMock) InspectService(serviceID string) (*framework.ServiceConfig, int, error) {
+	return f.config, 2, nil
+}
+
+func TestStackScaleInspectedService(t *testing.T) {
+	config := &framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9", Envs: []string{"NGINX_PORT=80"}, Publish: []string{"80/tcp"}, Memory: 256}
+	fw := &inspectorFrameworkMock{config: config}
+	fw.services = []*framework.ServiceInformation{{ID: "/nginx", ImageName: "nginx", ImageTag: "1.9"}}
+	s := newStackWithFramework(fw)
+	fw.On("DeployService", *config, 3).Return()
+
+	_, err := s.Scale(context.Background(), "nginx", 3)
+	assert.Nil(t, err)
+	fw.AssertExpectations(t)
+}
+
+func TestScale(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	mocks := make(map[string]*StackMock)
+	for key, mockId := range map[string]int{"sjc": 1, "scl": 1, "dal": 1} {
+		stackMock := new(StackMock)
+		stackMock.mockId = mockId
+		stackMock.On("Scale", "nginx", mock.Anything).Return()
+		sm.stacks[key] = stackMock
+		mocks[key] = stackMock
+	}
+
+	result := sm.Scale(context.Background(), "nginx", ScaleOptions{Instances: -1, StackInstances: map[string]int{"sjc": 3, "scl": 5}})
+	assert.True(t, result.Succeeded())
+	mocks["sjc"].AssertCalled(t, "Scale", "nginx", 3)
+	mocks["scl"].AssertCalled(t, "Scale", "nginx", 5)
+	mocks["dal"].AssertNotCalled(t, "Scale", "nginx", mock.Anything)
+	assert.Equal(t, STACK_SKIPPED, result.Stacks["dal"].Status)
+
+	result = sm.Scale(context.Background(), "nginx", ScaleOptions{Instances: 2, StackInstances: map[string]int{"wdc": 3}})
+	assert.False(t, result.Succeeded(), "Should fail with a stack not configured")
+	assert.NotNil(t, result.Error)
+}
+
+func TestScaleMissingService(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	stackMock := new(StackMock)
+	stackMock.mockId = 2
+	stackMock.On("Scale", "nginx", 2).Return()
+	sm.stacks["sjc"] = stackMock
+
+	result := sm.Scale(context.Background(), "nginx", ScaleOptions{Instances: 2})
+	assert.False(t, result.Succeeded(), "Should fail when the service does not exist")
+	assert.NotNil(t, result.Stacks["sjc"].Error)
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/latam-airlines/crane/configuration"
+)
+
+// ClusterSelector chooses the clusters where crane runs. Without clusters and groups every
+// cluster is selected, the excluded clusters are removed at the end
+type ClusterSelector struct {
+	Clusters []string
+	Exclude  []string
+	Groups   []string
+}
+
+// filter returns the selected clusters of the configuration, the clusters and groups of the
+// selector should be configured
+func (s ClusterSelector) filter(clusters map[string]configuration.Cluster) (map[string]configuration.Cluster, error) {
+	for _, key := range append(append([]string{}, s.Clusters...), s.Exclude...) {
+		if _, ok := clusters[key]; !ok {
+			return nil, fmt.Errorf("The cluster %s is not configured", key)
+		}
+	}
+
+	included := make(map[string]bool)
+	for _, key := range s.Clusters {
+		included[key] = true
+	}
+	for _, group := range s.Groups {
+		found := false
+		for key, cluster := range clusters {
+			if cluster.InGroup(group) {
+				included[key] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("The cluster group %s is not configured", group)
+		}
+	}
+
+	excluded := make(map[string]bool)
+	for _, key := range s.Exclude {
+		excluded[key] = true
+	}
+
+	selected := make(map[string]configuration.Cluster)
+	for key, cluster := range clusters {
+		if excluded[key] || (len(included) != 0 && !included[key]) {
+			continue
+		}
+		selected[key] = cluster
+	}
+	return selected, nil
+}
+
+// String describes the selector for the logs
+func (s ClusterSelector) String() string {
+	var parts []string
+	if len(s.Clusters) != 0 {
+		parts = append(parts, "clusters: "+strings.Join(s.Clusters, ","))
+	}
+	if len(s.Groups) != 0 {
+		parts = append(parts, "groups: "+strings.Join(s.Groups, ","))
+	}
+	if len(s.Exclude) != 0 {
+		parts = append(parts, "excluded: "+strings.Join(s.Exclude, ","))
+	}
+	if len(parts) == 0 {
+		return "all clusters"
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
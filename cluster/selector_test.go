@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func selectorClusters() map[string]configuration.Cluster {
+	return map[string]configuration.Cluster{
+		"sjc": {Groups: []string{"prod", "us"}},
+		"dal": {Groups: []string{"prod", "us"}},
+		"scl": {Groups: []string{"prod"}},
+		"qa":  {},
+	}
+}
+
+func selectedKeys(t *testing.T, selector ClusterSelector) []string {
+	clusters, err := selector.filter(selectorClusters())
+	assert.Nil(t, err)
+	var keys []string
+	for key := range clusters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestClusterSelector(t *testing.T) {
+	assert.Len(t, selectedKeys(t, ClusterSelector{}), 4, "Should select every cluster")
+	assert.Equal(t, []string{"scl"}, selectedKeys(t, ClusterSelector{Clusters: []string{"scl"}}))
+	assert.Equal(t, []string{"dal", "qa", "sjc"}, selectedKeys(t, ClusterSelector{Groups: []string{"us"}, Clusters: []string{"qa"}}))
+	assert.Equal(t, []string{"scl", "sjc"}, selectedKeys(t, ClusterSelector{Groups: []string{"prod"}, Exclude: []string{"dal"}}))
+}
+
+func TestClusterSelectorNotConfigured(t *testing.T) {
+	_, err := ClusterSelector{Clusters: []string{"wdc"}}.filter(selectorClusters())
+	assert.NotNil(t, err, "Should return error with a cluster not configured")
+	_, err = ClusterSelector{Exclude: []string{"wdc"}}.filter(selectorClusters())
+	assert.NotNil(t, err, "Should return error with a cluster not configured")
+	_, err = ClusterSelector{Groups: []string{"staging"}}.filter(selectorClusters())
+	assert.NotNil(t, err, "Should return error with a group not configured")
+}
@@ -0,0 +1,51 @@
+package cluster
+
+import "github.com/latam-airlines/mesos-framework-factory"
+
+// ServiceInspector is implemented by the frameworks able to describe the current definition of a
+// service. It returns a nil config when the service does not exist
+type ServiceInspector interface {
+	InspectService(serviceID string) (*framework.ServiceConfig, int, error)
+}
+
+// ServiceSnapshot keeps the definition of a service in a stack before it is modified
+type ServiceSnapshot struct {
+	ServiceID string
+	// Service is nil when the service did not exist in the stack
+	Service *framework.ServiceInformation
+	// Config is read from the framework when it implements ServiceInspector, otherwise a deploy
+	// records the definition it deploys, see recordDeployed
+	Config    *framework.ServiceConfig
+	Instances int
+	// Framework is the type of framework of the stack, the config is in its units
+	Framework string
+}
+
+// CPU returns the CPU of the config in cores, the unit of the manifests
+func (s *ServiceSnapshot) CPU() float64 {
+	if s.Config == nil {
+		return 0
+	}
+	return s.Config.CPUShares / unitsOf(s.Framework).cpuPerCore
+}
+
+// recordDeployed completes the snapshot of an existing service that the framework could not
+// inspect with the definition of the deploy, keeping the image and tag of the running service.
+// The framework does not return the envs of the service, so the envs of the deploy are restored
+// with the image and instances that were running
+func (s *ServiceSnapshot) recordDeployed(config framework.ServiceConfig) {
+	if !s.Exists() || s.Config != nil {
+		return
+	}
+	config.ImageName = s.Service.ImageName
+	config.Tag = s.Service.ImageTag
+	s.Config = &config
+}
+
+// Exists reports if the service was running in the stack when the snapshot was taken
+func (s *ServiceSnapshot) Exists() bool {
+	return s.Service != nil
+}
+
+// BackupFunc saves the definition of a service in a stack before it is removed
+type BackupFunc func(stackKey string, snapshot *ServiceSnapshot) error
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/latam-airlines/crane/configuration"
@@ -8,6 +9,8 @@ import (
 	"github.com/latam-airlines/mesos-framework-factory"
 	"github.com/latam-airlines/mesos-framework-factory/factory"
 	"regexp"
+	"sync"
+	"time"
 )
 
 type StackStatus int
@@ -15,33 +18,72 @@ type StackStatus int
 const (
 	STACK_READY StackStatus = 1 + iota
 	STACK_FAILED
+	// STACK_DEGRADED the stack has unhealthy instances, but they are within the tolerance
+	STACK_DEGRADED
+	// STACK_SKIPPED the deploy stopped before reaching the stack
+	STACK_SKIPPED
 )
 
 var stackStatus = [...]string{
 	"STACK_READY",
 	"STACK_FAILED",
+	"STACK_DEGRADED",
+	"STACK_SKIPPED",
 }
 
 func (s StackStatus) String() string {
 	return stackStatus[s-1]
 }
 
+// Succeeded reports if the status counts as a successful deploy
+func (s StackStatus) Succeeded() bool {
+	return s == STACK_READY || s == STACK_DEGRADED
+}
+
+// healthStatus judges the instances of a service. The stack is ready when every instance is
+// healthy and degraded when the fraction of unhealthy instances is under the tolerance
+func healthStatus(service *framework.ServiceInformation, tolerance float64) StackStatus {
+	if service == nil {
+		return STACK_READY
+	}
+	unhealthy := unhealthyInstances(service)
+	if unhealthy == 0 {
+		return STACK_READY
+	}
+	if float64(unhealthy)/float64(len(service.Instances)) < tolerance {
+		return STACK_DEGRADED
+	}
+	return STACK_FAILED
+}
+
 type StackInterface interface {
 	getServices() []*framework.ServiceInformation
 	undeployInstance(instance string)
-	DeployCheckAndNotify(serviceConfig framework.ServiceConfig, instances int, tolerance float64, ch chan *ServiceInfoStatus)
-	FindServiceInformation(search string) ([]*framework.ServiceInformation, error)
-	DeleteService(serviceId string) chan error
-	Rollback(string, string)
+	DeployCheckAndNotify(ctx context.Context, serviceConfig framework.ServiceConfig, instances int, tolerance float64, ch chan *ServiceInfoStatus)
+	FindServiceInformation(ctx context.Context, search string) ([]*framework.ServiceInformation, error)
+	DeleteService(ctx context.Context, serviceId string) chan error
+	FindService(ctx context.Context, serviceId string) (*framework.ServiceInformation, error)
+	Snapshot(ctx context.Context, serviceId string) (*ServiceSnapshot, error)
+	Restore(ctx context.Context, snapshot *ServiceSnapshot) error
+	Scale(ctx context.Context, serviceId string, instances int) (*framework.ServiceInformation, error)
+	SupportsBlueGreen() bool
+	LabelService(ctx context.Context, serviceId string, labels map[string]string) error
 }
 
 type Stack struct {
-	id                    string
-	frameworkApiHelper    framework.Framework
-	services              []*framework.ServiceInformation
+	id                 string
+	frameworkApiHelper framework.Framework
+	// frameworkType is the type of framework configured in crane.yml
+	frameworkType string
+	services      []*framework.ServiceInformation
+	// mutex protects the services, the operations on different services run at the same time
+	mutex                 sync.Mutex
 	serviceIdNotification chan string
 	stackNofitication     chan<- StackStatus
 	log                   *log.Entry
+	retry                 *retryPolicy
+	// operationTimeout limits every call to the framework, there is no limit when it is zero
+	operationTimeout time.Duration
 }
 
 func NewStack(stackKey string, stackNofitication chan<- StackStatus, config configuration.Cluster) (StackInterface, error) {
@@ -49,44 +91,139 @@ func NewStack(stackKey string, stackNofitication chan<- StackStatus, config conf
 		return nil, &ClusterDisabled{Name: stackKey}
 	}
 
+	if config.OperationTimeout < 0 {
+		return nil, fmt.Errorf("The operation-timeout of %s should not be negative", stackKey)
+	}
 	clusterScheduler, err := factory.Create(config.Framework.Type(), config.Framework.Parameters())
 	if err != nil {
 		return nil, fmt.Errorf("Error creating framework %s in %s. %s", config.Framework.Type(), stackKey, err.Error())
 	}
+	clusterScheduler, err = extendFramework(config.Framework.Type(), clusterScheduler, config.Framework.Parameters())
+	if err != nil {
+		return nil, fmt.Errorf("Error extending framework %s in %s. %s", config.Framework.Type(), stackKey, err.Error())
+	}
+	retry, err := newRetryPolicy(config.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("Error in the retry of %s. %s", stackKey, err.Error())
+	}
 	s := new(Stack)
+	s.retry = retry
+	s.operationTimeout = time.Duration(config.OperationTimeout) * time.Second
 	s.id = stackKey
 	s.stackNofitication = stackNofitication
 	s.frameworkApiHelper = clusterScheduler
+	s.frameworkType = config.Framework.Type()
 	s.serviceIdNotification = make(chan string, 1000)
-
-	util.Log.WithFields(log.Fields{
+	s.log = util.Log.WithFields(log.Fields{
 		"stack": stackKey,
-	}).Infof("A new framework was created: %s", config.Framework.Type())
+	})
+
+	s.log.Infof("A new framework was created: %s", config.Framework.Type())
 
 	return s, nil
 }
 
 func (s *Stack) getServices() []*framework.ServiceInformation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	return s.services
 }
 
-func (s *Stack) DeployCheckAndNotify(serviceConfig framework.ServiceConfig, instances int, tolerance float64, ch chan *ServiceInfoStatus) {
-	service, err := s.frameworkApiHelper.DeployService(serviceConfig, instances)
+// setServices keeps the services found or deployed by the last operation on the stack
+func (s *Stack) setServices(services []*framework.ServiceInformation) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.services = services
+}
 
-	serviceInfoStatus := new(ServiceInfoStatus)
+// call runs the operation on the framework until it finishes, the context is done or the
+// operation timeout of the stack expires. The frameworks can not be cancelled, so an operation
+// that does not finish in time keeps running in background and its result is discarded
+func (s *Stack) call(ctx context.Context, operation string, fn func() (interface{}, error)) (interface{}, error) {
+	if s.operationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.operationTimeout)
+		defer cancel()
+	}
+
+	type callResult struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		value, err := fn()
+		done <- callResult{value, err}
+	}()
 
+	select {
+	case result := <-done:
+		return result.value, result.err
+	case <-ctx.Done():
+		return nil, &OperationInterrupted{Operation: operation, Stack: s.id, Err: ctx.Err()}
+	}
+}
+
+// withRetry runs the operation on the framework following the retry policy of the stack
+func (s *Stack) withRetry(ctx context.Context, operation string, fn func() (interface{}, error)) (interface{}, int, error) {
+	retry := s.retry
+	if retry == nil {
+		retry, _ = newRetryPolicy(configuration.Retry{})
+	}
+	return retry.run(ctx, s.log, operation, func() (interface{}, error) {
+		return s.call(ctx, operation, fn)
+	})
+}
+
+func (s *Stack) deployService(ctx context.Context, serviceConfig framework.ServiceConfig, instances int) (*framework.ServiceInformation, int, error) {
+	value, attempts, err := s.withRetry(ctx, "DeployService "+serviceConfig.ServiceID, func() (interface{}, error) {
+		return s.frameworkApiHelper.DeployService(serviceConfig, instances)
+	})
+	service, _ := value.(*framework.ServiceInformation)
+	return service, attempts, err
+}
+
+func (s *Stack) deleteService(ctx context.Context, serviceId string) error {
+	_, _, err := s.withRetry(ctx, "DeleteService "+serviceId, func() (interface{}, error) {
+		return nil, s.frameworkApiHelper.DeleteService(serviceId)
+	})
+	return err
+}
+
+func (s *Stack) inspectService(ctx context.Context, inspector ServiceInspector, serviceId string) (*framework.ServiceConfig, int, error) {
+	type inspection struct {
+		config    *framework.ServiceConfig
+		instances int
+	}
+	value, _, err := s.withRetry(ctx, "InspectService "+serviceId, func() (interface{}, error) {
+		config, instances, err := inspector.InspectService(serviceId)
+		return inspection{config, instances}, err
+	})
 	if err != nil {
+		return nil, 0, err
+	}
+	inspected := value.(inspection)
+	return inspected.config, inspected.instances, nil
+}
+
+func (s *Stack) DeployCheckAndNotify(ctx context.Context, serviceConfig framework.ServiceConfig, instances int, tolerance float64, ch chan *ServiceInfoStatus) {
+	service, attempts, err := s.deployService(ctx, serviceConfig, instances)
 
-		serviceInfoStatus.serviceInfo = service
+	serviceInfoStatus := new(ServiceInfoStatus)
+	serviceInfoStatus.serviceInfo = service
+	serviceInfoStatus.attempts = attempts
 
+	if err != nil {
 		serviceInfoStatus.status = STACK_FAILED
+		serviceInfoStatus.err = err
 		util.Log.Errorln(err)
 	} else {
-		serviceInfoStatus.serviceInfo = service
-		serviceInfoStatus.status = STACK_READY
-		services := make([]*framework.ServiceInformation, 0)
-		services = append(services, service)
-		s.services = services
+		serviceInfoStatus.status = healthStatus(service, tolerance)
+		if serviceInfoStatus.status == STACK_FAILED {
+			serviceInfoStatus.err = fmt.Errorf("%d of %d instances are unhealthy, tolerance %.2f", unhealthyInstances(service), len(service.Instances), tolerance)
+			s.log.Errorln(serviceInfoStatus.err)
+		}
+		s.setServices([]*framework.ServiceInformation{service})
 	}
 
 	ch <- serviceInfoStatus
@@ -100,25 +237,129 @@ func (s *Stack) undeployInstance(instance string) {
 	s.frameworkApiHelper.UndeployInstance(instance)
 }
 
-func (s *Stack) Rollback(appId, previousVersion string) {
+// Rollback asks the framework to deploy a previous version again. The framework does not report
+// the outcome, so the call is not retried, it is only limited by the operation timeout
+func (s *Stack) Rollback(ctx context.Context, appId, previousVersion string) error {
 	log.Infof("Comenzando Rollback en el Stack")
-	s.frameworkApiHelper.RollbackService(appId, previousVersion)
+	_, err := s.call(ctx, "RollbackService "+appId, func() (interface{}, error) {
+		s.frameworkApiHelper.RollbackService(appId, previousVersion)
+		return nil, nil
+	})
+	return err
 }
 
-func (s *Stack) FindServiceInformation(search string) ([]*framework.ServiceInformation, error) {
-	services, err := s.frameworkApiHelper.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{regexp.MustCompile(search)})
+func (s *Stack) FindServiceInformation(ctx context.Context, search string) ([]*framework.ServiceInformation, error) {
+	criteria := &framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile(search)}
+	value, _, err := s.withRetry(ctx, "FindServiceInformation", func() (interface{}, error) {
+		return s.frameworkApiHelper.FindServiceInformation(criteria)
+	})
 	if err != nil {
 		return nil, err
 	}
-	s.services = services
-	return s.services, nil
+	services := value.([]*framework.ServiceInformation)
+	s.setServices(services)
+	return services, nil
 }
 
-func (s *Stack) DeleteService(serviceId string) chan error {
+func (s *Stack) DeleteService(ctx context.Context, serviceId string) chan error {
 	ch := make(chan error)
 	go func() {
-		err := s.frameworkApiHelper.DeleteService(serviceId)
-		ch <- err
+		ch <- s.deleteService(ctx, serviceId)
 	}()
 	return ch
 }
+
+// FindService returns the service with the id, or nil if it does not exist in the stack
+func (s *Stack) FindService(ctx context.Context, serviceId string) (*framework.ServiceInformation, error) {
+	value, _, err := s.withRetry(ctx, "FindService "+serviceId, func() (interface{}, error) {
+		criteria := &serviceIDCriteria{id: serviceId}
+		services, err := s.frameworkApiHelper.FindServiceInformation(criteria)
+		if err != nil && criteria.notFound() {
+			// The frameworks return an error when nothing is found, it is not retried
+			return []*framework.ServiceInformation(nil), nil
+		}
+		return services, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	services := value.([]*framework.ServiceInformation)
+	if len(services) == 0 {
+		return nil, nil
+	}
+	return services[0], nil
+}
+
+// Snapshot saves the current definition of the service in the stack
+func (s *Stack) Snapshot(ctx context.Context, serviceId string) (*ServiceSnapshot, error) {
+	service, err := s.FindService(ctx, serviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &ServiceSnapshot{ServiceID: serviceId, Service: service, Framework: s.frameworkType}
+	if service == nil {
+		return snapshot, nil
+	}
+	snapshot.Instances = len(service.Instances)
+
+	if inspector, ok := s.frameworkApiHelper.(ServiceInspector); ok {
+		config, instances, err := s.inspectService(ctx, inspector, serviceId)
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			snapshot.Config = config
+			snapshot.Instances = instances
+		}
+	}
+	return snapshot, nil
+}
+
+// Restore returns the service to the definition saved in the snapshot. If the service did not
+// exist when the snapshot was taken it is deleted. When the definition can not be deployed, or
+// the framework only scales the existing service as marathon does, the framework rolls the
+// service back to the version of the snapshot
+func (s *Stack) Restore(ctx context.Context, snapshot *ServiceSnapshot) error {
+	if !snapshot.Exists() {
+		s.log.Infof("Deleting service %s, it did not exist before the deploy", snapshot.ServiceID)
+		return s.deleteService(ctx, snapshot.ServiceID)
+	}
+
+	if snapshot.Config != nil {
+		s.log.Infof("Restoring service %s to %s:%s with %d instances", snapshot.ServiceID, snapshot.Config.ImageName, snapshot.Config.Tag, snapshot.Instances)
+		_, _, err := s.deployService(ctx, *snapshot.Config, snapshot.Instances)
+		if err == nil {
+			err = s.checkRestored(ctx, snapshot)
+		}
+		if err == nil || snapshot.Service.Version == "" {
+			return err
+		}
+		s.log.Warnf("The definition of %s was not restored: %s", snapshot.ServiceID, err)
+	}
+
+	if snapshot.Service.Version == "" {
+		return fmt.Errorf("The version of %s before the deploy is unknown, it can not be restored", snapshot.ServiceID)
+	}
+	s.log.Infof("Restoring service %s to version %s (%s)", snapshot.ServiceID, snapshot.Service.Version, snapshot.Service.FullImageName())
+	if err := s.Rollback(ctx, snapshot.Service.ID, snapshot.Service.Version); err != nil {
+		return err
+	}
+	return s.checkRestored(ctx, snapshot)
+}
+
+// checkRestored checks that the service runs the image of the snapshot after a restore. The
+// definition of the service is not returned by every framework, so only the image is compared
+func (s *Stack) checkRestored(ctx context.Context, snapshot *ServiceSnapshot) error {
+	service, err := s.FindService(ctx, snapshot.ServiceID)
+	if err != nil {
+		return fmt.Errorf("The restore of %s could not be verified: %s", snapshot.ServiceID, err)
+	}
+	if service == nil {
+		return fmt.Errorf("The service %s does not exist after the restore", snapshot.ServiceID)
+	}
+	if service.FullImageName() != snapshot.Service.FullImageName() {
+		return fmt.Errorf("The service %s runs %s after the restore, expected %s", snapshot.ServiceID, service.FullImageName(), snapshot.Service.FullImageName())
+	}
+	return nil
+}
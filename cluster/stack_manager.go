@@ -1,36 +1,96 @@
 package cluster
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/latam-airlines/crane/configuration"
 	"github.com/latam-airlines/crane/util"
 	"github.com/latam-airlines/mesos-framework-factory"
 )
 
 type CraneManager interface {
-	Deploy(serviceConfig framework.ServiceConfig, instances int, tolerance float64) bool
-	FindServiceInformation(string) []*framework.ServiceInformation
+	Deploy(ctx context.Context, serviceConfig framework.ServiceConfig, options DeployOptions) *DeployResult
+	FindServiceInformation(ctx context.Context, search string) []*framework.ServiceInformation
 	DeployedContainers() []*framework.ServiceInformation
-	Rollback(string, string)
-	DeleteService(string) error
+	DeleteService(ctx context.Context, serviceId string, backup BackupFunc) *DeployResult
+	Rollback(ctx context.Context, serviceId string, snapshots map[string]*ServiceSnapshot) *DeployResult
+	ServiceStatus(ctx context.Context, serviceId string) map[string]*StackServiceStatus
+	Scale(ctx context.Context, serviceId string, options ScaleOptions) *DeployResult
+	PlanDeploy(ctx context.Context, serviceConfig framework.ServiceConfig, options DeployOptions) *DeployPlan
+	PlanDelete(ctx context.Context, serviceId string) *DeployPlan
+	PromoteBlueGreen(ctx context.Context, serviceId string) *DeployResult
+	AbortBlueGreen(ctx context.Context, serviceId string) *DeployResult
+}
+
+// DeployOptions groups the parameters of a deploy on every stack
+type DeployOptions struct {
+	Instances int
+	Tolerance float64
+	// Overrides replaces values of the service on a stack, using the id of the stack as key. They
+	// are applied after the overrides of the stack configured in crane.yml
+	Overrides map[string]configuration.ServiceOverride
+	// Policy replaces the values of the deploy policy configured in crane.yml
+	Policy configuration.DeployPolicy
+	// Hooks of the service, they run after the hooks configured in crane.yml
+	Hooks configuration.Hooks
+	// Verify checks every deployed instance from crane, the instances that fail count against the
+	// tolerance and a stack that fails is rolled back
+	Verify configuration.Verification
 }
 
 type StackManager struct {
 	stacks            map[string]StackInterface
 	stackNotification chan StackStatus
+	policy            configuration.DeployPolicy
+	// overrides are the values of the services replaced on every stack by crane.yml
+	overrides map[string]configuration.ServiceOverride
+	// frameworks are the types of framework of every stack, a deploy can mix them
+	frameworks map[string]string
+	// hooks configured in crane.yml, they run on every deploy and delete
+	hooks configuration.Hooks
+}
+
+// deployment tracks the stacks modified by a deploy and their snapshots
+type deployment struct {
+	snapshots map[string]*ServiceSnapshot
+	deployed  map[string]bool
+	mutex     sync.Mutex
+	// completed counts the waves of the strategy that finished successfully
+	completed int
 }
 
 type ServiceInfoStatus struct {
 	serviceInfo *framework.ServiceInformation
 	status      StackStatus
+	err         error
+	// attempts used to deploy the service
+	attempts int
 }
 
-func NewStackManager(config *configuration.Configuration) (CraneManager, error) {
+// NewStackManager creates a stack for every cluster of the configuration chosen by the selector
+func NewStackManager(config *configuration.Configuration, selector ClusterSelector) (CraneManager, error) {
+	clusters, err := selector.filter(config.Clusters)
+	if err != nil {
+		return nil, err
+	}
+	util.Log.Debugf("Selecting %s", selector)
+
 	sm := new(StackManager)
 	sm.stacks = make(map[string]StackInterface)
 	sm.stackNotification = make(chan StackStatus, 100)
+	sm.policy = config.Deploy
+	sm.overrides = make(map[string]configuration.ServiceOverride)
+	sm.frameworks = make(map[string]string)
+	sm.hooks = config.Hooks
+	for key, cluster := range clusters {
+		sm.overrides[key] = cluster.Service
+	}
 
-	err := sm.setupStacks(config.Clusters)
+	err = sm.setupStacks(clusters)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +113,8 @@ func (sm *StackManager) setupStacks(config map[string]configuration.Cluster) err
 		}
 
 		sm.stacks[key] = s
-		util.Log.Infof("Cluster %s was configured", key)
+		sm.frameworks[key] = config[key].Framework.Type()
+		util.Log.Infof("Cluster %s was configured with %s", key, sm.frameworks[key])
 	}
 
 	if len(sm.stacks) == 0 {
@@ -62,38 +123,317 @@ func (sm *StackManager) setupStacks(config map[string]configuration.Cluster) err
 	return nil
 }
 
-func (sm *StackManager) Deploy(serviceConfig framework.ServiceConfig, instances int, tolerance float64) bool {
+// Deploy deploys the service on the stacks following the deploy strategy. Before deploying, the
+// current definition of the service is saved on every stack, so if any stack fails the stacks
+// already deployed are restored to it. When the context is done the stacks still deploying fail
+// and the deployed stacks are restored as well. A failing pre-deploy hook aborts the deploy, the
+// post-deploy hooks run once the deploy started, whatever its outcome. The blue-green strategy
+// deploys a new version instead, see deployBlueGreen
+func (sm *StackManager) Deploy(ctx context.Context, serviceConfig framework.ServiceConfig, options DeployOptions) *DeployResult {
 	util.Log.Infof("enter deploy stack manager - stacks: %d", len(sm.stacks))
+	start := time.Now()
+	result := newDeployResult()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
 
-	chanMap := make(map[string]chan *ServiceInfoStatus)
+	for stackKey := range options.Overrides {
+		if _, ok := sm.stacks[stackKey]; !ok {
+			util.Log.Warnf("The overrides of stack %s are ignored, the stack is not configured", stackKey)
+		}
+	}
+
+	policy := mergeDeployPolicy(sm.policy, options.Policy)
+	waves, err := sm.deployWaves(policy)
+	if err != nil {
+		util.Log.Errorf("Deploy aborted: %s", err)
+		result.Status = STACK_FAILED
+		result.Error = err
+		return result
+	}
 
 	for stackKey := range sm.stacks {
-		ch := make(chan *ServiceInfoStatus)
-		chanMap[stackKey] = ch
-		go sm.stacks[stackKey].DeployCheckAndNotify(serviceConfig, instances, tolerance, ch)
+		if _, _, err := sm.stackServiceConfig(stackKey, serviceConfig, options); err != nil {
+			util.Log.Errorf("Deploy aborted: %s", err)
+			result.Status = STACK_FAILED
+			result.Error = err
+			return result
+		}
+	}
+
+	hooks := sm.hooks.Append(options.Hooks)
+	if err := fireHooks(ctx, hooks, newHookPayload(configuration.PreDeploy, serviceConfig.ServiceID, &serviceConfig)); err != nil {
+		util.Log.Errorf("Deploy aborted: %s", err)
+		result.Status = STACK_FAILED
+		result.Error = err
+		return result
+	}
+	// The post-deploy hooks run before the first deferred function, they set the duration themselves
+	defer func() {
+		result.Duration = time.Since(start)
+		payload := newHookPayload(configuration.PostDeploy, serviceConfig.ServiceID, &serviceConfig)
+		fireHooks(ctx, hooks, payload.withResult(result))
+	}()
+
+	if policy.Strategy == StrategyBlueGreen {
+		sm.deployBlueGreen(ctx, serviceConfig, options, policy, hooks, result)
+		return result
+	}
+
+	snapshots, err := sm.takeSnapshots(ctx, serviceConfig, options)
+	if err != nil {
+		util.Log.Errorf("Deploy aborted, the current definition of the service could not be saved: %s", err)
+		result.Status = STACK_FAILED
+		result.Error = fmt.Errorf("The current definition of the service could not be saved: %s", err)
+		return result
+	}
+
+	dep := &deployment{snapshots: snapshots, deployed: make(map[string]bool)}
+	for i, wave := range waves {
+		util.Log.Infof("Deploying %s on stacks %v", serviceConfig.ServiceID, wave)
+		if !sm.deployWave(ctx, dep, wave, serviceConfig, options, hooks, result) {
+			break
+		}
+		if policy.Strategy == StrategyCanary && i == 0 {
+			if err := sm.soak(ctx, wave[0], serviceConfig.ServiceID, policy, options.Tolerance); err != nil {
+				result.Error = err
+				break
+			}
+		}
+		dep.completed++
+	}
+
+	for stackKey := range sm.stacks {
+		if _, ok := result.Stacks[stackKey]; !ok {
+			result.Stacks[stackKey] = &StackResult{Status: STACK_SKIPPED}
+		}
+	}
+
+	result.summarize()
+	if dep.completed != len(waves) {
+		if result.Error == nil && ctx.Err() != nil {
+			result.Error = fmt.Errorf("The deploy was interrupted: %s", ctx.Err())
+		}
+		for stackKey, err := range sm.restoreDeployed(dep) {
+			if err != nil {
+				result.Stacks[stackKey].Error = fmt.Errorf("Rollback fails: %s", err)
+				result.Stacks[stackKey].RollbackError = err
+			} else {
+				result.Stacks[stackKey].RolledBack = true
+			}
+		}
+		result.Status = STACK_FAILED
+	}
+	return result
+}
+
+// deployWave deploys the service at the same time on every stack of the wave
+func (sm *StackManager) deployWave(ctx context.Context, dep *deployment, wave []string, serviceConfig framework.ServiceConfig, options DeployOptions, hooks configuration.Hooks, deployResult *DeployResult) bool {
+	type stackResult struct {
+		stackKey string
+		status   *ServiceInfoStatus
+		duration time.Duration
+	}
+	results := make(chan stackResult, len(wave))
+
+	for _, stackKey := range wave {
+		go func(stackKey string) {
+			start := time.Now()
+			ch := make(chan *ServiceInfoStatus, 1)
+			if stackConfig, instances, err := sm.stackServiceConfig(stackKey, serviceConfig, options); err != nil {
+				ch <- &ServiceInfoStatus{status: STACK_FAILED, err: err}
+			} else {
+				sm.stacks[stackKey].DeployCheckAndNotify(ctx, stackConfig, instances, options.Tolerance, ch)
+			}
+			serviceInfoStatus := <-ch
+			// An interrupted deploy can still finish on the framework, so the stack is restored too
+			if _, interrupted := serviceInfoStatus.err.(*OperationInterrupted); interrupted || serviceInfoStatus.status.Succeeded() {
+				dep.mutex.Lock()
+				dep.deployed[stackKey] = true
+				dep.mutex.Unlock()
+			}
+			if serviceInfoStatus.status.Succeeded() {
+				sm.verifyStack(ctx, stackKey, serviceConfig, options, serviceInfoStatus)
+			}
+			results <- stackResult{stackKey, serviceInfoStatus, time.Since(start)}
+		}(stackKey)
 	}
 
 	//Checking for results on each go routine
-	for stackKey, ch := range chanMap {
-		if serviceInfoStatus := <-ch; serviceInfoStatus.status == STACK_READY {
-			util.Log.Infof("Deploy Process OK on stack %s, status %d", stackKey, serviceInfoStatus.status)
-		} else {
-			util.Log.Errorf("Deploy Process Fails on stack %s", stackKey)
-
-			if serviceInfoStatus.serviceInfo != nil {
-				sm.Rollback(serviceInfoStatus.serviceInfo.ID, serviceInfoStatus.serviceInfo.Version)
+	success := true
+	for range wave {
+		result := <-results
+		stackResult := &StackResult{
+			Status:   result.status.status,
+			Service:  result.status.serviceInfo,
+			Error:    result.status.err,
+			Duration: result.duration,
+			Attempts: result.status.attempts,
+		}
+		deployResult.Stacks[result.stackKey] = stackResult
+		event := configuration.PostStackSuccess
+		switch result.status.status {
+		case STACK_READY:
+			util.Log.Infof("Deploy Process OK on stack %s, status %s", result.stackKey, result.status.status)
+		case STACK_DEGRADED:
+			util.Log.Warnf("Deploy Process degraded on stack %s, unhealthy instances within the tolerance", result.stackKey)
+		default:
+			util.Log.Errorf("Deploy Process Fails on stack %s", result.stackKey)
+			event = configuration.PostStackFailure
+			success = false
+		}
+		payload := newHookPayload(event, serviceConfig.ServiceID, &serviceConfig)
+		fireHooks(ctx, hooks, payload.withStack(result.stackKey, stackResult))
+	}
+	return success
+}
+
+// verifyStack verifies the instances deployed on the stack and judges them again with the
+// tolerance, the instances that failed the verification are unhealthy
+func (sm *StackManager) verifyStack(ctx context.Context, stackKey string, serviceConfig framework.ServiceConfig, options DeployOptions, status *ServiceInfoStatus) {
+	service := status.serviceInfo
+	if verifyService(ctx, stackKey, service, options.Verify, serviceConfig) == 0 {
+		return
+	}
+	status.status = healthStatus(service, options.Tolerance)
+	if status.status == STACK_FAILED {
+		status.err = fmt.Errorf("%d of %d instances are unhealthy or fail the %s verification, tolerance %.2f", unhealthyInstances(service), len(service.Instances), options.Verify.Type, options.Tolerance)
+	}
+}
+
+// takeSnapshots saves the definition of the service on every stack. The stacks that can not
+// inspect the service record the definition of the deploy with the running image and instances
+func (sm *StackManager) takeSnapshots(ctx context.Context, serviceConfig framework.ServiceConfig, options DeployOptions) (map[string]*ServiceSnapshot, error) {
+	serviceID := serviceConfig.ServiceID
+	type snapshotResult struct {
+		stackKey string
+		snapshot *ServiceSnapshot
+		err      error
+	}
+	results := make(chan snapshotResult, len(sm.stacks))
+	for stackKey := range sm.stacks {
+		go func(stackKey string) {
+			snapshot, err := sm.stacks[stackKey].Snapshot(ctx, serviceID)
+			if err == nil {
+				// The config of every stack was validated before the deploy
+				stackConfig, _, _ := sm.stackServiceConfig(stackKey, serviceConfig, options)
+				snapshot.recordDeployed(stackConfig)
+			}
+			results <- snapshotResult{stackKey, snapshot, err}
+		}(stackKey)
+	}
+
+	snapshots := make(map[string]*ServiceSnapshot)
+	var err error
+	for range sm.stacks {
+		result := <-results
+		if result.err != nil {
+			util.Log.Errorf("Snapshot of service %s fails on stack %s: %s", serviceID, result.stackKey, result.err)
+			err = result.err
+			continue
+		}
+		snapshots[result.stackKey] = result.snapshot
+	}
+	return snapshots, err
+}
+
+// restoreDeployed restores the stacks where the deploy succeeded to their snapshot.
+// The restore does not use the context of the deploy, it must run even when the deploy timed out
+// or was cancelled, each operation is still limited by the operation timeout of the stack.
+// It returns the outcome of the stacks restored by this call
+func (sm *StackManager) restoreDeployed(dep *deployment) map[string]error {
+	dep.mutex.Lock()
+	var stackKeys []string
+	for stackKey, deployed := range dep.deployed {
+		if deployed {
+			stackKeys = append(stackKeys, stackKey)
+		}
+	}
+	dep.mutex.Unlock()
+
+	type restoreResult struct {
+		stackKey string
+		err      error
+	}
+	results := make(chan restoreResult, len(stackKeys))
+	for _, stackKey := range stackKeys {
+		go func(stackKey string) {
+			err := sm.stacks[stackKey].Restore(context.Background(), dep.snapshots[stackKey])
+			if err != nil {
+				util.Log.Errorf("Rollback fails on stack %s: %s", stackKey, err)
+			} else {
+				util.Log.Infof("Rollback OK on stack %s", stackKey)
+			}
+			results <- restoreResult{stackKey, err}
+		}(stackKey)
+	}
+	restored := make(map[string]error)
+	for range stackKeys {
+		result := <-results
+		restored[result.stackKey] = result.err
+	}
+	return restored
+}
+
+// Rollback restores the service on every stack to its snapshot concurrently, as a failed deploy
+// restores the stacks it deployed. The stacks without a snapshot are skipped. A failure on a stack
+// does not stop the others, every result is returned
+func (sm *StackManager) Rollback(ctx context.Context, serviceId string, snapshots map[string]*ServiceSnapshot) *DeployResult {
+	util.Log.Infof("Starting the rollback of %s", serviceId)
+	start := time.Now()
+	result := newDeployResult()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	for stackKey := range snapshots {
+		if _, ok := sm.stacks[stackKey]; !ok {
+			util.Log.Warnf("The snapshot of %s on stack %s is ignored, the stack is not selected", serviceId, stackKey)
+		}
+	}
+
+	type rollbackResult struct {
+		stackKey string
+		result   *StackResult
+	}
+	results := make(chan rollbackResult, len(sm.stacks))
+	for stackKey := range sm.stacks {
+		go func(stackKey string) {
+			snapshot, ok := snapshots[stackKey]
+			if !ok {
+				results <- rollbackResult{stackKey, &StackResult{Status: STACK_SKIPPED}}
+				return
+			}
+			stackStart := time.Now()
+			stackResult := &StackResult{Status: STACK_READY, Service: snapshot.Service, RolledBack: true}
+			if err := sm.stacks[stackKey].Restore(ctx, snapshot); err != nil {
+				stackResult = &StackResult{Status: STACK_FAILED, Error: err, RollbackError: err}
 			}
+			stackResult.Duration = time.Since(stackStart)
+			results <- rollbackResult{stackKey, stackResult}
+		}(stackKey)
+	}
 
-			return false
+	for range sm.stacks {
+		restored := <-results
+		result.Stacks[restored.stackKey] = restored.result
+		switch restored.result.Status {
+		case STACK_READY:
+			util.Log.Infof("Rollback OK on stack %s", restored.stackKey)
+		case STACK_SKIPPED:
+			util.Log.Infof("The rollback of %s skips stack %s, there is nothing to restore", serviceId, restored.stackKey)
+		default:
+			util.Log.Errorf("Rollback fails on stack %s: %s", restored.stackKey, restored.result.Error)
 		}
 	}
-	return true
+	result.summarize()
+	return result
 }
 
-func (sm *StackManager) FindServiceInformation(search string) []*framework.ServiceInformation {
+func (sm *StackManager) FindServiceInformation(ctx context.Context, search string) []*framework.ServiceInformation {
 	allServices := make([]*framework.ServiceInformation, 0)
 	for stack := range sm.stacks {
-		services, err := sm.stacks[stack].FindServiceInformation(search)
+		services, err := sm.stacks[stack].FindServiceInformation(ctx, search)
 		if err != nil {
 			util.Log.Errorln(err)
 		}
@@ -115,33 +455,74 @@ func (sm *StackManager) DeployedContainers() []*framework.ServiceInformation {
 	return allServices
 }
 
-func (sm *StackManager) Rollback(appId, previousVersion string) {
-	util.Log.Infoln("Starting Rollback")
-	for stack := range sm.stacks {
-		sm.stacks[stack].Rollback(appId, previousVersion)
-	}
-}
-
-func (sm *StackManager) DeleteService(serviceId string) error {
+// DeleteService deletes the service on every stack concurrently. The definition of the service
+// on each stack is given to the backup before deleting it, and the stack is not deleted if the
+// backup fails. A failure on a stack does not stop the others, every result is returned. A failing
+// pre-delete hook aborts the delete
+func (sm *StackManager) DeleteService(ctx context.Context, serviceId string, backup BackupFunc) *DeployResult {
 	util.Log.Infoln("Starting DeleteService")
+	start := time.Now()
+	result := newDeployResult()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
 
-	chanMap := make(map[string]chan error)
+	if err := fireHooks(ctx, sm.hooks, newHookPayload(configuration.PreDelete, serviceId, nil)); err != nil {
+		util.Log.Errorf("Delete aborted: %s", err)
+		result.Status = STACK_FAILED
+		result.Error = err
+		return result
+	}
 
+	type deleteResult struct {
+		stackKey string
+		result   *StackResult
+	}
+	results := make(chan deleteResult, len(sm.stacks))
 	for stackKey := range sm.stacks {
-		ch := sm.stacks[stackKey].DeleteService(serviceId)
-		chanMap[stackKey] = ch
+		go func(stackKey string) {
+			stackStart := time.Now()
+			stackResult := sm.deleteStackService(ctx, stackKey, serviceId, backup)
+			stackResult.Duration = time.Since(stackStart)
+			results <- deleteResult{stackKey, stackResult}
+		}(stackKey)
 	}
 
-	//Checking for results on each go routine
-	for stackKey, ch := range chanMap {
-		if err := <-ch; err == nil {
-			util.Log.Infof("Delete Process OK on stack %s", stackKey)
-		} else {
-			util.Log.Errorf("Delete Process Fails ok stack %s", stackKey)
-			// XXX: Se elimina Rollback(), se debe implementar Retry Configurable PAAS-593
-			return err
+	for range sm.stacks {
+		deleted := <-results
+		result.Stacks[deleted.stackKey] = deleted.result
+		switch deleted.result.Status {
+		case STACK_READY:
+			util.Log.Infof("Delete Process OK on stack %s", deleted.stackKey)
+		case STACK_SKIPPED:
+			util.Log.Infof("The service %s does not exist on stack %s", serviceId, deleted.stackKey)
+		default:
+			util.Log.Errorf("Delete Process Fails on stack %s: %s", deleted.stackKey, deleted.result.Error)
 		}
 	}
+	result.summarize()
+	result.Duration = time.Since(start)
+	fireHooks(ctx, sm.hooks, newHookPayload(configuration.PostDelete, serviceId, nil).withResult(result))
+	return result
+}
 
-	return nil
+func (sm *StackManager) deleteStackService(ctx context.Context, stackKey, serviceId string, backup BackupFunc) *StackResult {
+	snapshot, err := sm.stacks[stackKey].Snapshot(ctx, serviceId)
+	if err != nil {
+		return &StackResult{Status: STACK_FAILED, Error: err}
+	}
+	if !snapshot.Exists() {
+		return &StackResult{Status: STACK_SKIPPED}
+	}
+
+	if backup != nil {
+		if err := backup(stackKey, snapshot); err != nil {
+			return &StackResult{Status: STACK_FAILED, Service: snapshot.Service, Error: fmt.Errorf("Backup fails, the service was not deleted: %s", err)}
+		}
+	}
+
+	if err := <-sm.stacks[stackKey].DeleteService(ctx, serviceId); err != nil {
+		return &StackResult{Status: STACK_FAILED, Service: snapshot.Service, Error: err}
+	}
+	return &StackResult{Status: STACK_READY, Service: snapshot.Service}
 }
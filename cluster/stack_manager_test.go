@@ -1,13 +1,16 @@
 package cluster
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/latam-airlines/crane/configuration"
+	_ "github.com/latam-airlines/crane/framework/fake"
 	"github.com/latam-airlines/mesos-framework-factory"
 	_ "github.com/latam-airlines/mesos-framework-factory/marathon"
 	"github.com/stretchr/testify/assert"
@@ -34,11 +37,11 @@ func (s *StackMock) undeployInstance(instance string) {
 	s.Called()
 }
 
-func (s *StackMock) DeployCheckAndNotify(serviceConfig framework.ServiceConfig, instances int, tolerance float64, ch chan *ServiceInfoStatus) {
+func (s *StackMock) DeployCheckAndNotify(ctx context.Context, serviceConfig framework.ServiceConfig, instances int, tolerance float64, ch chan *ServiceInfoStatus) {
 	s.Called(serviceConfig, instances, tolerance, ch)
 	serviceInfoStatus := new(ServiceInfoStatus)
 
-	if s.mockId == 1 {
+	if s.mockId == 1 || s.mockId == 4 {
 		serviceInfoStatus.status = STACK_READY
 	} else {
 		serviceInfoStatus.serviceInfo = new(framework.ServiceInformation)
@@ -51,7 +54,7 @@ func (s *StackMock) DeployCheckAndNotify(serviceConfig framework.ServiceConfig,
 	return
 }
 
-func (s *StackMock) FindServiceInformation(search string) ([]*framework.ServiceInformation, error) {
+func (s *StackMock) FindServiceInformation(ctx context.Context, search string) ([]*framework.ServiceInformation, error) {
 	s.Called(search)
 
 	if s.mockId == 2 {
@@ -67,7 +70,7 @@ func (s *StackMock) FindServiceInformation(search string) ([]*framework.ServiceI
 	return services, nil
 }
 
-func (s *StackMock) DeleteService(serviceId string) chan error {
+func (s *StackMock) DeleteService(ctx context.Context, serviceId string) chan error {
 	s.Called(serviceId)
 
 	ch := make(chan error)
@@ -82,9 +85,50 @@ func (s *StackMock) DeleteService(serviceId string) chan error {
 	return ch
 }
 
-func (s *StackMock) Rollback(appId, previousVersion string) {
-	s.Called(appId, previousVersion)
-	return
+func (s *StackMock) FindService(ctx context.Context, serviceId string) (*framework.ServiceInformation, error) {
+	s.Called(serviceId)
+	service := new(framework.ServiceInformation)
+	service.ID = serviceId
+	service.Instances = []*framework.Instance{{ID: "1", Status: framework.InstanceUp}}
+	if s.mockId != 1 {
+		service.Instances[0].Status = framework.InstanceDown
+	}
+	return service, nil
+}
+
+func (s *StackMock) Snapshot(ctx context.Context, serviceId string) (*ServiceSnapshot, error) {
+	s.Called(serviceId)
+	snapshot := &ServiceSnapshot{ServiceID: serviceId}
+	if s.mockId == 3 {
+		return nil, errors.New("Simulated Fail Error from Snapshot")
+	}
+	snapshot.Service = new(framework.ServiceInformation)
+	snapshot.Service.ID = serviceId
+	snapshot.Service.Version = "VERSION-1.0"
+	return snapshot, nil
+}
+
+func (s *StackMock) Restore(ctx context.Context, snapshot *ServiceSnapshot) error {
+	s.Called(snapshot)
+	return nil
+}
+
+func (s *StackMock) Scale(ctx context.Context, serviceId string, instances int) (*framework.ServiceInformation, error) {
+	s.Called(serviceId, instances)
+	if s.mockId != 1 {
+		return nil, fmt.Errorf("The service %s does not exist", serviceId)
+	}
+	return &framework.ServiceInformation{ID: serviceId}, nil
+}
+
+func (s *StackMock) SupportsBlueGreen() bool {
+	s.Called()
+	return s.mockId == 1
+}
+
+func (s *StackMock) LabelService(ctx context.Context, serviceId string, labels map[string]string) error {
+	s.Called(serviceId, labels)
+	return nil
 }
 
 func TestConstructor(t *testing.T) {
@@ -100,7 +144,7 @@ func TestConstructor(t *testing.T) {
 			},
 		},
 	}
-	sm, _ := NewStackManager(config)
+	sm, _ := NewStackManager(config, ClusterSelector{})
 	assert.NotNil(t, sm, "Instance should be healthy")
 	v := reflect.ValueOf(sm).Elem()
 	stacks := v.FieldByName("stacks")
@@ -112,21 +156,63 @@ func TestDeployMethod(t *testing.T) {
 	sm.stacks = make(map[string]StackInterface)
 	sm.stackNotification = make(chan StackStatus, 100)
 
+	svc := framework.ServiceConfig{ServiceID: "nginx"}
+
+	okMock := new(StackMock)
+	okMock.mockId = 1
+	okMock.On("Snapshot", "nginx").Return().On("DeployCheckAndNotify", svc, 2, 0.0, mock.AnythingOfType("chan *cluster.ServiceInfoStatus")).WaitUntil(time.After(500 * time.Millisecond)).Return()
+	okMock.On("Restore", mock.AnythingOfType("*cluster.ServiceSnapshot")).Return()
+	sm.stacks["key1"] = okMock
+	failMock := new(StackMock)
+	failMock.mockId = 2
+	failMock.On("Snapshot", "nginx").Return().On("DeployCheckAndNotify", svc, 2, 0.0, mock.AnythingOfType("chan *cluster.ServiceInfoStatus")).Return()
+	sm.stacks["key2"] = failMock
+
+	assert.False(t, sm.Deploy(context.Background(), svc, DeployOptions{Instances: 2}).Succeeded(), "Deploy should fail")
+	okMock.AssertExpectations(t)
+	failMock.AssertExpectations(t)
+	failMock.AssertNotCalled(t, "Restore", mock.Anything)
+	restored := okMock.Calls[len(okMock.Calls)-1].Arguments.Get(0).(*ServiceSnapshot)
+	assert.Equal(t, "VERSION-1.0", restored.Service.Version, "Should restore the previous version")
+	assert.Equal(t, &svc, restored.Config, "Should record the definition of the deploy")
+}
+
+func TestDeploySnapshotError(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.stackNotification = make(chan StackStatus, 100)
+
+	svc := framework.ServiceConfig{ServiceID: "nginx"}
+
+	stackMock := new(StackMock)
+	stackMock.mockId = 3
+	stackMock.On("Snapshot", "nginx").Return()
+	sm.stacks["key1"] = stackMock
+
+	assert.False(t, sm.Deploy(context.Background(), svc, DeployOptions{Instances: 2}).Succeeded(), "Deploy should be aborted")
+	stackMock.AssertNotCalled(t, "DeployCheckAndNotify", svc, 2, 0.0, mock.Anything)
+}
+
+func TestDeployWithInstancesOverride(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.stackNotification = make(chan StackStatus, 100)
+
 	svc := framework.ServiceConfig{}
 
 	stackMock := new(StackMock)
 	stackMock.mockId = 1
-	stackMock.On("Rollback", "nginx", "VERSION-1.0").Return().On("DeployCheckAndNotify", svc, 2, 0.0, mock.AnythingOfType("chan *cluster.ServiceInfoStatus")).WaitUntil(time.After(500 * time.Millisecond)).Return()
-	key := "key1"
-	sm.stacks[key] = stackMock
-	stackMock = new(StackMock)
-	stackMock.mockId = 2
-	stackMock.On("Rollback", "nginx", "VERSION-1.0").Return().On("DeployCheckAndNotify", svc, 2, 0.0, mock.AnythingOfType("chan *cluster.ServiceInfoStatus")).WaitUntil(time.After(500 * time.Millisecond)).Return()
-	key = "key2"
-	sm.stacks[key] = stackMock
-	sm.Deploy(svc, 2, 0.0)
-	stackMock.AssertExpectations(t)
+	stackMock.On("Snapshot", "").Return().On("DeployCheckAndNotify", svc, 2, 0.0, mock.AnythingOfType("chan *cluster.ServiceInfoStatus")).Return()
+	sm.stacks["key1"] = stackMock
+	overriddenMock := new(StackMock)
+	overriddenMock.mockId = 1
+	overriddenMock.On("Snapshot", "").Return().On("DeployCheckAndNotify", svc, 5, 0.0, mock.AnythingOfType("chan *cluster.ServiceInfoStatus")).Return()
+	sm.stacks["key2"] = overriddenMock
 
+	result := sm.Deploy(context.Background(), svc, DeployOptions{Instances: 2, Overrides: map[string]configuration.ServiceOverride{"key2": {Instances: 5}}})
+	assert.True(t, result.Succeeded(), "Deploy should succeed")
+	stackMock.AssertExpectations(t)
+	overriddenMock.AssertExpectations(t)
 }
 
 func TestDeleteService(t *testing.T) {
@@ -138,32 +224,65 @@ func TestDeleteService(t *testing.T) {
 	stackMock.mockId = 1
 	key := "key1"
 	sm.stacks[key] = stackMock
+	stackMock.On("Snapshot", serviceId).Return()
 	stackMock.On("DeleteService", serviceId).Return(mock.AnythingOfType("chan error"))
 
-	err := sm.DeleteService(serviceId)
+	var backups []string
+	result := sm.DeleteService(context.Background(), serviceId, func(stackKey string, snapshot *ServiceSnapshot) error {
+		backups = append(backups, stackKey)
+		return nil
+	})
 	stackMock.AssertExpectations(t)
-	assert.Nil(t, err, "err should be nil")
+	assert.True(t, result.Succeeded(), "Delete should succeed")
+	assert.Equal(t, []string{key}, backups, "Should backup the stack before deleting")
 }
 func TestDeleteServiceError(t *testing.T) {
 	sm := new(StackManager)
 	sm.stacks = make(map[string]StackInterface)
 	sm.stackNotification = make(chan StackStatus, 100)
 	serviceId := "serviceId"
+	okMock := new(StackMock)
+	okMock.mockId = 1
+	sm.stacks["key1"] = okMock
+	okMock.On("Snapshot", serviceId).Return()
+	okMock.On("DeleteService", serviceId).Return(mock.AnythingOfType("chan error"))
+
+	failMock := new(StackMock)
+	failMock.mockId = 2
+	sm.stacks["key2"] = failMock
+	failMock.On("Snapshot", serviceId).Return()
+	failMock.On("DeleteService", serviceId).Return(mock.AnythingOfType("chan error"))
+
+	result := sm.DeleteService(context.Background(), serviceId, nil)
+	okMock.AssertExpectations(t)
+	failMock.AssertExpectations(t)
+	assert.False(t, result.Succeeded(), "Delete should fail")
+	assert.Equal(t, STACK_READY, result.Stacks["key1"].Status, "Should keep deleting on the other stacks")
+	assert.NotNil(t, result.Stacks["key2"].Error)
+}
+
+func TestDeleteServiceBackupError(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
 	stackMock := new(StackMock)
 	stackMock.mockId = 1
-	key := "key1"
-	sm.stacks[key] = stackMock
-	stackMock.On("DeleteService", serviceId).Return(mock.AnythingOfType("chan error"))
+	sm.stacks["key1"] = stackMock
+	stackMock.On("Snapshot", "serviceId").Return()
 
-	stackMock = new(StackMock)
-	stackMock.mockId = 2
-	key = "key2"
-	sm.stacks[key] = stackMock
-	stackMock.On("DeleteService", serviceId).Return(mock.AnythingOfType("chan error"))
+	result := sm.DeleteService(context.Background(), "serviceId", func(stackKey string, snapshot *ServiceSnapshot) error {
+		return errors.New("disk full")
+	})
+	assert.False(t, result.Succeeded(), "Delete should fail")
+	stackMock.AssertNotCalled(t, "DeleteService", "serviceId")
+}
 
-	err := sm.DeleteService(serviceId)
-	stackMock.AssertExpectations(t)
-	assert.NotNil(t, err, "err should be different from nil")
+func TestDeleteServiceMissing(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = map[string]StackInterface{"local": newStackWithFramework(new(FrameworkMock))}
+
+	result := sm.DeleteService(context.Background(), "nginx", nil)
+	assert.True(t, result.Succeeded())
+	assert.Equal(t, STACK_SKIPPED, result.Stacks["local"].Status, "Nothing to delete")
 }
 
 func TestFindServiceInformation(t *testing.T) {
@@ -175,7 +294,7 @@ func TestFindServiceInformation(t *testing.T) {
 	sm.stacks[key] = stackMock
 	search := "search"
 	stackMock.On("FindServiceInformation", search).Return(mock.AnythingOfType("[]*framework.ServiceInformation"))
-	sm.FindServiceInformation(search)
+	sm.FindServiceInformation(context.Background(), search)
 	stackMock.AssertExpectations(t)
 }
 
@@ -189,19 +308,7 @@ func TestFindServiceInformationError(t *testing.T) {
 	sm.stacks[key] = stackMock
 	search := "search"
 	stackMock.On("FindServiceInformation", search).Return(mock.AnythingOfType("[]*framework.ServiceInformation"))
-	sm.FindServiceInformation(search)
-	stackMock.AssertExpectations(t)
-}
-
-func TestRollback(t *testing.T) {
-	sm := new(StackManager)
-	sm.stacks = make(map[string]StackInterface)
-	sm.stackNotification = make(chan StackStatus, 100)
-	stackMock := new(StackMock)
-	key := "dal"
-	sm.stacks[key] = stackMock
-	stackMock.On("Rollback", "nginx", "VERSION-1.0").Return()
-	sm.Rollback("nginx", "VERSION-1.0")
+	sm.FindServiceInformation(context.Background(), search)
 	stackMock.AssertExpectations(t)
 }
 
@@ -229,6 +336,185 @@ func TestInvalidFramework(t *testing.T) {
 			},
 		},
 	}
-	_, err := NewStackManager(config)
+	_, err := NewStackManager(config, ClusterSelector{})
 	assert.NotNil(t, err, "Should return error")
 }
+
+func TestDeployTimeoutRollsBack(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.stackNotification = make(chan StackStatus, 100)
+
+	running := []*framework.ServiceInformation{{ID: "/nginx", ImageName: "nginx", ImageTag: "1.9", Version: "v1"}}
+	okFramework := &FrameworkMock{services: running}
+	okFramework.On("DeployService", mock.Anything, 2).Return()
+	// The recorded definition is deployed again with the running image
+	okFramework.On("DeployService", framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9"}, 0).Return()
+	sm.stacks["sjc"] = newStackWithFramework(okFramework)
+
+	stuck := &stuckFramework{FrameworkMock: FrameworkMock{services: running}, release: make(chan struct{})}
+	defer close(stuck.release)
+	// The recorded definition can not be deployed on the stuck stack, the framework rolls it back
+	stuck.On("RollbackService", "/nginx", "v1").Return()
+	stuckStack := newStackWithFramework(stuck)
+	stuckStack.operationTimeout = 20 * time.Millisecond
+	sm.stacks["scl"] = stuckStack
+
+	result := sm.Deploy(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, DeployOptions{Instances: 2})
+	assert.False(t, result.Succeeded(), "Deploy should fail")
+	assert.Equal(t, STACK_FAILED, result.Stacks["scl"].Status)
+	assert.Contains(t, result.Stacks["scl"].Error.Error(), "timed out")
+	assert.True(t, result.Stacks["scl"].RolledBack, "The stuck stack should be restored, its deploy can still finish")
+	assert.True(t, result.Stacks["sjc"].RolledBack, "The deployed stack should be restored")
+	okFramework.AssertExpectations(t)
+	stuck.AssertExpectations(t)
+}
+
+func TestDeployCancelledRollsBack(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.stackNotification = make(chan StackStatus, 100)
+
+	stuck := &stuckFramework{release: make(chan struct{})}
+	defer close(stuck.release)
+	stuck.On("DeleteService", "nginx").Return()
+	sm.stacks["scl"] = newStackWithFramework(stuck)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	result := sm.Deploy(ctx, framework.ServiceConfig{ServiceID: "nginx"}, DeployOptions{Instances: 1})
+	assert.False(t, result.Succeeded(), "Deploy should fail")
+	assert.NotNil(t, result.Error, "The interruption should be reported")
+	assert.True(t, result.Stacks["scl"].RolledBack, "The new service should be deleted")
+	stuck.AssertExpectations(t)
+}
+
+func TestDeployMixedFrameworks(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.stackNotification = make(chan StackStatus, 100)
+	sm.frameworks = map[string]string{"sjc": "marathon", "scl": "swarm"}
+
+	svc := framework.ServiceConfig{ServiceID: "nginx", CPUShares: 0.25}
+	marathonMock := &StackMock{mockId: 1}
+	marathonMock.On("Snapshot", "nginx").Return().On("DeployCheckAndNotify", framework.ServiceConfig{ServiceID: "nginx", CPUShares: 0.25}, 1, 0.0, mock.Anything).Return()
+	sm.stacks["sjc"] = marathonMock
+	swarmMock := &StackMock{mockId: 1}
+	swarmMock.On("Snapshot", "nginx").Return().On("DeployCheckAndNotify", framework.ServiceConfig{ServiceID: "nginx", CPUShares: 256}, 1, 0.0, mock.Anything).Return()
+	sm.stacks["scl"] = swarmMock
+
+	result := sm.Deploy(context.Background(), svc, DeployOptions{Instances: 1})
+	assert.True(t, result.Succeeded(), "Deploy should succeed")
+	marathonMock.AssertExpectations(t)
+	swarmMock.AssertExpectations(t)
+}
+
+func TestDeployInvalidCPU(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.stackNotification = make(chan StackStatus, 100)
+	sm.frameworks = map[string]string{"sjc": "marathon"}
+	stackMock := &StackMock{mockId: 1}
+	sm.stacks["sjc"] = stackMock
+
+	result := sm.Deploy(context.Background(), framework.ServiceConfig{ServiceID: "nginx", CPUShares: 2}, DeployOptions{Instances: 1})
+	assert.False(t, result.Succeeded(), "Deploy should be aborted")
+	assert.NotNil(t, result.Error)
+	stackMock.AssertNotCalled(t, "Snapshot", mock.Anything)
+}
+
+func TestDeployRehearsalWithFakeFramework(t *testing.T) {
+	config := &configuration.Configuration{
+		Clusters: map[string]configuration.Cluster{
+			"sjc": {Framework: configuration.Framework{"fake": configuration.Parameters{}}},
+			"scl": {Framework: configuration.Framework{"fake": configuration.Parameters{"fail-deploy": true}}},
+			"dal": {Framework: configuration.Framework{"fake": configuration.Parameters{"fail-instances": 50}}},
+		},
+	}
+	sm, err := NewStackManager(config, ClusterSelector{})
+	assert.Nil(t, err)
+
+	svc := framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9", Publish: []string{"8080/tcp"}}
+	result := sm.Deploy(context.Background(), svc, DeployOptions{Instances: 2, Tolerance: 0.6})
+	assert.False(t, result.Succeeded(), "The deploy on scl should fail")
+	assert.Equal(t, STACK_FAILED, result.Stacks["scl"].Status)
+	assert.Empty(t, sm.FindServiceInformation(context.Background(), "nginx"), "The stacks deployed should be restored")
+
+	delete(config.Clusters, "scl")
+	sm, err = NewStackManager(config, ClusterSelector{})
+	assert.Nil(t, err)
+	result = sm.Deploy(context.Background(), svc, DeployOptions{Instances: 2, Tolerance: 0.6})
+	assert.True(t, result.Succeeded(), "Deploy should succeed")
+	assert.Equal(t, STACK_READY, result.Stacks["sjc"].Status)
+	assert.Equal(t, STACK_DEGRADED, result.Stacks["dal"].Status, "Half of the instances of dal are down")
+	assert.Len(t, sm.FindServiceInformation(context.Background(), "nginx"), 2)
+}
+
+func TestConcurrentDeploysOfServices(t *testing.T) {
+	config := &configuration.Configuration{
+		Clusters: map[string]configuration.Cluster{
+			"sjc": {Framework: configuration.Framework{"fake": configuration.Parameters{}}},
+			"scl": {Framework: configuration.Framework{"fake": configuration.Parameters{}}},
+		},
+	}
+	sm, err := NewStackManager(config, ClusterSelector{})
+	assert.Nil(t, err)
+
+	serviceIDs := []string{"nginx", "redis"}
+	results := make([]*DeployResult, len(serviceIDs))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, serviceID := range serviceIDs {
+		wg.Add(1)
+		go func(i int, serviceID string) {
+			defer wg.Done()
+			<-start
+			svc := framework.ServiceConfig{ServiceID: serviceID, ImageName: serviceID, Tag: "1.0"}
+			results[i] = sm.Deploy(context.Background(), svc, DeployOptions{Instances: 2})
+			sm.FindServiceInformation(context.Background(), serviceID)
+		}(i, serviceID)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, result := range results {
+		assert.True(t, result.Succeeded(), "The deploy of %s should succeed", serviceIDs[i])
+	}
+	assert.Len(t, sm.FindServiceInformation(context.Background(), "nginx|redis"), 4)
+	assert.NotEmpty(t, sm.DeployedContainers())
+}
+
+func TestRollbackWithFakeFramework(t *testing.T) {
+	config := &configuration.Configuration{
+		Clusters: map[string]configuration.Cluster{
+			"sjc": {Framework: configuration.Framework{"fake": configuration.Parameters{}}},
+			"scl": {Framework: configuration.Framework{"fake": configuration.Parameters{}}},
+		},
+	}
+	sm, err := NewStackManager(config, ClusterSelector{})
+	assert.Nil(t, err)
+
+	svc := framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.8"}
+	previous := sm.Deploy(context.Background(), svc, DeployOptions{Instances: 1})
+	assert.True(t, previous.Succeeded())
+	svc.Tag = "1.9"
+	assert.True(t, sm.Deploy(context.Background(), svc, DeployOptions{Instances: 1}).Succeeded())
+
+	snapshots := map[string]*ServiceSnapshot{
+		"sjc": {ServiceID: "nginx", Service: previous.Stacks["sjc"].Service, Instances: 1},
+		"dal": {ServiceID: "nginx", Service: previous.Stacks["sjc"].Service, Instances: 1},
+	}
+	result := sm.Rollback(context.Background(), "nginx", snapshots)
+	assert.True(t, result.Succeeded(), "Rollback should succeed")
+	assert.True(t, result.Stacks["sjc"].RolledBack)
+	assert.Equal(t, STACK_SKIPPED, result.Stacks["scl"].Status, "The stack without snapshot keeps its version")
+	assert.NotContains(t, result.Stacks, "dal", "The stacks not selected are ignored")
+	status := sm.ServiceStatus(context.Background(), "nginx")
+	assert.Equal(t, "nginx:1.8", status["sjc"].Service.FullImageName())
+	assert.Equal(t, "nginx:1.9", status["scl"].Service.FullImageName())
+
+	snapshots["sjc"] = &ServiceSnapshot{ServiceID: "nginx", Service: &framework.ServiceInformation{ID: "nginx", ImageName: "nginx", ImageTag: "1.7"}}
+	result = sm.Rollback(context.Background(), "nginx", snapshots)
+	assert.False(t, result.Succeeded(), "The version of the snapshot is unknown")
+	assert.NotNil(t, result.Stacks["sjc"].RollbackError)
+}
@@ -0,0 +1,207 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// FrameworkMock behaves like marathon, returning an error when no service meets the criteria
+type FrameworkMock struct {
+	mock.Mock
+	services []*framework.ServiceInformation
+	findErr  error
+}
+
+func (f *FrameworkMock) ID() string { return "mock" }
+
+func (f *FrameworkMock) FindServiceInformation(criteria framework.ServiceInformationCriteria) ([]*framework.ServiceInformation, error) {
+	if f.findErr != nil {
+		return nil, f.findErr
+	}
+	filtered := criteria.MeetCriteria(f.services)
+	if len(filtered) == 0 {
+		return nil, errors.New("No services found")
+	}
+	return filtered, nil
+}
+
+func (f *FrameworkMock) UndeployInstance(string) error { return nil }
+
+func (f *FrameworkMock) DeployService(config framework.ServiceConfig, instances int) (*framework.ServiceInformation, error) {
+	f.Called(config, instances)
+	return &framework.ServiceInformation{ID: config.ServiceID}, nil
+}
+
+func (f *FrameworkMock) DeleteService(serviceId string) error {
+	f.Called(serviceId)
+	return nil
+}
+
+func (f *FrameworkMock) RollbackService(serviceId, version string) {
+	f.Called(serviceId, version)
+}
+
+func newStackWithFramework(fw framework.Framework) *Stack {
+	s := new(Stack)
+	s.id = "local"
+	s.frameworkApiHelper = fw
+	s.log = util.Log.WithField("stack", s.id)
+	return s
+}
+
+func TestSnapshotExistingService(t *testing.T) {
+	fw := new(FrameworkMock)
+	fw.services = []*framework.ServiceInformation{
+		{ID: "/other", ImageName: "nginx"},
+		{ID: "/nginx", ImageName: "nginx", ImageTag: "1.9", Version: "v1", Instances: []*framework.Instance{{ID: "1"}, {ID: "2"}}},
+	}
+	s := newStackWithFramework(fw)
+
+	snapshot, err := s.Snapshot(context.Background(), "nginx")
+	assert.Nil(t, err, "Should take the snapshot")
+	assert.True(t, snapshot.Exists(), "Service should exist")
+	assert.Equal(t, 2, snapshot.Instances)
+
+	fw.On("RollbackService", "/nginx", "v1").Return()
+	assert.Nil(t, s.Restore(context.Background(), snapshot))
+	fw.AssertExpectations(t)
+}
+
+func TestRestoreUnverifiedRollback(t *testing.T) {
+	fw := new(FrameworkMock)
+	fw.services = []*framework.ServiceInformation{{ID: "/nginx", ImageName: "nginx", ImageTag: "1.9", Version: "v1"}}
+	s := newStackWithFramework(fw)
+	snapshot, err := s.Snapshot(context.Background(), "nginx")
+	assert.Nil(t, err)
+
+	fw.services = []*framework.ServiceInformation{{ID: "/nginx", ImageName: "nginx", ImageTag: "1.10", Version: "v2"}}
+	fw.On("RollbackService", "/nginx", "v1").Return()
+	err = s.Restore(context.Background(), snapshot)
+	assert.NotNil(t, err, "The framework did not bring the previous image back")
+	assert.Contains(t, err.Error(), "nginx:1.10")
+
+	fw.services = nil
+	assert.NotNil(t, s.Restore(context.Background(), snapshot), "The service is missing after the rollback")
+}
+
+func TestRestoreRecordedDefinition(t *testing.T) {
+	fw := new(FrameworkMock)
+	fw.services = []*framework.ServiceInformation{{ID: "/nginx", ImageName: "nginx", ImageTag: "1.9", Version: "v1", Instances: []*framework.Instance{{ID: "1"}, {ID: "2"}}}}
+	s := newStackWithFramework(fw)
+	snapshot, err := s.Snapshot(context.Background(), "nginx")
+	assert.Nil(t, err)
+	snapshot.recordDeployed(framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.10", Envs: []string{"NGINX_PORT=80"}})
+
+	restored := framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9", Envs: []string{"NGINX_PORT=80"}}
+	fw.On("DeployService", restored, 2).Return()
+	assert.Nil(t, s.Restore(context.Background(), snapshot))
+	fw.AssertExpectations(t)
+	fw.AssertNotCalled(t, "RollbackService", mock.Anything, mock.Anything)
+}
+
+func TestRestoreFrameworkOnlyScales(t *testing.T) {
+	fw := new(FrameworkMock)
+	fw.services = []*framework.ServiceInformation{{ID: "/nginx", ImageName: "nginx", ImageTag: "1.9", Version: "v1", Instances: []*framework.Instance{{ID: "1"}}}}
+	s := newStackWithFramework(fw)
+	snapshot, err := s.Snapshot(context.Background(), "nginx")
+	assert.Nil(t, err)
+	snapshot.recordDeployed(framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.10"})
+
+	// The deploy only scales the service, it keeps running the new image
+	fw.services = []*framework.ServiceInformation{{ID: "/nginx", ImageName: "nginx", ImageTag: "1.10", Version: "v2"}}
+	fw.On("DeployService", mock.Anything, 1).Return()
+	fw.On("RollbackService", "/nginx", "v1").Run(func(mock.Arguments) {
+		fw.services = []*framework.ServiceInformation{{ID: "/nginx", ImageName: "nginx", ImageTag: "1.9", Version: "v3"}}
+	}).Return()
+	assert.Nil(t, s.Restore(context.Background(), snapshot))
+	fw.AssertExpectations(t)
+}
+
+func TestSnapshotNewService(t *testing.T) {
+	fw := new(FrameworkMock)
+	s := newStackWithFramework(fw)
+
+	snapshot, err := s.Snapshot(context.Background(), "nginx")
+	assert.Nil(t, err, "A service that does not exist is not an error")
+	assert.False(t, snapshot.Exists(), "Service should not exist")
+
+	fw.On("DeleteService", "nginx").Return()
+	assert.Nil(t, s.Restore(context.Background(), snapshot))
+	fw.AssertExpectations(t)
+}
+
+func TestSnapshotError(t *testing.T) {
+	fw := new(FrameworkMock)
+	fw.findErr = errors.New("connection refused")
+	s := newStackWithFramework(fw)
+
+	_, err := s.Snapshot(context.Background(), "nginx")
+	assert.NotNil(t, err, "Should return the error of the framework")
+}
+
+func TestHealthStatus(t *testing.T) {
+	service := &framework.ServiceInformation{Instances: []*framework.Instance{
+		{ID: "1", Status: framework.InstanceUp},
+		{ID: "2", Status: framework.InstanceUp},
+		{ID: "3", Status: framework.InstanceUp},
+		{ID: "4", Status: framework.InstanceDown},
+	}}
+	assert.Equal(t, STACK_DEGRADED, healthStatus(service, 0.5), "1 of 4 unhealthy is under the tolerance")
+	assert.Equal(t, STACK_FAILED, healthStatus(service, 0.25), "1 of 4 unhealthy is not under the tolerance")
+	service.Instances[3].Status = framework.InstanceUp
+	assert.Equal(t, STACK_READY, healthStatus(service, 0.0), "Every instance is healthy")
+	assert.Equal(t, STACK_READY, healthStatus(&framework.ServiceInformation{}, 0.0), "A service without instances is ready")
+}
+
+func TestDeployCheckAndNotifyTolerance(t *testing.T) {
+	fw := new(FrameworkMock)
+	s := newStackWithFramework(fw)
+	fw.On("DeployService", mock.Anything, 2).Return()
+	ch := make(chan *ServiceInfoStatus, 1)
+	s.DeployCheckAndNotify(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, 2, 0.5, ch)
+	assert.Equal(t, STACK_READY, (<-ch).status, "A service without instances is ready")
+}
+
+// stuckFramework does not answer the deploys until it is released
+type stuckFramework struct {
+	FrameworkMock
+	release chan struct{}
+}
+
+func (f *stuckFramework) DeployService(config framework.ServiceConfig, instances int) (*framework.ServiceInformation, error) {
+	<-f.release
+	return &framework.ServiceInformation{ID: config.ServiceID}, nil
+}
+
+func TestDeployOperationTimeout(t *testing.T) {
+	fw := &stuckFramework{release: make(chan struct{})}
+	defer close(fw.release)
+	s := newStackWithFramework(fw)
+	s.operationTimeout = 20 * time.Millisecond
+
+	ch := make(chan *ServiceInfoStatus, 1)
+	s.DeployCheckAndNotify(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, 1, 0.0, ch)
+	status := <-ch
+	assert.Equal(t, STACK_FAILED, status.status, "A stuck deploy should fail")
+	assert.IsType(t, &OperationInterrupted{}, status.err)
+	assert.Contains(t, status.err.Error(), "timed out")
+}
+
+func TestDeployCancelled(t *testing.T) {
+	fw := &stuckFramework{release: make(chan struct{})}
+	defer close(fw.release)
+	s := newStackWithFramework(fw)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := s.deployService(ctx, framework.ServiceConfig{ServiceID: "nginx"}, 1)
+	assert.NotNil(t, err, "A cancelled deploy should fail")
+	assert.Contains(t, err.Error(), "cancelled")
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"context"
+	"sort"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// UnknownInstances is the desired instances of a service when the framework can not describe it
+const UnknownInstances = -1
+
+// StackServiceStatus is the state of a service in a stack
+type StackServiceStatus struct {
+	// Service is nil when the service does not exist in the stack
+	Service *framework.ServiceInformation
+	// Config and Desired are only known when the framework implements ServiceInspector
+	Config  *framework.ServiceConfig
+	Desired int
+	Error   error
+}
+
+// Healthy counts the healthy instances of the service
+func (s *StackServiceStatus) Healthy() int {
+	if s.Service == nil {
+		return 0
+	}
+	return len(s.Service.Instances) - unhealthyInstances(s.Service)
+}
+
+// ServiceStatus queries the service on every stack concurrently, using the id of the stack as key
+func (sm *StackManager) ServiceStatus(ctx context.Context, serviceId string) map[string]*StackServiceStatus {
+	type stackStatus struct {
+		stackKey string
+		status   *StackServiceStatus
+	}
+	results := make(chan stackStatus, len(sm.stacks))
+	for stackKey := range sm.stacks {
+		go func(stackKey string) {
+			status := &StackServiceStatus{Desired: UnknownInstances}
+			snapshot, err := sm.stacks[stackKey].Snapshot(ctx, serviceId)
+			if err != nil {
+				status.Error = err
+			} else {
+				status.Service = snapshot.Service
+				if snapshot.Config != nil {
+					status.Config = snapshot.Config
+					status.Desired = snapshot.Instances
+				}
+			}
+			results <- stackStatus{stackKey, status}
+		}(stackKey)
+	}
+
+	statuses := make(map[string]*StackServiceStatus)
+	for range sm.stacks {
+		result := <-results
+		statuses[result.stackKey] = result.status
+	}
+	return statuses
+}
+
+// RunningTags returns the sorted tags of the service running on the stacks. The service drifts
+// when more than one tag is running
+func RunningTags(statuses map[string]*StackServiceStatus) []string {
+	seen := make(map[string]bool)
+	tags := make([]string, 0)
+	for _, status := range statuses {
+		if status.Service == nil || seen[status.Service.ImageTag] {
+			continue
+		}
+		seen[status.Service.ImageTag] = true
+		tags = append(tags, status.Service.ImageTag)
+	}
+	sort.Strings(tags)
+	return tags
+}
@@ -0,0 +1,37 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceStatus(t *testing.T) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	for key, mockId := range map[string]int{"sjc": 1, "scl": 3} {
+		stackMock := new(StackMock)
+		stackMock.mockId = mockId
+		stackMock.On("Snapshot", "nginx").Return()
+		sm.stacks[key] = stackMock
+	}
+
+	statuses := sm.ServiceStatus(context.Background(), "nginx")
+	assert.Equal(t, 2, len(statuses), "Should query every stack")
+	assert.Equal(t, "nginx", statuses["sjc"].Service.ID)
+	assert.Equal(t, UnknownInstances, statuses["sjc"].Desired, "The stack does not inspect the service")
+	assert.NotNil(t, statuses["scl"].Error, "Should keep the error of the stack")
+}
+
+func TestRunningTags(t *testing.T) {
+	statuses := map[string]*StackServiceStatus{
+		"sjc": {Service: &framework.ServiceInformation{ImageTag: "1.1"}},
+		"scl": {Service: &framework.ServiceInformation{ImageTag: "1.0"}},
+		"dal": {Service: &framework.ServiceInformation{ImageTag: "1.1"}},
+		"wdc": {Error: errors.New("Connection refused")},
+	}
+	assert.Equal(t, []string{"1.0", "1.1"}, RunningTags(statuses))
+}
@@ -0,0 +1,188 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+const (
+	// StrategyParallel deploys on every stack at the same time
+	StrategyParallel = "parallel"
+	// StrategySequential deploys stack by stack and stops at the first failure
+	StrategySequential = "sequential"
+	// StrategyCanary deploys on the canary stack, checks its health during the soak time and
+	// then deploys on the rest of the stacks at the same time
+	StrategyCanary = "canary"
+	// StrategyBlueGreen deploys the new version next to the current one on every stack and moves
+	// the active label to it once every stack is healthy
+	StrategyBlueGreen = "blue-green"
+
+	defaultSoakInterval = 10
+)
+
+// newTimer creates the timers of the waits, the tests replace it so they do not wait
+var newTimer = time.NewTimer
+
+// sleepContext waits the duration unless the context is done before, in that case it returns
+// the error of the context
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	timer := newTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mergeDeployPolicy replaces the values of the policy with the non empty values of override
+func mergeDeployPolicy(policy, override configuration.DeployPolicy) configuration.DeployPolicy {
+	if override.Strategy != "" {
+		policy.Strategy = override.Strategy
+	}
+	if len(override.Order) != 0 {
+		policy.Order = override.Order
+	}
+	if override.Canary != "" {
+		policy.Canary = override.Canary
+	}
+	if override.SoakTime != 0 {
+		policy.SoakTime = override.SoakTime
+	}
+	if override.SoakInterval != 0 {
+		policy.SoakInterval = override.SoakInterval
+	}
+	if override.KeepOld != 0 {
+		policy.KeepOld = override.KeepOld
+	}
+	if override.ActiveLabel != "" {
+		policy.ActiveLabel = override.ActiveLabel
+	}
+	if policy.Strategy == "" {
+		policy.Strategy = StrategyParallel
+	}
+	return policy
+}
+
+// orderedStackKeys returns the stacks following the configured order, the stacks that are not
+// part of the order are deployed at the end in alphabetical order
+func (sm *StackManager) orderedStackKeys(order []string) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, stackKey := range order {
+		if _, ok := sm.stacks[stackKey]; !ok {
+			return nil, fmt.Errorf("The stack %s of the deploy order is not configured", stackKey)
+		}
+		if !seen[stackKey] {
+			keys = append(keys, stackKey)
+			seen[stackKey] = true
+		}
+	}
+
+	var rest []string
+	for stackKey := range sm.stacks {
+		if !seen[stackKey] {
+			rest = append(rest, stackKey)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...), nil
+}
+
+// deployWaves splits the stacks in groups deployed one after the other according to the strategy.
+// The stacks of a group are deployed at the same time
+func (sm *StackManager) deployWaves(policy configuration.DeployPolicy) ([][]string, error) {
+	keys, err := sm.orderedStackKeys(policy.Order)
+	if err != nil {
+		return nil, err
+	}
+
+	switch policy.Strategy {
+	case StrategyParallel, StrategyBlueGreen:
+		return [][]string{keys}, nil
+	case StrategySequential:
+		waves := make([][]string, len(keys))
+		for i, stackKey := range keys {
+			waves[i] = []string{stackKey}
+		}
+		return waves, nil
+	case StrategyCanary:
+		if _, ok := sm.stacks[policy.Canary]; !ok {
+			return nil, fmt.Errorf("The canary stack \"%s\" is not configured", policy.Canary)
+		}
+		waves := [][]string{{policy.Canary}}
+		var rest []string
+		for _, stackKey := range keys {
+			if stackKey != policy.Canary {
+				rest = append(rest, stackKey)
+			}
+		}
+		if len(rest) != 0 {
+			waves = append(waves, rest)
+		}
+		return waves, nil
+	default:
+		return nil, fmt.Errorf("Unknown deploy strategy %s", policy.Strategy)
+	}
+}
+
+// soak checks the health of the instances of the service on the canary stack until the soak
+// time finishes. It fails as soon as the service is missing or its unhealthy instances exceed
+// the tolerance
+func (sm *StackManager) soak(ctx context.Context, stackKey, serviceID string, policy configuration.DeployPolicy, tolerance float64) error {
+	interval := policy.SoakInterval
+	if interval <= 0 {
+		interval = defaultSoakInterval
+	}
+	util.Log.Infof("Soaking %s on canary stack %s during %d seconds", serviceID, stackKey, policy.SoakTime)
+
+	deadline := time.Now().Add(time.Duration(policy.SoakTime) * time.Second)
+	for {
+		service, err := sm.stacks[stackKey].FindService(ctx, serviceID)
+		if err == nil && service == nil {
+			err = fmt.Errorf("the service %s does not exist", serviceID)
+		}
+		if err == nil && healthStatus(service, tolerance) == STACK_FAILED {
+			err = fmt.Errorf("%d of %d instances are unhealthy", unhealthyInstances(service), len(service.Instances))
+		}
+		if err != nil {
+			util.Log.Errorf("Canary check fails on stack %s: %s", stackKey, err)
+			return fmt.Errorf("Canary check fails on stack %s: %s", stackKey, err)
+		}
+
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			break
+		}
+		wait := time.Duration(interval) * time.Second
+		if wait > remaining {
+			wait = remaining
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return fmt.Errorf("Canary check on stack %s was interrupted: %s", stackKey, err)
+		}
+	}
+
+	util.Log.Infof("Canary %s is healthy on stack %s", serviceID, stackKey)
+	return nil
+}
+
+func unhealthyInstances(service *framework.ServiceInformation) int {
+	unhealthy := 0
+	for _, instance := range service.Instances {
+		if !instance.Healthy() {
+			unhealthy++
+		}
+	}
+	return unhealthy
+}
@@ -0,0 +1,134 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newStrategyStackManager(mocks map[string]int, policy configuration.DeployPolicy) (*StackManager, map[string]*StackMock) {
+	sm := new(StackManager)
+	sm.stacks = make(map[string]StackInterface)
+	sm.stackNotification = make(chan StackStatus, 100)
+	sm.policy = policy
+	stackMocks := make(map[string]*StackMock)
+	for key, mockId := range mocks {
+		stackMock := new(StackMock)
+		stackMock.mockId = mockId
+		stackMock.On("Snapshot", "nginx").Return()
+		stackMock.On("DeployCheckAndNotify", mock.Anything, 1, 0.0, mock.Anything).Return()
+		stackMock.On("FindService", "nginx").Return()
+		stackMock.On("Restore", mock.Anything).Return()
+		sm.stacks[key] = stackMock
+		stackMocks[key] = stackMock
+	}
+	return sm, stackMocks
+}
+
+func TestMergeDeployPolicy(t *testing.T) {
+	policy := mergeDeployPolicy(configuration.DeployPolicy{}, configuration.DeployPolicy{})
+	assert.Equal(t, StrategyParallel, policy.Strategy, "Parallel should be the default strategy")
+
+	policy = mergeDeployPolicy(configuration.DeployPolicy{Strategy: StrategyCanary, Canary: "sjc", SoakTime: 60}, configuration.DeployPolicy{Canary: "scl"})
+	assert.Equal(t, StrategyCanary, policy.Strategy)
+	assert.Equal(t, "scl", policy.Canary, "Should override the canary")
+	assert.Equal(t, 60, policy.SoakTime)
+}
+
+func TestDeployWaves(t *testing.T) {
+	sm, _ := newStrategyStackManager(map[string]int{"sjc": 1, "scl": 1, "dal": 1}, configuration.DeployPolicy{})
+
+	waves, err := sm.deployWaves(configuration.DeployPolicy{Strategy: StrategySequential, Order: []string{"scl"}})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"scl"}, {"dal"}, {"sjc"}}, waves)
+
+	waves, err = sm.deployWaves(configuration.DeployPolicy{Strategy: StrategyCanary, Canary: "sjc"})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"sjc"}, {"dal", "scl"}}, waves)
+
+	_, err = sm.deployWaves(configuration.DeployPolicy{Strategy: StrategyCanary, Canary: "wdc"})
+	assert.NotNil(t, err, "Canary stack should be configured")
+
+	_, err = sm.deployWaves(configuration.DeployPolicy{Strategy: StrategySequential, Order: []string{"wdc"}})
+	assert.NotNil(t, err, "Stacks of the order should be configured")
+}
+
+func TestSequentialDeployStopsAtFirstFailure(t *testing.T) {
+	policy := configuration.DeployPolicy{Strategy: StrategySequential, Order: []string{"sjc", "scl", "dal"}}
+	sm, mocks := newStrategyStackManager(map[string]int{"sjc": 1, "scl": 2, "dal": 1}, policy)
+
+	result := sm.Deploy(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, DeployOptions{Instances: 1})
+	assert.False(t, result.Succeeded(), "Deploy should fail")
+	mocks["sjc"].AssertCalled(t, "Restore", mock.Anything)
+	mocks["dal"].AssertNotCalled(t, "DeployCheckAndNotify", mock.Anything, 1, 0.0, mock.Anything)
+	assert.True(t, result.Stacks["sjc"].RolledBack, "Deployed stack should be rolled back")
+	assert.Equal(t, STACK_FAILED, result.Stacks["scl"].Status)
+	assert.Equal(t, STACK_SKIPPED, result.Stacks["dal"].Status, "The deploy never reached the stack")
+}
+
+func TestCanaryDeploy(t *testing.T) {
+	_, restore := stubSleep()
+	defer restore()
+
+	policy := configuration.DeployPolicy{Strategy: StrategyCanary, Canary: "sjc"}
+	sm, mocks := newStrategyStackManager(map[string]int{"sjc": 1, "scl": 1}, policy)
+
+	result := sm.Deploy(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, DeployOptions{Instances: 1})
+	assert.True(t, result.Succeeded(), "Deploy should succeed")
+	mocks["sjc"].AssertCalled(t, "FindService", "nginx")
+	mocks["scl"].AssertCalled(t, "DeployCheckAndNotify", mock.Anything, 1, 0.0, mock.Anything)
+}
+
+func TestSleepContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	assert.Equal(t, context.Canceled, sleepContext(ctx, time.Hour))
+	assert.True(t, time.Since(start) < time.Minute, "Should stop waiting when the context is cancelled")
+	assert.Equal(t, context.Canceled, sleepContext(ctx, time.Hour), "Should not wait on a done context")
+}
+
+func TestCanaryUnhealthy(t *testing.T) {
+	policy := configuration.DeployPolicy{Strategy: StrategyCanary, Canary: "sjc"}
+	sm, mocks := newStrategyStackManager(map[string]int{"scl": 1}, policy)
+	canary := new(StackMock)
+	canary.mockId = 4
+	canary.On("Snapshot", "nginx").Return()
+	canary.On("FindService", "nginx").Return()
+	canary.On("Restore", mock.Anything).Return()
+	canary.On("DeployCheckAndNotify", mock.Anything, 1, 0.0, mock.Anything).Return()
+	sm.stacks["sjc"] = canary
+
+	result := sm.Deploy(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, DeployOptions{Instances: 1})
+	assert.False(t, result.Succeeded(), "Deploy should fail")
+	canary.AssertCalled(t, "Restore", mock.Anything)
+	mocks["scl"].AssertNotCalled(t, "DeployCheckAndNotify", mock.Anything, 1, 0.0, mock.Anything)
+	assert.NotNil(t, result.Error, "Should report why the canary failed")
+}
+
+func TestDeployDegraded(t *testing.T) {
+	sm, _ := newStrategyStackManager(map[string]int{"sjc": 1}, configuration.DeployPolicy{})
+	sm.stacks["scl"] = &degradedStackMock{StackMock: sm.stacks["sjc"].(*StackMock)}
+
+	result := sm.Deploy(context.Background(), framework.ServiceConfig{ServiceID: "nginx"}, DeployOptions{Instances: 1})
+	assert.True(t, result.Succeeded(), "Degraded deploy should succeed")
+	assert.Equal(t, STACK_DEGRADED, result.Status)
+	assert.Equal(t, STACK_DEGRADED, result.Stacks["scl"].Status)
+	assert.Equal(t, STACK_READY, result.Stacks["sjc"].Status)
+}
+
+type degradedStackMock struct {
+	*StackMock
+}
+
+func (s *degradedStackMock) DeployCheckAndNotify(ctx context.Context, serviceConfig framework.ServiceConfig, instances int, tolerance float64, ch chan *ServiceInfoStatus) {
+	ch <- &ServiceInfoStatus{status: STACK_DEGRADED}
+}
@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// frameworkUnits describes how a framework reads the resources of a service. The manifests
+// always give the CPU in cores, as marathon does, and it is translated for every framework
+type frameworkUnits struct {
+	// cpuPerCore is the value of one core on the framework
+	cpuPerCore float64
+	// maxCPU is the highest CPU in cores accepted on the framework, there is no limit when it is zero
+	maxCPU float64
+}
+
+// defaultFrameworkUnits is used by the frameworks without their own units
+var defaultFrameworkUnits = frameworkUnits{cpuPerCore: 1}
+
+var frameworksUnits = map[string]frameworkUnits{
+	"marathon": {cpuPerCore: 1, maxCPU: 1},
+	// swarm gives relative cpu shares to the containers, 1024 shares are one core
+	"swarm": {cpuPerCore: 1024, maxCPU: 1},
+	// kubernetes takes the cores and translates them to millicores itself
+	"kubernetes": {cpuPerCore: 1},
+	// nomad reserves the cpu in MHz, a core is taken as 1000 MHz
+	"nomad": {cpuPerCore: 1000},
+}
+
+func unitsOf(frameworkType string) frameworkUnits {
+	if units, ok := frameworksUnits[frameworkType]; ok {
+		return units
+	}
+	return defaultFrameworkUnits
+}
+
+// translateServiceConfig returns a copy of the config with the values in the units of the
+// framework. It fails when a value is out of the range accepted on the framework
+func translateServiceConfig(frameworkType string, config framework.ServiceConfig) (framework.ServiceConfig, error) {
+	units := unitsOf(frameworkType)
+	if units.maxCPU > 0 && config.CPUShares > units.maxCPU {
+		return config, fmt.Errorf("Cpu value should not be > %v cores for %s", units.maxCPU, frameworkType)
+	}
+	config.CPUShares *= units.cpuPerCore
+	return config, nil
+}
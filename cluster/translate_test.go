@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateServiceConfig(t *testing.T) {
+	config := framework.ServiceConfig{ServiceID: "nginx", CPUShares: 0.5, Memory: 256}
+
+	translated, err := translateServiceConfig("marathon", config)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, translated.CPUShares, "Marathon uses cores")
+
+	translated, err = translateServiceConfig("swarm", config)
+	assert.Nil(t, err)
+	assert.Equal(t, 512.0, translated.CPUShares, "Swarm uses 1024 shares per core")
+	assert.Equal(t, int64(256), translated.Memory)
+	assert.Equal(t, 0.5, config.CPUShares, "Should not modify the config")
+
+	translated, err = translateServiceConfig("nomad", config)
+	assert.Nil(t, err)
+	assert.Equal(t, 500.0, translated.CPUShares, "Nomad uses MHz")
+
+	translated, err = translateServiceConfig("other", config)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, translated.CPUShares, "Unknown frameworks use cores")
+}
+
+func TestTranslateServiceConfigMaxCPU(t *testing.T) {
+	_, err := translateServiceConfig("marathon", framework.ServiceConfig{CPUShares: 1.1})
+	assert.NotNil(t, err, "Should fail over the max of marathon")
+	_, err = translateServiceConfig("swarm", framework.ServiceConfig{CPUShares: 1025})
+	assert.NotNil(t, err, "The cpu of the manifest is in cores for swarm too")
+	_, err = translateServiceConfig("other", framework.ServiceConfig{CPUShares: 8})
+	assert.Nil(t, err, "Unknown frameworks have no max")
+}
+
+func TestSnapshotCPURoundTrip(t *testing.T) {
+	for _, frameworkType := range []string{"marathon", "swarm", "nomad", "kubernetes", "other"} {
+		translated, err := translateServiceConfig(frameworkType, framework.ServiceConfig{ServiceID: "nginx", CPUShares: 0.5})
+		assert.Nil(t, err)
+		snapshot := &ServiceSnapshot{ServiceID: "nginx", Config: &translated, Framework: frameworkType}
+		assert.Equal(t, 0.5, snapshot.CPU(), "The cpu of %s should be given back in cores", frameworkType)
+
+		again, err := translateServiceConfig(frameworkType, framework.ServiceConfig{CPUShares: snapshot.CPU()})
+		assert.Nil(t, err)
+		assert.Equal(t, translated.CPUShares, again.CPUShares, "Deploying the snapshot should reserve the same cpu on %s", frameworkType)
+	}
+	assert.Equal(t, 0.0, (&ServiceSnapshot{Framework: "nomad"}).CPU(), "Without the config the cpu is unknown")
+}
@@ -0,0 +1,176 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// Defaults of the verification of the instances
+const (
+	defaultVerifyAttempts = 3
+	defaultVerifyInterval = 5 * time.Second
+	defaultVerifyTimeout  = 5 * time.Second
+)
+
+// instanceAddress returns the host:port where crane reaches the port of the instance. The port is
+// the one of the verification, matched against the internal and public ports, or the lowest.
+// The advertised address is used as it is when it has a port, swarm advertises only the IP of
+// the node, that publishes the port
+func instanceAddress(instance *framework.Instance, port int64) (string, error) {
+	ports := make([]framework.InstancePort, 0, len(instance.Ports))
+	for _, p := range instance.Ports {
+		if p.Type == framework.UDP {
+			continue
+		}
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Internal < ports[j].Internal })
+
+	for _, p := range ports {
+		matches := port == 0 || p.Internal == port
+		for _, public := range p.Publics {
+			matches = matches || public == port
+		}
+		if !matches {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(p.Advertise); err == nil {
+			return p.Advertise, nil
+		}
+		if p.Advertise != "" {
+			published := p.Internal
+			if len(p.Publics) > 0 {
+				published = p.Publics[0]
+			}
+			return net.JoinHostPort(p.Advertise, strconv.FormatInt(published, 10)), nil
+		}
+		return net.JoinHostPort(instance.Host, strconv.FormatInt(p.Internal, 10)), nil
+	}
+	if port != 0 {
+		return "", fmt.Errorf("The instance has no TCP port %d", port)
+	}
+	return "", errors.New("The instance has no TCP port")
+}
+
+// checkInstance runs the verification once against the address
+func checkInstance(ctx context.Context, verify configuration.Verification, path, address string) error {
+	timeout := defaultVerifyTimeout
+	if verify.Timeout > 0 {
+		timeout = time.Duration(verify.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if verify.Type == configuration.VerifyTCP {
+		conn, err := new(net.Dialer).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+address+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if len(verify.ExpectedStatus) == 0 {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s responds %s", path, resp.Status)
+		}
+		return nil
+	}
+	for _, status := range verify.ExpectedStatus {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("GET %s responds %s, expected %v", path, resp.Status, verify.ExpectedStatus)
+}
+
+// verifyInstance retries the verification of the instance until it passes or the attempts run out
+func verifyInstance(ctx context.Context, verify configuration.Verification, path string, instance *framework.Instance) error {
+	address, err := instanceAddress(instance, verify.Port)
+	if err != nil {
+		return err
+	}
+	attempts := defaultVerifyAttempts
+	if verify.Attempts > 0 {
+		attempts = verify.Attempts
+	}
+	interval := defaultVerifyInterval
+	if verify.Interval > 0 {
+		interval = time.Duration(verify.Interval) * time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err = checkInstance(ctx, verify, path, address); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("%s: %s", address, err)
+		}
+		if sleepContext(ctx, interval) != nil {
+			return fmt.Errorf("%s: %s", address, err)
+		}
+	}
+}
+
+// verifyService verifies at the same time every healthy instance of the service. The instances
+// that fail are marked as down, so they count against the tolerance. The path of the http
+// verification is by default the path of the health check of the service. It returns the
+// number of instances that failed
+func verifyService(ctx context.Context, stackKey string, service *framework.ServiceInformation, verify configuration.Verification, serviceConfig framework.ServiceConfig) int {
+	if service == nil || !verify.Enabled() {
+		return 0
+	}
+	path := verify.Path
+	if path == "" && serviceConfig.HealthCheckConfig != nil {
+		path = serviceConfig.HealthCheckConfig.Path
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	failed := 0
+	for _, instance := range service.Instances {
+		if !instance.Healthy() {
+			continue
+		}
+		wg.Add(1)
+		go func(instance *framework.Instance) {
+			defer wg.Done()
+			if err := verifyInstance(ctx, verify, path, instance); err != nil {
+				util.Log.Errorf("The instance %s of %s on stack %s fails the %s verification: %s", instance.ID, service.ID, stackKey, verify.Type, err)
+				mutex.Lock()
+				instance.Status = framework.InstanceDown
+				failed++
+				mutex.Unlock()
+			}
+		}(instance)
+	}
+	wg.Wait()
+	return failed
+}
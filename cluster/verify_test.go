@@ -0,0 +1,197 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/crane/configuration"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// instanceAt returns an instance listening on the address of the server
+func instanceAt(t *testing.T, id, address string) *framework.Instance {
+	host, port, err := net.SplitHostPort(address)
+	assert.Nil(t, err)
+	internal, _ := strconv.ParseInt(port, 10, 64)
+	return &framework.Instance{
+		ID:     id,
+		Host:   host,
+		Status: framework.InstanceUp,
+		Ports:  map[string]framework.InstancePort{"8080/TCP": {Internal: internal, Publics: []int64{8080}, Type: framework.TCP}},
+	}
+}
+
+func TestInstanceAddress(t *testing.T) {
+	instance := &framework.Instance{
+		Host: "10.0.0.1",
+		Ports: map[string]framework.InstancePort{
+			"9090/TCP": {Internal: 31002, Publics: []int64{9090}, Type: framework.TCP},
+			"8080/TCP": {Internal: 31001, Publics: []int64{8080}, Type: framework.TCP},
+			"53/UDP":   {Internal: 31000, Publics: []int64{53}, Type: framework.UDP},
+		},
+	}
+	address, err := instanceAddress(instance, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:31001", address, "The lowest TCP port")
+
+	address, err = instanceAddress(instance, 9090)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:31002", address, "The port is matched against the public ports")
+
+	instance.Ports["9090/TCP"] = framework.InstancePort{Advertise: "node-1:30090", Internal: 9090, Type: framework.TCP}
+	address, err = instanceAddress(instance, 9090)
+	assert.Nil(t, err)
+	assert.Equal(t, "node-1:30090", address)
+
+	swarm := &framework.Instance{
+		Host: "worker-1",
+		Ports: map[string]framework.InstancePort{
+			"8080/TCP": {Advertise: "10.0.0.2", Internal: 8080, Publics: []int64{30080}, Type: framework.TCP},
+			"9090/TCP": {Advertise: "10.0.0.2", Internal: 9090, Type: framework.TCP},
+		},
+	}
+	address, err = instanceAddress(swarm, 8080)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2:30080", address, "Swarm advertises the IP of the node, that publishes the port")
+	address, err = instanceAddress(swarm, 9090)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2:9090", address, "The internal port when the port is not published")
+
+	_, err = instanceAddress(instance, 7070)
+	assert.NotNil(t, err)
+	_, err = instanceAddress(&framework.Instance{Host: "10.0.0.1"}, 0)
+	assert.NotNil(t, err)
+}
+
+func TestCheckInstanceHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/slow":
+			time.Sleep(2 * time.Second)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	address := server.Listener.Addr().String()
+	verify := configuration.Verification{Type: configuration.VerifyHTTP}
+
+	assert.Nil(t, checkInstance(context.Background(), verify, "/health", address))
+	assert.Nil(t, checkInstance(context.Background(), verify, "/empty", address))
+	err := checkInstance(context.Background(), verify, "/broken", address)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "500")
+
+	verify.ExpectedStatus = []int{200}
+	assert.NotNil(t, checkInstance(context.Background(), verify, "/empty", address), "Only the expected status pass")
+	verify.ExpectedStatus = []int{500}
+	assert.Nil(t, checkInstance(context.Background(), verify, "/broken", address))
+
+	verify.Timeout = 1
+	assert.NotNil(t, checkInstance(context.Background(), verify, "/slow", address))
+}
+
+func TestCheckInstanceTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+	verify := configuration.Verification{Type: configuration.VerifyTCP}
+
+	assert.Nil(t, checkInstance(context.Background(), verify, "/", address))
+	listener.Close()
+	assert.NotNil(t, checkInstance(context.Background(), verify, "/", address))
+}
+
+func TestVerifyServiceRetries(t *testing.T) {
+	waits, restore := stubSleep()
+	defer restore()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	service := &framework.ServiceInformation{ID: "nginx", Instances: []*framework.Instance{instanceAt(t, "a", server.Listener.Addr().String())}}
+	svc := framework.ServiceConfig{HealthCheckConfig: &framework.HealthCheck{Path: "health"}}
+	assert.Equal(t, 0, verifyService(context.Background(), "sjc", service, configuration.Verification{Type: configuration.VerifyHTTP}, svc))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests), "The third attempt passes")
+	assert.Equal(t, []time.Duration{defaultVerifyInterval, defaultVerifyInterval}, *waits)
+
+	atomic.StoreInt32(&requests, 0)
+	verify := configuration.Verification{Type: configuration.VerifyHTTP, Attempts: 2}
+	assert.Equal(t, 1, verifyService(context.Background(), "sjc", service, verify, svc))
+	assert.False(t, service.Instances[0].Healthy(), "The instance that fails is marked as down")
+}
+
+func TestVerifyServiceDisabled(t *testing.T) {
+	service := &framework.ServiceInformation{Instances: []*framework.Instance{{ID: "a", Status: framework.InstanceUp}}}
+	assert.Equal(t, 0, verifyService(context.Background(), "sjc", service, configuration.Verification{}, framework.ServiceConfig{}))
+	assert.Equal(t, 0, verifyService(context.Background(), "sjc", nil, configuration.Verification{Type: configuration.VerifyTCP}, framework.ServiceConfig{}))
+}
+
+// verifiedStackMock deploys the instances given
+type verifiedStackMock struct {
+	StackMock
+	instances []*framework.Instance
+}
+
+func (s *verifiedStackMock) DeployCheckAndNotify(ctx context.Context, serviceConfig framework.ServiceConfig, instances int, tolerance float64, ch chan *ServiceInfoStatus) {
+	s.Called(serviceConfig, instances, tolerance, ch)
+	ch <- &ServiceInfoStatus{
+		status:      STACK_READY,
+		serviceInfo: &framework.ServiceInformation{ID: serviceConfig.ServiceID, Instances: s.instances},
+	}
+}
+
+func TestDeployVerification(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	svc := framework.ServiceConfig{ServiceID: "nginx"}
+	newStack := func(addresses ...string) *verifiedStackMock {
+		stack := new(verifiedStackMock)
+		for i, address := range addresses {
+			stack.instances = append(stack.instances, instanceAt(t, strconv.Itoa(i), address))
+		}
+		stack.On("Snapshot", "nginx").Return().On("DeployCheckAndNotify", svc, 2, 0.5, mock.AnythingOfType("chan *cluster.ServiceInfoStatus")).Return()
+		stack.On("Restore", mock.AnythingOfType("*cluster.ServiceSnapshot")).Return()
+		return stack
+	}
+	healthyAddress, brokenAddress := healthy.Listener.Addr().String(), broken.Listener.Addr().String()
+
+	sm := new(StackManager)
+	degraded := newStack(healthyAddress, healthyAddress, brokenAddress)
+	sm.stacks = map[string]StackInterface{"sjc": newStack(healthyAddress, healthyAddress), "scl": degraded}
+	options := DeployOptions{Instances: 2, Tolerance: 0.5, Verify: configuration.Verification{Type: configuration.VerifyHTTP, Attempts: 1}}
+	result := sm.Deploy(context.Background(), svc, options)
+	assert.True(t, result.Succeeded())
+	assert.Equal(t, STACK_READY, result.Stacks["sjc"].Status)
+	assert.Equal(t, STACK_DEGRADED, result.Stacks["scl"].Status, "One of three instances fails the verification")
+
+	failed := newStack(healthyAddress, brokenAddress)
+	sm.stacks["scl"] = failed
+	result = sm.Deploy(context.Background(), svc, options)
+	assert.False(t, result.Succeeded())
+	assert.Equal(t, STACK_FAILED, result.Stacks["scl"].Status)
+	assert.Contains(t, result.Stacks["scl"].Error.Error(), "http verification")
+	assert.True(t, result.Stacks["scl"].RolledBack, "The stack that fails the verification is rolled back")
+	failed.AssertCalled(t, "Restore", mock.AnythingOfType("*cluster.ServiceSnapshot"))
+}
@@ -12,6 +12,33 @@ type Parameters map[string]interface{}
 type Cluster struct {
 	Disabled  bool      `yaml:"disabled"`
 	Framework Framework `yaml:"framework"`
+	// Service valores que se sobreescriben en todos los servicios desplegados en el cluster
+	Service ServiceOverride `yaml:"service,omitempty"`
+	// Groups grupos del cluster, permiten seleccionar varios clusters con --cluster-group
+	Groups []string `yaml:"groups,omitempty"`
+	Retry  Retry    `yaml:"retry,omitempty"`
+	// OperationTimeout segundos que puede durar cada operación sobre el framework, sin límite si es 0
+	OperationTimeout int `yaml:"operation-timeout,omitempty"`
+}
+
+// Retry estructura para la configuración de los reintentos de las operaciones sobre el framework
+// de un cluster. Los backoff están en milisegundos y se duplican en cada intento. RetryOn indica
+// las clases de errores que se reintentan: connection, timeout, server-error o all
+type Retry struct {
+	Attempts       int      `yaml:"attempts,omitempty"`
+	InitialBackoff int      `yaml:"initial-backoff,omitempty"`
+	MaxBackoff     int      `yaml:"max-backoff,omitempty"`
+	RetryOn        []string `yaml:"retry-on,omitempty"`
+}
+
+// InGroup indica si el cluster pertenece al grupo
+func (c Cluster) InGroup(group string) bool {
+	for _, g := range c.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
 }
 
 // Logging structura para la configuracion de los logs de la App
@@ -22,10 +49,34 @@ type Loggging struct {
 	Output    string `yaml:"output" valid:"matches(console|file),required"`
 }
 
+// DeployPolicy estructura para la configuración de la estrategia de deploy entre clusters.
+// KeepOld son los segundos que se conserva la versión anterior en un deploy blue-green, vencidos
+// la borra el siguiente deploy y con 0 se borra al activar la nueva. ActiveLabel es el label que
+// marca la versión que recibe el tráfico
+type DeployPolicy struct {
+	Strategy     string   `yaml:"strategy,omitempty" valid:"matches(^parallel$|^sequential$|^canary$|^blue-green$)"`
+	Order        []string `yaml:"order,omitempty"`
+	Canary       string   `yaml:"canary,omitempty"`
+	SoakTime     int      `yaml:"soak-time,omitempty"`
+	SoakInterval int      `yaml:"soak-interval,omitempty"`
+	KeepOld      int      `yaml:"keep-old,omitempty"`
+	ActiveLabel  string   `yaml:"active-label,omitempty"`
+}
+
+// History estructura para la configuración del historial de operaciones sobre los clusters. Sin
+// Path se usa ~/.crane/history.jsonl
+type History struct {
+	Path     string `yaml:"path,omitempty"`
+	Disabled bool   `yaml:"disabled,omitempty"`
+}
+
 // Configuration estructura para la configuracion global de Crane
 type Configuration struct {
 	Clusters map[string]Cluster `yaml:"cluster"`
 	Logging  Loggging           `yaml:"logging"`
+	Deploy   DeployPolicy       `yaml:"deploy" valid:"optional"`
+	History  History            `yaml:"history,omitempty" valid:"optional"`
+	Hooks    Hooks              `yaml:"hooks,omitempty" valid:"optional"`
 }
 
 // Framework mapeo de un un Framework en base a su ID y sus parametros de configuración
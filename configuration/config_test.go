@@ -95,6 +95,86 @@ cluster:
         deploy-timeout: 30
 `
 
+func TestParseDeployPolicy(t *testing.T) {
+	var config Configuration
+	err := yaml.Unmarshal([]byte(`
+deploy:
+  strategy: canary
+  canary: sjc
+  order: [sjc, scl]
+  soak-time: 300
+`), &config)
+	assert.Nil(t, err)
+	assert.Equal(t, "canary", config.Deploy.Strategy)
+	assert.Equal(t, "sjc", config.Deploy.Canary)
+	assert.Equal(t, []string{"sjc", "scl"}, config.Deploy.Order)
+	assert.Equal(t, 300, config.Deploy.SoakTime)
+}
+
+func TestParseBlueGreenPolicy(t *testing.T) {
+	var config Configuration
+	err := yaml.Unmarshal([]byte(`
+deploy:
+  strategy: blue-green
+  keep-old: 3600
+  active-label: router.active
+`), &config)
+	assert.Nil(t, err)
+	assert.Equal(t, "blue-green", config.Deploy.Strategy)
+	assert.Equal(t, 3600, config.Deploy.KeepOld)
+	assert.Equal(t, "router.active", config.Deploy.ActiveLabel)
+}
+
+func TestParseClusterServiceOverride(t *testing.T) {
+	var config Configuration
+	err := yaml.Unmarshal([]byte(`
+cluster:
+  scl:
+    framework: marathon
+    service:
+      instances: 4
+      envs:
+        - ENDPOINT=http://api.scl
+      constraints:
+        rack: scl-r1
+`), &config)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, config.Clusters["scl"].Service.Instances)
+	assert.Equal(t, []string{"ENDPOINT=http://api.scl"}, config.Clusters["scl"].Service.Envs)
+	assert.Equal(t, "scl-r1", config.Clusters["scl"].Service.Constraints["rack"])
+}
+
+func TestParseClusterRetry(t *testing.T) {
+	var config Configuration
+	err := yaml.Unmarshal([]byte(`
+cluster:
+  sjc:
+    framework: marathon
+    retry:
+      attempts: 3
+      initial-backoff: 500
+      max-backoff: 5000
+      retry-on: [connection, server-error]
+`), &config)
+	assert.Nil(t, err)
+	assert.Equal(t, Retry{Attempts: 3, InitialBackoff: 500, MaxBackoff: 5000, RetryOn: []string{"connection", "server-error"}}, config.Clusters["sjc"].Retry)
+}
+
+func TestParseClusterOperationTimeout(t *testing.T) {
+	var config Configuration
+	err := yaml.Unmarshal([]byte(`
+cluster:
+  sjc:
+    framework: marathon
+    operation-timeout: 30
+  scl:
+    framework: marathon
+`), &config)
+	assert.Nil(t, err)
+	assert.Equal(t, 30, config.Clusters["sjc"].OperationTimeout)
+	assert.Equal(t, 0, config.Clusters["scl"].OperationTimeout)
+}
+
 func Test(t *testing.T) {
 	suite.Run(t, new(ConfigSuite))
 }
@@ -124,3 +204,29 @@ func (suite *ConfigSuite) TestParseSimple() {
 	assert.Nil(suite.T(), err)
 	assert.True(suite.T(), assert.ObjectsAreEqual(config, suite.expectedConfig))
 }
+
+func TestParseHistory(t *testing.T) {
+	var config Configuration
+	err := yaml.Unmarshal([]byte(`
+history:
+  path: /var/log/crane/history.jsonl
+`), &config)
+	assert.Nil(t, err)
+	assert.Equal(t, History{Path: "/var/log/crane/history.jsonl"}, config.History)
+
+	err = yaml.Unmarshal([]byte(`
+history:
+  disabled: true
+`), &config)
+	assert.Nil(t, err)
+	assert.True(t, config.History.Disabled)
+}
+
+func TestVerificationValidate(t *testing.T) {
+	assert.Nil(t, Verification{}.Validate())
+	assert.Nil(t, Verification{Type: VerifyHTTP, Path: "/health", ExpectedStatus: []int{200, 204}, Attempts: 3}.Validate())
+	assert.NotNil(t, Verification{Type: "udp"}.Validate())
+	assert.NotNil(t, Verification{Type: VerifyTCP, Timeout: -1}.Validate())
+	assert.NotNil(t, Verification{Type: VerifyHTTP, ExpectedStatus: []int{42}}.Validate())
+	assert.False(t, Verification{}.Enabled())
+}
@@ -0,0 +1,100 @@
+package configuration
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Eventos en los que se ejecutan los hooks
+const (
+	PreDeploy        = "pre-deploy"
+	PostStackSuccess = "post-stack-success"
+	PostStackFailure = "post-stack-failure"
+	PostDeploy       = "post-deploy"
+	PreDelete        = "pre-delete"
+	PostDelete       = "post-delete"
+)
+
+// Hook estructura para la configuración de un paso propio de una operación: un comando que se
+// ejecuta con sh o un webhook que recibe un POST. Ambos reciben el servicio y los resultados de
+// cada stack en JSON, el comando por stdin. Timeout está en segundos, sin él se usa el de crane
+type Hook struct {
+	Command string            `yaml:"command,omitempty" json:"command,omitempty"`
+	URL     string            `yaml:"url,omitempty" json:"url,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Timeout int               `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// Name identifica al hook en los logs y los errores
+func (h Hook) Name() string {
+	if h.Command != "" {
+		return h.Command
+	}
+	return h.URL
+}
+
+// Hooks estructura con los hooks de cada evento, se ejecutan en el orden en que se declaran. Si
+// falla un hook pre-deploy o pre-delete la operación se cancela, el resto sólo se informa
+type Hooks struct {
+	PreDeploy        []Hook `yaml:"pre-deploy,omitempty" json:"pre-deploy,omitempty"`
+	PostStackSuccess []Hook `yaml:"post-stack-success,omitempty" json:"post-stack-success,omitempty"`
+	PostStackFailure []Hook `yaml:"post-stack-failure,omitempty" json:"post-stack-failure,omitempty"`
+	PostDeploy       []Hook `yaml:"post-deploy,omitempty" json:"post-deploy,omitempty"`
+	PreDelete        []Hook `yaml:"pre-delete,omitempty" json:"pre-delete,omitempty"`
+	PostDelete       []Hook `yaml:"post-delete,omitempty" json:"post-delete,omitempty"`
+}
+
+// For retorna los hooks del evento
+func (h Hooks) For(event string) []Hook {
+	switch event {
+	case PreDeploy:
+		return h.PreDeploy
+	case PostStackSuccess:
+		return h.PostStackSuccess
+	case PostStackFailure:
+		return h.PostStackFailure
+	case PostDeploy:
+		return h.PostDeploy
+	case PreDelete:
+		return h.PreDelete
+	case PostDelete:
+		return h.PostDelete
+	}
+	return nil
+}
+
+// Append retorna los hooks de ambos, los de h se ejecutan primero
+func (h Hooks) Append(other Hooks) Hooks {
+	join := func(a, b []Hook) []Hook {
+		return append(append([]Hook(nil), a...), b...)
+	}
+	return Hooks{
+		PreDeploy:        join(h.PreDeploy, other.PreDeploy),
+		PostStackSuccess: join(h.PostStackSuccess, other.PostStackSuccess),
+		PostStackFailure: join(h.PostStackFailure, other.PostStackFailure),
+		PostDeploy:       join(h.PostDeploy, other.PostDeploy),
+		PreDelete:        join(h.PreDelete, other.PreDelete),
+		PostDelete:       join(h.PostDelete, other.PostDelete),
+	}
+}
+
+// Validate verifica que cada hook sea un comando o un webhook
+func (h Hooks) Validate() error {
+	for _, event := range []string{PreDeploy, PostStackSuccess, PostStackFailure, PostDeploy, PreDelete, PostDelete} {
+		for i, hook := range h.For(event) {
+			if (hook.Command == "") == (hook.URL == "") {
+				return fmt.Errorf("El hook %d de %s debe tener un command o una url", i+1, event)
+			}
+			if hook.URL != "" {
+				u, err := url.Parse(hook.URL)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("La url %s del hook %d de %s no es válida", hook.URL, i+1, event)
+				}
+			}
+			if hook.Timeout < 0 {
+				return fmt.Errorf("El timeout del hook %d de %s no debe ser negativo", i+1, event)
+			}
+		}
+	}
+	return nil
+}
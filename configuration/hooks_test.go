@@ -0,0 +1,45 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseHooks(t *testing.T) {
+	var config Configuration
+	err := yaml.Unmarshal([]byte(`
+hooks:
+  pre-deploy:
+    - command: ./migrate.sh
+      timeout: 60
+  post-stack-failure:
+    - url: https://tickets.example.com/hooks/crane
+      headers:
+        Authorization: Bearer norris
+`), &config)
+	assert.Nil(t, err)
+	assert.Equal(t, []Hook{{Command: "./migrate.sh", Timeout: 60}}, config.Hooks.For(PreDeploy))
+	assert.Equal(t, "https://tickets.example.com/hooks/crane", config.Hooks.For(PostStackFailure)[0].Name())
+	assert.Empty(t, config.Hooks.For(PostDeploy))
+	assert.Nil(t, config.Hooks.Validate())
+}
+
+func TestHooksAppend(t *testing.T) {
+	global := Hooks{PreDeploy: []Hook{{Command: "global"}}}
+	service := Hooks{PreDeploy: []Hook{{Command: "service"}}, PostDelete: []Hook{{Command: "cleanup"}}}
+
+	hooks := global.Append(service)
+	assert.Equal(t, []Hook{{Command: "global"}, {Command: "service"}}, hooks.PreDeploy)
+	assert.Equal(t, []Hook{{Command: "cleanup"}}, hooks.PostDelete)
+	assert.Len(t, global.PreDeploy, 1, "The hooks should not be modified")
+}
+
+func TestHooksValidate(t *testing.T) {
+	assert.NotNil(t, Hooks{PreDeploy: []Hook{{}}}.Validate())
+	assert.NotNil(t, Hooks{PostDeploy: []Hook{{Command: "notify.sh", URL: "http://ci"}}}.Validate())
+	assert.NotNil(t, Hooks{PreDelete: []Hook{{URL: "ci/hooks"}}}.Validate())
+	assert.NotNil(t, Hooks{PostDelete: []Hook{{Command: "notify.sh", Timeout: -1}}}.Validate())
+	assert.Nil(t, Hooks{PostStackSuccess: []Hook{{URL: "http://ci:8080/hooks"}}}.Validate())
+}
@@ -0,0 +1,330 @@
+package configuration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SystemConfigFile archivo de configuración del sistema, es la primera capa
+var SystemConfigFile = "/etc/crane/crane.yml"
+
+// UserConfigFile archivo de configuración del usuario, sobreescribe al del sistema. ~ es el HOME
+// al momento de leer la configuración
+var UserConfigFile = filepath.Join("~", ".crane", "crane.yml")
+
+const (
+	// EnvPrefix prefijo de las variables de entorno que sobreescriben la configuración. Los niveles
+	// se separan con __ y los _ de cada nivel son -, ej. CRANE_CLUSTER__SJC__OPERATION_TIMEOUT=30
+	EnvPrefix    = "CRANE_"
+	envSeparator = "__"
+
+	// includeKey directiva de un archivo con los archivos que se leen antes que él
+	includeKey = "include"
+)
+
+// envSections secciones de la configuración que se pueden sobreescribir con variables de entorno
+var envSections = map[string]bool{"cluster": true, "logging": true, "deploy": true, "history": true}
+
+// expandHome reemplaza ~ al inicio de la ruta por el HOME, sin HOME la ruta se ignora
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// origin capa de donde viene un valor de la configuración
+type origin struct {
+	source string
+	// dir directorio con el que se resuelven las rutas relativas del valor
+	dir string
+}
+
+// Entry valor de la configuración combinada con la capa de donde viene
+type Entry struct {
+	Path   []string
+	Value  interface{}
+	Origin string
+}
+
+// Layered configuración resultante de combinar las capas: el archivo del sistema, el del usuario,
+// el del proyecto y las variables de entorno, cada una sobreescribe a las anteriores. Los mapas se
+// combinan y el resto de los valores, incluidas las listas, se reemplazan
+type Layered struct {
+	Config *Configuration
+	// Files archivos leídos, en el orden en que se combinaron
+	Files   []string
+	values  map[string]interface{}
+	origins map[string]origin
+}
+
+// LoadLayered combina las capas de la configuración y resuelve las referencias de los parámetros.
+// El archivo del proyecto es opcional si hay otra capa, salvo que required lo exija. environ son
+// las variables de entorno, como os.Environ
+func LoadLayered(projectFile string, required bool, environ []string) (*Layered, error) {
+	l, err := MergeLayers(projectFile, required, environ)
+	if err != nil {
+		return nil, err
+	}
+	err = l.Config.expandReferences(func(path []string) string {
+		return l.originOf(path).dir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// MergeLayers combina las capas de la configuración como LoadLayered, sin resolver las referencias
+// de los parámetros
+func MergeLayers(projectFile string, required bool, environ []string) (*Layered, error) {
+	l := &Layered{values: make(map[string]interface{}), origins: make(map[string]origin)}
+
+	candidates := []string{expandHome(SystemConfigFile), expandHome(UserConfigFile)}
+	if projectFile != "" {
+		absolute, err := filepath.Abs(projectFile)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(absolute); err != nil && required {
+			return nil, err
+		}
+		candidates = append(candidates, absolute)
+	}
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := l.loadFile(path, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(l.Files) == 0 {
+		return nil, fmt.Errorf("No se encontró ningún archivo de configuración: %s", strings.Join(candidates, ", "))
+	}
+
+	if err := l.applyEnv(environ); err != nil {
+		return nil, err
+	}
+
+	content, err := yaml.Marshal(l.values)
+	if err != nil {
+		return nil, err
+	}
+	l.Config = new(Configuration)
+	if err := yaml.Unmarshal(content, l.Config); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// loadFile combina un archivo, después de los archivos que incluye. visiting son los archivos
+// que lo incluyen, para detectar los include circulares
+func (l *Layered) loadFile(path string, visiting []string) error {
+	for _, v := range visiting {
+		if v == path {
+			return fmt.Errorf("include circular: %s -> %s", strings.Join(visiting, " -> "), path)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var raw map[interface{}]interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	values, _ := normalize(raw).(map[string]interface{})
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+
+	includes, err := includedFiles(values[includeKey])
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	delete(values, includeKey)
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if err := l.loadFile(include, append(visiting, path)); err != nil {
+			return err
+		}
+	}
+
+	l.merge(l.values, values, nil, origin{source: path, dir: filepath.Dir(path)})
+	l.Files = append(l.Files, path)
+	return nil
+}
+
+// includedFiles lee la directiva include, que puede ser un archivo o una lista de archivos
+func includedFiles(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		files := make([]string, 0, len(v))
+		for _, file := range v {
+			name, ok := file.(string)
+			if !ok {
+				return nil, fmt.Errorf("include debe ser un archivo o una lista de archivos")
+			}
+			files = append(files, name)
+		}
+		return files, nil
+	default:
+		return nil, fmt.Errorf("include debe ser un archivo o una lista de archivos")
+	}
+}
+
+// normalize convierte los mapas de yaml a mapas con llaves de texto
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			normalized[fmt.Sprint(key)] = normalize(item)
+		}
+		return normalized
+	case []interface{}:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+func pathKey(path []string) string {
+	return strings.Join(path, ".")
+}
+
+// merge combina src sobre dst registrando el origen de cada valor
+func (l *Layered) merge(dst, src map[string]interface{}, prefix []string, o origin) {
+	for key, value := range src {
+		path := append(append([]string(nil), prefix...), key)
+		srcMap, isMap := value.(map[string]interface{})
+		if isMap {
+			dstMap, ok := dst[key].(map[string]interface{})
+			if !ok {
+				l.clearOrigins(path)
+				dstMap = make(map[string]interface{})
+				dst[key] = dstMap
+			}
+			l.origins[pathKey(path)] = o
+			l.merge(dstMap, srcMap, path, o)
+			continue
+		}
+		l.clearOrigins(path)
+		dst[key] = value
+		l.origins[pathKey(path)] = o
+	}
+}
+
+// clearOrigins olvida el origen de un valor y de los valores que contiene
+func (l *Layered) clearOrigins(path []string) {
+	key := pathKey(path)
+	for p := range l.origins {
+		if p == key || strings.HasPrefix(p, key+".") {
+			delete(l.origins, p)
+		}
+	}
+}
+
+// originOf retorna el origen del valor o del mapa más cercano que lo contiene
+func (l *Layered) originOf(path []string) origin {
+	for i := len(path); i > 0; i-- {
+		if o, ok := l.origins[pathKey(path[:i])]; ok {
+			return o
+		}
+	}
+	return origin{}
+}
+
+// applyEnv combina las variables de entorno CRANE_* de las secciones de la configuración. Los
+// valores se leen como yaml, así CRANE_CLUSTER__SJC__DISABLED=true es un booleano
+func (l *Layered) applyEnv(environ []string) error {
+	sort.Strings(environ)
+	for _, env := range environ {
+		keyVal := strings.SplitN(env, "=", 2)
+		if len(keyVal) != 2 || !strings.HasPrefix(keyVal[0], EnvPrefix) {
+			continue
+		}
+		var path []string
+		for _, part := range strings.Split(strings.TrimPrefix(keyVal[0], EnvPrefix), envSeparator) {
+			path = append(path, strings.Replace(strings.ToLower(part), "_", "-", -1))
+		}
+		if !envSections[path[0]] {
+			continue
+		}
+		for _, part := range path {
+			if part == "" {
+				return fmt.Errorf("La variable de entorno %s tiene un nivel vacío", keyVal[0])
+			}
+		}
+
+		values := map[string]interface{}{path[len(path)-1]: envValue(keyVal[1])}
+		for i := len(path) - 2; i >= 0; i-- {
+			values = map[string]interface{}{path[i]: values}
+		}
+		l.merge(l.values, values, nil, origin{source: "env " + keyVal[0]})
+	}
+	return nil
+}
+
+// envValue lee el valor como yaml cuando representa un número o un booleano, el resto es texto
+func envValue(value string) interface{} {
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return value
+	}
+	switch parsed.(type) {
+	case int, bool, float64:
+		if fmt.Sprint(parsed) == value {
+			return parsed
+		}
+	}
+	return value
+}
+
+// Entries retorna los valores de la configuración combinada ordenados por su ruta. Los mapas
+// vacíos también son valores
+func (l *Layered) Entries() []Entry {
+	var entries []Entry
+	var walk func(values map[string]interface{}, prefix []string)
+	walk = func(values map[string]interface{}, prefix []string) {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			path := append(append([]string(nil), prefix...), key)
+			if m, ok := values[key].(map[string]interface{}); ok && len(m) != 0 {
+				walk(m, path)
+				continue
+			}
+			entries = append(entries, Entry{Path: path, Value: values[key], Origin: l.originOf(path).source})
+		}
+	}
+	walk(l.values, nil)
+	return entries
+}
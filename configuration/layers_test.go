@@ -0,0 +1,205 @@
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// layersDir writes the files of the layers in a temporary dir, the system and user files are
+// replaced by the ones of the dir
+func layersDir(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "layers")
+	assert.Nil(t, err)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+	system, user := SystemConfigFile, UserConfigFile
+	SystemConfigFile = filepath.Join(dir, "etc", "crane.yml")
+	UserConfigFile = filepath.Join(dir, "home", "crane.yml")
+	return dir, func() {
+		SystemConfigFile, UserConfigFile = system, user
+		os.RemoveAll(dir)
+	}
+}
+
+func entriesByPath(l *Layered) map[string]Entry {
+	entries := make(map[string]Entry)
+	for _, entry := range l.Entries() {
+		entries[pathKey(entry.Path)] = entry
+	}
+	return entries
+}
+
+func TestLoadLayered(t *testing.T) {
+	dir, done := layersDir(t, map[string]string{
+		"etc/crane.yml": `
+logging:
+  level: info
+  formatter: text
+  output: console
+deploy:
+  strategy: sequential
+  order: [sjc, scl]
+`,
+		"home/crane.yml": `
+logging:
+  level: debug
+cluster:
+  sjc:
+    framework:
+      marathon:
+        address: http://sjc:8081
+        deploy-timeout: 30
+`,
+		"project/crane.yml": `
+deploy:
+  order: [scl]
+cluster:
+  sjc:
+    framework:
+      marathon:
+        deploy-timeout: 60
+`,
+	})
+	defer done()
+
+	project := filepath.Join(dir, "project", "crane.yml")
+	l, err := LoadLayered(project, true, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{SystemConfigFile, UserConfigFile, project}, l.Files)
+	assert.Equal(t, "debug", l.Config.Logging.Level, "The user file overrides the system file")
+	assert.Equal(t, "text", l.Config.Logging.Formatter, "The maps are merged")
+	assert.Equal(t, []string{"scl"}, l.Config.Deploy.Order, "The lists are replaced")
+	assert.Equal(t, "sequential", l.Config.Deploy.Strategy)
+	params := l.Config.Clusters["sjc"].Framework.Parameters()
+	assert.Equal(t, "http://sjc:8081", params["address"])
+	assert.Equal(t, 60, params["deploy-timeout"])
+
+	entries := entriesByPath(l)
+	assert.Equal(t, UserConfigFile, entries["logging.level"].Origin)
+	assert.Equal(t, SystemConfigFile, entries["logging.formatter"].Origin)
+	assert.Equal(t, project, entries["cluster.sjc.framework.marathon.deploy-timeout"].Origin)
+	assert.Equal(t, UserConfigFile, entries["cluster.sjc.framework.marathon.address"].Origin)
+}
+
+func TestLoadLayeredEnv(t *testing.T) {
+	dir, done := layersDir(t, map[string]string{
+		"crane.yml": `
+cluster:
+  sjc:
+    framework:
+      marathon:
+        address: http://sjc:8081
+`,
+	})
+	defer done()
+
+	environ := []string{
+		"CRANE_CLUSTER__SJC__FRAMEWORK__MARATHON__DEPLOY_TIMEOUT=60",
+		"CRANE_CLUSTER__SJC__DISABLED=true",
+		"CRANE_CLUSTER__SJC__FRAMEWORK__MARATHON__BASIC_AUTH_PWD=0123",
+		"CRANE_LOGGING__LEVEL=warn",
+		"CRANE_TEST_MARATHON_HOST=ignored",
+		"PATH=/usr/bin",
+	}
+	l, err := LoadLayered(filepath.Join(dir, "crane.yml"), false, environ)
+	assert.Nil(t, err)
+	sjc := l.Config.Clusters["sjc"]
+	assert.True(t, sjc.Disabled)
+	assert.Equal(t, 60, sjc.Framework.Parameters()["deploy-timeout"], "The numbers are read as yaml")
+	assert.Equal(t, "0123", sjc.Framework.Parameters()["basic-auth-pwd"], "The values that change when read are text")
+	assert.Equal(t, "http://sjc:8081", sjc.Framework.Parameters()["address"])
+	assert.Equal(t, "warn", l.Config.Logging.Level)
+	assert.Equal(t, "env CRANE_LOGGING__LEVEL", entriesByPath(l)["logging.level"].Origin)
+	_, ok := entriesByPath(l)["test-marathon-host"]
+	assert.False(t, ok, "Only the sections of the configuration are overridden")
+
+	_, err = LoadLayered(filepath.Join(dir, "crane.yml"), false, []string{"CRANE_CLUSTER____DISABLED=true"})
+	assert.NotNil(t, err, "Should fail with an empty level")
+}
+
+func TestLoadLayeredIncludes(t *testing.T) {
+	dir, done := layersDir(t, map[string]string{
+		"shared/clusters.yml": `
+include: secrets.yml
+cluster:
+  scl:
+    framework:
+      marathon:
+        address: http://scl:8081
+        basic-auth-pwd: file:scl-pwd
+`,
+		"shared/scl-pwd":     "secret\n",
+		"shared/secrets.yml": "logging:\n  level: info\n",
+		"project/crane.yml": `
+include: [../shared/clusters.yml]
+cluster:
+  scl:
+    groups: [prod]
+`,
+		"cycle/a.yml": "include: b.yml\n",
+		"cycle/b.yml": "include: a.yml\n",
+	})
+	defer done()
+
+	project := filepath.Join(dir, "project", "crane.yml")
+	l, err := LoadLayered(project, true, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "shared", "secrets.yml"), filepath.Join(dir, "shared", "clusters.yml"), project}, l.Files)
+	scl := l.Config.Clusters["scl"]
+	assert.Equal(t, []string{"prod"}, scl.Groups)
+	assert.Equal(t, "http://scl:8081", scl.Framework.Parameters()["address"])
+	assert.Equal(t, "secret", scl.Framework.Parameters()["basic-auth-pwd"], "The file references are relative to the file that has them")
+	assert.Equal(t, "info", l.Config.Logging.Level)
+
+	_, err = LoadLayered(filepath.Join(dir, "cycle", "a.yml"), true, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "include circular")
+}
+
+func TestLoadLayeredMissingFiles(t *testing.T) {
+	dir, done := layersDir(t, map[string]string{"home/crane.yml": "logging:\n  level: info\n"})
+	defer done()
+
+	l, err := LoadLayered(filepath.Join(dir, "crane.yml"), false, nil)
+	assert.Nil(t, err, "The project file is optional when other layers exist")
+	assert.Equal(t, []string{UserConfigFile}, l.Files)
+
+	_, err = LoadLayered(filepath.Join(dir, "crane.yml"), true, nil)
+	assert.NotNil(t, err, "Should fail when the project file is required")
+
+	os.Remove(UserConfigFile)
+	_, err = LoadLayered(filepath.Join(dir, "crane.yml"), false, nil)
+	assert.NotNil(t, err, "Should fail without any file")
+}
+
+func TestUserConfigFileFromHome(t *testing.T) {
+	dir, done := layersDir(t, map[string]string{".crane/crane.yml": "logging:\n  level: debug\n"})
+	defer done()
+	UserConfigFile = filepath.Join("~", ".crane", "crane.yml")
+	home := os.Getenv("HOME")
+	defer os.Setenv("HOME", home)
+	os.Setenv("HOME", dir)
+
+	l, err := LoadLayered(filepath.Join(dir, "crane.yml"), false, nil)
+	assert.Nil(t, err, "The user file should be resolved with the HOME of the load")
+	assert.Equal(t, []string{filepath.Join(dir, ".crane", "crane.yml")}, l.Files)
+}
+
+func TestMergeLayersUnresolved(t *testing.T) {
+	dir, done := layersDir(t, map[string]string{"crane.yml": "cluster:\n  sjc:\n    framework:\n      marathon:\n        address: ${CRANE_TEST_MISSING}\n"})
+	defer done()
+	os.Unsetenv("CRANE_TEST_MISSING")
+
+	_, err := LoadLayered(filepath.Join(dir, "crane.yml"), true, nil)
+	assert.NotNil(t, err, "Should fail with an unresolved reference")
+	l, err := MergeLayers(filepath.Join(dir, "crane.yml"), true, nil)
+	assert.Nil(t, err, "The references are not resolved")
+	assert.Equal(t, "${CRANE_TEST_MISSING}", entriesByPath(l)["cluster.sjc.framework.marathon.address"].Value)
+}
@@ -0,0 +1,86 @@
+package configuration
+
+import "fmt"
+
+// HealthCheck estructura para la configuración del health check de un servicio
+type HealthCheck struct {
+	Path string `yaml:"path" json:"path"`
+}
+
+// Tipos de verificación de las instancias
+const (
+	VerifyHTTP = "http"
+	VerifyTCP  = "tcp"
+)
+
+// Verification estructura para la verificación que hace crane de cada instancia desplegada, además
+// del health check del framework. Sin Type no se verifica. Path es por defecto el del health check
+// y Port el menor de la instancia. Sin ExpectedStatus se acepta cualquier 2xx. Interval y Timeout
+// están en segundos
+type Verification struct {
+	Type           string `yaml:"type,omitempty" json:"type,omitempty"`
+	Path           string `yaml:"path,omitempty" json:"path,omitempty"`
+	Port           int64  `yaml:"port,omitempty" json:"port,omitempty"`
+	ExpectedStatus []int  `yaml:"expected-status,omitempty" json:"expected-status,omitempty"`
+	Attempts       int    `yaml:"attempts,omitempty" json:"attempts,omitempty"`
+	Interval       int    `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Timeout        int    `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// Enabled indica si las instancias se verifican
+func (v Verification) Enabled() bool {
+	return v.Type != ""
+}
+
+// Validate verifica los valores de la verificación
+func (v Verification) Validate() error {
+	switch v.Type {
+	case "", VerifyHTTP, VerifyTCP:
+	default:
+		return fmt.Errorf("El tipo de verificación %s no es válido, debe ser http o tcp", v.Type)
+	}
+	if v.Port < 0 || v.Attempts < 0 || v.Interval < 0 || v.Timeout < 0 {
+		return fmt.Errorf("El puerto, los intentos, el intervalo y el timeout de la verificación no deben ser negativos")
+	}
+	for _, status := range v.ExpectedStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("El estado HTTP %d esperado por la verificación no es válido", status)
+		}
+	}
+	return nil
+}
+
+// ServiceOverride estructura con los valores de un servicio que se sobreescriben en un cluster.
+// Los valores vacíos no se sobreescriben, las variables de entorno, constraints y labels se
+// agregan a las del servicio reemplazando las que tienen la misma llave
+type ServiceOverride struct {
+	Instances   int               `yaml:"instances,omitempty" json:"instances,omitempty"`
+	CPU         float64           `yaml:"cpu,omitempty" json:"cpu,omitempty"`
+	Memory      int64             `yaml:"memory,omitempty" json:"memory,omitempty"`
+	Envs        []string          `yaml:"envs,omitempty" json:"envs,omitempty"`
+	Constraints map[string]string `yaml:"constraints,omitempty" json:"constraints,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// ServiceManifest estructura del manifiesto declarativo de un servicio utilizado por deploy
+type ServiceManifest struct {
+	ServiceID             string                     `yaml:"service-id" json:"service-id" valid:"required"`
+	Image                 string                     `yaml:"image" json:"image" valid:"required"`
+	Tag                   string                     `yaml:"tag" json:"tag" valid:"required"`
+	Ports                 []string                   `yaml:"ports" json:"ports"`
+	CPU                   float64                    `yaml:"cpu" json:"cpu"`
+	Memory                int64                      `yaml:"memory" json:"memory"`
+	EnvFiles              []string                   `yaml:"env-files" json:"env-files"`
+	Envs                  []string                   `yaml:"envs" json:"envs"`
+	Constraints           map[string]string          `yaml:"constraints" json:"constraints"`
+	Labels                map[string]string          `yaml:"labels" json:"labels"`
+	Beta                  string                     `yaml:"beta" json:"beta"`
+	HealthCheck           HealthCheck                `yaml:"health-check" json:"health-check"`
+	MinimumHealthCapacity float64                    `yaml:"minimum-health-capacity" json:"minimum-health-capacity"`
+	MaximumOverCapacity   float64                    `yaml:"maximum-over-capacity" json:"maximum-over-capacity"`
+	Instances             int                        `yaml:"instances" json:"instances"`
+	Tolerance             float64                    `yaml:"tolerance" json:"tolerance"`
+	Clusters              map[string]ServiceOverride `yaml:"cluster" json:"cluster"`
+	Hooks                 Hooks                      `yaml:"hooks,omitempty" json:"hooks,omitempty" valid:"optional"`
+	Verify                Verification               `yaml:"verify,omitempty" json:"verify,omitempty" valid:"optional"`
+}
@@ -0,0 +1,154 @@
+package configuration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// filePrefix indica que el valor de un parámetro se lee desde un archivo, ej. file:/run/secrets/marathon
+const filePrefix = "file:"
+
+// envReference encuentra las referencias ${VARIABLE} y las referencias escapadas $${VARIABLE}, que
+// quedan como el texto ${VARIABLE}
+var envReference = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// wholeReference indica que el valor completo es una sola referencia
+var wholeReference = regexp.MustCompile(`^\$\{[^}]*\}$`)
+
+// UnresolvedReferences error con las referencias de los parámetros que no se pudieron resolver
+type UnresolvedReferences struct {
+	Errors []string
+}
+
+func (err *UnresolvedReferences) Error() string {
+	return "Referencias sin resolver en la configuración:\n  " + strings.Join(err.Errors, "\n  ")
+}
+
+// ExpandReferences reemplaza en los parámetros de los frameworks las referencias ${VARIABLE} por
+// el valor de la variable de entorno y los valores file:ruta por el contenido del archivo, sin
+// los saltos de línea finales. Las rutas relativas son relativas a baseDir. Un valor que es una
+// sola referencia toma el tipo de la variable: entero, decimal, booleano o texto. $${ se escribe
+// como ${ sin resolverse. Retorna UnresolvedReferences con todas las referencias que no se resolvieron
+func (c *Configuration) ExpandReferences(baseDir string) error {
+	return c.expandReferences(func(path []string) string { return baseDir })
+}
+
+// expandReferences resuelve las referencias con las rutas relativas al directorio que retorna
+// baseDir para la ruta del parámetro en la configuración
+func (c *Configuration) expandReferences(baseDir func(path []string) string) error {
+	var errs []string
+	clusters := make([]string, 0, len(c.Clusters))
+	for key := range c.Clusters {
+		clusters = append(clusters, key)
+	}
+	sort.Strings(clusters)
+
+	for _, clusterKey := range clusters {
+		for frameworkType, params := range c.Clusters[clusterKey].Framework {
+			keys := make([]string, 0, len(params))
+			for key := range params {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				value, err := expandValue(params[key], baseDir([]string{"cluster", clusterKey, "framework", frameworkType, key}))
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("cluster %s, %s.%s: %s", clusterKey, frameworkType, key, err))
+					continue
+				}
+				params[key] = value
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return &UnresolvedReferences{Errors: errs}
+	}
+	return nil
+}
+
+// expandValue resuelve las referencias de un valor, incluidos los valores de listas y mapas
+func expandValue(value interface{}, baseDir string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		expanded, err := expandString(v, baseDir)
+		if err != nil || !wholeReference.MatchString(v) {
+			return expanded, err
+		}
+		return typedValue(expanded), nil
+	case []interface{}:
+		for i := range v {
+			expanded, err := expandValue(v[i], baseDir)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		for key := range v {
+			expanded, err := expandValue(v[key], baseDir)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+func expandString(value, baseDir string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		if strings.HasPrefix(reference, "$$") {
+			return reference[1:]
+		}
+		name := envReference.FindStringSubmatch(reference)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok || name == "" {
+			missing = append(missing, name)
+		}
+		return env
+	})
+	if len(missing) != 0 {
+		return "", fmt.Errorf("la variable de entorno %s no está definida", strings.Join(missing, ", "))
+	}
+
+	if !strings.HasPrefix(expanded, filePrefix) {
+		return expanded, nil
+	}
+	path := strings.TrimPrefix(expanded, filePrefix)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("no se pudo leer el archivo %s", path)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// typedValue convierte el valor de una variable de entorno al tipo que tendría escrito en el YAML
+func typedValue(value string) interface{} {
+	if i, err := strconv.Atoi(value); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	switch strings.ToLower(value) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return value
+}
@@ -0,0 +1,105 @@
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func referencesConfig(params Parameters) *Configuration {
+	return &Configuration{Clusters: map[string]Cluster{"sjc": {Framework: Framework{"marathon": params}}}}
+}
+
+func TestExpandEnvReferences(t *testing.T) {
+	os.Setenv("CRANE_TEST_HOST", "marathon.sjc")
+	os.Setenv("CRANE_TEST_USER", "chuck")
+	defer os.Unsetenv("CRANE_TEST_HOST")
+	defer os.Unsetenv("CRANE_TEST_USER")
+
+	config := referencesConfig(Parameters{
+		"address":         "http://${CRANE_TEST_HOST}:8081",
+		"basic-auth-user": "${CRANE_TEST_USER}",
+		"deploy-timeout":  30,
+		"datacenters":     []interface{}{"${CRANE_TEST_HOST}", "dc2"},
+	})
+	assert.Nil(t, config.ExpandReferences("."))
+	params := config.Clusters["sjc"].Framework.Parameters()
+	assert.Equal(t, "http://marathon.sjc:8081", params["address"])
+	assert.Equal(t, "chuck", params["basic-auth-user"])
+	assert.Equal(t, 30, params["deploy-timeout"], "The values without references are not modified")
+	assert.Equal(t, []interface{}{"marathon.sjc", "dc2"}, params["datacenters"])
+}
+
+func TestExpandTypedReferences(t *testing.T) {
+	os.Setenv("CRANE_TEST_TIMEOUT", "30")
+	os.Setenv("CRANE_TEST_TOLERANCE", "0.5")
+	os.Setenv("CRANE_TEST_INSECURE", "true")
+	defer os.Unsetenv("CRANE_TEST_TIMEOUT")
+	defer os.Unsetenv("CRANE_TEST_TOLERANCE")
+	defer os.Unsetenv("CRANE_TEST_INSECURE")
+
+	config := referencesConfig(Parameters{
+		"deploy-timeout": "${CRANE_TEST_TIMEOUT}",
+		"tolerance":      "${CRANE_TEST_TOLERANCE}",
+		"insecure":       "${CRANE_TEST_INSECURE}",
+		"address":        "http://marathon:${CRANE_TEST_TIMEOUT}",
+		"ports":          []interface{}{"${CRANE_TEST_TIMEOUT}"},
+	})
+	assert.Nil(t, config.ExpandReferences("."))
+	params := config.Clusters["sjc"].Framework.Parameters()
+	assert.Equal(t, 30, params["deploy-timeout"], "A single reference takes the type of the value")
+	assert.Equal(t, 0.5, params["tolerance"])
+	assert.Equal(t, true, params["insecure"])
+	assert.Equal(t, "http://marathon:30", params["address"], "A reference inside a text stays a text")
+	assert.Equal(t, []interface{}{30}, params["ports"])
+}
+
+func TestEscapedReferences(t *testing.T) {
+	os.Unsetenv("CRANE_TEST_MISSING")
+	os.Setenv("CRANE_TEST_USER", "chuck")
+	defer os.Unsetenv("CRANE_TEST_USER")
+
+	config := referencesConfig(Parameters{
+		"template": "$${CRANE_TEST_MISSING}",
+		"path":     "/users/${CRANE_TEST_USER}/$${HOME}",
+	})
+	assert.Nil(t, config.ExpandReferences("."), "The escaped references are not resolved")
+	params := config.Clusters["sjc"].Framework.Parameters()
+	assert.Equal(t, "${CRANE_TEST_MISSING}", params["template"])
+	assert.Equal(t, "/users/chuck/${HOME}", params["path"])
+}
+
+func TestExpandFileReferences(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "secrets")
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "marathon"), []byte("norris\n"), 0600))
+	os.Setenv("CRANE_TEST_SECRETS", dir)
+	defer os.Unsetenv("CRANE_TEST_SECRETS")
+
+	config := referencesConfig(Parameters{
+		"basic-auth-pwd": "file:marathon",
+		"tlskey":         "file:${CRANE_TEST_SECRETS}/marathon",
+	})
+	assert.Nil(t, config.ExpandReferences(dir))
+	params := config.Clusters["sjc"].Framework.Parameters()
+	assert.Equal(t, "norris", params["basic-auth-pwd"], "The relative paths are relative to the base dir")
+	assert.Equal(t, "norris", params["tlskey"])
+}
+
+func TestUnresolvedReferences(t *testing.T) {
+	os.Unsetenv("CRANE_TEST_MISSING")
+	config := referencesConfig(Parameters{
+		"address":        "http://${CRANE_TEST_MISSING}:8081",
+		"basic-auth-pwd": "file:/crane/missing/secret",
+	})
+	err := config.ExpandReferences(".")
+	assert.NotNil(t, err)
+	unresolved, ok := err.(*UnresolvedReferences)
+	assert.True(t, ok)
+	assert.Len(t, unresolved.Errors, 2, "Every unresolved reference should be reported")
+	assert.Contains(t, err.Error(), "cluster sjc, marathon.address: la variable de entorno CRANE_TEST_MISSING no está definida")
+	assert.Contains(t, err.Error(), "/crane/missing/secret")
+}
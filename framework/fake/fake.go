@@ -0,0 +1,366 @@
+// Package fake is a framework that keeps the services in memory, or in a JSON state file shared by
+// several runs of crane. It deploys nothing, so it is used to rehearse deploy strategies and to
+// test crane without a real cluster. It is registered as the framework "fake":
+//
+//	cluster:
+//	  rehearsal:
+//	    framework:
+//	      fake:
+//	        state-file: /tmp/crane-rehearsal.json
+//	        latency: 500ms
+//	        fail-deploy: false
+//	        fail-instances: 25
+//
+// The failures are injected per cluster: fail-deploy makes every deploy on the cluster fail and
+// fail-instances reports that percentage of the instances of every service as down.
+package fake
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/latam-airlines/mesos-framework-factory/factory"
+	"github.com/latam-airlines/mesos-framework-factory/utils"
+)
+
+const (
+	frameworkID = "fake"
+
+	defaultHost  = "fake-node"
+	defaultNodes = 3
+	firstPort    = 31000
+)
+
+func init() {
+	factory.Register(frameworkID, &fakeCreator{})
+}
+
+// fakeCreator implements factory.FrameworkFactory
+type fakeCreator struct{}
+
+func (creator *fakeCreator) Create(params map[string]interface{}) (framework.Framework, error) {
+	f := &Fake{
+		stateFile: utils.ExtractString(params, "state-file"),
+		host:      utils.ExtractString(params, "host"),
+		nodes:     defaultNodes,
+	}
+	if f.host == "" {
+		f.host = defaultHost
+	}
+
+	if value, ok := params["latency"]; ok {
+		latency, err := time.ParseDuration(fmt.Sprint(value))
+		if err != nil || latency < 0 {
+			return nil, errors.New("Parameter latency should be a duration, ie. 500ms")
+		}
+		f.latency = latency
+	}
+	if value, ok := params["fail-deploy"]; ok {
+		if f.failDeploy, ok = value.(bool); !ok {
+			return nil, errors.New("Parameter fail-deploy should be true or false")
+		}
+	}
+	if value, ok := params["fail-instances"]; ok {
+		if f.failInstances, ok = value.(int); !ok || f.failInstances < 0 || f.failInstances > 100 {
+			return nil, errors.New("Parameter fail-instances should be a percentage between 0 and 100")
+		}
+	}
+	if value, ok := params["nodes"]; ok {
+		if f.nodes, ok = value.(int); !ok || f.nodes <= 0 {
+			return nil, errors.New("Parameter nodes should be a number greater than 0")
+		}
+	}
+
+	if f.stateFile == "" {
+		f.memory = newState()
+	} else if _, err := loadState(f.stateFile); err != nil {
+		return nil, fmt.Errorf("Invalid state-file %s: %s", f.stateFile, err)
+	}
+	return f, nil
+}
+
+// Fake implements framework.Framework keeping the services in memory or in the state file
+type Fake struct {
+	mutex         sync.Mutex
+	stateFile     string
+	memory        *state
+	latency       time.Duration
+	failDeploy    bool
+	failInstances int
+	host          string
+	nodes         int
+}
+
+func (f *Fake) ID() string {
+	return frameworkID
+}
+
+// update runs the operation on the state after the latency of the framework. The state file is
+// read before the operation and written after it when the operation succeeds
+func (f *Fake) update(operation func(s *state) error) error {
+	time.Sleep(f.latency)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.stateFile == "" {
+		return operation(f.memory)
+	}
+	s, err := loadState(f.stateFile)
+	if err != nil {
+		return err
+	}
+	if err := operation(s); err != nil {
+		return err
+	}
+	return s.save(f.stateFile)
+}
+
+func serviceKey(serviceID string) string {
+	return strings.TrimPrefix(serviceID, "/")
+}
+
+// failedInstances is the number of instances reported as down, rounding the percentage
+func (f *Fake) failedInstances(instances int) int {
+	return int(math.Floor(float64(instances*f.failInstances)/100 + 0.5))
+}
+
+// newInstances creates the instances of a version of the service spread on the nodes, each one
+// with its own public ports. The last ones are down when failures are injected
+func (f *Fake) newInstances(s *state, svc *service, from, to int) []*framework.Instance {
+	id := serviceKey(svc.Config.ServiceID)
+	instances := make([]*framework.Instance, 0, to-from)
+	for i := from; i < to; i++ {
+		host := fmt.Sprintf("%s-%d", f.host, i%f.nodes+1)
+		instance := &framework.Instance{
+			ID:            fmt.Sprintf("%s.%d.%d", id, svc.Version, i),
+			Host:          host,
+			ContainerName: fmt.Sprintf("%s-%d-%d", id, svc.Version, i),
+			Status:        framework.InstanceUp,
+			Ports:         make(map[string]framework.InstancePort),
+		}
+		for _, publish := range svc.Config.Publish {
+			parts := strings.Split(publish, "/")
+			internal, _ := strconv.ParseInt(parts[0], 10, 64)
+			protocol := framework.TCP
+			if len(parts) == 2 {
+				protocol = framework.NewInstancePortType(parts[1])
+			}
+			instance.Ports[fmt.Sprintf("%d/%s", internal, protocol)] = framework.InstancePort{
+				Advertise: fmt.Sprintf("%s:%d", host, s.NextPort),
+				Internal:  internal,
+				Publics:   []int64{s.NextPort},
+				Type:      protocol,
+			}
+			s.NextPort++
+		}
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// markFailed reports as down the instances chosen by the failure injection
+func (f *Fake) markFailed(instances []*framework.Instance) {
+	failed := f.failedInstances(len(instances))
+	for i, instance := range instances {
+		instance.Status = framework.InstanceUp
+		if i >= len(instances)-failed {
+			instance.Status = framework.InstanceDown
+		}
+	}
+}
+
+// information returns a copy of the service, so the callers can not modify the state
+func information(svc *service) *framework.ServiceInformation {
+	info := &framework.ServiceInformation{
+		ID:        serviceKey(svc.Config.ServiceID),
+		ImageName: svc.Config.ImageName,
+		ImageTag:  svc.Config.Tag,
+		Version:   strconv.Itoa(svc.Version),
+	}
+	for _, instance := range svc.Instances {
+		copied := *instance
+		copied.Ports = make(map[string]framework.InstancePort, len(instance.Ports))
+		for key, port := range instance.Ports {
+			copied.Ports[key] = port
+		}
+		info.Instances = append(info.Instances, &copied)
+	}
+	return info
+}
+
+// release creates a new version of the service with the definition
+func (f *Fake) release(s *state, svc *service, config framework.ServiceConfig, instances int) {
+	svc.Version++
+	svc.Config = config
+	svc.History = append(svc.History, revision{Version: svc.Version, Config: config, Instances: instances})
+	svc.Instances = f.newInstances(s, svc, 0, instances)
+	f.markFailed(svc.Instances)
+}
+
+// FindServiceInformation returns the services meeting the criteria, it fails when there is none
+// as marathon does
+func (f *Fake) FindServiceInformation(criteria framework.ServiceInformationCriteria) ([]*framework.ServiceInformation, error) {
+	var all []*framework.ServiceInformation
+	err := f.update(func(s *state) error {
+		keys := make([]string, 0, len(s.Services))
+		for key := range s.Services {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			all = append(all, information(s.Services[key]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	filtered := criteria.MeetCriteria(all)
+	if len(filtered) == 0 {
+		return nil, errors.New("No services found")
+	}
+	return filtered, nil
+}
+
+// DeployService creates a version of the service, unless the definition and the instances are the
+// ones deployed. It fails when deploy failures are injected
+func (f *Fake) DeployService(config framework.ServiceConfig, instances int) (*framework.ServiceInformation, error) {
+	key := serviceKey(config.ServiceID)
+	if key == "" {
+		return nil, fmt.Errorf("Invalid service id %s", config.ServiceID)
+	}
+	if f.failDeploy {
+		time.Sleep(f.latency)
+		return nil, fmt.Errorf("The deploy of %s failed, failures are injected on the fake framework", key)
+	}
+
+	var info *framework.ServiceInformation
+	err := f.update(func(s *state) error {
+		svc, ok := s.Services[key]
+		if !ok {
+			svc = &service{}
+			s.Services[key] = svc
+		}
+		if !ok || !reflect.DeepEqual(svc.Config, config) || len(svc.Instances) != instances {
+			f.release(s, svc, config, instances)
+		}
+		info = information(svc)
+		return nil
+	})
+	return info, err
+}
+
+// ScaleService adds or removes instances of the current version of the service
+func (f *Fake) ScaleService(serviceID string, instances int) (*framework.ServiceInformation, error) {
+	var info *framework.ServiceInformation
+	err := f.update(func(s *state) error {
+		svc, ok := s.Services[serviceKey(serviceID)]
+		if !ok {
+			return fmt.Errorf("Service %s not found", serviceID)
+		}
+		if instances < len(svc.Instances) {
+			svc.Instances = svc.Instances[:instances]
+		} else {
+			svc.Instances = append(svc.Instances, f.newInstances(s, svc, len(svc.Instances), instances)...)
+		}
+		f.markFailed(svc.Instances)
+		info = information(svc)
+		return nil
+	})
+	return info, err
+}
+
+// LabelService changes the labels of the current version of the service without creating a
+// version. A label with an empty value is removed
+func (f *Fake) LabelService(serviceID string, labels map[string]string) error {
+	return f.update(func(s *state) error {
+		svc, ok := s.Services[serviceKey(serviceID)]
+		if !ok {
+			return fmt.Errorf("Service %s not found", serviceID)
+		}
+		updated := make(map[string]string, len(svc.Config.Labels)+len(labels))
+		for key, value := range svc.Config.Labels {
+			updated[key] = value
+		}
+		for key, value := range labels {
+			if value == "" {
+				delete(updated, key)
+			} else {
+				updated[key] = value
+			}
+		}
+		svc.Config.Labels = updated
+		return nil
+	})
+}
+
+// InspectService returns the definition of the service and its instances, a nil config when the
+// service does not exist
+func (f *Fake) InspectService(serviceID string) (*framework.ServiceConfig, int, error) {
+	var config *framework.ServiceConfig
+	var instances int
+	err := f.update(func(s *state) error {
+		if svc, ok := s.Services[serviceKey(serviceID)]; ok {
+			copied := svc.Config
+			config, instances = &copied, len(svc.Instances)
+		}
+		return nil
+	})
+	return config, instances, err
+}
+
+// DeleteService removes the service, it fails when the service does not exist
+func (f *Fake) DeleteService(serviceID string) error {
+	return f.update(func(s *state) error {
+		key := serviceKey(serviceID)
+		if _, ok := s.Services[key]; !ok {
+			return fmt.Errorf("Service %s not found", serviceID)
+		}
+		delete(s.Services, key)
+		return nil
+	})
+}
+
+// UndeployInstance removes an instance of any service, it is not replaced
+func (f *Fake) UndeployInstance(instanceID string) error {
+	return f.update(func(s *state) error {
+		for _, svc := range s.Services {
+			for i, instance := range svc.Instances {
+				if instance.ID == instanceID {
+					svc.Instances = append(svc.Instances[:i], svc.Instances[i+1:]...)
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("Instance %s not found", instanceID)
+	})
+}
+
+// RollbackService deploys again the definition of a previous version, as a new version
+func (f *Fake) RollbackService(serviceID, version string) {
+	err := f.update(func(s *state) error {
+		svc, ok := s.Services[serviceKey(serviceID)]
+		if !ok {
+			return fmt.Errorf("Service %s not found", serviceID)
+		}
+		for _, rev := range svc.History {
+			if strconv.Itoa(rev.Version) == version {
+				f.release(s, svc, rev.Config, rev.Instances)
+				return nil
+			}
+		}
+		return fmt.Errorf("The version %s of %s does not exist", version, serviceID)
+	})
+	if err != nil {
+		util.Log.Errorf("Failed to rollback %s to version %s: %s", serviceID, version, err)
+	}
+}
@@ -0,0 +1,205 @@
+package fake
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/latam-airlines/mesos-framework-factory/factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFake(t *testing.T, params map[string]interface{}) *Fake {
+	fw, err := factory.Create("fake", params)
+	assert.Nil(t, err)
+	return fw.(*Fake)
+}
+
+func nginxConfig() framework.ServiceConfig {
+	return framework.ServiceConfig{
+		ServiceID: "/nginx",
+		ImageName: "registry:5000/nginx",
+		Tag:       "1.9",
+		CPUShares: 0.5,
+		Memory:    256,
+		Publish:   []string{"8080/tcp", "53/udp"},
+	}
+}
+
+func TestCreateParameters(t *testing.T) {
+	f := newTestFake(t, map[string]interface{}{"latency": "20ms", "fail-deploy": true, "fail-instances": 50, "nodes": 2})
+	assert.Equal(t, 20*time.Millisecond, f.latency)
+	assert.True(t, f.failDeploy)
+	assert.Equal(t, 50, f.failInstances)
+	assert.Equal(t, 2, f.nodes)
+
+	for _, params := range []map[string]interface{}{
+		{"latency": "slow"},
+		{"fail-deploy": "yes"},
+		{"fail-instances": 101},
+		{"nodes": 0},
+	} {
+		_, err := factory.Create("fake", params)
+		assert.NotNil(t, err, "Should fail with %v", params)
+	}
+}
+
+func TestDeployService(t *testing.T) {
+	f := newTestFake(t, map[string]interface{}{"nodes": 2})
+
+	service, err := f.DeployService(nginxConfig(), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx", service.ID)
+	assert.Equal(t, "registry:5000/nginx:1.9", service.FullImageName())
+	assert.Equal(t, "1", service.Version)
+	assert.Len(t, service.Instances, 3)
+	instance := service.Instances[2]
+	assert.Equal(t, "nginx.1.2", instance.ID)
+	assert.Equal(t, "fake-node-1", instance.Host, "The instances are spread on the nodes")
+	assert.True(t, instance.Healthy())
+	assert.Equal(t, framework.InstancePort{Advertise: "fake-node-1:31005", Internal: 53, Publics: []int64{31005}, Type: framework.UDP}, instance.Ports["53/UDP"])
+
+	service, err = f.DeployService(nginxConfig(), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", service.Version, "The same definition should not create a version")
+
+	config := nginxConfig()
+	config.Tag = "1.10"
+	service, err = f.DeployService(config, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", service.Version)
+	assert.Len(t, service.Instances, 2)
+}
+
+func TestFailureInjection(t *testing.T) {
+	f := newTestFake(t, map[string]interface{}{"fail-deploy": true})
+	_, err := f.DeployService(nginxConfig(), 1)
+	assert.NotNil(t, err)
+	config, _, _ := f.InspectService("nginx")
+	assert.Nil(t, config, "A failed deploy should not create the service")
+
+	f = newTestFake(t, map[string]interface{}{"fail-instances": 25})
+	service, err := f.DeployService(nginxConfig(), 4)
+	assert.Nil(t, err)
+	assert.True(t, service.Instances[0].Healthy())
+	assert.False(t, service.Instances[3].Healthy(), "A quarter of the instances should be down")
+
+	service, err = f.ScaleService("nginx", 8)
+	assert.Nil(t, err)
+	assert.True(t, service.Instances[3].Healthy())
+	assert.False(t, service.Instances[6].Healthy())
+	assert.False(t, service.Instances[7].Healthy())
+}
+
+func TestLatency(t *testing.T) {
+	f := newTestFake(t, map[string]interface{}{"latency": "30ms"})
+	start := time.Now()
+	f.DeployService(nginxConfig(), 1)
+	assert.True(t, time.Since(start) >= 30*time.Millisecond, "The operation should wait the latency")
+}
+
+func TestFindServiceInformation(t *testing.T) {
+	f := newTestFake(t, map[string]interface{}{})
+
+	_, err := f.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile("nginx")})
+	assert.NotNil(t, err, "Should fail when no service meets the criteria")
+
+	f.DeployService(nginxConfig(), 2)
+	f.DeployService(framework.ServiceConfig{ServiceID: "redis", ImageName: "redis", Tag: "3"}, 1)
+	services, err := f.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile("nginx:1.9")})
+	assert.Nil(t, err)
+	assert.Len(t, services, 1)
+
+	services[0].Instances[0].Status = framework.InstanceDown
+	services, _ = f.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile("nginx")})
+	assert.True(t, services[0].Instances[0].Healthy(), "The callers should not modify the state")
+}
+
+func TestInspectAndScaleService(t *testing.T) {
+	f := newTestFake(t, map[string]interface{}{})
+
+	config, _, err := f.InspectService("nginx")
+	assert.Nil(t, err)
+	assert.Nil(t, config, "The service does not exist")
+	_, err = f.ScaleService("nginx", 2)
+	assert.NotNil(t, err)
+
+	f.DeployService(nginxConfig(), 2)
+	service, err := f.ScaleService("/nginx", 1)
+	assert.Nil(t, err)
+	assert.Len(t, service.Instances, 1)
+	assert.Equal(t, "1", service.Version, "Scaling should not create a version")
+
+	config, instances, err := f.InspectService("nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, instances)
+	expected := nginxConfig()
+	assert.Equal(t, &expected, config)
+}
+
+func TestLabelService(t *testing.T) {
+	f := newTestFake(t, map[string]interface{}{})
+
+	assert.NotNil(t, f.LabelService("nginx", map[string]string{"crane.active": "true"}))
+	config := nginxConfig()
+	config.Labels = map[string]string{"environment": "beta", "crane.keep-until": "1700000000"}
+	f.DeployService(config, 2)
+	assert.Nil(t, f.LabelService("/nginx", map[string]string{"crane.active": "true", "crane.keep-until": ""}))
+
+	inspected, _, _ := f.InspectService("nginx")
+	assert.Equal(t, map[string]string{"environment": "beta", "crane.active": "true"}, inspected.Labels)
+	service, _ := f.DeployService(*inspected, 2)
+	assert.Equal(t, "1", service.Version, "Labeling should not create a version")
+}
+
+func TestRollbackService(t *testing.T) {
+	f := newTestFake(t, map[string]interface{}{})
+
+	f.DeployService(nginxConfig(), 2)
+	config := nginxConfig()
+	config.Tag = "1.10"
+	f.DeployService(config, 3)
+
+	f.RollbackService("nginx", "1")
+	services, _ := f.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile("nginx")})
+	assert.Equal(t, "1.9", services[0].ImageTag)
+	assert.Equal(t, "3", services[0].Version, "The rollback is a new version")
+	assert.Len(t, services[0].Instances, 2)
+}
+
+func TestDeleteAndUndeploy(t *testing.T) {
+	f := newTestFake(t, map[string]interface{}{})
+
+	assert.NotNil(t, f.DeleteService("nginx"), "Should fail when the service does not exist")
+	service, _ := f.DeployService(nginxConfig(), 2)
+	assert.Nil(t, f.UndeployInstance(service.Instances[0].ID))
+	assert.NotNil(t, f.UndeployInstance("missing"))
+	_, instances, _ := f.InspectService("nginx")
+	assert.Equal(t, 1, instances)
+
+	assert.Nil(t, f.DeleteService("/nginx"))
+	config, _, _ := f.InspectService("nginx")
+	assert.Nil(t, config)
+}
+
+func TestStateFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fake")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	_, err := newTestFake(t, map[string]interface{}{"state-file": path}).DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+
+	other := newTestFake(t, map[string]interface{}{"state-file": path})
+	services, err := other.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile("nginx")})
+	assert.Nil(t, err, "Another run should find the services of the state file")
+	assert.Len(t, services[0].Instances, 2)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("{broken"), 0600))
+	_, err = factory.Create("fake", map[string]interface{}{"state-file": path})
+	assert.NotNil(t, err, "Should fail with a broken state file")
+}
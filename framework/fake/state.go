@@ -0,0 +1,77 @@
+package fake
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// state is everything the fake framework knows, it is saved in the state file between runs
+type state struct {
+	Services map[string]*service `json:"services"`
+	// NextPort is the next public port given to an instance
+	NextPort int64 `json:"next_port"`
+}
+
+// service is a service deployed on the fake framework with the definitions it had
+type service struct {
+	Config    framework.ServiceConfig `json:"config"`
+	Version   int                     `json:"version"`
+	Instances []*framework.Instance   `json:"instances"`
+	History   []revision              `json:"history"`
+}
+
+// revision is a definition of a service, they are kept to rollback to them
+type revision struct {
+	Version   int                     `json:"version"`
+	Config    framework.ServiceConfig `json:"config"`
+	Instances int                     `json:"instances"`
+}
+
+func newState() *state {
+	return &state{Services: make(map[string]*service), NextPort: firstPort}
+}
+
+// loadState reads the state file, a file that does not exist is an empty state
+func loadState(path string) (*state, error) {
+	s := newState()
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, err
+	}
+	if s.Services == nil {
+		s.Services = make(map[string]*service)
+	}
+	return s, nil
+}
+
+// save writes the state file, through a temporary file so it is never left half written
+func (s *state) save(path string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".crane-fake")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,31 @@
+package fake
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAndSaveState(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fake")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	s, err := loadState(path)
+	assert.Nil(t, err, "A missing state file is an empty state")
+	assert.Empty(t, s.Services)
+	assert.Equal(t, int64(firstPort), s.NextPort)
+
+	s.Services["nginx"] = &service{Version: 2}
+	s.NextPort = 31010
+	assert.Nil(t, s.save(path))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1, "The temporary file should be renamed")
+
+	loaded, err := loadState(path)
+	assert.Nil(t, err)
+	assert.Equal(t, s, loaded)
+}
@@ -0,0 +1,257 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	contentTypeJSON       = "application/json"
+	contentTypeMergePatch = "application/merge-patch+json"
+)
+
+// APIError is an error answered by the API server
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *APIError) Error() string {
+	return fmt.Sprintf("Kubernetes API error: %d %s", err.StatusCode, err.Message)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// client calls the REST API of a Kubernetes cluster
+type client struct {
+	server   string
+	http     *http.Client
+	token    string
+	username string
+	password string
+}
+
+// do sends the body as JSON and decodes the answer in out, when they are not nil
+func (c *client) do(method, path, contentType string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.server, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentTypeJSON)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		content, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(content, &status) != nil || status.Message == "" {
+			status.Message = http.StatusText(resp.StatusCode)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: status.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// kubeconfig is the part of the kubectl configuration file used to reach a cluster
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Username              string `yaml:"username"`
+			Password              string `yaml:"password"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// defaultKubeconfig follows kubectl, using KUBECONFIG or the config in the home directory
+func defaultKubeconfig() string {
+	if path := os.Getenv("KUBECONFIG"); path != "" {
+		return strings.Split(path, string(os.PathListSeparator))[0]
+	}
+	return filepath.Join(os.Getenv("HOME"), ".kube", "config")
+}
+
+// newClientFromKubeconfig builds the client of the context of the kubeconfig, the current context
+// when it is empty. It also returns the namespace of the context
+func newClientFromKubeconfig(path, contextName string, timeout time.Duration) (*client, string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error reading the kubeconfig %s: %s", path, err)
+	}
+	var config kubeconfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, "", fmt.Errorf("Error parsing the kubeconfig %s: %s", path, err)
+	}
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	if contextName == "" {
+		return nil, "", fmt.Errorf("The kubeconfig %s has no current context", path)
+	}
+
+	var clusterName, userName, namespace string
+	found := false
+	for _, context := range config.Contexts {
+		if context.Name == contextName {
+			clusterName, userName, namespace = context.Context.Cluster, context.Context.User, context.Context.Namespace
+			found = true
+		}
+	}
+	if !found {
+		return nil, "", fmt.Errorf("The context %s does not exist in the kubeconfig %s", contextName, path)
+	}
+
+	dir := filepath.Dir(path)
+	c := &client{}
+	tlsConfig := &tls.Config{}
+	found = false
+	for _, cluster := range config.Clusters {
+		if cluster.Name != clusterName {
+			continue
+		}
+		found = true
+		c.server = cluster.Cluster.Server
+		tlsConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+		ca, err := fileOrData(dir, cluster.Cluster.CertificateAuthority, cluster.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, "", err
+		}
+		if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, "", fmt.Errorf("Invalid certificate authority of cluster %s", clusterName)
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+	if !found || c.server == "" {
+		return nil, "", fmt.Errorf("The cluster %s of context %s has no server", clusterName, contextName)
+	}
+
+	for _, user := range config.Users {
+		if user.Name != userName {
+			continue
+		}
+		c.token = user.User.Token
+		if c.token == "" && user.User.TokenFile != "" {
+			token, err := ioutil.ReadFile(resolvePath(dir, user.User.TokenFile))
+			if err != nil {
+				return nil, "", err
+			}
+			c.token = strings.TrimSpace(string(token))
+		}
+		c.username, c.password = user.User.Username, user.User.Password
+
+		cert, err := fileOrData(dir, user.User.ClientCertificate, user.User.ClientCertificateData)
+		if err != nil {
+			return nil, "", err
+		}
+		key, err := fileOrData(dir, user.User.ClientKey, user.User.ClientKeyData)
+		if err != nil {
+			return nil, "", err
+		}
+		if cert != nil || key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, "", fmt.Errorf("Invalid client certificate of user %s: %s", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+
+	c.http = &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}
+	return c, namespace, nil
+}
+
+// fileOrData reads the file, or decodes the base64 data when there is no file
+func fileOrData(dir, file, data string) ([]byte, error) {
+	if file != "" {
+		return ioutil.ReadFile(resolvePath(dir, file))
+	}
+	if data != "" {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, errors.New("Invalid base64 data in the kubeconfig")
+		}
+		return decoded, nil
+	}
+	return nil, nil
+}
+
+// resolvePath resolves the paths of the kubeconfig relative to its directory, as kubectl does
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
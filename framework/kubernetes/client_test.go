@@ -0,0 +1,99 @@
+package kubernetes
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestKubeconfigCurrentContext(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kubeconfig")
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "token", "file-token\n")
+	path := writeFile(t, dir, "config", `
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://prod:6443
+    insecure-skip-tls-verify: true
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: deployer
+users:
+- name: deployer
+  user:
+    tokenFile: token
+`)
+
+	c, namespace, err := newClientFromKubeconfig(path, "", requestTimeout)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://prod:6443", c.server)
+	assert.Equal(t, "file-token", c.token, "The token file is relative to the kubeconfig")
+	assert.Equal(t, "", namespace)
+	assert.True(t, c.http.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+
+	_, _, err = newClientFromKubeconfig(path, "staging", requestTimeout)
+	assert.NotNil(t, err, "Should fail with a context that does not exist")
+	_, _, err = newClientFromKubeconfig(filepath.Join(dir, "missing"), "", requestTimeout)
+	assert.NotNil(t, err, "Should fail without kubeconfig")
+}
+
+func TestKubeconfigInvalidCertificate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kubeconfig")
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "config", `
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://prod:6443
+    certificate-authority-data: `+base64.StdEncoding.EncodeToString([]byte("not a certificate"))+`
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: deployer
+users:
+- name: deployer
+  user: {}
+`)
+	_, _, err := newClientFromKubeconfig(path, "", requestTimeout)
+	assert.NotNil(t, err)
+}
+
+func TestClientBasicAuthAndErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"kind":"Status","message":"etcd is unavailable"}`))
+	}))
+	defer server.Close()
+
+	c := &client{server: server.URL, http: http.DefaultClient, username: "admin", password: "secret"}
+	err := c.do(http.MethodGet, "/api/v1/namespaces/default/pods", "", nil, nil)
+	assert.Equal(t, &APIError{StatusCode: http.StatusServiceUnavailable, Message: "etcd is unavailable"}, err)
+	assert.False(t, isNotFound(err))
+
+	c.password = "wrong"
+	err = c.do(http.MethodGet, "/api/v1/namespaces/default/pods", "", nil, nil)
+	assert.Equal(t, &APIError{StatusCode: http.StatusUnauthorized, Message: "Unauthorized"}, err)
+}
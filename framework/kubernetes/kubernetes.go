@@ -0,0 +1,383 @@
+// Package kubernetes deploys the services of crane as Deployments of a Kubernetes cluster, with a
+// Service publishing their ports. It is registered as the framework "kubernetes":
+//
+//	cluster:
+//	  gke:
+//	    framework:
+//	      kubernetes:
+//	        kubeconfig: /home/crane/.kube/config
+//	        context: gke-prod
+//	        namespace: payments
+//	        deploy-timeout: 300
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/latam-airlines/mesos-framework-factory/factory"
+	"github.com/latam-airlines/mesos-framework-factory/utils"
+)
+
+const (
+	frameworkID = "kubernetes"
+
+	defaultNamespace     = "default"
+	defaultServiceType   = "NodePort"
+	defaultDeployTimeout = 300
+	requestTimeout       = 30 * time.Second
+)
+
+// pollInterval is the wait between the checks of a rollout, it is replaced in the tests
+var pollInterval = 2 * time.Second
+
+func init() {
+	factory.Register(frameworkID, &kubernetesCreator{})
+}
+
+// kubernetesCreator implements factory.FrameworkFactory
+type kubernetesCreator struct{}
+
+func (creator *kubernetesCreator) Create(params map[string]interface{}) (framework.Framework, error) {
+	kubeconfig := utils.ExtractString(params, "kubeconfig")
+	if kubeconfig == "" {
+		kubeconfig = defaultKubeconfig()
+	}
+
+	deployTimeout := defaultDeployTimeout
+	if value, ok := params["deploy-timeout"]; ok {
+		if deployTimeout, ok = value.(int); !ok || deployTimeout <= 0 {
+			return nil, errors.New("Parameter deploy-timeout should be a number of seconds greater than 0")
+		}
+	}
+
+	serviceType := utils.ExtractString(params, "service-type")
+	switch serviceType {
+	case "":
+		serviceType = defaultServiceType
+	case "NodePort", "ClusterIP", "LoadBalancer":
+	default:
+		return nil, fmt.Errorf("Unknown service-type %s, it should be NodePort, ClusterIP or LoadBalancer", serviceType)
+	}
+
+	client, namespace, err := newClientFromKubeconfig(kubeconfig, utils.ExtractString(params, "context"), requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if ns := utils.ExtractString(params, "namespace"); ns != "" {
+		namespace = ns
+	}
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	return &Kubernetes{client: client, namespace: namespace, serviceType: serviceType, deployTimeout: deployTimeout}, nil
+}
+
+// Kubernetes implements framework.Framework on a namespace of a Kubernetes cluster
+type Kubernetes struct {
+	client        *client
+	namespace     string
+	serviceType   string
+	deployTimeout int
+}
+
+func (k *Kubernetes) ID() string {
+	return frameworkID
+}
+
+func (k *Kubernetes) deploymentsPath() string {
+	return "/apis/apps/v1/namespaces/" + k.namespace + "/deployments"
+}
+
+func (k *Kubernetes) replicaSetsPath() string {
+	return "/apis/apps/v1/namespaces/" + k.namespace + "/replicasets"
+}
+
+func (k *Kubernetes) servicesPath() string {
+	return "/api/v1/namespaces/" + k.namespace + "/services"
+}
+
+func (k *Kubernetes) podsPath() string {
+	return "/api/v1/namespaces/" + k.namespace + "/pods"
+}
+
+// selectorQuery selects the objects of a service, or of every service when the name is empty
+func selectorQuery(name string) string {
+	selector := serviceLabel
+	if name != "" {
+		selector += "=" + name
+	}
+	return "?labelSelector=" + url.QueryEscape(selector)
+}
+
+func (k *Kubernetes) getDeployment(name string) (*deployment, error) {
+	d := new(deployment)
+	if err := k.client.do(http.MethodGet, k.deploymentsPath()+"/"+name, "", nil, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (k *Kubernetes) getService(name string) (*service, error) {
+	s := new(service)
+	if err := k.client.do(http.MethodGet, k.servicesPath()+"/"+name, "", nil, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// FindServiceInformation returns the services meeting the criteria, it fails when there is none
+// as marathon does
+func (k *Kubernetes) FindServiceInformation(criteria framework.ServiceInformationCriteria) ([]*framework.ServiceInformation, error) {
+	var deployments deploymentList
+	if err := k.client.do(http.MethodGet, k.deploymentsPath()+selectorQuery(""), "", nil, &deployments); err != nil {
+		return nil, err
+	}
+	var pods podList
+	if err := k.client.do(http.MethodGet, k.podsPath()+selectorQuery(""), "", nil, &pods); err != nil {
+		return nil, err
+	}
+	var services struct {
+		Items []service `json:"items"`
+	}
+	if err := k.client.do(http.MethodGet, k.servicesPath()+selectorQuery(""), "", nil, &services); err != nil {
+		return nil, err
+	}
+
+	podsByService := make(map[string][]pod)
+	for _, p := range pods.Items {
+		name := p.Metadata.Labels[serviceLabel]
+		podsByService[name] = append(podsByService[name], p)
+	}
+	servicesByName := make(map[string]*service)
+	for i := range services.Items {
+		servicesByName[services.Items[i].Metadata.Name] = &services.Items[i]
+	}
+
+	all := make([]*framework.ServiceInformation, 0, len(deployments.Items))
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		all = append(all, serviceInformation(d, podsByService[d.Metadata.Name], servicesByName[d.Metadata.Name]))
+	}
+	filtered := criteria.MeetCriteria(all)
+	if len(filtered) == 0 {
+		return nil, errors.New("No services found")
+	}
+	return filtered, nil
+}
+
+// describe returns the current information of the service with its pods
+func (k *Kubernetes) describe(name string) (*framework.ServiceInformation, error) {
+	d, err := k.getDeployment(name)
+	if err != nil {
+		return nil, err
+	}
+	var pods podList
+	if err := k.client.do(http.MethodGet, k.podsPath()+selectorQuery(name), "", nil, &pods); err != nil {
+		return nil, err
+	}
+	svc, err := k.getService(name)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	return serviceInformation(d, pods.Items, svc), nil
+}
+
+// DeployService creates the deployment of the service or replaces its definition, and waits until
+// the rollout finishes. A new deployment that fails is deleted, as marathon does
+func (k *Kubernetes) DeployService(config framework.ServiceConfig, instances int) (*framework.ServiceInformation, error) {
+	d, err := translateServiceConfig(config, instances, k.namespace)
+	if err != nil {
+		return nil, err
+	}
+	name := d.Metadata.Name
+
+	current, err := k.getDeployment(name)
+	created := false
+	switch {
+	case isNotFound(err):
+		util.Log.Infof("Creating deployment %s in namespace %s", name, k.namespace)
+		err = k.client.do(http.MethodPost, k.deploymentsPath(), contentTypeJSON, d, nil)
+		created = true
+	case err == nil:
+		util.Log.Infof("Updating deployment %s in namespace %s", name, k.namespace)
+		d.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+		err = k.client.do(http.MethodPut, k.deploymentsPath()+"/"+name, contentTypeJSON, d, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.applyService(d); err != nil {
+		return nil, err
+	}
+
+	if err := k.waitForRollout(name); err != nil {
+		if created {
+			util.Log.Errorf("Deleting deployment %s, it was created and its rollout fails: %s", name, err)
+			k.DeleteService(config.ServiceID)
+		}
+		return nil, err
+	}
+	return k.describe(name)
+}
+
+// applyService creates or updates the service publishing the ports of the deployment, the node
+// ports already assigned are kept
+func (k *Kubernetes) applyService(d *deployment) error {
+	name := d.Metadata.Name
+	current, err := k.getService(name)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	desired := translateService(d, k.serviceType)
+	if len(desired.Spec.Ports) == 0 {
+		if current == nil {
+			return nil
+		}
+		return k.client.do(http.MethodDelete, k.servicesPath()+"/"+name, "", nil, nil)
+	}
+	if current == nil {
+		return k.client.do(http.MethodPost, k.servicesPath(), contentTypeJSON, desired, nil)
+	}
+
+	nodePorts := make(map[string]int64)
+	for _, port := range current.Spec.Ports {
+		nodePorts[port.Name] = port.NodePort
+	}
+	for i := range desired.Spec.Ports {
+		if current.Spec.Type == desired.Spec.Type {
+			desired.Spec.Ports[i].NodePort = nodePorts[desired.Spec.Ports[i].Name]
+		}
+	}
+	desired.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+	desired.Spec.ClusterIP = current.Spec.ClusterIP
+	return k.client.do(http.MethodPut, k.servicesPath()+"/"+name, contentTypeJSON, desired, nil)
+}
+
+// waitForRollout waits until every replica of the deployment runs its last definition and is
+// available, as kubectl rollout status does
+func (k *Kubernetes) waitForRollout(name string) error {
+	deadline := time.Now().Add(time.Duration(k.deployTimeout) * time.Second)
+	for {
+		d, err := k.getDeployment(name)
+		if err != nil {
+			return err
+		}
+		status := d.Status
+		if status.ObservedGeneration >= d.Metadata.Generation && status.UpdatedReplicas == d.Spec.Replicas &&
+			status.Replicas == d.Spec.Replicas && status.AvailableReplicas == d.Spec.Replicas {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The rollout of %s timed out after %d seconds, %d of %d replicas are available", name, k.deployTimeout, status.AvailableReplicas, d.Spec.Replicas)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// ScaleService changes the replicas of the deployment without modifying its definition
+func (k *Kubernetes) ScaleService(serviceID string, instances int) (*framework.ServiceInformation, error) {
+	name := resourceName(serviceID)
+	patch := map[string]interface{}{"spec": map[string]interface{}{"replicas": instances}}
+	if err := k.client.do(http.MethodPatch, k.deploymentsPath()+"/"+name, contentTypeMergePatch, patch, nil); err != nil {
+		return nil, err
+	}
+	if err := k.waitForRollout(name); err != nil {
+		return nil, err
+	}
+	return k.describe(name)
+}
+
+// LabelService changes the labels of the deployment without modifying its pods, so there is no
+// rollout. A label with an empty value is removed
+func (k *Kubernetes) LabelService(serviceID string, labels map[string]string) error {
+	patched := make(map[string]interface{}, len(labels))
+	for key, value := range labels {
+		if key == serviceLabel {
+			return fmt.Errorf("The label %s is reserved", serviceLabel)
+		}
+		if value == "" {
+			patched[key] = nil
+		} else {
+			patched[key] = value
+		}
+	}
+	patch := map[string]interface{}{"metadata": map[string]interface{}{"labels": patched}}
+	return k.client.do(http.MethodPatch, k.deploymentsPath()+"/"+resourceName(serviceID), contentTypeMergePatch, patch, nil)
+}
+
+// InspectService returns the definition of the service and its replicas, a nil config when the
+// deployment does not exist
+func (k *Kubernetes) InspectService(serviceID string) (*framework.ServiceConfig, int, error) {
+	d, err := k.getDeployment(resourceName(serviceID))
+	if isNotFound(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return serviceConfigFromDeployment(d), d.Spec.Replicas, nil
+}
+
+// DeleteService deletes the deployment with its pods and the service publishing its ports
+func (k *Kubernetes) DeleteService(serviceID string) error {
+	name := resourceName(serviceID)
+	options := map[string]string{"kind": "DeleteOptions", "apiVersion": "v1", "propagationPolicy": "Background"}
+	if err := k.client.do(http.MethodDelete, k.deploymentsPath()+"/"+name, contentTypeJSON, options, nil); err != nil {
+		util.Log.Errorf("Failed to delete the deployment %s: %s", name, err)
+		return err
+	}
+	if err := k.client.do(http.MethodDelete, k.servicesPath()+"/"+name, "", nil, nil); err != nil && !isNotFound(err) {
+		util.Log.Errorf("Failed to delete the service %s: %s", name, err)
+		return err
+	}
+	return nil
+}
+
+// UndeployInstance deletes a pod, the deployment replaces it
+func (k *Kubernetes) UndeployInstance(podName string) error {
+	return k.client.do(http.MethodDelete, k.podsPath()+"/"+podName, "", nil, nil)
+}
+
+// RollbackService returns the deployment to the definition of a previous revision, as kubectl
+// rollout undo does
+func (k *Kubernetes) RollbackService(serviceID, version string) {
+	if err := k.rollback(resourceName(serviceID), version); err != nil {
+		util.Log.Errorf("Failed to rollback %s to revision %s: %s", serviceID, version, err)
+	}
+}
+
+func (k *Kubernetes) rollback(name, revision string) error {
+	var replicaSets replicaSetList
+	if err := k.client.do(http.MethodGet, k.replicaSetsPath()+selectorQuery(name), "", nil, &replicaSets); err != nil {
+		return err
+	}
+	var template *podTemplate
+	for i := range replicaSets.Items {
+		if replicaSets.Items[i].Metadata.Annotations[revisionAnnotation] == revision {
+			template = &replicaSets.Items[i].Spec.Template
+		}
+	}
+	if template == nil {
+		return fmt.Errorf("The revision %s of %s does not exist", revision, name)
+	}
+	delete(template.Metadata.Labels, templateHashLabel)
+
+	d, err := k.getDeployment(name)
+	if err != nil {
+		return err
+	}
+	d.Spec.Template = *template
+	if err := k.client.do(http.MethodPut, k.deploymentsPath()+"/"+name, contentTypeJSON, d, nil); err != nil {
+		return err
+	}
+	return k.waitForRollout(name)
+}
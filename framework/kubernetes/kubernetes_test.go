@@ -0,0 +1,492 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/latam-airlines/mesos-framework-factory/factory"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAPIServer keeps the objects of a namespace in memory. The deployments are rolled out
+// as soon as they are saved, unless stuck is set
+type fakeAPIServer struct {
+	sync.Mutex
+	deployments map[string]*deployment
+	replicaSets []replicaSet
+	services    map[string]*service
+	pods        map[string]*pod
+	stuck       bool
+	nextPort    int64
+}
+
+func newFakeAPIServer() *fakeAPIServer {
+	return &fakeAPIServer{
+		deployments: make(map[string]*deployment),
+		services:    make(map[string]*service),
+		pods:        make(map[string]*pod),
+		nextPort:    30000,
+	}
+}
+
+var objectPath = regexp.MustCompile(`^/(?:api/v1|apis/apps/v1)/namespaces/([^/]+)/([a-z]+)(?:/([^/]+))?$`)
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	match := objectPath.FindStringSubmatch(r.URL.Path)
+	if match == nil || match[1] != "crane" {
+		writeStatus(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+		return
+	}
+	resource, name := match[2], match[3]
+	selector := r.URL.Query().Get("labelSelector")
+
+	switch {
+	case resource == "deployments" && name == "" && r.Method == http.MethodGet:
+		list := deploymentList{Items: []deployment{}}
+		for _, d := range f.deployments {
+			if matchSelector(d.Metadata.Labels, selector) {
+				list.Items = append(list.Items, *d)
+			}
+		}
+		writeJSON(w, list)
+	case resource == "deployments" && name == "" && r.Method == http.MethodPost:
+		d := new(deployment)
+		json.NewDecoder(r.Body).Decode(d)
+		if _, ok := f.deployments[d.Metadata.Name]; ok {
+			writeStatus(w, http.StatusConflict, "already exists")
+			return
+		}
+		f.saveDeployment(d, nil)
+		writeJSON(w, d)
+	case resource == "deployments" && r.Method == http.MethodGet:
+		if d, ok := f.deployments[name]; ok {
+			writeJSON(w, d)
+		} else {
+			writeStatus(w, http.StatusNotFound, "deployments "+name+" not found")
+		}
+	case resource == "deployments" && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		current, ok := f.deployments[name]
+		if !ok {
+			writeStatus(w, http.StatusNotFound, "deployments "+name+" not found")
+			return
+		}
+		d := new(deployment)
+		if r.Method == http.MethodPatch {
+			copied := *current
+			d = &copied
+		}
+		json.NewDecoder(r.Body).Decode(d)
+		f.saveDeployment(d, current)
+		writeJSON(w, d)
+	case resource == "deployments" && r.Method == http.MethodDelete:
+		if _, ok := f.deployments[name]; !ok {
+			writeStatus(w, http.StatusNotFound, "deployments "+name+" not found")
+			return
+		}
+		delete(f.deployments, name)
+		f.setPods(name, nil, 0)
+		writeJSON(w, map[string]string{"status": "Success"})
+	case resource == "replicasets" && r.Method == http.MethodGet:
+		list := replicaSetList{Items: []replicaSet{}}
+		for _, rs := range f.replicaSets {
+			if matchSelector(rs.Metadata.Labels, selector) {
+				list.Items = append(list.Items, rs)
+			}
+		}
+		writeJSON(w, list)
+	case resource == "services" && name == "" && r.Method == http.MethodGet:
+		list := struct {
+			Items []service `json:"items"`
+		}{Items: []service{}}
+		for _, s := range f.services {
+			if matchSelector(s.Metadata.Labels, selector) {
+				list.Items = append(list.Items, *s)
+			}
+		}
+		writeJSON(w, list)
+	case resource == "services" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		s := new(service)
+		json.NewDecoder(r.Body).Decode(s)
+		for i := range s.Spec.Ports {
+			if s.Spec.Ports[i].NodePort == 0 {
+				s.Spec.Ports[i].NodePort = f.nextPort
+				f.nextPort++
+			}
+		}
+		f.services[s.Metadata.Name] = s
+		writeJSON(w, s)
+	case resource == "services" && r.Method == http.MethodGet:
+		if s, ok := f.services[name]; ok {
+			writeJSON(w, s)
+		} else {
+			writeStatus(w, http.StatusNotFound, "services "+name+" not found")
+		}
+	case resource == "services" && r.Method == http.MethodDelete:
+		if _, ok := f.services[name]; !ok {
+			writeStatus(w, http.StatusNotFound, "services "+name+" not found")
+			return
+		}
+		delete(f.services, name)
+		writeJSON(w, map[string]string{"status": "Success"})
+	case resource == "pods" && name == "" && r.Method == http.MethodGet:
+		list := podList{Items: []pod{}}
+		for _, p := range f.pods {
+			if matchSelector(p.Metadata.Labels, selector) {
+				list.Items = append(list.Items, *p)
+			}
+		}
+		writeJSON(w, list)
+	case resource == "pods" && r.Method == http.MethodDelete:
+		delete(f.pods, name)
+		writeJSON(w, map[string]string{"status": "Success"})
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, r.Method+" "+r.URL.Path)
+	}
+}
+
+// saveDeployment stores the deployment, creating a new revision when its template changes
+func (f *fakeAPIServer) saveDeployment(d, current *deployment) {
+	revision := 1
+	changed := true
+	if current != nil {
+		d.Metadata.Generation = current.Metadata.Generation
+		revision, _ = strconv.Atoi(current.Metadata.Annotations[revisionAnnotation])
+		changed = !reflect.DeepEqual(d.Spec.Template, current.Spec.Template)
+		if changed {
+			revision++
+		}
+	}
+	d.Metadata.Generation++
+	if d.Metadata.Annotations == nil {
+		d.Metadata.Annotations = make(map[string]string)
+	}
+	d.Metadata.Annotations[revisionAnnotation] = strconv.Itoa(revision)
+	if changed {
+		rs := replicaSet{Metadata: objectMeta{
+			Name:        fmt.Sprintf("%s-%d", d.Metadata.Name, revision),
+			Labels:      d.Spec.Selector.MatchLabels,
+			Annotations: map[string]string{revisionAnnotation: strconv.Itoa(revision)},
+		}}
+		rs.Spec.Template = d.Spec.Template
+		f.replicaSets = append(f.replicaSets, rs)
+	}
+
+	if f.stuck {
+		d.Status = deploymentStatus{ObservedGeneration: d.Metadata.Generation, Replicas: d.Spec.Replicas}
+	} else {
+		d.Status = deploymentStatus{ObservedGeneration: d.Metadata.Generation, Replicas: d.Spec.Replicas, UpdatedReplicas: d.Spec.Replicas, AvailableReplicas: d.Spec.Replicas}
+	}
+	f.deployments[d.Metadata.Name] = d
+	f.setPods(d.Metadata.Name, &d.Spec.Template, d.Spec.Replicas)
+}
+
+// setPods replaces the pods of the deployment
+func (f *fakeAPIServer) setPods(name string, template *podTemplate, replicas int) {
+	for podName, p := range f.pods {
+		if p.Metadata.Labels[serviceLabel] == name {
+			delete(f.pods, podName)
+		}
+	}
+	for i := 0; i < replicas; i++ {
+		p := &pod{Metadata: objectMeta{Name: fmt.Sprintf("%s-%d", name, i), Labels: template.Metadata.Labels}, Spec: template.Spec}
+		p.Spec.NodeName = "node-1"
+		p.Status.HostIP = "10.0.0.1"
+		if !f.stuck {
+			p.Status.Phase = "Running"
+			p.Status.Conditions = append(p.Status.Conditions, struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			}{"Ready", "True"})
+		}
+		f.pods[p.Metadata.Name] = p
+	}
+}
+
+func matchSelector(labels map[string]string, selector string) bool {
+	if selector == "" {
+		return true
+	}
+	keyVal := strings.SplitN(selector, "=", 2)
+	value, ok := labels[keyVal[0]]
+	return ok && (len(keyVal) == 1 || value == keyVal[1])
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "message": message, "code": code})
+}
+
+// writeKubeconfig writes a kubeconfig with a context for the server
+func writeKubeconfig(t *testing.T, server string) string {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	assert.Nil(t, err)
+	path := filepath.Join(dir, "config")
+	content := `
+apiVersion: v1
+kind: Config
+current-context: other
+clusters:
+- name: fake
+  cluster:
+    server: ` + server + `
+contexts:
+- name: other
+  context:
+    cluster: missing
+    user: crane
+- name: fake
+  context:
+    cluster: fake
+    user: crane
+    namespace: crane
+users:
+- name: crane
+  user:
+    token: secret-token
+`
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func newTestKubernetes(t *testing.T) (*Kubernetes, *fakeAPIServer, func()) {
+	pollInterval = time.Millisecond
+	fake := newFakeAPIServer()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret-token", r.Header.Get("Authorization"))
+		fake.ServeHTTP(w, r)
+	}))
+	path := writeKubeconfig(t, server.URL)
+
+	fw, err := factory.Create("kubernetes", map[string]interface{}{"kubeconfig": path, "context": "fake", "deploy-timeout": 1})
+	assert.Nil(t, err)
+	return fw.(*Kubernetes), fake, func() {
+		server.Close()
+		os.RemoveAll(filepath.Dir(path))
+		pollInterval = 2 * time.Second
+	}
+}
+
+func nginxConfig() framework.ServiceConfig {
+	return framework.ServiceConfig{
+		ServiceID:         "/nginx",
+		ImageName:         "registry:5000/nginx",
+		Tag:               "1.9",
+		CPUShares:         0.5,
+		Memory:            256,
+		Publish:           []string{"8080/tcp"},
+		Envs:              []string{"REGION=us"},
+		Constraints:       map[string]string{"zone": "a"},
+		HealthCheckConfig: &framework.HealthCheck{Path: "/health"},
+	}
+}
+
+func TestCreateParameters(t *testing.T) {
+	path := writeKubeconfig(t, "https://kubernetes:6443")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	fw, err := factory.Create("kubernetes", map[string]interface{}{"kubeconfig": path, "context": "fake"})
+	assert.Nil(t, err)
+	k := fw.(*Kubernetes)
+	assert.Equal(t, "crane", k.namespace, "Should use the namespace of the context")
+	assert.Equal(t, defaultServiceType, k.serviceType)
+	assert.Equal(t, defaultDeployTimeout, k.deployTimeout)
+
+	fw, err = factory.Create("kubernetes", map[string]interface{}{"kubeconfig": path, "context": "fake", "namespace": "payments"})
+	assert.Nil(t, err)
+	assert.Equal(t, "payments", fw.(*Kubernetes).namespace, "The namespace parameter replaces the one of the context")
+
+	_, err = factory.Create("kubernetes", map[string]interface{}{"kubeconfig": path})
+	assert.NotNil(t, err, "The current context has a cluster that does not exist")
+	_, err = factory.Create("kubernetes", map[string]interface{}{"kubeconfig": path, "context": "fake", "service-type": "Ingress"})
+	assert.NotNil(t, err)
+	_, err = factory.Create("kubernetes", map[string]interface{}{"kubeconfig": path, "context": "fake", "deploy-timeout": "slow"})
+	assert.NotNil(t, err)
+}
+
+func TestDeployNewService(t *testing.T) {
+	k, fake, done := newTestKubernetes(t)
+	defer done()
+
+	service, err := k.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx", service.ID)
+	assert.Equal(t, "registry:5000/nginx", service.ImageName)
+	assert.Equal(t, "1.9", service.ImageTag)
+	assert.Equal(t, "1", service.Version)
+	assert.Len(t, service.Instances, 2)
+	instance := service.Instances[0]
+	assert.True(t, instance.Healthy())
+	assert.Equal(t, "10.0.0.1", instance.Host)
+	assert.Equal(t, framework.InstancePort{Advertise: "10.0.0.1:30000", Internal: 8080, Publics: []int64{30000}, Type: framework.TCP}, instance.Ports["8080/TCP"])
+
+	d := fake.deployments["nginx"]
+	c := d.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "registry:5000/nginx:1.9", c.Image)
+	assert.Equal(t, "500m", c.Resources.Limits["cpu"])
+	assert.Equal(t, "256Mi", c.Resources.Limits["memory"])
+	assert.Equal(t, map[string]string{"zone": "a"}, d.Spec.Template.Spec.NodeSelector)
+	assert.Equal(t, "/health", c.ReadinessProbe.HTTPGet.Path)
+	assert.Equal(t, "NodePort", fake.services["nginx"].Spec.Type)
+}
+
+func TestDeployUpdatesService(t *testing.T) {
+	k, fake, done := newTestKubernetes(t)
+	defer done()
+
+	_, err := k.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	config := nginxConfig()
+	config.Tag = "1.10"
+	service, err := k.DeployService(config, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.10", service.ImageTag)
+	assert.Equal(t, "2", service.Version, "The new template should be a new revision")
+	assert.Len(t, service.Instances, 3)
+	assert.Equal(t, int64(30000), fake.services["nginx"].Spec.Ports[0].NodePort, "Should keep the node port")
+}
+
+func TestDeployTimeoutDeletesNewService(t *testing.T) {
+	k, fake, done := newTestKubernetes(t)
+	defer done()
+	fake.stuck = true
+
+	_, err := k.DeployService(nginxConfig(), 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.Empty(t, fake.deployments, "A new deployment that fails should be deleted")
+	assert.Empty(t, fake.services)
+}
+
+func TestFindServiceInformation(t *testing.T) {
+	k, _, done := newTestKubernetes(t)
+	defer done()
+
+	_, err := k.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile("nginx")})
+	assert.NotNil(t, err, "Should fail when no service meets the criteria")
+
+	_, err = k.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	services, err := k.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile("nginx:1.9")})
+	assert.Nil(t, err)
+	assert.Len(t, services, 1)
+	assert.Len(t, services[0].Instances, 2)
+}
+
+func TestInspectService(t *testing.T) {
+	k, _, done := newTestKubernetes(t)
+	defer done()
+
+	config, instances, err := k.InspectService("nginx")
+	assert.Nil(t, err)
+	assert.Nil(t, config, "The service does not exist")
+
+	_, err = k.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	config, instances, err = k.InspectService("nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, instances)
+	expected := nginxConfig()
+	expected.ServiceID = "nginx"
+	assert.Equal(t, &expected, config, "The definition should be the one deployed")
+}
+
+func TestScaleService(t *testing.T) {
+	k, fake, done := newTestKubernetes(t)
+	defer done()
+
+	_, err := k.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	service, err := k.ScaleService("nginx", 4)
+	assert.Nil(t, err)
+	assert.Len(t, service.Instances, 4)
+	assert.Equal(t, "1", service.Version, "Scaling should not create a revision")
+	assert.Equal(t, "registry:5000/nginx:1.9", fake.deployments["nginx"].Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestLabelService(t *testing.T) {
+	k, fake, done := newTestKubernetes(t)
+	defer done()
+
+	assert.NotNil(t, k.LabelService("nginx", map[string]string{"crane.active": "true"}), "The deployment does not exist")
+	_, err := k.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	assert.Nil(t, k.LabelService("nginx", map[string]string{"crane.active": "true"}))
+	assert.Equal(t, "true", fake.deployments["nginx"].Metadata.Labels["crane.active"])
+	assert.NotNil(t, k.LabelService("nginx", map[string]string{serviceLabel: "other"}))
+
+	config, _, err := k.InspectService("nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, "true", config.Labels["crane.active"])
+	service, _ := k.describe("nginx")
+	assert.Equal(t, "1", service.Version, "Labeling should not create a revision")
+}
+
+func TestRollbackService(t *testing.T) {
+	k, fake, done := newTestKubernetes(t)
+	defer done()
+
+	_, err := k.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	config := nginxConfig()
+	config.Tag = "1.10"
+	_, err = k.DeployService(config, 2)
+	assert.Nil(t, err)
+
+	k.RollbackService("nginx", "1")
+	assert.Equal(t, "registry:5000/nginx:1.9", fake.deployments["nginx"].Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestDeleteService(t *testing.T) {
+	k, fake, done := newTestKubernetes(t)
+	defer done()
+
+	assert.NotNil(t, k.DeleteService("nginx"), "Should fail when the service does not exist")
+	_, err := k.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	assert.Nil(t, k.DeleteService("/nginx"))
+	assert.Empty(t, fake.deployments)
+	assert.Empty(t, fake.services)
+	assert.Empty(t, fake.pods)
+}
+
+func TestUndeployInstance(t *testing.T) {
+	k, fake, done := newTestKubernetes(t)
+	defer done()
+
+	_, err := k.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	assert.Nil(t, k.UndeployInstance("nginx-0"))
+	assert.Len(t, fake.pods, 1)
+}
+
+func TestAPIError(t *testing.T) {
+	k, _, done := newTestKubernetes(t)
+	defer done()
+	k.namespace = "other"
+
+	_, err := k.DeployService(nginxConfig(), 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Kubernetes API error: 404")
+}
@@ -0,0 +1,463 @@
+package kubernetes
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+const (
+	// serviceLabel selects the objects of a service, its value is the name of the objects
+	serviceLabel = "crane/service"
+	// serviceIDAnnotation keeps the id of the service, it can not be used as name of an object
+	serviceIDAnnotation = "crane/service-id"
+	// revisionAnnotation is the revision of a deployment and its replica sets
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+	templateHashLabel  = "pod-template-hash"
+
+	defaultCPU = 0.25
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// resourceName returns the name of the objects of the service, the names of Kubernetes only
+// accept lowercase alphanumeric characters and dashes
+func resourceName(serviceID string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(strings.Trim(serviceID, "/")), "-")
+	return strings.Trim(name, "-")
+}
+
+type objectMeta struct {
+	Name              string            `json:"name,omitempty"`
+	Namespace         string            `json:"namespace,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	Generation        int64             `json:"generation,omitempty"`
+	DeletionTimestamp string            `json:"deletionTimestamp,omitempty"`
+}
+
+type deployment struct {
+	APIVersion string           `json:"apiVersion,omitempty"`
+	Kind       string           `json:"kind,omitempty"`
+	Metadata   objectMeta       `json:"metadata"`
+	Spec       deploymentSpec   `json:"spec"`
+	Status     deploymentStatus `json:"status,omitempty"`
+}
+
+type deploymentSpec struct {
+	Replicas int                `json:"replicas"`
+	Selector *labelSelector     `json:"selector,omitempty"`
+	Strategy deploymentStrategy `json:"strategy,omitempty"`
+	Template podTemplate        `json:"template"`
+}
+
+type labelSelector struct {
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+}
+
+type deploymentStrategy struct {
+	Type          string         `json:"type,omitempty"`
+	RollingUpdate *rollingUpdate `json:"rollingUpdate,omitempty"`
+}
+
+type rollingUpdate struct {
+	MaxUnavailable string `json:"maxUnavailable,omitempty"`
+	MaxSurge       string `json:"maxSurge,omitempty"`
+}
+
+type deploymentStatus struct {
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	Replicas           int   `json:"replicas,omitempty"`
+	UpdatedReplicas    int   `json:"updatedReplicas,omitempty"`
+	AvailableReplicas  int   `json:"availableReplicas,omitempty"`
+}
+
+type deploymentList struct {
+	Items []deployment `json:"items"`
+}
+
+type replicaSet struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Template podTemplate `json:"template"`
+	} `json:"spec"`
+}
+
+type replicaSetList struct {
+	Items []replicaSet `json:"items"`
+}
+
+type podTemplate struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     podSpec    `json:"spec"`
+}
+
+type podSpec struct {
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	NodeName     string            `json:"nodeName,omitempty"`
+	Containers   []container       `json:"containers"`
+}
+
+type container struct {
+	Name           string               `json:"name"`
+	Image          string               `json:"image"`
+	Env            []envVar             `json:"env,omitempty"`
+	Ports          []containerPort      `json:"ports,omitempty"`
+	Resources      resourceRequirements `json:"resources,omitempty"`
+	ReadinessProbe *probe               `json:"readinessProbe,omitempty"`
+}
+
+type envVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type containerPort struct {
+	ContainerPort int64  `json:"containerPort"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+type resourceRequirements struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+type probe struct {
+	HTTPGet             *httpGetAction `json:"httpGet,omitempty"`
+	InitialDelaySeconds int            `json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int            `json:"periodSeconds,omitempty"`
+	TimeoutSeconds      int            `json:"timeoutSeconds,omitempty"`
+	FailureThreshold    int            `json:"failureThreshold,omitempty"`
+}
+
+type httpGetAction struct {
+	Path string `json:"path"`
+	Port int64  `json:"port"`
+}
+
+type service struct {
+	APIVersion string      `json:"apiVersion,omitempty"`
+	Kind       string      `json:"kind,omitempty"`
+	Metadata   objectMeta  `json:"metadata"`
+	Spec       serviceSpec `json:"spec"`
+}
+
+type serviceSpec struct {
+	Type      string            `json:"type,omitempty"`
+	ClusterIP string            `json:"clusterIP,omitempty"`
+	Selector  map[string]string `json:"selector,omitempty"`
+	Ports     []servicePort     `json:"ports,omitempty"`
+}
+
+type servicePort struct {
+	Name       string `json:"name,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	Port       int64  `json:"port"`
+	TargetPort int64  `json:"targetPort,omitempty"`
+	NodePort   int64  `json:"nodePort,omitempty"`
+}
+
+type pod struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     podSpec    `json:"spec"`
+	Status   struct {
+		Phase      string `json:"phase,omitempty"`
+		HostIP     string `json:"hostIP,omitempty"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions,omitempty"`
+	} `json:"status"`
+}
+
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+// ready reports if the pod is running and passes its readiness probe
+func (p *pod) ready() bool {
+	if p.Status.Phase != "Running" || p.Metadata.DeletionTimestamp != "" {
+		return false
+	}
+	for _, condition := range p.Status.Conditions {
+		if condition.Type == "Ready" {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
+
+// parsePort reads a port of the services, ie 8080/tcp
+func parsePort(publish string) (containerPort, error) {
+	parts := strings.Split(publish, "/")
+	port, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 {
+		return containerPort{}, fmt.Errorf("Port does not match format, ie. 8080/tcp: %s", publish)
+	}
+	return containerPort{ContainerPort: port, Protocol: strings.ToUpper(parts[1])}, nil
+}
+
+// translateServiceConfig builds the deployment of the service
+func translateServiceConfig(config framework.ServiceConfig, instances int, namespace string) (*deployment, error) {
+	name := resourceName(config.ServiceID)
+	if name == "" {
+		return nil, fmt.Errorf("Invalid service id %s", config.ServiceID)
+	}
+	selector := map[string]string{serviceLabel: name}
+	annotations := map[string]string{serviceIDAnnotation: strings.TrimPrefix(config.ServiceID, "/")}
+	labels := map[string]string{serviceLabel: name}
+	for key, value := range config.Labels {
+		labels[key] = value
+	}
+
+	c := container{Name: name, Image: config.ImageName + ":" + config.Tag}
+	envs := make(map[string]bool)
+	for _, env := range config.Envs {
+		keyVal := strings.SplitN(env, "=", 2)
+		if len(keyVal) != 2 {
+			continue
+		}
+		c.Env = append(c.Env, envVar{Name: keyVal[0], Value: keyVal[1]})
+		envs[keyVal[0]] = true
+	}
+	if !envs["SERVICE_NAME"] {
+		c.Env = append(c.Env, envVar{Name: "SERVICE_NAME", Value: annotations[serviceIDAnnotation]})
+	}
+	for _, publish := range config.Publish {
+		port, err := parsePort(publish)
+		if err != nil {
+			return nil, err
+		}
+		c.Ports = append(c.Ports, port)
+	}
+
+	cpu := config.CPUShares
+	if cpu == 0 {
+		cpu = defaultCPU
+	}
+	c.Resources.Requests = map[string]string{"cpu": formatCPU(cpu)}
+	c.Resources.Limits = map[string]string{"cpu": formatCPU(cpu)}
+	if config.Memory > 0 {
+		c.Resources.Requests["memory"] = fmt.Sprintf("%dMi", config.Memory)
+		c.Resources.Limits["memory"] = fmt.Sprintf("%dMi", config.Memory)
+	}
+
+	if health := config.HealthCheckConfig; health != nil && health.Path != "" && len(c.Ports) != 0 {
+		c.ReadinessProbe = &probe{HTTPGet: &httpGetAction{Path: health.Path, Port: c.Ports[0].ContainerPort}}
+		if health.GracePeriod > 0 {
+			c.ReadinessProbe.InitialDelaySeconds = health.GracePeriod
+		}
+		if health.Interval > 0 {
+			c.ReadinessProbe.PeriodSeconds = health.Interval
+		}
+		if health.Timeout > 0 {
+			c.ReadinessProbe.TimeoutSeconds = health.Timeout
+		}
+		if health.MaxConsecutiveFailures > 0 {
+			c.ReadinessProbe.FailureThreshold = health.MaxConsecutiveFailures
+		}
+	}
+
+	d := &deployment{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata:   objectMeta{Name: name, Namespace: namespace, Labels: labels, Annotations: annotations},
+		Spec: deploymentSpec{
+			Replicas: instances,
+			Selector: &labelSelector{MatchLabels: selector},
+			Template: podTemplate{
+				Metadata: objectMeta{Labels: labels, Annotations: annotations},
+				Spec:     podSpec{NodeSelector: config.Constraints, Containers: []container{c}},
+			},
+		},
+	}
+	// The capacities of marathon are fractions of the instances, as the percentages of Kubernetes
+	if config.MinimumHealthCapacity > 0 || config.MaximumOverCapacity > 0 {
+		d.Spec.Strategy = deploymentStrategy{Type: "RollingUpdate", RollingUpdate: &rollingUpdate{
+			MaxUnavailable: fmt.Sprintf("%d%%", int(math.Floor((1-config.MinimumHealthCapacity)*100))),
+			MaxSurge:       fmt.Sprintf("%d%%", int(math.Ceil(config.MaximumOverCapacity*100))),
+		}}
+	}
+	return d, nil
+}
+
+// translateService builds the service that publishes the ports of the deployment on every node
+func translateService(d *deployment, serviceType string) *service {
+	s := &service{
+		APIVersion: "v1",
+		Kind:       "Service",
+		Metadata:   objectMeta{Name: d.Metadata.Name, Namespace: d.Metadata.Namespace, Labels: d.Spec.Selector.MatchLabels, Annotations: d.Metadata.Annotations},
+		Spec:       serviceSpec{Type: serviceType, Selector: d.Spec.Selector.MatchLabels},
+	}
+	for _, port := range d.Spec.Template.Spec.Containers[0].Ports {
+		s.Spec.Ports = append(s.Spec.Ports, servicePort{
+			Name:       fmt.Sprintf("%s-%d", strings.ToLower(port.Protocol), port.ContainerPort),
+			Protocol:   port.Protocol,
+			Port:       port.ContainerPort,
+			TargetPort: port.ContainerPort,
+		})
+	}
+	return s
+}
+
+// serviceConfigFromDeployment describes the service of the deployment, it is the inverse of
+// translateServiceConfig
+func serviceConfigFromDeployment(d *deployment) *framework.ServiceConfig {
+	config := &framework.ServiceConfig{ServiceID: serviceID(d.Metadata)}
+	if len(d.Spec.Template.Spec.Containers) == 0 {
+		return config
+	}
+	c := d.Spec.Template.Spec.Containers[0]
+	config.ImageName, config.Tag = imageAndTag(c.Image)
+	for _, env := range c.Env {
+		if env.Name != "SERVICE_NAME" {
+			config.Envs = append(config.Envs, env.Name+"="+env.Value)
+		}
+	}
+	for _, port := range c.Ports {
+		config.Publish = append(config.Publish, fmt.Sprintf("%d/%s", port.ContainerPort, strings.ToLower(port.Protocol)))
+	}
+	config.CPUShares = parseCPU(c.Resources.Limits["cpu"])
+	config.Memory = parseMemory(c.Resources.Limits["memory"])
+	if len(d.Spec.Template.Spec.NodeSelector) != 0 {
+		config.Constraints = d.Spec.Template.Spec.NodeSelector
+	}
+	for key, value := range d.Metadata.Labels {
+		if key == serviceLabel {
+			continue
+		}
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		config.Labels[key] = value
+	}
+	if c.ReadinessProbe != nil && c.ReadinessProbe.HTTPGet != nil {
+		config.HealthCheckConfig = &framework.HealthCheck{
+			Path:                   c.ReadinessProbe.HTTPGet.Path,
+			GracePeriod:            c.ReadinessProbe.InitialDelaySeconds,
+			Interval:               c.ReadinessProbe.PeriodSeconds,
+			Timeout:                c.ReadinessProbe.TimeoutSeconds,
+			MaxConsecutiveFailures: c.ReadinessProbe.FailureThreshold,
+		}
+	}
+	if update := d.Spec.Strategy.RollingUpdate; update != nil {
+		config.MinimumHealthCapacity = 1 - parsePercentage(update.MaxUnavailable)
+		config.MaximumOverCapacity = parsePercentage(update.MaxSurge)
+	}
+	return config
+}
+
+// serviceInformation describes the deployment and its pods. The public ports are the node ports
+// of the service, when it exists
+func serviceInformation(d *deployment, pods []pod, svc *service) *framework.ServiceInformation {
+	info := &framework.ServiceInformation{ID: serviceID(d.Metadata), Version: d.Metadata.Annotations[revisionAnnotation]}
+	if len(d.Spec.Template.Spec.Containers) != 0 {
+		info.ImageName, info.ImageTag = imageAndTag(d.Spec.Template.Spec.Containers[0].Image)
+	}
+
+	nodePorts := make(map[string]int64)
+	if svc != nil {
+		for _, port := range svc.Spec.Ports {
+			nodePorts[fmt.Sprintf("%d/%s", port.TargetPort, port.Protocol)] = port.NodePort
+		}
+	}
+
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Metadata.Name < pods[j].Metadata.Name })
+	for _, p := range pods {
+		if p.Metadata.DeletionTimestamp != "" {
+			continue
+		}
+		instance := &framework.Instance{ID: p.Metadata.Name, Host: p.Status.HostIP, Status: framework.InstanceDown}
+		if instance.Host == "" {
+			instance.Host = p.Spec.NodeName
+		}
+		if p.ready() {
+			instance.Status = framework.InstanceUp
+		}
+		if len(p.Spec.Containers) != 0 {
+			instance.ContainerName = p.Spec.Containers[0].Name
+			for _, port := range p.Spec.Containers[0].Ports {
+				key := fmt.Sprintf("%d/%s", port.ContainerPort, port.Protocol)
+				instancePort := framework.InstancePort{Internal: port.ContainerPort, Type: framework.NewInstancePortType(port.Protocol)}
+				if nodePort := nodePorts[key]; nodePort != 0 {
+					instancePort.Publics = []int64{nodePort}
+					instancePort.Advertise = fmt.Sprintf("%s:%d", instance.Host, nodePort)
+				}
+				if instance.Ports == nil {
+					instance.Ports = make(map[string]framework.InstancePort)
+				}
+				instance.Ports[key] = instancePort
+			}
+		}
+		info.Instances = append(info.Instances, instance)
+	}
+	return info
+}
+
+func serviceID(meta objectMeta) string {
+	if id := meta.Annotations[serviceIDAnnotation]; id != "" {
+		return id
+	}
+	return meta.Name
+}
+
+// imageAndTag splits the image, the registry can have a port so the tag is after the last colon
+// following the last slash
+func imageAndTag(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || i < strings.LastIndex(image, "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
+
+// formatCPU writes the cores as millicores
+func formatCPU(cores float64) string {
+	return fmt.Sprintf("%dm", int64(math.Ceil(cores*1000)))
+}
+
+// parseCPU reads a quantity of cpu, in cores or millicores
+func parseCPU(quantity string) float64 {
+	if strings.HasSuffix(quantity, "m") {
+		millicores, _ := strconv.ParseFloat(strings.TrimSuffix(quantity, "m"), 64)
+		return millicores / 1000
+	}
+	cores, _ := strconv.ParseFloat(quantity, 64)
+	return cores
+}
+
+var memoryUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+// parseMemory reads a quantity of memory as megabytes, the unit of the memory of the services
+func parseMemory(quantity string) int64 {
+	if quantity == "" {
+		return 0
+	}
+	multiplier := 1.0
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(quantity, unit.suffix) {
+			quantity = strings.TrimSuffix(quantity, unit.suffix)
+			multiplier = unit.bytes
+			break
+		}
+	}
+	value, _ := strconv.ParseFloat(quantity, 64)
+	return int64(math.Ceil(value * multiplier / (1 << 20)))
+}
+
+func parsePercentage(value string) float64 {
+	percentage, _ := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	return percentage / 100
+}
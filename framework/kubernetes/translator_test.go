@@ -0,0 +1,53 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceName(t *testing.T) {
+	assert.Equal(t, "nginx", resourceName("/nginx"))
+	assert.Equal(t, "payments-api-v2", resourceName("/payments/API_v2"))
+	assert.Equal(t, "", resourceName("/"))
+}
+
+func TestImageAndTag(t *testing.T) {
+	image, tag := imageAndTag("registry:5000/nginx:1.9")
+	assert.Equal(t, "registry:5000/nginx", image)
+	assert.Equal(t, "1.9", tag)
+	image, tag = imageAndTag("registry:5000/nginx")
+	assert.Equal(t, "registry:5000/nginx", image)
+	assert.Equal(t, "latest", tag)
+}
+
+func TestQuantities(t *testing.T) {
+	assert.Equal(t, "250m", formatCPU(0.25))
+	assert.Equal(t, 0.25, parseCPU("250m"))
+	assert.Equal(t, 2.0, parseCPU("2"))
+	assert.Equal(t, int64(512), parseMemory("512Mi"))
+	assert.Equal(t, int64(1024), parseMemory("1Gi"))
+	assert.Equal(t, int64(0), parseMemory(""))
+}
+
+func TestTranslateCapacity(t *testing.T) {
+	config := framework.ServiceConfig{ServiceID: "nginx", ImageName: "nginx", Tag: "1.9", MinimumHealthCapacity: 0.5, MaximumOverCapacity: 0.2}
+	d, err := translateServiceConfig(config, 2, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, &rollingUpdate{MaxUnavailable: "50%", MaxSurge: "20%"}, d.Spec.Strategy.RollingUpdate)
+	assert.Equal(t, "250m", d.Spec.Template.Spec.Containers[0].Resources.Limits["cpu"], "Should use the default cpu")
+	assert.Equal(t, []envVar{{Name: "SERVICE_NAME", Value: "nginx"}}, d.Spec.Template.Spec.Containers[0].Env)
+
+	inspected := serviceConfigFromDeployment(d)
+	assert.Equal(t, 0.5, inspected.MinimumHealthCapacity)
+	assert.Equal(t, 0.2, inspected.MaximumOverCapacity)
+	assert.Empty(t, inspected.Envs, "SERVICE_NAME is added by the framework")
+}
+
+func TestTranslateInvalidPort(t *testing.T) {
+	_, err := translateServiceConfig(framework.ServiceConfig{ServiceID: "nginx", Publish: []string{"http"}}, 1, "default")
+	assert.NotNil(t, err)
+	_, err = translateServiceConfig(framework.ServiceConfig{ServiceID: "/"}, 1, "default")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,182 @@
+// Package marathon extends the marathon framework of mesos-framework-factory with the operations
+// of crane it does not implement, calling the REST API of Marathon with the parameters of the
+// framework in crane.yml:
+//
+//	cluster:
+//	  sjc:
+//	    framework:
+//	      marathon:
+//	        address: http://marathon.sjc:8080
+//	        deploy-timeout: 300
+//	        basic-auth-user: crane
+//	        basic-auth-pwd: secret
+//
+// The applications are still created and deleted by the marathon framework. The extension reads
+// and changes their labels, so the blue-green strategy runs on Marathon.
+package marathon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/latam-airlines/mesos-framework-factory/utils"
+)
+
+const (
+	frameworkID = "marathon"
+
+	defaultDeployTimeout = 300
+	requestTimeout       = 30 * time.Second
+)
+
+// pollInterval is the wait between the checks of a deployment, it is replaced in the tests
+var pollInterval = 2 * time.Second
+
+func init() {
+	cluster.RegisterExtension(frameworkID, Extend)
+}
+
+// Marathon is the marathon framework with the operations of crane
+type Marathon struct {
+	framework.Framework
+	client        *client
+	deployTimeout int
+}
+
+// Extend wraps the marathon framework, it reads the same parameters
+func Extend(fw framework.Framework, params map[string]interface{}) (framework.Framework, error) {
+	address := utils.ExtractString(params, "address")
+	if address == "" {
+		return nil, errors.New("Parameter address does not exist")
+	}
+	deployTimeout := defaultDeployTimeout
+	if value, ok := params["deploy-timeout"].(int); ok && value > 0 {
+		deployTimeout = value
+	}
+	c := &client{
+		address:  utils.ValidateEndpoint(address),
+		user:     utils.ExtractString(params, "basic-auth-user"),
+		password: utils.ExtractString(params, "basic-auth-pwd"),
+		http:     &http.Client{Timeout: requestTimeout},
+	}
+	return &Marathon{Framework: fw, client: c, deployTimeout: deployTimeout}, nil
+}
+
+// application reads the application, with its tasks when they are embedded
+func (m *Marathon) application(id string, embedTasks bool) (*app, error) {
+	path := "/apps" + id
+	if embedTasks {
+		path += "?embed=app.tasks"
+	}
+	var answer struct {
+		App app `json:"app"`
+	}
+	if err := m.client.do(http.MethodGet, path, nil, &answer); err != nil {
+		return nil, err
+	}
+	return &answer.App, nil
+}
+
+// describe returns the application with its tasks
+func (m *Marathon) describe(id string) (*framework.ServiceInformation, error) {
+	a, err := m.application(id, true)
+	if err != nil {
+		return nil, err
+	}
+	return serviceInformation(a), nil
+}
+
+// update changes the fields of the application and waits until Marathon deploys it
+func (m *Marathon) update(id string, fields interface{}) error {
+	var result deploymentResult
+	if err := m.client.do(http.MethodPut, "/apps"+id+"?force=true", fields, &result); err != nil {
+		return err
+	}
+	return m.waitForDeployment(id, result.DeploymentID)
+}
+
+// waitForDeployment waits until Marathon finishes the deployment
+func (m *Marathon) waitForDeployment(id, deploymentID string) error {
+	deadline := time.Now().Add(time.Duration(m.deployTimeout) * time.Second)
+	for {
+		var deployments []deployment
+		if err := m.client.do(http.MethodGet, "/deployments", nil, &deployments); err != nil {
+			return err
+		}
+		running := false
+		for _, d := range deployments {
+			if d.ID == deploymentID {
+				running = true
+			}
+		}
+		if !running {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The deployment of %s timed out after %d seconds", id, m.deployTimeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// ScaleService changes the instances of the application without modifying its definition. The
+// application is read first, Marathon creates the application on an update when it does not exist
+func (m *Marathon) ScaleService(serviceID string, instances int) (*framework.ServiceInformation, error) {
+	id := appID(serviceID)
+	_, err := m.describe(id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("The application %s does not exist", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.update(id, map[string]int{"instances": instances}); err != nil {
+		return nil, err
+	}
+	return m.describe(id)
+}
+
+// InspectService returns the definition of the application and its instances, a nil config when
+// the application does not exist
+func (m *Marathon) InspectService(serviceID string) (*framework.ServiceConfig, int, error) {
+	a, err := m.application(appID(serviceID), false)
+	if isNotFound(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return serviceConfig(a), a.Instances, nil
+}
+
+// LabelService changes the labels of the application, a label with an empty value is removed.
+// Marathon deploys the application again with the new labels, its tasks are restarted following
+// the upgrade strategy of the application
+func (m *Marathon) LabelService(serviceID string, labels map[string]string) error {
+	id := appID(serviceID)
+	a, err := m.application(id, false)
+	if isNotFound(err) {
+		return fmt.Errorf("The application %s does not exist", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	updated := make(map[string]string, len(a.Labels)+len(labels))
+	for key, value := range a.Labels {
+		updated[key] = value
+	}
+	for key, value := range labels {
+		if value == "" {
+			delete(updated, key)
+		} else {
+			updated[key] = value
+		}
+	}
+	return m.update(id, map[string]map[string]string{"labels": updated})
+}
@@ -0,0 +1,266 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMarathon keeps the applications in memory. The deployments finish after being listed
+// once, unless stuck is set
+type fakeMarathon struct {
+	sync.Mutex
+	apps        map[string]map[string]interface{}
+	deployments map[string]bool
+	updates     []map[string]interface{}
+	stuck       bool
+	next        int
+}
+
+func newFakeMarathon() *fakeMarathon {
+	return &fakeMarathon{apps: make(map[string]map[string]interface{}), deployments: make(map[string]bool)}
+}
+
+func (f *fakeMarathon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch {
+	case r.URL.Path == "/v2/deployments":
+		deployments := []deployment{}
+		for id := range f.deployments {
+			deployments = append(deployments, deployment{ID: id})
+			if !f.stuck {
+				delete(f.deployments, id)
+			}
+		}
+		writeJSON(w, deployments)
+	case strings.HasPrefix(r.URL.Path, "/v2/apps/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v2/apps")
+		a, ok := f.apps[id]
+		switch {
+		case r.Method == http.MethodGet && ok:
+			writeJSON(w, map[string]interface{}{"app": a})
+		case r.Method == http.MethodGet:
+			http.Error(w, fmt.Sprintf(`{"message":"App '%s' does not exist"}`, id), http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			var update map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&update)
+			f.updates = append(f.updates, update)
+			if !ok {
+				a = map[string]interface{}{"id": id}
+				f.apps[id] = a
+			}
+			for key, value := range update {
+				a[key] = value
+			}
+			if instances, ok := update["instances"].(float64); ok {
+				a["tasks"] = tasks(id, int(instances))
+			}
+			f.next++
+			deploymentID := fmt.Sprintf("deployment-%d", f.next)
+			f.deployments[deploymentID] = true
+			writeJSON(w, deploymentResult{DeploymentID: deploymentID, Version: fmt.Sprintf("2016-03-0%dT00:00:00.000Z", f.next)})
+		default:
+			http.Error(w, r.Method+" "+r.URL.Path, http.StatusMethodNotAllowed)
+		}
+	default:
+		http.Error(w, "unknown path "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+// tasks returns the healthy tasks of an application
+func tasks(id string, count int) []map[string]interface{} {
+	list := make([]map[string]interface{}, count)
+	for i := range list {
+		list[i] = map[string]interface{}{
+			"id":                 fmt.Sprintf("%s.%d", strings.Trim(id, "/"), i),
+			"host":               "10.0.2.1",
+			"ports":              []int64{int64(31000 + i)},
+			"state":              "TASK_RUNNING",
+			"healthCheckResults": []map[string]bool{{"alive": true}},
+		}
+	}
+	return list
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// baseFramework stands for the marathon framework of mesos-framework-factory
+type baseFramework struct {
+	framework.Framework
+}
+
+func (b *baseFramework) ID() string { return frameworkID }
+
+func newTestMarathon(t *testing.T) (*Marathon, *fakeMarathon, func()) {
+	pollInterval = time.Millisecond
+	fake := newFakeMarathon()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "crane:secret", user+":"+password)
+		fake.ServeHTTP(w, r)
+	}))
+
+	fw, err := Extend(new(baseFramework), map[string]interface{}{
+		"address":         server.URL,
+		"deploy-timeout":  1,
+		"basic-auth-user": "crane",
+		"basic-auth-pwd":  "secret",
+	})
+	assert.Nil(t, err)
+	return fw.(*Marathon), fake, server.Close
+}
+
+// addApp registers an application as the marathon framework creates it
+func (f *fakeMarathon) addApp(id string, instances int) {
+	f.Lock()
+	defer f.Unlock()
+	f.apps[id] = map[string]interface{}{
+		"id":        id,
+		"instances": instances,
+		"version":   "2016-03-01T00:00:00.000Z",
+		"container": map[string]interface{}{"docker": map[string]interface{}{
+			"image":        "registry.latam.com:5000/nginx:1.9",
+			"portMappings": []map[string]interface{}{{"containerPort": 80, "protocol": "tcp"}},
+		}},
+		"cpus":            0.5,
+		"mem":             256,
+		"env":             map[string]interface{}{"SERVICE_NAME": id, "LOG_LEVEL": "info", "DB_PASSWORD": map[string]string{"secret": "db"}},
+		"labels":          map[string]string{"image_name": "registry.latam.com:5000/nginx", "image_tag": "1.9", "environment": "beta"},
+		"constraints":     [][]string{{"slave_name", "CLUSTER", "node-1"}},
+		"upgradeStrategy": map[string]float64{"minimumHealthCapacity": 0.5, "maximumOverCapacity": 0.2},
+		"healthChecks":    []map[string]interface{}{{"protocol": "HTTP", "path": "/health", "gracePeriodSeconds": 30, "intervalSeconds": 10, "timeoutSeconds": 5, "maxConsecutiveFailures": 3}},
+		"tasks":           tasks(id, instances),
+	}
+}
+
+func TestExtendRequiresAddress(t *testing.T) {
+	_, err := Extend(new(baseFramework), map[string]interface{}{"deploy-timeout": 30})
+	assert.NotNil(t, err)
+}
+
+func TestExtendKeepsFramework(t *testing.T) {
+	m, _, stop := newTestMarathon(t)
+	defer stop()
+	assert.Equal(t, "marathon", m.ID(), "The operations of the framework should be kept")
+	assert.True(t, strings.HasSuffix(m.client.address, "/v2"), "The address should include the version of the API")
+}
+
+func TestScaleService(t *testing.T) {
+	m, fake, stop := newTestMarathon(t)
+	defer stop()
+	fake.addApp("/nginx", 2)
+
+	service, err := m.ScaleService("nginx", 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "/nginx", service.ID)
+	assert.Equal(t, "registry.latam.com:5000/nginx", service.ImageName)
+	assert.Equal(t, "1.9", service.ImageTag)
+	assert.Len(t, service.Instances, 4)
+	assert.True(t, service.Instances[0].Healthy())
+	assert.Equal(t, framework.InstancePort{Internal: 31000, Publics: []int64{80}, Type: framework.TCP}, service.Instances[0].Ports["80/TCP"])
+	assert.Equal(t, []map[string]interface{}{{"instances": float64(4)}}, fake.updates, "Only the instances should change")
+	assert.Empty(t, fake.deployments, "Should wait for the deployment")
+}
+
+func TestScaleMissingService(t *testing.T) {
+	m, fake, stop := newTestMarathon(t)
+	defer stop()
+
+	_, err := m.ScaleService("nginx", 4)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
+	assert.Empty(t, fake.apps, "Marathon creates the application on an update, it should not be sent")
+}
+
+func TestScaleServiceTimeout(t *testing.T) {
+	m, fake, stop := newTestMarathon(t)
+	defer stop()
+	fake.addApp("/nginx", 2)
+	fake.stuck = true
+
+	_, err := m.ScaleService("nginx", 4)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
+
+func TestInspectService(t *testing.T) {
+	m, fake, stop := newTestMarathon(t)
+	defer stop()
+	fake.addApp("/nginx", 2)
+
+	config, instances, err := m.InspectService("nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, instances)
+	assert.Equal(t, &framework.ServiceConfig{
+		ServiceID:             "nginx",
+		ImageName:             "registry.latam.com:5000/nginx",
+		Tag:                   "1.9",
+		CPUShares:             0.5,
+		Memory:                256,
+		Envs:                  []string{"LOG_LEVEL=info"},
+		Publish:               []string{"80/tcp"},
+		Labels:                map[string]string{"environment": "beta"},
+		Constraints:           map[string]string{"slave_name": "node-1"},
+		MinimumHealthCapacity: 0.5,
+		MaximumOverCapacity:   0.2,
+		HealthCheckConfig:     &framework.HealthCheck{Path: "/health", GracePeriod: 30, Interval: 10, Timeout: 5, MaxConsecutiveFailures: 3},
+	}, config, "The labels, envs and secrets added by the framework are not part of the definition")
+
+	config, _, err = m.InspectService("apache")
+	assert.Nil(t, err)
+	assert.Nil(t, config, "The application does not exist")
+}
+
+func TestLabelService(t *testing.T) {
+	m, fake, stop := newTestMarathon(t)
+	defer stop()
+	fake.addApp("/nginx", 2)
+
+	assert.Nil(t, m.LabelService("nginx", map[string]string{"crane.active": "true", "environment": ""}))
+	assert.Equal(t, []map[string]interface{}{{"labels": map[string]interface{}{
+		"image_name":   "registry.latam.com:5000/nginx",
+		"image_tag":    "1.9",
+		"crane.active": "true",
+	}}}, fake.updates, "Only the labels should change, the empty ones are removed")
+	assert.Empty(t, fake.deployments, "Should wait for the deployment")
+
+	config, _, _ := m.InspectService("nginx")
+	assert.Equal(t, map[string]string{"crane.active": "true"}, config.Labels)
+
+	err := m.LabelService("apache", map[string]string{"crane.active": "true"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
+}
+
+func TestUnhealthyTasks(t *testing.T) {
+	a := &app{
+		ID:           "/nginx",
+		HealthChecks: []healthCheck{{Path: "/health"}},
+		Tasks: []task{
+			{ID: "b", State: "TASK_RUNNING", HealthCheckResults: []healthCheckResult{{Alive: false}}},
+			{ID: "a", State: "TASK_STAGING"},
+			{ID: "c", State: "TASK_RUNNING"},
+		},
+	}
+	service := serviceInformation(a)
+	assert.Equal(t, "a", service.Instances[0].ID, "The instances should be sorted")
+	for _, instance := range service.Instances {
+		assert.False(t, instance.Healthy(), "Instance %s should be unhealthy", instance.ID)
+	}
+
+	a.HealthChecks = nil
+	assert.True(t, serviceInformation(a).Instances[2].Healthy(), "A running task without health checks is healthy")
+}
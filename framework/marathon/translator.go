@@ -0,0 +1,226 @@
+package marathon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// Labels and envs the marathon framework adds to every application, they are not part of the
+// definition of the service
+const (
+	imageNameLabel = "image_name"
+	imageTagLabel  = "image_tag"
+	serviceNameEnv = "SERVICE_NAME"
+)
+
+// app is the part of a Marathon application used by crane
+type app struct {
+	ID              string                 `json:"id"`
+	Instances       int                    `json:"instances"`
+	Version         string                 `json:"version"`
+	CPUs            float64                `json:"cpus"`
+	Mem             float64                `json:"mem"`
+	Env             map[string]interface{} `json:"env,omitempty"`
+	Labels          map[string]string      `json:"labels,omitempty"`
+	Constraints     [][]string             `json:"constraints,omitempty"`
+	URIs            []string               `json:"uris,omitempty"`
+	UpgradeStrategy *upgradeStrategy       `json:"upgradeStrategy,omitempty"`
+	Container       *container             `json:"container,omitempty"`
+	HealthChecks    []healthCheck          `json:"healthChecks,omitempty"`
+	Tasks           []task                 `json:"tasks,omitempty"`
+}
+
+type upgradeStrategy struct {
+	MinimumHealthCapacity float64 `json:"minimumHealthCapacity"`
+	MaximumOverCapacity   float64 `json:"maximumOverCapacity"`
+}
+
+type healthCheck struct {
+	Path                   string `json:"path,omitempty"`
+	GracePeriodSeconds     int    `json:"gracePeriodSeconds"`
+	IntervalSeconds        int    `json:"intervalSeconds"`
+	TimeoutSeconds         int    `json:"timeoutSeconds"`
+	MaxConsecutiveFailures int    `json:"maxConsecutiveFailures"`
+}
+
+type container struct {
+	Docker *docker `json:"docker,omitempty"`
+}
+
+type docker struct {
+	Image        string        `json:"image"`
+	PortMappings []portMapping `json:"portMappings,omitempty"`
+}
+
+type portMapping struct {
+	ContainerPort int64  `json:"containerPort"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+type task struct {
+	ID                 string              `json:"id"`
+	Host               string              `json:"host"`
+	Ports              []int64             `json:"ports"`
+	State              string              `json:"state"`
+	HealthCheckResults []healthCheckResult `json:"healthCheckResults"`
+}
+
+type healthCheckResult struct {
+	Alive bool `json:"alive"`
+}
+
+// deployment is a deployment in progress on Marathon
+type deployment struct {
+	ID string `json:"id"`
+}
+
+// deploymentResult is the answer of Marathon to a change of an application
+type deploymentResult struct {
+	DeploymentID string `json:"deploymentId"`
+	Version      string `json:"version"`
+}
+
+// appID returns the id of the application of the service, Marathon ids are absolute paths
+func appID(serviceID string) string {
+	return "/" + strings.TrimPrefix(serviceID, "/")
+}
+
+// healthy reports if the task runs and passes the health checks of the application
+func (t *task) healthy(healthChecks bool) bool {
+	if t.State != "" && t.State != "TASK_RUNNING" {
+		return false
+	}
+	if !healthChecks {
+		return true
+	}
+	if len(t.HealthCheckResults) == 0 {
+		return false
+	}
+	for _, result := range t.HealthCheckResults {
+		if !result.Alive {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceInformation describes the application and its tasks. The ports follow the marathon
+// framework, the internal port is the port of the host and the public one is the container port
+func serviceInformation(a *app) *framework.ServiceInformation {
+	info := &framework.ServiceInformation{ID: a.ID, Version: a.Version}
+	var mappings []portMapping
+	if a.Container != nil && a.Container.Docker != nil {
+		info.ImageName, info.ImageTag = imageAndTag(a.Container.Docker.Image)
+		mappings = a.Container.Docker.PortMappings
+	}
+
+	tasks := append([]task(nil), a.Tasks...)
+	sort.Slice(tasks, func(i, k int) bool { return tasks[i].ID < tasks[k].ID })
+	for _, t := range tasks {
+		instance := &framework.Instance{ID: t.ID, Host: t.Host, Status: framework.InstanceDown}
+		if t.healthy(len(a.HealthChecks) != 0) {
+			instance.Status = framework.InstanceUp
+		}
+		for i, hostPort := range t.Ports {
+			if i >= len(mappings) {
+				break
+			}
+			if instance.Ports == nil {
+				instance.Ports = make(map[string]framework.InstancePort)
+			}
+			portType := framework.NewInstancePortType(mappings[i].Protocol)
+			instance.Ports[fmt.Sprintf("%d/%s", mappings[i].ContainerPort, portType)] = framework.InstancePort{
+				Internal: hostPort,
+				Publics:  []int64{mappings[i].ContainerPort},
+				Type:     portType,
+			}
+		}
+		info.Instances = append(info.Instances, instance)
+	}
+	return info
+}
+
+// serviceConfig returns the definition of the service deployed as the application, as the
+// marathon framework translates it. The cpu is in cores, the unit of Marathon. The envs that are
+// not strings, as the secrets, are not part of the definition
+func serviceConfig(a *app) *framework.ServiceConfig {
+	config := &framework.ServiceConfig{
+		ServiceID: strings.TrimPrefix(a.ID, "/"),
+		CPUShares: a.CPUs,
+		Memory:    int64(a.Mem),
+	}
+	if a.Container != nil && a.Container.Docker != nil {
+		config.ImageName, config.Tag = imageAndTag(a.Container.Docker.Image)
+		for _, mapping := range a.Container.Docker.PortMappings {
+			protocol := mapping.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			config.Publish = append(config.Publish, fmt.Sprintf("%d/%s", mapping.ContainerPort, protocol))
+		}
+	}
+
+	names := make([]string, 0, len(a.Env))
+	for name := range a.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value, ok := a.Env[name].(string); ok && name != serviceNameEnv {
+			config.Envs = append(config.Envs, name+"="+value)
+		}
+	}
+
+	for key, value := range a.Labels {
+		if key == imageNameLabel || key == imageTagLabel {
+			continue
+		}
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		config.Labels[key] = value
+	}
+	for _, constraint := range a.Constraints {
+		if len(constraint) != 3 {
+			continue
+		}
+		if config.Constraints == nil {
+			config.Constraints = make(map[string]string)
+		}
+		config.Constraints[constraint[0]] = constraint[2]
+	}
+	if len(a.URIs) > 0 {
+		config.DockerCfg = a.URIs[0]
+	}
+	if a.UpgradeStrategy != nil {
+		config.MinimumHealthCapacity = a.UpgradeStrategy.MinimumHealthCapacity
+		config.MaximumOverCapacity = a.UpgradeStrategy.MaximumOverCapacity
+	}
+	for _, check := range a.HealthChecks {
+		if check.Path == "" {
+			continue
+		}
+		config.HealthCheckConfig = &framework.HealthCheck{
+			Path:                   check.Path,
+			GracePeriod:            check.GracePeriodSeconds,
+			Interval:               check.IntervalSeconds,
+			Timeout:                check.TimeoutSeconds,
+			MaxConsecutiveFailures: check.MaxConsecutiveFailures,
+		}
+		break
+	}
+	return config
+}
+
+// imageAndTag splits the image, the registry can have a port so the tag is after the last colon
+// following the last slash
+func imageAndTag(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || i < strings.LastIndex(image, "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
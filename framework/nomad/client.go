@@ -0,0 +1,97 @@
+package nomad
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIError is an error answered by the Nomad agent
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *APIError) Error() string {
+	return fmt.Sprintf("Nomad API error: %d %s", err.StatusCode, err.Message)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// client calls the HTTP API of a Nomad agent
+type client struct {
+	address   string
+	token     string
+	region    string
+	namespace string
+	http      *http.Client
+}
+
+// do sends the body as JSON and decodes the answer in out, when they are not nil
+func (c *client) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	query := url.Values{}
+	if c.region != "" {
+		query.Set("region", c.region)
+	}
+	if c.namespace != "" {
+		query.Set("namespace", c.namespace)
+	}
+	if i := strings.Index(path, "?"); i >= 0 {
+		values, _ := url.ParseQuery(path[i+1:])
+		for key := range values {
+			query.Set(key, values.Get(key))
+		}
+		path = path[:i]
+	}
+	endpoint := strings.TrimSuffix(c.address, "/") + path
+	if len(query) != 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-Nomad-Token", c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		content, _ := ioutil.ReadAll(resp.Body)
+		message := strings.TrimSpace(string(content))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
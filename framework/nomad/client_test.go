@@ -0,0 +1,39 @@
+package nomad
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientQueryAndToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/job/nginx", r.URL.Path)
+		assert.Equal(t, "scl", r.URL.Query().Get("region"))
+		assert.Equal(t, "crane", r.URL.Query().Get("namespace"))
+		assert.Equal(t, "true", r.URL.Query().Get("purge"))
+		assert.Equal(t, "secret-token", r.Header.Get("X-Nomad-Token"))
+		w.Write([]byte(`{"EvalID": "eval"}`))
+	}))
+	defer server.Close()
+
+	c := &client{address: server.URL + "/", token: "secret-token", region: "scl", namespace: "crane", http: http.DefaultClient}
+	var out struct{ EvalID string }
+	assert.Nil(t, c.do(http.MethodDelete, "/v1/job/nginx?purge=true", nil, &out))
+	assert.Equal(t, "eval", out.EvalID)
+}
+
+func TestClientAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "job not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := &client{address: server.URL, http: http.DefaultClient}
+	err := c.do(http.MethodGet, "/v1/job/nginx", nil, nil)
+	assert.Equal(t, &APIError{StatusCode: http.StatusNotFound, Message: "job not found"}, err)
+	assert.True(t, isNotFound(err))
+	assert.False(t, isNotFound(&APIError{StatusCode: http.StatusInternalServerError}))
+}
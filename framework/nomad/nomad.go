@@ -0,0 +1,333 @@
+// Package nomad deploys the services of crane as jobs of a HashiCorp Nomad cluster, each job has a
+// group running the image with the docker driver. It is registered as the framework "nomad":
+//
+//	cluster:
+//	  edge:
+//	    framework:
+//	      nomad:
+//	        address: http://nomad.edge:4646
+//	        region: scl
+//	        datacenters: [scl1, scl2]
+//	        deploy-timeout: 300
+package nomad
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/latam-airlines/mesos-framework-factory/factory"
+	"github.com/latam-airlines/mesos-framework-factory/utils"
+)
+
+const (
+	frameworkID = "nomad"
+
+	defaultAddress       = "http://127.0.0.1:4646"
+	defaultDatacenter    = "dc1"
+	defaultDeployTimeout = 300
+	requestTimeout       = 30 * time.Second
+)
+
+// pollInterval is the wait between the checks of a deployment, it is replaced in the tests
+var pollInterval = 2 * time.Second
+
+func init() {
+	factory.Register(frameworkID, &nomadCreator{})
+}
+
+// nomadCreator implements factory.FrameworkFactory
+type nomadCreator struct{}
+
+func (creator *nomadCreator) Create(params map[string]interface{}) (framework.Framework, error) {
+	address := utils.ExtractString(params, "address")
+	if address == "" {
+		address = os.Getenv("NOMAD_ADDR")
+	}
+	if address == "" {
+		address = defaultAddress
+	}
+	if parsed, err := url.Parse(address); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("Parameter address should be the url of a Nomad agent, ie. %s", defaultAddress)
+	}
+
+	token := utils.ExtractString(params, "token")
+	if token == "" {
+		token = os.Getenv("NOMAD_TOKEN")
+	}
+
+	deployTimeout := defaultDeployTimeout
+	if value, ok := params["deploy-timeout"]; ok {
+		if deployTimeout, ok = value.(int); !ok || deployTimeout <= 0 {
+			return nil, errors.New("Parameter deploy-timeout should be a number of seconds greater than 0")
+		}
+	}
+
+	datacenters := []string{defaultDatacenter}
+	if value, ok := params["datacenters"]; ok {
+		list, ok := value.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, errors.New("Parameter datacenters should be a list of datacenters")
+		}
+		datacenters = nil
+		for _, dc := range list {
+			name, ok := dc.(string)
+			if !ok || name == "" {
+				return nil, errors.New("Parameter datacenters should be a list of datacenters")
+			}
+			datacenters = append(datacenters, name)
+		}
+	}
+
+	serviceProvider := utils.ExtractString(params, "service-provider")
+	switch serviceProvider {
+	case "", "consul", "nomad":
+	default:
+		return nil, fmt.Errorf("Unknown service-provider %s, it should be consul or nomad", serviceProvider)
+	}
+
+	c := &client{
+		address:   address,
+		token:     token,
+		region:    utils.ExtractString(params, "region"),
+		namespace: utils.ExtractString(params, "namespace"),
+		http:      &http.Client{Timeout: requestTimeout},
+	}
+	return &Nomad{client: c, datacenters: datacenters, serviceProvider: serviceProvider, deployTimeout: deployTimeout}, nil
+}
+
+// Nomad implements framework.Framework on a region and namespace of a Nomad cluster
+type Nomad struct {
+	client          *client
+	datacenters     []string
+	serviceProvider string
+	deployTimeout   int
+}
+
+func (n *Nomad) ID() string {
+	return frameworkID
+}
+
+func (n *Nomad) getJob(id string) (*job, error) {
+	j := new(job)
+	if err := n.client.do(http.MethodGet, "/v1/job/"+url.PathEscape(id), nil, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (n *Nomad) allocations(id string) ([]allocation, error) {
+	var stubs []allocation
+	if err := n.client.do(http.MethodGet, "/v1/job/"+url.PathEscape(id)+"/allocations", nil, &stubs); err != nil {
+		return nil, err
+	}
+	// The stubs have no ports, they are read from every allocation that should be running
+	allocations := make([]allocation, 0, len(stubs))
+	for _, stub := range stubs {
+		if stub.DesiredStatus != "run" {
+			continue
+		}
+		a := new(allocation)
+		if err := n.client.do(http.MethodGet, "/v1/allocation/"+stub.ID, nil, a); err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, *a)
+	}
+	return allocations, nil
+}
+
+// describe returns the current information of the job with its allocations
+func (n *Nomad) describe(id string) (*framework.ServiceInformation, error) {
+	j, err := n.getJob(id)
+	if err != nil {
+		return nil, err
+	}
+	allocations, err := n.allocations(id)
+	if err != nil {
+		return nil, err
+	}
+	return serviceInformation(j, allocations), nil
+}
+
+// FindServiceInformation returns the services meeting the criteria, it fails when there is none
+// as marathon does. Only the jobs deployed by crane are considered
+func (n *Nomad) FindServiceInformation(criteria framework.ServiceInformationCriteria) ([]*framework.ServiceInformation, error) {
+	var stubs []jobStub
+	if err := n.client.do(http.MethodGet, "/v1/jobs", nil, &stubs); err != nil {
+		return nil, err
+	}
+
+	all := make([]*framework.ServiceInformation, 0, len(stubs))
+	for _, stub := range stubs {
+		if stub.Type != "service" {
+			continue
+		}
+		j, err := n.getJob(stub.ID)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := j.Meta[serviceIDMeta]; !ok {
+			continue
+		}
+		allocations, err := n.allocations(stub.ID)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, serviceInformation(j, allocations))
+	}
+	filtered := criteria.MeetCriteria(all)
+	if len(filtered) == 0 {
+		return nil, errors.New("No services found")
+	}
+	return filtered, nil
+}
+
+// DeployService registers the job of the service and waits until its deployment succeeds. A new
+// job that fails is purged, as marathon does
+func (n *Nomad) DeployService(config framework.ServiceConfig, instances int) (*framework.ServiceInformation, error) {
+	j, err := n.translateServiceConfig(config, instances)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = n.getJob(j.ID)
+	created := isNotFound(err)
+	if err != nil && !created {
+		return nil, err
+	}
+
+	util.Log.Infof("Registering job %s on %s", j.ID, n.client.address)
+	if err := n.client.do(http.MethodPost, "/v1/jobs", map[string]interface{}{"Job": j}, nil); err != nil {
+		return nil, err
+	}
+
+	if err := n.waitForDeployment(j.ID); err != nil {
+		if created {
+			util.Log.Errorf("Purging job %s, it was created and its deployment fails: %s", j.ID, err)
+			n.DeleteService(config.ServiceID)
+		}
+		return nil, err
+	}
+	return n.describe(j.ID)
+}
+
+// waitForDeployment waits until the deployment of the current version of the job succeeds. The
+// jobs without a deployment are ready when every allocation of the version is healthy
+func (n *Nomad) waitForDeployment(id string) error {
+	deadline := time.Now().Add(time.Duration(n.deployTimeout) * time.Second)
+	for {
+		j, err := n.getJob(id)
+		if err != nil {
+			return err
+		}
+		var d *deployment
+		if err := n.client.do(http.MethodGet, "/v1/job/"+url.PathEscape(id)+"/deployment", nil, &d); err != nil {
+			return err
+		}
+
+		healthy, count := 0, 0
+		if len(j.TaskGroups) != 0 {
+			count = j.TaskGroups[0].Count
+		}
+		switch {
+		case d != nil && d.JobVersion == j.Version && d.Status == "successful":
+			return nil
+		case d != nil && d.JobVersion == j.Version && (d.Status == "failed" || d.Status == "cancelled"):
+			return fmt.Errorf("The deployment of %s is %s: %s", id, d.Status, d.StatusDescription)
+		case d == nil:
+			allocations, err := n.allocations(id)
+			if err != nil {
+				return err
+			}
+			for _, a := range allocations {
+				if a.JobVersion == j.Version && a.healthy() {
+					healthy++
+				}
+			}
+			if healthy == count {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The deployment of %s timed out after %d seconds", id, n.deployTimeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// ScaleService changes the count of the group of the job without modifying its definition
+func (n *Nomad) ScaleService(serviceID string, instances int) (*framework.ServiceInformation, error) {
+	id := jobID(serviceID)
+	j, err := n.getJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(j.TaskGroups) == 0 {
+		return nil, fmt.Errorf("The job %s has no groups", id)
+	}
+	request := map[string]interface{}{
+		"Count":  instances,
+		"Target": map[string]string{"Group": j.TaskGroups[0].Name},
+	}
+	if err := n.client.do(http.MethodPost, "/v1/job/"+url.PathEscape(id)+"/scale", request, nil); err != nil {
+		return nil, err
+	}
+	if err := n.waitForDeployment(id); err != nil {
+		return nil, err
+	}
+	return n.describe(id)
+}
+
+// InspectService returns the definition of the service and its instances, a nil config when the
+// job does not exist
+func (n *Nomad) InspectService(serviceID string) (*framework.ServiceConfig, int, error) {
+	j, err := n.getJob(jobID(serviceID))
+	if isNotFound(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	config, instances := serviceConfigFromJob(j)
+	return config, instances, nil
+}
+
+// DeleteService stops the job and purges it, so its id can be registered again from scratch
+func (n *Nomad) DeleteService(serviceID string) error {
+	id := jobID(serviceID)
+	if err := n.client.do(http.MethodDelete, "/v1/job/"+url.PathEscape(id)+"?purge=true", nil, nil); err != nil {
+		util.Log.Errorf("Failed to delete the job %s: %s", id, err)
+		return err
+	}
+	return nil
+}
+
+// UndeployInstance stops an allocation, the scheduler places a new one
+func (n *Nomad) UndeployInstance(allocationID string) error {
+	return n.client.do(http.MethodPost, "/v1/allocation/"+allocationID+"/stop", nil, nil)
+}
+
+// RollbackService reverts the job to a previous version, as nomad job revert does
+func (n *Nomad) RollbackService(serviceID, version string) {
+	if err := n.rollback(jobID(serviceID), version); err != nil {
+		util.Log.Errorf("Failed to rollback %s to version %s: %s", serviceID, version, err)
+	}
+}
+
+func (n *Nomad) rollback(id, version string) error {
+	number, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid version %s of %s", version, id)
+	}
+	request := map[string]interface{}{"JobID": id, "JobVersion": number}
+	if err := n.client.do(http.MethodPost, "/v1/job/"+url.PathEscape(id)+"/revert", request, nil); err != nil {
+		return err
+	}
+	return n.waitForDeployment(id)
+}
@@ -0,0 +1,406 @@
+package nomad
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/latam-airlines/mesos-framework-factory/factory"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAgent keeps the jobs of a namespace in memory. The deployments succeed as soon as the jobs
+// are registered, unless stuck or failing are set
+type fakeAgent struct {
+	sync.Mutex
+	jobs        map[string]*job
+	versions    map[string][]job
+	deployments map[string]*deployment
+	allocations map[string]*allocation
+	stuck       bool
+	failing     bool
+	nextAlloc   int
+	nextPort    int64
+}
+
+func newFakeAgent() *fakeAgent {
+	return &fakeAgent{
+		jobs:        make(map[string]*job),
+		versions:    make(map[string][]job),
+		deployments: make(map[string]*deployment),
+		allocations: make(map[string]*allocation),
+		nextPort:    20000,
+	}
+}
+
+var apiPath = regexp.MustCompile(`^/v1/(jobs|job|allocation)(?:/([^/]+))?(?:/([a-z]+))?$`)
+
+func (f *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	match := apiPath.FindStringSubmatch(r.URL.Path)
+	if match == nil || r.URL.Query().Get("namespace") != "crane" {
+		http.Error(w, "unknown path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	resource, id, action := match[1], match[2], match[3]
+
+	switch {
+	case resource == "jobs" && r.Method == http.MethodGet:
+		stubs := []jobStub{}
+		for _, j := range f.jobs {
+			stubs = append(stubs, jobStub{ID: j.ID, Type: j.Type})
+		}
+		writeJSON(w, stubs)
+	case resource == "jobs" && r.Method == http.MethodPost:
+		var request struct{ Job *job }
+		json.NewDecoder(r.Body).Decode(&request)
+		f.register(request.Job)
+		writeJSON(w, map[string]string{"EvalID": "eval"})
+	case resource == "job" && f.jobs[id] == nil:
+		http.Error(w, "job not found", http.StatusNotFound)
+	case resource == "job" && action == "" && r.Method == http.MethodGet:
+		writeJSON(w, f.jobs[id])
+	case resource == "job" && action == "" && r.Method == http.MethodDelete:
+		if r.URL.Query().Get("purge") != "true" {
+			http.Error(w, "the job should be purged", http.StatusBadRequest)
+			return
+		}
+		delete(f.jobs, id)
+		delete(f.versions, id)
+		delete(f.deployments, id)
+		f.setAllocations(id, 0)
+		writeJSON(w, map[string]string{"EvalID": "eval"})
+	case resource == "job" && action == "allocations":
+		stubs := []allocation{}
+		for _, a := range f.allocations {
+			if strings.HasPrefix(a.ID, id+"-") {
+				stubs = append(stubs, allocation{ID: a.ID, DesiredStatus: a.DesiredStatus, ClientStatus: a.ClientStatus, JobVersion: a.JobVersion})
+			}
+		}
+		writeJSON(w, stubs)
+	case resource == "job" && action == "deployment":
+		writeJSON(w, f.deployments[id])
+	case resource == "job" && action == "scale":
+		var request struct{ Count int }
+		json.NewDecoder(r.Body).Decode(&request)
+		scaled := *f.jobs[id]
+		scaled.TaskGroups = append([]taskGroup(nil), scaled.TaskGroups...)
+		scaled.TaskGroups[0].Count = request.Count
+		f.register(&scaled)
+		writeJSON(w, map[string]string{"EvalID": "eval"})
+	case resource == "job" && action == "revert":
+		var request struct{ JobVersion uint64 }
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.JobVersion >= uint64(len(f.versions[id])) {
+			http.Error(w, "version not found", http.StatusBadRequest)
+			return
+		}
+		reverted := f.versions[id][request.JobVersion]
+		f.register(&reverted)
+		writeJSON(w, map[string]string{"EvalID": "eval"})
+	case resource == "allocation" && action == "" && r.Method == http.MethodGet:
+		if a, ok := f.allocations[id]; ok {
+			writeJSON(w, a)
+		} else {
+			http.Error(w, "alloc not found", http.StatusNotFound)
+		}
+	case resource == "allocation" && action == "stop":
+		delete(f.allocations, id)
+		writeJSON(w, map[string]string{"EvalID": "eval"})
+	default:
+		http.Error(w, r.Method+" "+r.URL.Path, http.StatusMethodNotAllowed)
+	}
+}
+
+// register stores the job, creating a new version when its definition changes
+func (f *fakeAgent) register(j *job) {
+	j.Status = "running"
+	if current, ok := f.jobs[j.ID]; ok {
+		j.Version = current.Version
+		if !reflect.DeepEqual(*j, *current) {
+			j.Version++
+		}
+	} else {
+		j.Version = 0
+	}
+	if uint64(len(f.versions[j.ID])) == j.Version {
+		f.versions[j.ID] = append(f.versions[j.ID], *j)
+	}
+	f.jobs[j.ID] = j
+
+	d := &deployment{ID: fmt.Sprintf("%s-%d", j.ID, j.Version), JobVersion: j.Version, Status: "successful"}
+	if f.stuck {
+		d.Status = "running"
+	}
+	if f.failing {
+		d.Status, d.StatusDescription = "failed", "Failed due to progress deadline"
+	}
+	f.deployments[j.ID] = d
+	f.setAllocations(j.ID, j.TaskGroups[0].Count)
+}
+
+// setAllocations replaces the allocations of the job
+func (f *fakeAgent) setAllocations(id string, count int) {
+	for allocID := range f.allocations {
+		if strings.HasPrefix(allocID, id+"-") {
+			delete(f.allocations, allocID)
+		}
+	}
+	for i := 0; i < count; i++ {
+		j := f.jobs[id]
+		a := &allocation{ID: fmt.Sprintf("%s-%d", id, f.nextAlloc), NodeName: "edge-1", DesiredStatus: "run", ClientStatus: "running", JobVersion: j.Version}
+		f.nextAlloc++
+		if f.stuck {
+			a.ClientStatus = "pending"
+		}
+		n := network{IP: "10.0.1.1"}
+		for _, net := range j.TaskGroups[0].Networks {
+			for _, p := range net.DynamicPorts {
+				n.DynamicPorts = append(n.DynamicPorts, port{Label: p.Label, Value: f.nextPort, To: p.To})
+				f.nextPort++
+			}
+		}
+		a.AllocatedResources = &struct {
+			Shared struct {
+				Networks []network `json:"Networks"`
+			} `json:"Shared"`
+		}{}
+		a.AllocatedResources.Shared.Networks = []network{n}
+		f.allocations[a.ID] = a
+	}
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func newTestNomad(t *testing.T) (*Nomad, *fakeAgent, func()) {
+	pollInterval = time.Millisecond
+	fake := newFakeAgent()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret-token", r.Header.Get("X-Nomad-Token"))
+		fake.ServeHTTP(w, r)
+	}))
+
+	fw, err := factory.Create("nomad", map[string]interface{}{
+		"address":        server.URL,
+		"token":          "secret-token",
+		"namespace":      "crane",
+		"datacenters":    []interface{}{"scl1", "scl2"},
+		"deploy-timeout": 1,
+	})
+	assert.Nil(t, err)
+	return fw.(*Nomad), fake, func() {
+		server.Close()
+		pollInterval = 2 * time.Second
+	}
+}
+
+func nginxConfig() framework.ServiceConfig {
+	return framework.ServiceConfig{
+		ServiceID:         "/nginx",
+		ImageName:         "registry:5000/nginx",
+		Tag:               "1.9",
+		CPUShares:         500,
+		Memory:            256,
+		Publish:           []string{"8080/tcp"},
+		Envs:              []string{"REGION=us"},
+		Constraints:       map[string]string{"zone": "a"},
+		HealthCheckConfig: &framework.HealthCheck{Path: "/health", Interval: 10, Timeout: 2},
+	}
+}
+
+func TestCreateParameters(t *testing.T) {
+	fw, err := factory.Create("nomad", map[string]interface{}{"address": "http://nomad:4646"})
+	assert.Nil(t, err)
+	n := fw.(*Nomad)
+	assert.Equal(t, "http://nomad:4646", n.client.address)
+	assert.Equal(t, []string{defaultDatacenter}, n.datacenters)
+	assert.Equal(t, defaultDeployTimeout, n.deployTimeout)
+
+	_, err = factory.Create("nomad", map[string]interface{}{"address": "nomad"})
+	assert.NotNil(t, err, "The address should be an url")
+	_, err = factory.Create("nomad", map[string]interface{}{"address": "http://nomad:4646", "datacenters": "dc1"})
+	assert.NotNil(t, err, "The datacenters should be a list")
+	_, err = factory.Create("nomad", map[string]interface{}{"address": "http://nomad:4646", "deploy-timeout": "slow"})
+	assert.NotNil(t, err)
+	_, err = factory.Create("nomad", map[string]interface{}{"address": "http://nomad:4646", "service-provider": "etcd"})
+	assert.NotNil(t, err)
+}
+
+func TestDeployNewService(t *testing.T) {
+	n, fake, done := newTestNomad(t)
+	defer done()
+
+	service, err := n.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx", service.ID)
+	assert.Equal(t, "registry:5000/nginx", service.ImageName)
+	assert.Equal(t, "1.9", service.ImageTag)
+	assert.Equal(t, "0", service.Version)
+	assert.Len(t, service.Instances, 2)
+	instance := service.Instances[0]
+	assert.True(t, instance.Healthy())
+	assert.Equal(t, "10.0.1.1", instance.Host)
+	assert.Equal(t, framework.InstancePort{Advertise: "10.0.1.1:20000", Internal: 8080, Publics: []int64{20000}, Type: framework.TCP}, instance.Ports["8080/TCP"])
+
+	j := fake.jobs["nginx"]
+	assert.Equal(t, []string{"scl1", "scl2"}, j.Datacenters)
+	assert.Equal(t, []constraint{{LTarget: "${meta.zone}", RTarget: "a", Operand: "="}}, j.Constraints)
+	assert.Equal(t, "checks", j.Update.HealthCheck)
+	group := j.TaskGroups[0]
+	assert.Equal(t, "/health", group.Services[0].Checks[0].Path)
+	assert.Equal(t, "tcp_8080", group.Services[0].PortLabel)
+	task := group.Tasks[0]
+	assert.Equal(t, "docker", task.Driver)
+	assert.Equal(t, "registry:5000/nginx:1.9", task.Config["image"])
+	assert.Equal(t, resources{CPU: 500, MemoryMB: 256}, task.Resources)
+	assert.Equal(t, map[string]string{"SERVICE_NAME": "nginx", "REGION": "us"}, task.Env)
+}
+
+func TestDeployUpdatesService(t *testing.T) {
+	n, _, done := newTestNomad(t)
+	defer done()
+
+	_, err := n.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	config := nginxConfig()
+	config.Tag = "1.10"
+	service, err := n.DeployService(config, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.10", service.ImageTag)
+	assert.Equal(t, "1", service.Version, "The new definition should be a new version")
+	assert.Len(t, service.Instances, 3)
+}
+
+func TestDeployTimeoutPurgesNewService(t *testing.T) {
+	n, fake, done := newTestNomad(t)
+	defer done()
+	fake.stuck = true
+
+	_, err := n.DeployService(nginxConfig(), 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.Empty(t, fake.jobs, "A new job that fails should be purged")
+}
+
+func TestDeployFailed(t *testing.T) {
+	n, fake, done := newTestNomad(t)
+	defer done()
+
+	_, err := n.DeployService(nginxConfig(), 1)
+	assert.Nil(t, err)
+	fake.failing = true
+
+	config := nginxConfig()
+	config.Tag = "1.10"
+	_, err = n.DeployService(config, 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "progress deadline")
+	assert.NotEmpty(t, fake.jobs, "A job that existed should not be purged")
+}
+
+func TestFindServiceInformation(t *testing.T) {
+	n, fake, done := newTestNomad(t)
+	defer done()
+
+	_, err := n.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile("nginx")})
+	assert.NotNil(t, err, "Should fail when no service meets the criteria")
+
+	fake.jobs["batch"] = &job{ID: "batch", Type: "batch"}
+	fake.jobs["other"] = &job{ID: "other", Type: "service", TaskGroups: []taskGroup{{Tasks: []task{{Config: map[string]interface{}{"image": "nginx:1.9"}}}}}}
+	_, err = n.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	services, err := n.FindServiceInformation(&framework.ImageNameAndImageTagRegexpCriteria{FullImageNameRegexp: regexp.MustCompile("nginx:1.9")})
+	assert.Nil(t, err)
+	assert.Len(t, services, 1, "Only the jobs deployed by crane should be found")
+	assert.Len(t, services[0].Instances, 2)
+}
+
+func TestInspectService(t *testing.T) {
+	n, _, done := newTestNomad(t)
+	defer done()
+
+	config, instances, err := n.InspectService("nginx")
+	assert.Nil(t, err)
+	assert.Nil(t, config, "The service does not exist")
+
+	_, err = n.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	config, instances, err = n.InspectService("nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, instances)
+	expected := nginxConfig()
+	expected.ServiceID = "nginx"
+	assert.Equal(t, &expected, config, "The definition should be the one deployed")
+}
+
+func TestScaleService(t *testing.T) {
+	n, fake, done := newTestNomad(t)
+	defer done()
+
+	_, err := n.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	service, err := n.ScaleService("nginx", 4)
+	assert.Nil(t, err)
+	assert.Len(t, service.Instances, 4)
+	assert.Equal(t, "registry:5000/nginx:1.9", fake.jobs["nginx"].TaskGroups[0].Tasks[0].Config["image"])
+}
+
+func TestRollbackService(t *testing.T) {
+	n, fake, done := newTestNomad(t)
+	defer done()
+
+	_, err := n.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	config := nginxConfig()
+	config.Tag = "1.10"
+	_, err = n.DeployService(config, 2)
+	assert.Nil(t, err)
+
+	n.RollbackService("nginx", "0")
+	assert.Equal(t, "registry:5000/nginx:1.9", fake.jobs["nginx"].TaskGroups[0].Tasks[0].Config["image"])
+}
+
+func TestDeleteService(t *testing.T) {
+	n, fake, done := newTestNomad(t)
+	defer done()
+
+	assert.NotNil(t, n.DeleteService("nginx"), "Should fail when the service does not exist")
+	_, err := n.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	assert.Nil(t, n.DeleteService("/nginx"))
+	assert.Empty(t, fake.jobs)
+	assert.Empty(t, fake.allocations)
+}
+
+func TestUndeployInstance(t *testing.T) {
+	n, fake, done := newTestNomad(t)
+	defer done()
+
+	service, err := n.DeployService(nginxConfig(), 2)
+	assert.Nil(t, err)
+	assert.Nil(t, n.UndeployInstance(service.Instances[0].ID))
+	assert.Len(t, fake.allocations, 1)
+}
+
+func TestAPIError(t *testing.T) {
+	n, _, done := newTestNomad(t)
+	defer done()
+	n.client.namespace = "other"
+
+	_, err := n.DeployService(nginxConfig(), 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Nomad API error: 404")
+}
@@ -0,0 +1,399 @@
+package nomad
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+const (
+	// The meta of the jobs deployed by crane, the rest of the meta are the labels of the service
+	serviceIDMeta             = "crane-service-id"
+	minimumHealthCapacityMeta = "crane-minimum-health-capacity"
+	maximumOverCapacityMeta   = "crane-maximum-over-capacity"
+	cranePrefix               = "crane-"
+
+	// defaultCPU is the cpu of the services without cpu, in MHz
+	defaultCPU = 250
+)
+
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// jobID returns the id of the job of the service, the ids of Nomad can not have slashes
+func jobID(serviceID string) string {
+	return strings.Trim(invalidIDChars.ReplaceAllString(strings.Trim(serviceID, "/"), "-"), "-")
+}
+
+type job struct {
+	ID          string            `json:"ID"`
+	Name        string            `json:"Name"`
+	Type        string            `json:"Type"`
+	Region      string            `json:"Region,omitempty"`
+	Namespace   string            `json:"Namespace,omitempty"`
+	Datacenters []string          `json:"Datacenters"`
+	Meta        map[string]string `json:"Meta,omitempty"`
+	Constraints []constraint      `json:"Constraints,omitempty"`
+	Update      *updateStrategy   `json:"Update,omitempty"`
+	TaskGroups  []taskGroup       `json:"TaskGroups"`
+	Version     uint64            `json:"Version,omitempty"`
+	Status      string            `json:"Status,omitempty"`
+}
+
+type constraint struct {
+	LTarget string `json:"LTarget"`
+	RTarget string `json:"RTarget"`
+	Operand string `json:"Operand"`
+}
+
+type updateStrategy struct {
+	MaxParallel     int    `json:"MaxParallel"`
+	HealthCheck     string `json:"HealthCheck,omitempty"`
+	MinHealthyTime  int64  `json:"MinHealthyTime,omitempty"`
+	HealthyDeadline int64  `json:"HealthyDeadline,omitempty"`
+}
+
+type taskGroup struct {
+	Name     string    `json:"Name"`
+	Count    int       `json:"Count"`
+	Networks []network `json:"Networks,omitempty"`
+	Services []service `json:"Services,omitempty"`
+	Tasks    []task    `json:"Tasks"`
+}
+
+type network struct {
+	Mode         string `json:"Mode,omitempty"`
+	IP           string `json:"IP,omitempty"`
+	DynamicPorts []port `json:"DynamicPorts,omitempty"`
+}
+
+type port struct {
+	Label string `json:"Label"`
+	Value int64  `json:"Value,omitempty"`
+	To    int64  `json:"To,omitempty"`
+}
+
+type service struct {
+	Name      string  `json:"Name"`
+	PortLabel string  `json:"PortLabel,omitempty"`
+	Provider  string  `json:"Provider,omitempty"`
+	Checks    []check `json:"Checks,omitempty"`
+}
+
+type check struct {
+	Name     string `json:"Name,omitempty"`
+	Type     string `json:"Type"`
+	Path     string `json:"Path,omitempty"`
+	Interval int64  `json:"Interval"`
+	Timeout  int64  `json:"Timeout"`
+}
+
+type task struct {
+	Name      string                 `json:"Name"`
+	Driver    string                 `json:"Driver"`
+	Config    map[string]interface{} `json:"Config"`
+	Env       map[string]string      `json:"Env,omitempty"`
+	Resources resources              `json:"Resources"`
+}
+
+type resources struct {
+	CPU      int   `json:"CPU,omitempty"`
+	MemoryMB int64 `json:"MemoryMB,omitempty"`
+}
+
+type jobStub struct {
+	ID   string `json:"ID"`
+	Type string `json:"Type"`
+}
+
+type deployment struct {
+	ID                string `json:"ID"`
+	JobVersion        uint64 `json:"JobVersion"`
+	Status            string `json:"Status"`
+	StatusDescription string `json:"StatusDescription"`
+}
+
+type allocation struct {
+	ID               string `json:"ID"`
+	NodeName         string `json:"NodeName"`
+	DesiredStatus    string `json:"DesiredStatus"`
+	ClientStatus     string `json:"ClientStatus"`
+	JobVersion       uint64 `json:"JobVersion"`
+	DeploymentStatus *struct {
+		Healthy *bool `json:"Healthy"`
+	} `json:"DeploymentStatus,omitempty"`
+	AllocatedResources *struct {
+		Shared struct {
+			Networks []network `json:"Networks"`
+		} `json:"Shared"`
+	} `json:"AllocatedResources,omitempty"`
+}
+
+// healthy reports if the allocation runs and passes its checks, when the deploy tracks them
+func (a *allocation) healthy() bool {
+	if a.ClientStatus != "running" {
+		return false
+	}
+	return a.DeploymentStatus == nil || a.DeploymentStatus.Healthy == nil || *a.DeploymentStatus.Healthy
+}
+
+// portLabel names the port of the service with its protocol, ie tcp_8080
+func portLabel(publish string) (string, int64, error) {
+	parts := strings.Split(publish, "/")
+	number, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 {
+		return "", 0, fmt.Errorf("Port does not match format, ie. 8080/tcp: %s", publish)
+	}
+	return strings.ToLower(parts[1]) + "_" + parts[0], number, nil
+}
+
+// constraintTarget is the attribute of the nodes compared by a constraint. Hostname is the name
+// of the node, as in marathon, and the rest are meta of the nodes unless they are interpolations
+func constraintTarget(key string) string {
+	switch {
+	case strings.HasPrefix(key, "${"):
+		return key
+	case key == "hostname":
+		return "${attr.unique.hostname}"
+	default:
+		return "${meta." + key + "}"
+	}
+}
+
+func constraintKey(target string) string {
+	switch {
+	case target == "${attr.unique.hostname}":
+		return "hostname"
+	case strings.HasPrefix(target, "${meta.") && strings.HasSuffix(target, "}"):
+		return strings.TrimSuffix(strings.TrimPrefix(target, "${meta."), "}")
+	default:
+		return target
+	}
+}
+
+// translateServiceConfig builds the job of the service, with a group running a docker task
+func (n *Nomad) translateServiceConfig(config framework.ServiceConfig, instances int) (*job, error) {
+	id := jobID(config.ServiceID)
+	if id == "" {
+		return nil, fmt.Errorf("Invalid service id %s", config.ServiceID)
+	}
+
+	j := &job{
+		ID:          id,
+		Name:        id,
+		Type:        "service",
+		Region:      n.client.region,
+		Namespace:   n.client.namespace,
+		Datacenters: n.datacenters,
+		Meta:        map[string]string{serviceIDMeta: strings.TrimPrefix(config.ServiceID, "/")},
+	}
+	for key, value := range config.Labels {
+		j.Meta[key] = value
+	}
+
+	keys := make([]string, 0, len(config.Constraints))
+	for key := range config.Constraints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		j.Constraints = append(j.Constraints, constraint{LTarget: constraintTarget(key), RTarget: config.Constraints[key], Operand: "="})
+	}
+
+	t := task{
+		Name:   id,
+		Driver: "docker",
+		Config: map[string]interface{}{"image": config.ImageName + ":" + config.Tag},
+		Env:    map[string]string{"SERVICE_NAME": j.Meta[serviceIDMeta]},
+	}
+	for _, env := range config.Envs {
+		if keyVal := strings.SplitN(env, "=", 2); len(keyVal) == 2 {
+			t.Env[keyVal[0]] = keyVal[1]
+		}
+	}
+	t.Resources.CPU = int(math.Ceil(config.CPUShares))
+	if t.Resources.CPU == 0 {
+		t.Resources.CPU = defaultCPU
+	}
+	t.Resources.MemoryMB = config.Memory
+
+	group := taskGroup{Name: id, Count: instances}
+	var labels []string
+	var ports []port
+	for _, publish := range config.Publish {
+		label, number, err := portLabel(publish)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+		ports = append(ports, port{Label: label, To: number})
+	}
+	if len(ports) != 0 {
+		group.Networks = []network{{Mode: "host", DynamicPorts: ports}}
+		t.Config["ports"] = labels
+	}
+
+	j.Update = &updateStrategy{MaxParallel: 1, HealthCheck: "task_states"}
+	if config.MinimumHealthCapacity > 0 || config.MaximumOverCapacity > 0 {
+		// Nomad replaces MaxParallel allocations at a time, the ones allowed to be unhealthy
+		maxParallel := int(math.Floor((1 - config.MinimumHealthCapacity) * float64(instances)))
+		if maxParallel > 1 {
+			j.Update.MaxParallel = maxParallel
+		}
+		j.Meta[minimumHealthCapacityMeta] = strconv.FormatFloat(config.MinimumHealthCapacity, 'f', -1, 64)
+		j.Meta[maximumOverCapacityMeta] = strconv.FormatFloat(config.MaximumOverCapacity, 'f', -1, 64)
+	}
+
+	if health := config.HealthCheckConfig; health != nil && health.Path != "" && len(labels) != 0 {
+		c := check{Name: id + "-health", Type: "http", Path: health.Path, Interval: int64(10 * time.Second), Timeout: int64(2 * time.Second)}
+		if health.Interval > 0 {
+			c.Interval = int64(time.Duration(health.Interval) * time.Second)
+		}
+		if health.Timeout > 0 {
+			c.Timeout = int64(time.Duration(health.Timeout) * time.Second)
+		}
+		if health.GracePeriod > 0 {
+			j.Update.MinHealthyTime = int64(time.Duration(health.GracePeriod) * time.Second)
+		}
+		group.Services = []service{{Name: id, PortLabel: labels[0], Provider: n.serviceProvider, Checks: []check{c}}}
+		j.Update.HealthCheck = "checks"
+	}
+
+	group.Tasks = []task{t}
+	j.TaskGroups = []taskGroup{group}
+	return j, nil
+}
+
+// serviceConfigFromJob describes the service of the job, it is the inverse of translateServiceConfig
+func serviceConfigFromJob(j *job) (*framework.ServiceConfig, int) {
+	config := &framework.ServiceConfig{ServiceID: serviceID(j)}
+	if len(j.TaskGroups) == 0 || len(j.TaskGroups[0].Tasks) == 0 {
+		return config, 0
+	}
+	group := j.TaskGroups[0]
+	t := group.Tasks[0]
+	image, _ := t.Config["image"].(string)
+	config.ImageName, config.Tag = imageAndTag(image)
+	config.CPUShares = float64(t.Resources.CPU)
+	config.Memory = t.Resources.MemoryMB
+
+	envKeys := make([]string, 0, len(t.Env))
+	for key := range t.Env {
+		if key != "SERVICE_NAME" {
+			envKeys = append(envKeys, key)
+		}
+	}
+	sort.Strings(envKeys)
+	for _, key := range envKeys {
+		config.Envs = append(config.Envs, key+"="+t.Env[key])
+	}
+
+	for _, n := range group.Networks {
+		for _, p := range n.DynamicPorts {
+			if i := strings.Index(p.Label, "_"); i > 0 {
+				config.Publish = append(config.Publish, p.Label[i+1:]+"/"+p.Label[:i])
+			}
+		}
+	}
+	for _, c := range j.Constraints {
+		if config.Constraints == nil {
+			config.Constraints = make(map[string]string)
+		}
+		config.Constraints[constraintKey(c.LTarget)] = c.RTarget
+	}
+	for key, value := range j.Meta {
+		if strings.HasPrefix(key, cranePrefix) {
+			continue
+		}
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		config.Labels[key] = value
+	}
+	config.MinimumHealthCapacity, _ = strconv.ParseFloat(j.Meta[minimumHealthCapacityMeta], 64)
+	config.MaximumOverCapacity, _ = strconv.ParseFloat(j.Meta[maximumOverCapacityMeta], 64)
+
+	for _, s := range group.Services {
+		for _, c := range s.Checks {
+			if c.Type == "http" {
+				config.HealthCheckConfig = &framework.HealthCheck{
+					Path:     c.Path,
+					Interval: int(time.Duration(c.Interval) / time.Second),
+					Timeout:  int(time.Duration(c.Timeout) / time.Second),
+				}
+				if j.Update != nil {
+					config.HealthCheckConfig.GracePeriod = int(time.Duration(j.Update.MinHealthyTime) / time.Second)
+				}
+			}
+		}
+	}
+	return config, group.Count
+}
+
+// serviceInformation describes the job and its allocations that should be running
+func serviceInformation(j *job, allocations []allocation) *framework.ServiceInformation {
+	info := &framework.ServiceInformation{ID: serviceID(j), Version: strconv.FormatUint(j.Version, 10)}
+	taskName := ""
+	if len(j.TaskGroups) != 0 && len(j.TaskGroups[0].Tasks) != 0 {
+		image, _ := j.TaskGroups[0].Tasks[0].Config["image"].(string)
+		info.ImageName, info.ImageTag = imageAndTag(image)
+		taskName = j.TaskGroups[0].Tasks[0].Name
+	}
+
+	sort.Slice(allocations, func(i, k int) bool { return allocations[i].ID < allocations[k].ID })
+	for _, a := range allocations {
+		if a.DesiredStatus != "run" {
+			continue
+		}
+		instance := &framework.Instance{ID: a.ID, Host: a.NodeName, ContainerName: taskName, Status: framework.InstanceDown}
+		if a.healthy() {
+			instance.Status = framework.InstanceUp
+		}
+		if a.AllocatedResources != nil {
+			for _, n := range a.AllocatedResources.Shared.Networks {
+				if n.IP != "" {
+					instance.Host = n.IP
+				}
+				for _, p := range n.DynamicPorts {
+					protocol := "tcp"
+					if i := strings.Index(p.Label, "_"); i > 0 {
+						protocol = p.Label[:i]
+					}
+					if instance.Ports == nil {
+						instance.Ports = make(map[string]framework.InstancePort)
+					}
+					instance.Ports[fmt.Sprintf("%d/%s", p.To, strings.ToUpper(protocol))] = framework.InstancePort{
+						Advertise: fmt.Sprintf("%s:%d", instance.Host, p.Value),
+						Internal:  p.To,
+						Publics:   []int64{p.Value},
+						Type:      framework.NewInstancePortType(protocol),
+					}
+				}
+			}
+		}
+		info.Instances = append(info.Instances, instance)
+	}
+	return info
+}
+
+func serviceID(j *job) string {
+	if id := j.Meta[serviceIDMeta]; id != "" {
+		return id
+	}
+	return j.ID
+}
+
+// imageAndTag splits the image, the registry can have a port so the tag is after the last colon
+// following the last slash
+func imageAndTag(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || i < strings.LastIndex(image, "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
@@ -0,0 +1,77 @@
+package nomad
+
+import (
+	"testing"
+
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobID(t *testing.T) {
+	assert.Equal(t, "nginx", jobID("/nginx"))
+	assert.Equal(t, "payments-API_v2", jobID("/payments/API_v2"))
+	assert.Equal(t, "", jobID("/"))
+}
+
+func TestConstraintTarget(t *testing.T) {
+	assert.Equal(t, "${attr.unique.hostname}", constraintTarget("hostname"))
+	assert.Equal(t, "${meta.zone}", constraintTarget("zone"))
+	assert.Equal(t, "${node.class}", constraintTarget("${node.class}"))
+	for _, key := range []string{"hostname", "zone", "${node.class}"} {
+		assert.Equal(t, key, constraintKey(constraintTarget(key)))
+	}
+}
+
+func TestTranslateCapacityAndLabels(t *testing.T) {
+	n := &Nomad{client: &client{}, datacenters: []string{"dc1"}}
+	config := framework.ServiceConfig{
+		ServiceID:             "nginx",
+		ImageName:             "nginx",
+		Tag:                   "1.9",
+		MinimumHealthCapacity: 0.5,
+		MaximumOverCapacity:   0.2,
+		Labels:                map[string]string{"team": "payments"},
+	}
+	j, err := n.translateServiceConfig(config, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, j.Update.MaxParallel, "Half of the allocations can be replaced at a time")
+	assert.Equal(t, "task_states", j.Update.HealthCheck, "Without health check the task states are used")
+	assert.Equal(t, defaultCPU, j.TaskGroups[0].Tasks[0].Resources.CPU, "Should use the default cpu")
+	assert.Nil(t, j.TaskGroups[0].Networks)
+	assert.Equal(t, "payments", j.Meta["team"])
+
+	inspected, instances := serviceConfigFromJob(j)
+	assert.Equal(t, 4, instances)
+	assert.Equal(t, 0.5, inspected.MinimumHealthCapacity)
+	assert.Equal(t, 0.2, inspected.MaximumOverCapacity)
+	assert.Equal(t, map[string]string{"team": "payments"}, inspected.Labels, "The meta of crane are not labels")
+	assert.Empty(t, inspected.Envs, "SERVICE_NAME is added by the framework")
+}
+
+func TestTranslateInvalidPort(t *testing.T) {
+	n := &Nomad{client: &client{}}
+	_, err := n.translateServiceConfig(framework.ServiceConfig{ServiceID: "nginx", Publish: []string{"http"}}, 1)
+	assert.NotNil(t, err)
+	_, err = n.translateServiceConfig(framework.ServiceConfig{ServiceID: "/"}, 1)
+	assert.NotNil(t, err)
+}
+
+func TestServiceInformationSkipsStoppedAllocations(t *testing.T) {
+	j := &job{ID: "nginx", Version: 3, Meta: map[string]string{serviceIDMeta: "nginx"}}
+	unhealthy := false
+	allocations := []allocation{
+		{ID: "b", NodeName: "edge-2", DesiredStatus: "run", ClientStatus: "running"},
+		{ID: "a", NodeName: "edge-1", DesiredStatus: "stop", ClientStatus: "complete"},
+		{ID: "c", NodeName: "edge-3", DesiredStatus: "run", ClientStatus: "running"},
+	}
+	allocations[2].DeploymentStatus = &struct {
+		Healthy *bool `json:"Healthy"`
+	}{Healthy: &unhealthy}
+
+	info := serviceInformation(j, allocations)
+	assert.Equal(t, "3", info.Version)
+	assert.Len(t, info.Instances, 2)
+	assert.Equal(t, "edge-2", info.Instances[0].Host, "Without networks the host is the node")
+	assert.True(t, info.Instances[0].Healthy())
+	assert.False(t, info.Instances[1].Healthy(), "The allocation fails its checks")
+}
@@ -0,0 +1,266 @@
+// Package history keeps a record of the operations of crane on the clusters. Every deploy, scale
+// and delete is appended as a JSON line to a file that is never rewritten, so it can be handed to
+// auditors as it is
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/crane/util"
+	"github.com/latam-airlines/mesos-framework-factory"
+)
+
+// StackEntry is the outcome of the operation on a stack
+type StackEntry struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	Image      string  `json:"image,omitempty"`
+	Version    string  `json:"version,omitempty"`
+	Instances  int     `json:"instances"`
+	Duration   float64 `json:"duration"`
+	Attempts   int     `json:"attempts,omitempty"`
+	RolledBack bool    `json:"rolled-back,omitempty"`
+}
+
+// Entry is an operation of crane on the clusters. Durations are in seconds
+type Entry struct {
+	Time      time.Time                `json:"time"`
+	User      string                   `json:"user"`
+	Host      string                   `json:"host"`
+	Command   string                   `json:"command"`
+	ServiceID string                   `json:"service-id"`
+	Config    *framework.ServiceConfig `json:"config,omitempty"`
+	Result    string                   `json:"result"`
+	Error     string                   `json:"error,omitempty"`
+	Duration  float64                  `json:"duration"`
+	Stacks    map[string]*StackEntry   `json:"stacks"`
+}
+
+// RolledBack reports if the operation was rolled back on any stack
+func (e *Entry) RolledBack() bool {
+	for _, stack := range e.Stacks {
+		if stack.RolledBack {
+			return true
+		}
+	}
+	return false
+}
+
+// currentUser is the user running crane, it is replaced in the tests
+var currentUser = func() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// NewEntry describes the operation that finished with the result. The config is nil for the
+// operations that do not deploy a definition, as scale and delete. The secrets are masked
+func NewEntry(command string, serviceID string, config *framework.ServiceConfig, result *cluster.DeployResult) *Entry {
+	entry := &Entry{
+		Time:      time.Now().Add(-result.Duration).UTC(),
+		User:      currentUser(),
+		Command:   command,
+		ServiceID: serviceID,
+		Result:    result.Status.String(),
+		Duration:  result.Duration.Seconds(),
+		Stacks:    make(map[string]*StackEntry),
+	}
+	entry.Host, _ = os.Hostname()
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+	if config != nil {
+		masked := *config
+		masked.Envs = util.MaskEnv(config.Envs)
+		if masked.DockerCfg != "" {
+			masked.DockerCfg = "*****"
+		}
+		entry.Config = &masked
+	}
+
+	for stackKey, stackResult := range result.Stacks {
+		stack := &StackEntry{
+			Status:     stackResult.Status.String(),
+			Duration:   stackResult.Duration.Seconds(),
+			Attempts:   stackResult.Attempts,
+			RolledBack: stackResult.RolledBack,
+		}
+		if stackResult.Error != nil {
+			stack.Error = stackResult.Error.Error()
+		}
+		if service := stackResult.Service; service != nil {
+			stack.Image = service.FullImageName()
+			stack.Version = service.Version
+			stack.Instances = len(service.Instances)
+		}
+		entry.Stacks[stackKey] = stack
+	}
+	return entry
+}
+
+// RollbackCommand is the command of the entries of the rollbacks
+const RollbackCommand = "rollback"
+
+// NewRollbackEntry describes the rollback of the stacks restored by the operation that finished
+// with the result, or that failed to be restored. It is nil when no stack was restored and the
+// rollback was not requested. A requested rollback without stacks to restore is skipped, or
+// failed when the result has an error
+func NewRollbackEntry(serviceID string, result *cluster.DeployResult, requested bool) *Entry {
+	entry := &Entry{
+		Time:      time.Now().UTC(),
+		User:      currentUser(),
+		Command:   RollbackCommand,
+		ServiceID: serviceID,
+		Result:    cluster.STACK_READY.String(),
+		Stacks:    make(map[string]*StackEntry),
+	}
+	entry.Host, _ = os.Hostname()
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+
+	for stackKey, stackResult := range result.Stacks {
+		switch {
+		case stackResult.RolledBack:
+			entry.Stacks[stackKey] = &StackEntry{Status: cluster.STACK_READY.String(), RolledBack: true}
+		case stackResult.RollbackError != nil:
+			entry.Stacks[stackKey] = &StackEntry{Status: cluster.STACK_FAILED.String(), Error: stackResult.RollbackError.Error()}
+			entry.Result = cluster.STACK_FAILED.String()
+		}
+	}
+	if len(entry.Stacks) == 0 {
+		if !requested {
+			return nil
+		}
+		if result.Error != nil {
+			entry.Result = cluster.STACK_FAILED.String()
+		} else {
+			entry.Result = cluster.STACK_SKIPPED.String()
+			entry.Error = "No cluster was deployed, there was nothing to restore"
+		}
+	}
+	return entry
+}
+
+// DeployCommand is the command of the entries of the deploys
+const DeployCommand = "deploy"
+
+// PreviousVersions returns the outcome of the deploy that each stack ran before the last deploy
+// of the entries, read from the entries of a service in the order they were appended. Only the
+// deploys that succeeded on a stack and were not rolled back count. The stacks of the last deploy
+// without a previous deploy are missing, as the stacks the last deploy did not change
+func PreviousVersions(entries []*Entry) map[string]*StackEntry {
+	previous := make(map[string]*StackEntry)
+	last := -1
+	for i := len(entries) - 1; i >= 0 && last < 0; i-- {
+		for stackKey := range entries[i].Stacks {
+			if entries[i].deployed(stackKey) {
+				last = i
+				break
+			}
+		}
+	}
+	if last < 0 {
+		return previous
+	}
+
+	for stackKey := range entries[last].Stacks {
+		if !entries[last].deployed(stackKey) {
+			continue
+		}
+		for i := last - 1; i >= 0; i-- {
+			if entries[i].deployed(stackKey) {
+				previous[stackKey] = entries[i].Stacks[stackKey]
+				break
+			}
+		}
+	}
+	return previous
+}
+
+// deployed reports if the entry is a deploy that succeeded on the stack and was not rolled back
+func (e *Entry) deployed(stackKey string) bool {
+	stack, ok := e.Stacks[stackKey]
+	if !ok || e.Command != DeployCommand || stack.RolledBack {
+		return false
+	}
+	return stack.Status == cluster.STACK_READY.String() || stack.Status == cluster.STACK_DEGRADED.String()
+}
+
+// Filter selects the entries of a query, the empty values select every entry
+type Filter struct {
+	ServiceID string
+	Since     time.Time
+}
+
+func (f Filter) matches(entry *Entry) bool {
+	if f.ServiceID != "" && strings.TrimPrefix(entry.ServiceID, "/") != strings.TrimPrefix(f.ServiceID, "/") {
+		return false
+	}
+	return f.Since.IsZero() || !entry.Time.Before(f.Since)
+}
+
+// Store is the file of JSON lines with the entries
+type Store struct {
+	Path string
+}
+
+// Append adds the entry at the end of the store, creating the file and its dir when needed
+func (s *Store) Append(entry *Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	// The line is written at once, so the entries of concurrent runs are not mixed
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Query returns the entries selected by the filter in the order they were appended. A store that
+// does not exist has no entries
+func (s *Store) Query(filter Filter) ([]*Entry, error) {
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		entry := new(Entry)
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("Invalid entry at line %d of %s: %s", line, s.Path, err)
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
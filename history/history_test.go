@@ -0,0 +1,161 @@
+package history
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/latam-airlines/crane/cluster"
+	"github.com/latam-airlines/mesos-framework-factory"
+	"github.com/stretchr/testify/assert"
+)
+
+func deployResult() *cluster.DeployResult {
+	return &cluster.DeployResult{
+		Status:   cluster.STACK_FAILED,
+		Duration: 90 * time.Second,
+		Stacks: map[string]*cluster.StackResult{
+			"sjc": {
+				Status:   cluster.STACK_READY,
+				Duration: 30 * time.Second,
+				Attempts: 1,
+				Service: &framework.ServiceInformation{
+					ImageName: "latam/app",
+					ImageTag:  "1.0",
+					Version:   "v2",
+					Instances: []*framework.Instance{{ID: "a"}, {ID: "b"}},
+				},
+			},
+			"scl": {
+				Status:     cluster.STACK_FAILED,
+				Error:      errors.New("unhealthy"),
+				RolledBack: true,
+			},
+		},
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	defer func(original func() string) { currentUser = original }(currentUser)
+	currentUser = func() string { return "chuck" }
+	config := &framework.ServiceConfig{
+		ServiceID: "app",
+		ImageName: "latam/app",
+		Tag:       "1.0",
+		Envs:      []string{"DB_PASSWORD=norris", "PORT=8080"},
+		DockerCfg: "auth",
+	}
+
+	entry := NewEntry("deploy", "app", config, deployResult())
+	assert.Equal(t, "chuck", entry.User)
+	assert.Equal(t, "deploy", entry.Command)
+	assert.Equal(t, "STACK_FAILED", entry.Result)
+	assert.Equal(t, 90.0, entry.Duration)
+	assert.WithinDuration(t, time.Now().Add(-90*time.Second), entry.Time, 5*time.Second)
+	assert.Equal(t, []string{"DB_PASSWORD=*****", "PORT=8080"}, entry.Config.Envs)
+	assert.Equal(t, "*****", entry.Config.DockerCfg)
+	assert.Equal(t, "DB_PASSWORD=norris", config.Envs[0], "the config of the deploy is not modified")
+	assert.Equal(t, &StackEntry{Status: "STACK_READY", Image: "latam/app:1.0", Version: "v2", Instances: 2, Duration: 30, Attempts: 1}, entry.Stacks["sjc"])
+	assert.Equal(t, &StackEntry{Status: "STACK_FAILED", Error: "unhealthy", RolledBack: true}, entry.Stacks["scl"])
+	assert.True(t, entry.RolledBack())
+}
+
+func TestNewEntryWithoutConfig(t *testing.T) {
+	entry := NewEntry("scale", "app", nil, &cluster.DeployResult{Status: cluster.STACK_READY, Error: errors.New("timeout")})
+	assert.Nil(t, entry.Config)
+	assert.Equal(t, "timeout", entry.Error)
+	assert.False(t, entry.RolledBack())
+}
+
+func TestNewRollbackEntry(t *testing.T) {
+	result := deployResult()
+	result.Stacks["dal"] = &cluster.StackResult{Status: cluster.STACK_READY, Error: errors.New("Rollback fails: timeout"), RollbackError: errors.New("timeout")}
+	entry := NewRollbackEntry("app", result, false)
+	assert.Equal(t, RollbackCommand, entry.Command)
+	assert.Equal(t, "STACK_FAILED", entry.Result, "A stack could not be restored")
+	assert.Len(t, entry.Stacks, 2, "Only the restored stacks belong to the rollback")
+	assert.Equal(t, &StackEntry{Status: "STACK_READY", RolledBack: true}, entry.Stacks["scl"])
+	assert.Equal(t, &StackEntry{Status: "STACK_FAILED", Error: "timeout"}, entry.Stacks["dal"])
+
+	succeeded := &cluster.DeployResult{Status: cluster.STACK_READY, Stacks: map[string]*cluster.StackResult{"sjc": {Status: cluster.STACK_READY}}}
+	assert.Nil(t, NewRollbackEntry("app", succeeded, false), "Nothing was restored")
+	entry = NewRollbackEntry("app", succeeded, true)
+	assert.Equal(t, "STACK_SKIPPED", entry.Result, "The requested rollback is recorded")
+	assert.Empty(t, entry.Stacks)
+
+	failed := &cluster.DeployResult{Status: cluster.STACK_FAILED, Stacks: make(map[string]*cluster.StackResult), Error: errors.New("no history")}
+	entry = NewRollbackEntry("app", failed, true)
+	assert.Equal(t, "STACK_FAILED", entry.Result)
+	assert.Equal(t, "no history", entry.Error)
+}
+
+func TestPreviousVersions(t *testing.T) {
+	stack := func(status, version string, rolledBack bool) *StackEntry {
+		return &StackEntry{Status: status, Image: "latam/app:" + version, Version: version, RolledBack: rolledBack}
+	}
+	entries := []*Entry{
+		{Command: "deploy", Stacks: map[string]*StackEntry{"sjc": stack("STACK_READY", "1", false), "scl": stack("STACK_READY", "1", false)}},
+		{Command: "deploy", Stacks: map[string]*StackEntry{"sjc": stack("STACK_DEGRADED", "2", false), "scl": stack("STACK_FAILED", "2", false)}},
+		{Command: "deploy", Stacks: map[string]*StackEntry{"sjc": stack("STACK_READY", "3", true), "scl": stack("STACK_READY", "3", true)}},
+		{Command: "scale", Stacks: map[string]*StackEntry{"sjc": stack("STACK_READY", "2", false)}},
+		{Command: "deploy", Stacks: map[string]*StackEntry{"sjc": stack("STACK_READY", "4", false), "scl": stack("STACK_READY", "4", false), "dal": stack("STACK_READY", "4", false)}},
+		{Command: "deploy", Stacks: map[string]*StackEntry{"sjc": stack("STACK_FAILED", "5", true)}},
+	}
+	previous := PreviousVersions(entries)
+	assert.Len(t, previous, 2, "The first deploy on dal has no previous version")
+	assert.Equal(t, "2", previous["sjc"].Version, "The rolled back deploy does not count")
+	assert.Equal(t, "1", previous["scl"].Version, "The failed deploy does not count")
+
+	assert.Empty(t, PreviousVersions(entries[:1]))
+	assert.Empty(t, PreviousVersions(nil))
+}
+
+func TestStoreAppendAndQuery(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+	store := &Store{Path: filepath.Join(dir, "audit", "history.jsonl")}
+
+	entries, err := store.Query(Filter{})
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	now := time.Now().UTC()
+	assert.Nil(t, store.Append(&Entry{Time: now.Add(-48 * time.Hour), Command: "deploy", ServiceID: "app"}))
+	assert.Nil(t, store.Append(&Entry{Time: now.Add(-time.Hour), Command: "scale", ServiceID: "/app"}))
+	assert.Nil(t, store.Append(&Entry{Time: now, Command: "delete", ServiceID: "other"}))
+
+	info, err := os.Stat(store.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err = store.Query(Filter{})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "deploy", entries[0].Command)
+
+	entries, err = store.Query(Filter{ServiceID: "app"})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+
+	entries, err = store.Query(Filter{ServiceID: "/app", Since: now.Add(-24 * time.Hour)})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "scale", entries[0].Command)
+}
+
+func TestStoreQueryInvalidLine(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+	store := &Store{Path: filepath.Join(dir, "history.jsonl")}
+	assert.Nil(t, store.Append(&Entry{Command: "deploy"}))
+	f, _ := os.OpenFile(store.Path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString("{broken\n")
+	f.Close()
+
+	_, err := store.Query(Filter{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"github.com/latam-airlines/crane/cli"
+	_ "github.com/latam-airlines/crane/framework/fake"
+	_ "github.com/latam-airlines/crane/framework/kubernetes"
+	_ "github.com/latam-airlines/crane/framework/marathon"
+	_ "github.com/latam-airlines/crane/framework/nomad"
 	_ "github.com/latam-airlines/mesos-framework-factory/marathon"
+	_ "github.com/latam-airlines/mesos-framework-factory/swarm"
 )
 
 func main() {
@@ -4,11 +4,15 @@ import (
 	"strings"
 )
 
+// secretKeys are the words that mark the name of an env as a secret
+var secretKeys = []string{"pass", "pwd", "secret", "token", "credential"}
+
+// MaskEnv hides the values of the envs whose name looks like a secret
 func MaskEnv(unmaskedEnvs []string) []string {
 	var maskedEnvs []string
 	for _, val := range unmaskedEnvs {
-		kv := strings.Split(val, "=")
-		if strings.Contains(kv[0], "pass") {
+		kv := strings.SplitN(val, "=", 2)
+		if IsSecretKey(kv[0]) {
 			maskedEnvs = append(maskedEnvs, kv[0]+"="+"*****")
 		} else {
 			maskedEnvs = append(maskedEnvs, val)
@@ -18,6 +22,17 @@ func MaskEnv(unmaskedEnvs []string) []string {
 	return maskedEnvs
 }
 
+// IsSecretKey reports if the name of an env or a parameter looks like a secret
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
 var letters = []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
 func Letter(n int) string {